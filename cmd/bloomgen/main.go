@@ -0,0 +1,71 @@
+// Command bloomgen builds the breached-password bloom filter loaded through
+// PASSWORDBREACHEDFILTER from a newline-separated list of passwords.
+//
+//	go run ./cmd/bloomgen -in breached.txt -out breached.bloom
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/liju-github/user-management/internal/passwords"
+)
+
+func main() {
+	in := flag.String("in", "", "newline-separated password list")
+	out := flag.String("out", "breached.bloom", "filter file to write")
+	fpRate := flag.Float64("fp", 0.001, "target false positive rate")
+	flag.Parse()
+
+	if *in == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	count, err := forEachLine(*in, func(string) {})
+	if err != nil {
+		log.Fatalf("Failed to read %s: %v", *in, err)
+	}
+
+	filter := passwords.NewBloomFilter(count, *fpRate)
+	if _, err := forEachLine(*in, filter.Add); err != nil {
+		log.Fatalf("Failed to read %s: %v", *in, err)
+	}
+
+	file, err := os.Create(*out)
+	if err != nil {
+		log.Fatalf("Failed to create %s: %v", *out, err)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	if _, err := filter.WriteTo(writer); err != nil {
+		log.Fatalf("Failed to write filter: %v", err)
+	}
+	if err := writer.Flush(); err != nil {
+		log.Fatalf("Failed to write filter: %v", err)
+	}
+
+	fmt.Printf("Wrote %d passwords to %s\n", count, *out)
+}
+
+func forEachLine(path string, fn func(string)) (uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var count uint64
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			fn(line)
+			count++
+		}
+	}
+	return count, scanner.Err()
+}
@@ -0,0 +1,122 @@
+// Command importer bulk imports users from a CSV or NDJSON file using the
+// server's .env configuration. Interrupting it pauses the job, which can be
+// continued later with -resume.
+//
+//	go run ./cmd/importer -file users.csv -dry-run
+//	go run ./cmd/importer -file users.ndjson -mark-verified
+//	go run ./cmd/importer -resume <job id>
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/liju-github/user-management/internal/config"
+	"github.com/liju-github/user-management/internal/database"
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/passwords"
+	"github.com/liju-github/user-management/internal/repository"
+	"github.com/liju-github/user-management/internal/services"
+	"github.com/liju-github/user-management/internal/storage"
+)
+
+func main() {
+	path := flag.String("file", "", "CSV or NDJSON file of users to import")
+	format := flag.String("format", "", "csv or ndjson; guessed from the file name when empty")
+	dryRun := flag.Bool("dry-run", false, "validate the file and report without creating users")
+	markVerified := flag.Bool("mark-verified", false, "treat imported emails as verified")
+	resume := flag.String("resume", "", "ID of an import job to continue")
+	flag.Parse()
+
+	if (*path == "") == (*resume == "") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	envConfig := config.EnvConfig()
+	db := database.ConnectDatabase(envConfig)
+
+	store, err := storage.Open(envConfig.STORAGEDRIVER, envConfig.STORAGELOCALDIR, envConfig.MEDIAURL, storage.S3Config{
+		Endpoint:  envConfig.S3ENDPOINT,
+		Region:    envConfig.S3REGION,
+		Bucket:    envConfig.S3BUCKET,
+		AccessKey: envConfig.S3ACCESSKEY,
+		SecretKey: envConfig.S3SECRETKEY,
+		PublicURL: envConfig.S3PUBLICURL,
+	})
+	if err != nil {
+		log.Fatal("Failed to configure storage:", err)
+	}
+
+	passwordManager := passwords.NewManagerFromConfig(
+		envConfig.PASSWORDHASHER,
+		passwords.Argon2idParams{
+			Memory:      envConfig.ARGON2MEMORY,
+			Iterations:  envConfig.ARGON2ITERATIONS,
+			Parallelism: envConfig.ARGON2PARALLELISM,
+		},
+		envConfig.BCRYPTCOST,
+	)
+	importService := services.NewImportService(repository.NewImportRepository(db), store, passwordManager,
+		services.WithImportMaxSize(0),
+		services.WithImportChunkSize(envConfig.IMPORTCHUNKSIZE),
+	)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	jobID := *resume
+	if jobID == "" {
+		file, err := os.Open(*path)
+		if err != nil {
+			log.Fatalf("Failed to open %s: %v", *path, err)
+		}
+		info, err := file.Stat()
+		if err != nil {
+			log.Fatalf("Failed to read %s: %v", *path, err)
+		}
+
+		job, err := importService.CreateImport(ctx, file, info.Size(), services.ImportOptions{
+			Format:       *format,
+			Filename:     info.Name(),
+			DryRun:       *dryRun,
+			MarkVerified: *markVerified,
+		}, services.SystemActor)
+		file.Close()
+		if err != nil {
+			log.Fatal("Failed to create import:", err)
+		}
+		jobID = job.ID
+		fmt.Printf("Created import %s\n", jobID)
+	}
+
+	job, err := importService.RunImport(ctx, jobID)
+	if job != nil {
+		report(job)
+	}
+	if err != nil {
+		if job != nil && job.Status == models.ImportPaused {
+			log.Fatalf("Import paused; continue it with -resume %s", job.ID)
+		}
+		log.Fatal("Import failed:", err)
+	}
+}
+
+func report(job *models.ImportJob) {
+	mode := ""
+	if job.DryRun {
+		mode = " (dry run)"
+	}
+	fmt.Printf("Import %s %s%s: %d rows processed, %d imported, %d skipped, %d invalid\n",
+		job.ID, job.Status, mode, job.Processed, job.Imported, job.Skipped, job.Invalid)
+	for _, issue := range job.Issues {
+		fmt.Printf("  line %d %s: %v\n", issue.Line, issue.Email, issue.Errors)
+	}
+	if shown := len(job.Issues); job.Skipped+job.Invalid > shown {
+		fmt.Printf("  ... %d more\n", job.Skipped+job.Invalid-shown)
+	}
+}
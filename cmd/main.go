@@ -1,24 +1,52 @@
 package main
 
 import (
+	"context"
+	"expvar"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/liju-github/user-management/internal/config"
 	"github.com/liju-github/user-management/internal/controllers"
 	"github.com/liju-github/user-management/internal/database"
+	"github.com/liju-github/user-management/internal/events"
+	"github.com/liju-github/user-management/internal/jobs"
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/oidc"
+	"github.com/liju-github/user-management/internal/passwords"
 	"github.com/liju-github/user-management/internal/repository"
 	"github.com/liju-github/user-management/internal/services"
+	"github.com/liju-github/user-management/internal/storage"
 	"github.com/liju-github/user-management/internal/utils"
 )
 
 func main() {
-	// Initialize the Fiber app
-	app := fiber.New()
+	envConfig := config.EnvConfig()
+
+	// Initialize the Fiber app; every handler error is rendered as problem+json.
+	// Request bodies are streamed so utils.BodyLimit can hold most routes to
+	// the upload size and let only the user import take a bigger file; the
+	// limits leave room for multipart overhead around the file.
+	uploadLimit := envConfig.MAXUPLOADSIZE + 1<<20
+	importLimit := envConfig.IMPORTMAXSIZE + 1<<20
+	app := fiber.New(fiber.Config{
+		ErrorHandler:                 controllers.ErrorHandler,
+		BodyLimit:                    int(max(uploadLimit, importLimit)),
+		StreamRequestBody:            true,
+		DisablePreParseMultipartForm: true,
+	})
+	app.Use(recover.New())
+	app.Use(utils.BodyLimit(uploadLimit, map[string]int64{
+		fiber.MethodPost + " /api/admin/imports": importLimit,
+	}))
 	app.Use(cors.New())
 	app.Get("/", func(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusCreated).JSON(fiber.Map{"message": "server is running"})
@@ -32,8 +60,6 @@ func main() {
 		TimeZone:   "Local",
 	}))
 
-	envConfig := config.EnvConfig()
-
 	db := database.ConnectDatabase(envConfig)
 	if db == nil {
 		log.Fatal("Failed to connect to the database")
@@ -43,48 +69,344 @@ func main() {
 	// Initialize repositories
 	userRepo := repository.NewUserRepository(db)
 	adminRepo := repository.NewAdminRepository(db)
+	auditRepo := repository.NewAuditRepository(db)
+	exportRepo := repository.NewExportRepository(db)
+	bulkJobRepo := repository.NewBulkJobRepository(db)
+	importRepo := repository.NewImportRepository(db)
+	statsRepo := repository.NewStatsRepository(db)
+	noteRepo := repository.NewNoteRepository(db)
+	webhookRepo := repository.NewWebhookRepository(db)
+	outboxRepo := repository.NewOutboxRepository(db)
+	organizationRepo := repository.NewOrganizationRepository(db)
+	groupRepo := repository.NewGroupRepository(db)
+	invitationRepo := repository.NewInvitationRepository(db)
+	identityRepo := repository.NewIdentityRepository(db)
 
 	// Initialize services
-	userService := services.NewUserService(userRepo)
-	adminService := services.NewAdminService(adminRepo, userRepo)
+	passwordPolicy := &passwords.Policy{
+		MinLength:          envConfig.PASSWORDMINLENGTH,
+		MaxLength:          envConfig.PASSWORDMAXLENGTH,
+		RequiredClasses:    envConfig.PASSWORDREQUIREDCLASSES,
+		RejectPersonalInfo: envConfig.PASSWORDREJECTPERSONALINFO,
+		HistorySize:        envConfig.PASSWORDHISTORYSIZE,
+	}
+	if envConfig.PASSWORDBREACHEDFILTER != "" {
+		breached, err := passwords.LoadBloomFilter(envConfig.PASSWORDBREACHEDFILTER)
+		if err != nil {
+			log.Fatal("Failed to load breached password filter:", err)
+		}
+		passwordPolicy.Breached = breached
+	}
+
+	store, err := storage.Open(envConfig.STORAGEDRIVER, envConfig.STORAGELOCALDIR, envConfig.MEDIAURL, storage.S3Config{
+		Endpoint:  envConfig.S3ENDPOINT,
+		Region:    envConfig.S3REGION,
+		Bucket:    envConfig.S3BUCKET,
+		AccessKey: envConfig.S3ACCESSKEY,
+		SecretKey: envConfig.S3SECRETKEY,
+		PublicURL: envConfig.S3PUBLICURL,
+	})
+	if err != nil {
+		log.Fatal("Failed to configure storage:", err)
+	}
+	if localStore, ok := store.(*storage.LocalStorage); ok {
+		app.Static("/media", localStore.Root())
+	}
+	privateStore, err := storage.OpenPrivate(envConfig.STORAGEDRIVER, envConfig.STORAGEPRIVATEDIR, storage.S3Config{
+		Endpoint:  envConfig.S3ENDPOINT,
+		Region:    envConfig.S3REGION,
+		Bucket:    envConfig.S3PRIVATEBUCKET,
+		AccessKey: envConfig.S3ACCESSKEY,
+		SecretKey: envConfig.S3SECRETKEY,
+	})
+	if err != nil {
+		log.Fatal("Failed to configure private storage:", err)
+	}
+	if envConfig.STORAGEDRIVER != "s3" && insideDir(envConfig.STORAGEPRIVATEDIR, envConfig.STORAGELOCALDIR) {
+		log.Fatal("STORAGEPRIVATEDIR must not be inside STORAGELOCALDIR, which is served publicly")
+	}
+
+	argon2Params := passwords.Argon2idParams{
+		Memory:      envConfig.ARGON2MEMORY,
+		Iterations:  envConfig.ARGON2ITERATIONS,
+		Parallelism: envConfig.ARGON2PARALLELISM,
+	}
+	if err := passwords.NewArgon2idHasher(argon2Params).Params().Validate(); err != nil {
+		log.Fatal("Invalid argon2id settings: ", err)
+	}
+	if envConfig.BCRYPTCOST > passwords.MaxBcryptCost {
+		log.Fatalf("BCRYPTCOST must be at most %d", passwords.MaxBcryptCost)
+	}
+	passwordManager := passwords.NewManagerFromConfig(envConfig.PASSWORDHASHER, argon2Params, envConfig.BCRYPTCOST)
+	mailer := services.NewMailer(envConfig)
+	auditService := services.NewAuditService(auditRepo)
+	webhookService := services.NewWebhookService(webhookRepo,
+		services.WithWebhookTimeout(envConfig.WEBHOOKTIMEOUT),
+		services.WithWebhookRetries(envConfig.WEBHOOKMAXATTEMPTS, envConfig.WEBHOOKRETRYBACKOFF),
+	)
+
+	// Domain events and the side effects that subscribe to them
+	eventBus := events.NewBus()
+	if envConfig.EVENTOUTBOX {
+		eventBus.UseOutbox()
+	}
+	eventCounts := expvar.NewMap("events")
+	services.SubscribeEmails(eventBus, mailer, envConfig.APPBASEURL)
+	services.SubscribeAudit(eventBus, auditService)
+	services.SubscribeWebhooks(eventBus, webhookService)
+	services.SubscribeMetrics(eventBus, eventCounts)
+
+	switch envConfig.SIGNUPMODE {
+	case models.SignupOpen, models.SignupInvite, models.SignupClosed:
+	default:
+		log.Fatalf("Invalid SIGNUPMODE %q: use open, invite or closed", envConfig.SIGNUPMODE)
+	}
+	if envConfig.INVITATIONSECRET == "" {
+		log.Fatal("INVITATIONSECRET must be set to sign invitation links")
+	}
+	invitationService := services.NewInvitationService(invitationRepo, groupRepo, userRepo, organizationRepo,
+		services.WithInvitationSecret(envConfig.INVITATIONSECRET),
+		services.WithInvitationTTL(envConfig.INVITATIONTTL),
+		services.WithSignupMode(envConfig.SIGNUPMODE),
+		services.WithGroupOwnerInvites(envConfig.INVITEBYGROUPOWNERS),
+		services.WithInvitationEvents(eventBus),
+	)
+
+	exportService := services.NewExportService(exportRepo, userRepo, privateStore,
+		services.WithExportMailer(mailer),
+		services.WithExportBaseURL(envConfig.APPBASEURL),
+		services.WithExportLinkTTL(envConfig.DATAEXPORTLINKTTL),
+		services.WithExportAudit(auditService),
+	)
+	userService := services.NewUserService(userRepo,
+		services.WithBaseURL(envConfig.APPBASEURL),
+		services.WithAntiEnumeration(envConfig.ANTIENUMERATION),
+		services.WithPasswordManager(passwordManager),
+		services.WithPasswordPolicy(passwordPolicy),
+		services.WithStorage(store),
+		services.WithMaxImageSize(envConfig.MAXUPLOADSIZE),
+		services.WithDeletionGracePeriod(envConfig.ACCOUNTDELETIONGRACE),
+		services.WithAuditLog(auditService),
+		services.WithDeletedEmailReuse(envConfig.ALLOWDELETEDEMAILREUSE),
+		services.WithEvents(eventBus),
+		services.WithInvitations(invitationService),
+		services.WithExports(exportService),
+	)
+	adminService := services.NewAdminService(adminRepo, userRepo,
+		services.WithAdminStorage(store),
+		services.WithAdminExports(exportService),
+		services.WithAdminAudit(auditService),
+		services.WithAdminUserService(userService),
+		services.WithAdminBulkJobs(bulkJobRepo, envConfig.BULKMAXUSERS),
+		services.WithImpersonationTTL(envConfig.IMPERSONATIONTTL),
+		services.WithAdminTags(noteRepo),
+		services.WithAdminEvents(eventBus),
+	)
+	importService := services.NewImportService(importRepo, privateStore, passwordManager,
+		services.WithImportMaxSize(envConfig.IMPORTMAXSIZE),
+		services.WithImportChunkSize(envConfig.IMPORTCHUNKSIZE),
+	)
+	statsService := services.NewStatsService(statsRepo,
+		services.WithStatsCacheTTL(envConfig.STATSCACHETTL),
+	)
+	noteService := services.NewNoteService(noteRepo, userRepo)
 	authService := services.NewAuthService(adminRepo, userRepo)
+	organizationService := services.NewOrganizationService(organizationRepo)
+	groupService := services.NewGroupService(groupRepo, userRepo,
+		services.WithGroupEvents(eventBus),
+	)
+	oidcProviders := make([]*oidc.Provider, len(envConfig.OIDCPROVIDERS))
+	for i, provider := range envConfig.OIDCPROVIDERS {
+		if provider.Issuer == "" || provider.ClientID == "" {
+			log.Fatalf("OIDC provider %q needs an issuer and a client ID", provider.Name)
+		}
+		oidcProviders[i] = oidc.NewProvider(oidc.Config{
+			Name:         provider.Name,
+			Issuer:       provider.Issuer,
+			ClientID:     provider.ClientID,
+			ClientSecret: provider.ClientSecret,
+			Scopes:       provider.Scopes,
+			RedirectURL:  envConfig.APPBASEURL + "/api/auth/oidc/" + provider.Name + "/callback",
+		})
+	}
+	socialLoginService := services.NewSocialLoginService(oidcProviders, identityRepo, userService,
+		services.WithSocialLoginTTL(envConfig.OIDCLOGINTTL),
+	)
+	exportService.RegisterSection(services.ExportSection{Name: "groups", Collect: func(userID string) (interface{}, error) {
+		return groupService.GroupsForUser(userID)
+	}})
+	exportService.RegisterSection(services.ExportSection{Name: "identities", Collect: func(userID string) (interface{}, error) {
+		return socialLoginService.IdentitiesForUser(userID)
+	}})
+	exportService.RegisterSection(services.ExportSection{Name: "invitations", Collect: func(userID string) (interface{}, error) {
+		return invitationService.InvitationsForUser(userID)
+	}})
 
 	// Initialize controllers
-	userController := controllers.NewUserController(userService)
+	userController := controllers.NewUserController(userService, groupService)
 	adminController := controllers.NewAdminController(adminService)
-	authController := controllers.NewAuthController(authService)
+	authController := controllers.NewAuthController(authService, groupService)
+	exportController := controllers.NewExportController(exportService)
+	importController := controllers.NewImportController(importService)
+	statsController := controllers.NewStatsController(statsService)
+	noteController := controllers.NewNoteController(noteService)
+	webhookController := controllers.NewWebhookController(webhookService)
+	metricsController := controllers.NewMetricsController(eventCounts)
+	organizationController := controllers.NewOrganizationController(organizationService)
+	groupController := controllers.NewGroupController(groupService)
+	invitationController := controllers.NewInvitationController(invitationService)
+	socialLoginController := controllers.NewSocialLoginController(socialLoginService, userService, groupService, envConfig.OIDCLOGINTTL)
 
 	fmt.Println(userController, adminController, authController)
 
+	// Every API request is for one organization, named by header or subdomain
+	app.Use(utils.TenantMiddleware(organizationService, envConfig.TENANTBASEDOMAIN))
+
 	// Auth group
 	authGroup := app.Group("/api/auth")
 	authGroup.Post("/signup", userController.Signup)
+	authGroup.Get("/invitations/:token", invitationController.PreviewInvitation)
+	authGroup.Get("/oidc", socialLoginController.ListProviders)
+	authGroup.Get("/oidc/:provider", socialLoginController.Begin)
+	authGroup.Get("/oidc/:provider/callback", socialLoginController.Callback)
 	authGroup.Post("/login", userController.Login)
 	authGroup.Post("/admin/login", adminController.Login)
 	authGroup.Get("/verify-email/:token", userController.VerifyEmail)
 	authGroup.Post("/resend-verification", userController.ResendVerification)
 	authGroup.Post("/reset-password", userController.RequestPasswordReset)
 	authGroup.Post("/confirm-reset-password", userController.ConfirmPasswordReset)
-	authGroup.Get("/refresh", utils.JWTMiddleware("", userRepo), authController.GetRefreshToken)
+	authGroup.Get("/refresh", utils.JWTMiddleware("", userRepo), utils.DenyImpersonation(), authController.GetRefreshToken)
+
+	// Generated default avatars for users without an uploaded picture
+	app.Get("/api/avatars/:size/:initials", userController.DefaultAvatar)
+
+	// Personal data export downloads, authorised by the emailed token
+	app.Get("/api/exports/:token", exportController.Download)
 
 	// User group
 	userGroup := app.Group("/api/user")
 	userGroup.Use(utils.JWTMiddleware("user", userRepo))
+	userGroup.Use(utils.RecordImpersonation(auditService))
 	userGroup.Get("/profile", userController.GetProfile)
 	userGroup.Put("/update", userController.UpdateProfile)
+	userGroup.Put("/change-password", utils.DenyImpersonation(), userController.ChangePassword)
 	userGroup.Post("/upload-profile-picture", userController.UploadProfilePicture)
+	userGroup.Delete("/account", utils.DenyImpersonation(), userController.DeleteAccount)
+	userGroup.Get("/security-history", userController.GetSecurityHistory)
+	userGroup.Get("/groups", userController.GetGroups)
+	userGroup.Post("/groups/:id/invitations", invitationController.InviteToGroup)
+	userGroup.Post("/export", exportController.RequestExport)
 
 	// Admin group
 	adminGroup := app.Group("/api/admin")
 	adminGroup.Use(utils.JWTMiddleware("admin", userRepo))
+	adminGroup.Use(utils.ScopeAdmin(adminRepo))
+	superAdmin := utils.RequireSuperAdmin(adminRepo)
+	adminGroup.Get("/organizations", superAdmin, organizationController.ListOrganizations)
+	adminGroup.Post("/organizations", superAdmin, organizationController.CreateOrganization)
+	adminGroup.Get("/organizations/:id", superAdmin, organizationController.GetOrganization)
+	adminGroup.Patch("/organizations/:id", superAdmin, organizationController.UpdateOrganization)
+	adminGroup.Get("/stats", superAdmin, statsController.GetStats)
+	adminGroup.Get("/metrics/events", superAdmin, metricsController.GetEventCounts)
 	adminGroup.Get("/users", adminController.GetAllUsers)
+	adminGroup.Get("/users/export", adminController.ExportUsers)
+	adminGroup.Get("/users/deleted", adminController.GetDeletedUsers)
+	adminGroup.Post("/users/bulk", adminController.BulkAction)
+	adminGroup.Get("/bulk-jobs/:id", adminController.GetBulkJob)
+	adminGroup.Put("/users/:id/restore", adminController.RestoreUser)
+	adminGroup.Delete("/users/:id/purge", adminController.PurgeUser)
 	adminGroup.Delete("/users/", adminController.DeleteUser)
 	adminGroup.Put("/users/block/", adminController.BlockUser)
 	adminGroup.Put("/users/unblock/", adminController.UnblockUser)
+	adminGroup.Get("/users/:id/blocks", adminController.GetBlockHistory)
+	adminGroup.Get("/users/:id", adminController.GetUser)
+	adminGroup.Patch("/users/:id", adminController.UpdateUser)
+	adminGroup.Post("/users/:id/impersonate", adminController.Impersonate)
+	adminGroup.Get("/users/:id/notes", noteController.ListNotes)
+	adminGroup.Post("/users/:id/notes", noteController.AddNote)
+	adminGroup.Put("/users/:id/notes/:noteId", noteController.EditNote)
+	adminGroup.Get("/users/:id/notes/:noteId/revisions", noteController.NoteRevisions)
+	adminGroup.Get("/users/:id/tags", noteController.GetTags)
+	adminGroup.Post("/users/:id/tags", noteController.AddTags)
+	adminGroup.Delete("/users/:id/tags/:tag", noteController.RemoveTag)
+	adminGroup.Get("/tags", superAdmin, noteController.ListTags)
+	adminGroup.Get("/users/:id/groups", groupController.GetUserGroups)
+	adminGroup.Get("/groups", groupController.ListGroups)
+	adminGroup.Post("/groups", groupController.CreateGroup)
+	adminGroup.Get("/groups/:id", groupController.GetGroup)
+	adminGroup.Patch("/groups/:id", groupController.UpdateGroup)
+	adminGroup.Delete("/groups/:id", groupController.DeleteGroup)
+	adminGroup.Put("/groups/:id/members/:userId", groupController.SetMember)
+	adminGroup.Delete("/groups/:id/members/:userId", groupController.RemoveMember)
+	adminGroup.Get("/invitations", invitationController.ListInvitations)
+	adminGroup.Post("/invitations", invitationController.CreateInvitation)
+	adminGroup.Post("/invitations/:id/resend", invitationController.ResendInvitation)
+	adminGroup.Delete("/invitations/:id", invitationController.RevokeInvitation)
+	manageCredentials := utils.RequirePermission(models.PermissionManageCredentials, adminRepo)
+	adminGroup.Post("/users/:id/send-password-reset", manageCredentials, adminController.SendPasswordReset)
+	adminGroup.Post("/users/:id/require-password-change", manageCredentials, adminController.RequirePasswordChange)
+	adminGroup.Post("/users/:id/revoke-sessions", manageCredentials, adminController.RevokeSessions)
+	verifyUsers := utils.RequirePermission(models.PermissionVerifyUsers, adminRepo)
+	adminGroup.Put("/users/:id/verify", verifyUsers, adminController.VerifyUser)
+	adminGroup.Put("/users/:id/unverify", verifyUsers, adminController.UnverifyUser)
+	adminGroup.Post("/users/:id/export", exportController.AdminRequestExport)
+	adminGroup.Get("/exports/:id/download", exportController.AdminDownload)
+	adminGroup.Post("/imports", superAdmin, importController.CreateImport)
+	adminGroup.Get("/imports/:id", superAdmin, importController.GetImport)
+	adminGroup.Post("/imports/:id/resume", superAdmin, importController.ResumeImport)
+	manageWebhooks := utils.RequirePermission(models.PermissionManageWebhooks, adminRepo)
+	adminGroup.Get("/webhooks", superAdmin, manageWebhooks, webhookController.ListEndpoints)
+	adminGroup.Post("/webhooks", superAdmin, manageWebhooks, webhookController.CreateEndpoint)
+	adminGroup.Get("/webhooks/:id", superAdmin, manageWebhooks, webhookController.GetEndpoint)
+	adminGroup.Patch("/webhooks/:id", superAdmin, manageWebhooks, webhookController.UpdateEndpoint)
+	adminGroup.Delete("/webhooks/:id", superAdmin, manageWebhooks, webhookController.DeleteEndpoint)
+	adminGroup.Post("/webhooks/:id/rotate-secret", superAdmin, manageWebhooks, webhookController.RotateSecret)
+	adminGroup.Get("/webhooks/:id/deliveries", superAdmin, manageWebhooks, webhookController.ListDeliveries)
+	adminGroup.Post("/webhook-deliveries/:id/replay", superAdmin, manageWebhooks, webhookController.ReplayDelivery)
+
+	// Background jobs
+	go jobs.Every(context.Background(), "purge-deleted-accounts", envConfig.ACCOUNTPURGEINTERVAL, func(ctx context.Context) error {
+		purged, err := userService.PurgeDueAccounts(ctx)
+		if purged > 0 {
+			log.Printf("Purged %d deleted accounts", purged)
+		}
+		return err
+	})
+	go jobs.Every(context.Background(), "delete-expired-exports", time.Hour, func(ctx context.Context) error {
+		_, err := exportService.DeleteExpiredExports(ctx)
+		return err
+	})
+	go jobs.Every(context.Background(), "fail-stale-bulk-jobs", 5*time.Minute, func(ctx context.Context) error {
+		failed, err := adminService.FailStaleBulkJobs(ctx)
+		if failed > 0 {
+			log.Printf("Failed %d stale bulk jobs", failed)
+		}
+		return err
+	})
+	go jobs.Every(context.Background(), "delete-expired-social-logins", time.Hour, func(ctx context.Context) error {
+		_, err := socialLoginService.DeleteExpiredLogins(ctx)
+		return err
+	})
+
+	go webhookService.Run(context.Background())
+	if envConfig.EVENTOUTBOX {
+		go eventBus.Relay(context.Background(), outboxRepo, envConfig.EVENTRELAYINTERVAL)
+	}
 
 	// Start the Fiber server
-	err := app.Listen(":8080")
+	err = app.Listen(":8080")
 	if err != nil {
 		log.Fatal("Failed to start server:", err)
 	}
 }
+
+// insideDir reports whether dir is parent or lies under it.
+func insideDir(dir, parent string) bool {
+	dir, errDir := filepath.Abs(dir)
+	parent, errParent := filepath.Abs(parent)
+	if errDir != nil || errParent != nil {
+		return false
+	}
+	rel, err := filepath.Rel(parent, dir)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -2,6 +2,8 @@ package config
 
 import (
 	"log"
+	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -12,6 +14,140 @@ type Env struct {
 	DBHOST     string
 	DBPORT     string
 	DBNAME     string
+
+	SMTPHOST     string
+	SMTPPORT     string
+	SMTPUSER     string
+	SMTPPASSWORD string
+	MAILFROM     string
+	APPBASEURL   string
+
+	// ANTIENUMERATION makes the public auth endpoints answer identically for
+	// known and unknown email addresses.
+	ANTIENUMERATION bool
+
+	// PASSWORDHASHER picks the algorithm for new hashes: "argon2id" or
+	// "bcrypt". Hashes from either algorithm keep verifying and are upgraded
+	// on the next successful login.
+	PASSWORDHASHER    string
+	ARGON2MEMORY      uint32
+	ARGON2ITERATIONS  uint32
+	ARGON2PARALLELISM uint8
+	BCRYPTCOST        int
+
+	// Password policy applied on signup, reset and change-password.
+	// PASSWORDREQUIREDCLASSES is a comma-separated subset of
+	// upper,lower,digit,special and PASSWORDBREACHEDFILTER is the path of a
+	// bloom filter built with cmd/bloomgen.
+	PASSWORDMINLENGTH          int
+	PASSWORDMAXLENGTH          int
+	PASSWORDREQUIREDCLASSES    []string
+	PASSWORDREJECTPERSONALINFO bool
+	PASSWORDHISTORYSIZE        int
+	PASSWORDBREACHEDFILTER     string
+
+	// STORAGEDRIVER selects where uploads are kept: "local" writes under
+	// STORAGELOCALDIR and serves it at /media, "s3" uses the S3* settings
+	// against any S3-compatible endpoint. MAXUPLOADSIZE is in bytes.
+	STORAGEDRIVER   string
+	STORAGELOCALDIR string
+	MEDIAURL        string
+	S3ENDPOINT      string
+	S3REGION        string
+	S3BUCKET        string
+	S3ACCESSKEY     string
+	S3SECRETKEY     string
+	S3PUBLICURL     string
+	MAXUPLOADSIZE   int64
+
+	// Personal data exports and user import files are kept in a private
+	// store that is never served: STORAGEPRIVATEDIR with the local driver,
+	// which must not be inside STORAGELOCALDIR, or S3PRIVATEBUCKET, a bucket
+	// without public access, with the s3 driver.
+	STORAGEPRIVATEDIR string
+	S3PRIVATEBUCKET   string
+
+	// ACCOUNTDELETIONGRACE is how long a self-service deletion can still be
+	// cancelled by signing in; ACCOUNTPURGEINTERVAL is how often accounts
+	// past that period are purged. Both are Go durations such as "720h".
+	ACCOUNTDELETIONGRACE time.Duration
+	ACCOUNTPURGEINTERVAL time.Duration
+
+	// DATAEXPORTLINKTTL is how long a personal data export can be
+	// downloaded before the archive is deleted.
+	DATAEXPORTLINKTTL time.Duration
+
+	// ALLOWDELETEDEMAILREUSE lets someone sign up again with the email of a
+	// soft-deleted account.
+	ALLOWDELETEDEMAILREUSE bool
+
+	// BULKMAXUSERS caps how many users one admin bulk action may affect.
+	BULKMAXUSERS int
+
+	// IMPORTMAXSIZE is the largest user import file accepted, in bytes, and
+	// IMPORTCHUNKSIZE how many imported users are inserted per transaction.
+	IMPORTMAXSIZE   int64
+	IMPORTCHUNKSIZE int
+
+	// IMPERSONATIONTTL is how long a token an admin gets to act as a user
+	// stays valid.
+	IMPERSONATIONTTL time.Duration
+
+	// STATSCACHETTL is how long admin dashboard stats are reused before
+	// being recomputed.
+	STATSCACHETTL time.Duration
+
+	// WEBHOOKTIMEOUT is how long a webhook endpoint has to respond.
+	// Failed deliveries are retried up to WEBHOOKMAXATTEMPTS attempts in
+	// all, waiting WEBHOOKRETRYBACKOFF before the first retry and twice as
+	// long before each one after.
+	WEBHOOKTIMEOUT      time.Duration
+	WEBHOOKMAXATTEMPTS  int
+	WEBHOOKRETRYBACKOFF time.Duration
+
+	// EVENTOUTBOX stores domain events in the database with the change they
+	// describe and dispatches them after it commits, polling for new ones
+	// every EVENTRELAYINTERVAL. Without it events are dispatched in-process
+	// as they happen.
+	EVENTOUTBOX        bool
+	EVENTRELAYINTERVAL time.Duration
+
+	// TENANTBASEDOMAIN lets requests name their organization by subdomain,
+	// as in acme.TENANTBASEDOMAIN. Requests can always name it with the
+	// X-Organization header instead.
+	TENANTBASEDOMAIN string
+
+	// SIGNUPMODE is who can sign up to organizations that do not choose for
+	// themselves: "open" to anyone, "invite" to invited people only, or
+	// "closed" to no one.
+	SIGNUPMODE string
+
+	// INVITATIONSECRET signs invitation links, which are valid for
+	// INVITATIONTTL. It is required.
+	INVITATIONSECRET string
+	INVITATIONTTL    time.Duration
+
+	// INVITEBYGROUPOWNERS lets group owners invite people into their groups.
+	INVITEBYGROUPOWNERS bool
+
+	// OIDCPROVIDERS names the OpenID Connect providers users can sign in
+	// with, such as "google,corp". Each is configured with
+	// OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENTID, OIDC_<NAME>_CLIENTSECRET and
+	// OIDC_<NAME>_SCOPES, which defaults to "email,profile". Providers must
+	// support discovery; OAuth-only ones such as GitHub need an OpenID
+	// Connect bridge in front of them. OIDCLOGINTTL is how long a user has to
+	// finish signing in at the provider.
+	OIDCPROVIDERS []OIDCProvider
+	OIDCLOGINTTL  time.Duration
+}
+
+// OIDCProvider is an OpenID Connect provider users can sign in with.
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
 }
 
 func EnvConfig() Env {
@@ -25,6 +161,43 @@ func EnvConfig() Env {
 
 	viper.AutomaticEnv()
 
+	viper.SetDefault("SMTPPORT", "587")
+	viper.SetDefault("APPBASEURL", "http://localhost:8080")
+	viper.SetDefault("PASSWORDHASHER", "argon2id")
+	viper.SetDefault("ARGON2MEMORY", 64*1024)
+	viper.SetDefault("ARGON2ITERATIONS", 3)
+	viper.SetDefault("ARGON2PARALLELISM", 2)
+	viper.SetDefault("BCRYPTCOST", 10)
+	viper.SetDefault("PASSWORDMINLENGTH", 8)
+	viper.SetDefault("PASSWORDMAXLENGTH", 72)
+	viper.SetDefault("PASSWORDREQUIREDCLASSES", "upper,lower,digit,special")
+	viper.SetDefault("PASSWORDREJECTPERSONALINFO", true)
+	viper.SetDefault("PASSWORDHISTORYSIZE", 5)
+	viper.SetDefault("STORAGEDRIVER", "local")
+	viper.SetDefault("STORAGELOCALDIR", "./media")
+	viper.SetDefault("MEDIAURL", "/media")
+	viper.SetDefault("STORAGEPRIVATEDIR", "./private")
+	viper.SetDefault("S3REGION", "us-east-1")
+	viper.SetDefault("MAXUPLOADSIZE", 5<<20)
+	viper.SetDefault("ACCOUNTDELETIONGRACE", "720h")
+	viper.SetDefault("ACCOUNTPURGEINTERVAL", "1h")
+	viper.SetDefault("DATAEXPORTLINKTTL", "48h")
+	viper.SetDefault("ALLOWDELETEDEMAILREUSE", true)
+	viper.SetDefault("BULKMAXUSERS", 500)
+	viper.SetDefault("IMPORTMAXSIZE", 100<<20)
+	viper.SetDefault("IMPORTCHUNKSIZE", 1000)
+	viper.SetDefault("IMPERSONATIONTTL", "15m")
+	viper.SetDefault("STATSCACHETTL", "1m")
+	viper.SetDefault("WEBHOOKTIMEOUT", "10s")
+	viper.SetDefault("WEBHOOKMAXATTEMPTS", 8)
+	viper.SetDefault("WEBHOOKRETRYBACKOFF", "30s")
+	viper.SetDefault("EVENTOUTBOX", false)
+	viper.SetDefault("EVENTRELAYINTERVAL", "5s")
+	viper.SetDefault("SIGNUPMODE", "open")
+	viper.SetDefault("INVITATIONTTL", "168h")
+	viper.SetDefault("INVITEBYGROUPOWNERS", false)
+	viper.SetDefault("OIDCLOGINTTL", "10m")
+
 	var env Env
 
 	env.DBUSER = viper.GetString("DBUSER")
@@ -33,5 +206,83 @@ func EnvConfig() Env {
 	env.DBPORT = viper.GetString("DBPORT")
 	env.DBNAME = viper.GetString("DBNAME")
 
+	env.SMTPHOST = viper.GetString("SMTPHOST")
+	env.SMTPPORT = viper.GetString("SMTPPORT")
+	env.SMTPUSER = viper.GetString("SMTPUSER")
+	env.SMTPPASSWORD = viper.GetString("SMTPPASSWORD")
+	env.MAILFROM = viper.GetString("MAILFROM")
+	env.APPBASEURL = viper.GetString("APPBASEURL")
+
+	env.ANTIENUMERATION = viper.GetBool("ANTIENUMERATION")
+
+	env.PASSWORDHASHER = viper.GetString("PASSWORDHASHER")
+	env.ARGON2MEMORY = viper.GetUint32("ARGON2MEMORY")
+	env.ARGON2ITERATIONS = viper.GetUint32("ARGON2ITERATIONS")
+	env.ARGON2PARALLELISM = uint8(viper.GetUint("ARGON2PARALLELISM"))
+	env.BCRYPTCOST = viper.GetInt("BCRYPTCOST")
+
+	env.PASSWORDMINLENGTH = viper.GetInt("PASSWORDMINLENGTH")
+	env.PASSWORDMAXLENGTH = viper.GetInt("PASSWORDMAXLENGTH")
+	env.PASSWORDREQUIREDCLASSES = splitList(viper.GetString("PASSWORDREQUIREDCLASSES"))
+	env.PASSWORDREJECTPERSONALINFO = viper.GetBool("PASSWORDREJECTPERSONALINFO")
+	env.PASSWORDHISTORYSIZE = viper.GetInt("PASSWORDHISTORYSIZE")
+	env.PASSWORDBREACHEDFILTER = viper.GetString("PASSWORDBREACHEDFILTER")
+
+	env.STORAGEDRIVER = viper.GetString("STORAGEDRIVER")
+	env.STORAGELOCALDIR = viper.GetString("STORAGELOCALDIR")
+	env.MEDIAURL = viper.GetString("MEDIAURL")
+	env.S3ENDPOINT = viper.GetString("S3ENDPOINT")
+	env.S3REGION = viper.GetString("S3REGION")
+	env.S3BUCKET = viper.GetString("S3BUCKET")
+	env.S3ACCESSKEY = viper.GetString("S3ACCESSKEY")
+	env.S3SECRETKEY = viper.GetString("S3SECRETKEY")
+	env.S3PUBLICURL = viper.GetString("S3PUBLICURL")
+	env.MAXUPLOADSIZE = viper.GetInt64("MAXUPLOADSIZE")
+	env.STORAGEPRIVATEDIR = viper.GetString("STORAGEPRIVATEDIR")
+	env.S3PRIVATEBUCKET = viper.GetString("S3PRIVATEBUCKET")
+
+	env.ACCOUNTDELETIONGRACE = viper.GetDuration("ACCOUNTDELETIONGRACE")
+	env.ACCOUNTPURGEINTERVAL = viper.GetDuration("ACCOUNTPURGEINTERVAL")
+	env.DATAEXPORTLINKTTL = viper.GetDuration("DATAEXPORTLINKTTL")
+	env.ALLOWDELETEDEMAILREUSE = viper.GetBool("ALLOWDELETEDEMAILREUSE")
+	env.BULKMAXUSERS = viper.GetInt("BULKMAXUSERS")
+	env.IMPORTMAXSIZE = viper.GetInt64("IMPORTMAXSIZE")
+	env.IMPORTCHUNKSIZE = viper.GetInt("IMPORTCHUNKSIZE")
+	env.IMPERSONATIONTTL = viper.GetDuration("IMPERSONATIONTTL")
+	env.STATSCACHETTL = viper.GetDuration("STATSCACHETTL")
+	env.WEBHOOKTIMEOUT = viper.GetDuration("WEBHOOKTIMEOUT")
+	env.WEBHOOKMAXATTEMPTS = viper.GetInt("WEBHOOKMAXATTEMPTS")
+	env.WEBHOOKRETRYBACKOFF = viper.GetDuration("WEBHOOKRETRYBACKOFF")
+	env.EVENTOUTBOX = viper.GetBool("EVENTOUTBOX")
+	env.EVENTRELAYINTERVAL = viper.GetDuration("EVENTRELAYINTERVAL")
+	env.TENANTBASEDOMAIN = viper.GetString("TENANTBASEDOMAIN")
+	env.SIGNUPMODE = viper.GetString("SIGNUPMODE")
+	env.INVITATIONSECRET = viper.GetString("INVITATIONSECRET")
+	env.INVITATIONTTL = viper.GetDuration("INVITATIONTTL")
+	env.INVITEBYGROUPOWNERS = viper.GetBool("INVITEBYGROUPOWNERS")
+	for _, name := range splitList(viper.GetString("OIDCPROVIDERS")) {
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		viper.SetDefault(prefix+"SCOPES", "email,profile")
+		env.OIDCPROVIDERS = append(env.OIDCPROVIDERS, OIDCProvider{
+			Name:         name,
+			Issuer:       viper.GetString(prefix + "ISSUER"),
+			ClientID:     viper.GetString(prefix + "CLIENTID"),
+			ClientSecret: viper.GetString(prefix + "CLIENTSECRET"),
+			Scopes:       splitList(viper.GetString(prefix + "SCOPES")),
+		})
+	}
+	env.OIDCLOGINTTL = viper.GetDuration("OIDCLOGINTTL")
+
 	return env
 }
+
+// splitList parses a comma-separated setting, dropping empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -1,6 +1,11 @@
 package controllers
 
 import (
+	"bufio"
+	"fmt"
+	"log"
+	"time"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/liju-github/user-management/internal/models"
 	"github.com/liju-github/user-management/internal/services"
@@ -19,27 +24,32 @@ func NewAdminController(adminService *services.AdminService) *AdminController {
 	}
 }
 
+// service returns the admin service for the organization the request acts
+// in; a super admin acting in every organization gets it unscoped.
+func (ac *AdminController) service(c *fiber.Ctx) *services.AdminService {
+	return ac.adminService.ForOrganization(organizationOf(c))
+}
+
 func (ac *AdminController) Login(c *fiber.Ctx) error {
 	var admin models.AdminRequest
-	if err := c.BodyParser(&admin); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid request payload",
-		})
+	if err := bindAndValidate(c, &admin); err != nil {
+		return err
 	}
 
 	
-	authAdmin, err := ac.adminService.Login(admin.Email, admin.Password)
+	authAdmin, err := ac.service(c).Login(admin.Email, admin.Password)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return err
 	}
 
 	
-	accessToken, accessErr := utils.GenerateJWT(admin.Email, authAdmin.ID, "admin", 1)
-	refreshToken, refreshErr := utils.GenerateJWT(admin.Email, authAdmin.ID, "admin", 72)
-	if accessErr != nil || refreshErr != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate token"})
+	accessToken, accessErr := utils.GenerateJWT(admin.Email, authAdmin.ID, "admin", 1, utils.WithOrganization(authAdmin.OrganizationID))
+	if accessErr != nil {
+		return accessErr
+	}
+	refreshToken, refreshErr := utils.GenerateJWT(admin.Email, authAdmin.ID, "admin", 72, utils.WithOrganization(authAdmin.OrganizationID))
+	if refreshErr != nil {
+		return refreshErr
 	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
@@ -53,12 +63,14 @@ func (ac *AdminController) Login(c *fiber.Ctx) error {
 
 
 func (ac *AdminController) GetAllUsers(c *fiber.Ctx) error {
-	
-	users, err := ac.adminService.GetAllUsers()
+	filter, err := userFilterFromQuery(c)
+	if err != nil {
+		return err
+	}
+
+	users, err := ac.service(c).GetAllUsers(filter)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to retrieve users: " + err.Error(),
-		})
+		return err
 	}
 
 	
@@ -90,10 +102,9 @@ func (ac *AdminController) GetAllUsers(c *fiber.Ctx) error {
 
 func (ac *AdminController) DeleteUser(c *fiber.Ctx) error {
 	userID := c.Query("id") 
-	if err := ac.adminService.DeleteUser(userID); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to delete user: " + err.Error(),
-		})
+	adminID, _ := c.Locals("ID").(string)
+	if err := ac.service(c).DeleteUser(userID, services.AdminActor(adminID)); err != nil {
+		return err
 	}
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "User deleted successfully!",
@@ -103,10 +114,15 @@ func (ac *AdminController) DeleteUser(c *fiber.Ctx) error {
 
 func (ac *AdminController) BlockUser(c *fiber.Ctx) error {
 	userID := c.Query("id") 
-	if err := ac.adminService.BlockUser(userID); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to block user: " + err.Error(),
-		})
+	adminID, _ := c.Locals("ID").(string)
+
+	var req models.BlockUserRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return err
+	}
+
+	if err := ac.service(c).BlockUser(userID, &req, services.AdminActor(adminID)); err != nil {
+		return err
 	}
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "User blocked successfully!",
@@ -116,12 +132,268 @@ func (ac *AdminController) BlockUser(c *fiber.Ctx) error {
 
 func (ac *AdminController) UnblockUser(c *fiber.Ctx) error {
 	userID := c.Query("id") 
-	if err := ac.adminService.UnblockUser(userID); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to unblock user: " + err.Error(),
-		})
+	adminID, _ := c.Locals("ID").(string)
+	if err := ac.service(c).UnblockUser(userID, services.AdminActor(adminID)); err != nil {
+		return err
 	}
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "User unblocked successfully!",
 	})
 }
+
+
+// GetDeletedUsers lists soft-deleted users so they can be restored or purged.
+func (ac *AdminController) GetDeletedUsers(c *fiber.Ctx) error {
+	users, err := ac.service(c).GetDeletedUsers()
+	if err != nil {
+		return err
+	}
+
+	deletedUsers := make([]models.UserProfileResponse, len(users))
+	for i, user := range users {
+		deletedUsers[i] = models.UserProfileResponse{
+			ID:          user.ID,
+			Name:        user.Name,
+			Email:       user.Email,
+			Age:         user.Age,
+			Gender:      user.Gender,
+			PhoneNumber: user.PhoneNumber,
+			Address:     user.Address,
+			ImageURL:    user.ImageURL,
+			IsVerified:  user.IsVerified,
+			IsBlocked:   user.IsBlocked,
+			CreatedAt:   user.CreatedAt.Format(time.RFC3339),
+			DeletedAt:   user.DeletedAt.Time.Format(time.RFC3339),
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"users": deletedUsers})
+}
+
+
+func (ac *AdminController) RestoreUser(c *fiber.Ctx) error {
+	adminID, _ := c.Locals("ID").(string)
+	if err := ac.service(c).RestoreUser(c.Params("id"), services.AdminActor(adminID)); err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "User restored successfully!",
+	})
+}
+
+
+func (ac *AdminController) VerifyUser(c *fiber.Ctx) error {
+	adminID, _ := c.Locals("ID").(string)
+	if err := ac.service(c).VerifyUser(c.Params("id"), services.AdminActor(adminID)); err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "User email marked as verified!",
+	})
+}
+
+
+func (ac *AdminController) UnverifyUser(c *fiber.Ctx) error {
+	adminID, _ := c.Locals("ID").(string)
+	if err := ac.service(c).UnverifyUser(c.Params("id"), services.AdminActor(adminID)); err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "User email marked as unverified!",
+	})
+}
+
+
+// SendPasswordReset emails the user a reset link; their current password
+// keeps working until they use it.
+func (ac *AdminController) SendPasswordReset(c *fiber.Ctx) error {
+	adminID, _ := c.Locals("ID").(string)
+	if err := ac.service(c).SendPasswordResetLink(c.Params("id"), services.AdminActor(adminID)); err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": models.PasswordResetEmailSent,
+	})
+}
+
+
+// RequirePasswordChange makes the user choose a new password at next sign-in.
+func (ac *AdminController) RequirePasswordChange(c *fiber.Ctx) error {
+	adminID, _ := c.Locals("ID").(string)
+	if err := ac.service(c).RequirePasswordChange(c.Params("id"), services.AdminActor(adminID)); err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "User must change their password at next sign-in!",
+	})
+}
+
+
+// RevokeSessions signs the user out everywhere.
+func (ac *AdminController) RevokeSessions(c *fiber.Ctx) error {
+	adminID, _ := c.Locals("ID").(string)
+	revoked, err := ac.service(c).RevokeSessions(c.Params("id"), services.AdminActor(adminID))
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "User sessions revoked!",
+		"revoked": revoked,
+	})
+}
+
+
+func (ac *AdminController) PurgeUser(c *fiber.Ctx) error {
+	adminID, _ := c.Locals("ID").(string)
+	if err := ac.service(c).PurgeUser(c.Params("id"), services.AdminActor(adminID)); err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "User permanently deleted!",
+	})
+}
+
+
+// GetBlockHistory lists every block placed on the user in the :id parameter.
+func (ac *AdminController) GetBlockHistory(c *fiber.Ctx) error {
+	blocks, err := ac.service(c).GetBlockHistory(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"blocks": blocks})
+}
+
+
+// GetUser returns a user's full profile and account status with their
+// recent sessions and audit events.
+func (ac *AdminController) GetUser(c *fiber.Ctx) error {
+	detail, err := ac.service(c).GetUserDetail(c.Params("id"))
+	if err != nil {
+		return err
+	}
+
+	user := detail.User
+	return c.Status(fiber.StatusOK).JSON(models.AdminUserDetailResponse{
+		User: newProfileResponse(user, detail.Images),
+		Status: models.UserStatusResponse{
+			IsVerified:          user.IsVerified,
+			MustChangePassword:  user.MustChangePassword,
+			IsBlocked:           user.IsBlocked,
+			BlockReason:         user.BlockReason,
+			BlockedUntil:        user.BlockedUntil,
+			DeletionScheduledAt: user.DeletionScheduledAt,
+			ImportedAt:          user.ImportedAt,
+		},
+		Tags:        detail.Tags,
+		Sessions:    detail.Sessions,
+		RecentAudit: detail.RecentAudit,
+	})
+}
+
+
+// Impersonate issues a short-lived token that lets the admin use the API as
+// the user. Sensitive actions stay blocked under it and every request made
+// with it is audited.
+func (ac *AdminController) Impersonate(c *fiber.Ctx) error {
+	adminID, _ := c.Locals("ID").(string)
+
+	user, session, err := ac.service(c).Impersonate(c.Params("id"), c.Get(fiber.HeaderUserAgent), c.IP(), services.AdminActor(adminID))
+	if err != nil {
+		return err
+	}
+
+	token, err := utils.GenerateJWT(user.Email, user.ID, "user", 0,
+		utils.WithSessionID(session.ID),
+		utils.WithExpiry(session.ExpiresAt),
+		utils.WithActor(adminID),
+		utils.WithOrganization(user.OrganizationID),
+	)
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(models.ImpersonationResponse{
+		Token:     token,
+		SessionID: session.ID,
+		ExpiresAt: session.ExpiresAt,
+	})
+}
+
+
+// UpdateUser changes any of a user's profile fields, including their email
+// and verification status.
+func (ac *AdminController) UpdateUser(c *fiber.Ctx) error {
+	adminID, _ := c.Locals("ID").(string)
+
+	var req models.AdminUserUpdateRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return err
+	}
+
+	user, err := ac.service(c).UpdateUser(c.Params("id"), &req, services.AdminActor(adminID))
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": models.ProfileUpdatedSuccessfully,
+		"user":    newProfileResponse(user, nil),
+	})
+}
+
+
+// ExportUsers streams the users matching the list filters as CSV or NDJSON,
+// chosen by ?format=. ?columns= picks a comma-separated subset of columns.
+// Personal data is masked unless the admin holds the view_pii permission.
+func (ac *AdminController) ExportUsers(c *fiber.Ctx) error {
+	adminID, _ := c.Locals("ID").(string)
+
+	filter, err := userFilterFromQuery(c)
+	if err != nil {
+		return err
+	}
+	export, err := ac.service(c).NewUserExport(c.Query("format"), filter, queryList(c, "columns"), adminID)
+	if err != nil {
+		return err
+	}
+
+	c.Set(fiber.HeaderContentType, export.ContentType())
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="users-%s.%s"`, time.Now().UTC().Format("20060102-150405"), export.Format))
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := export.Write(w); err != nil {
+			log.Printf("User export failed: %v", err)
+		}
+	})
+	return nil
+}
+
+
+// BulkAction applies one action to a list of users or to every user matching
+// a filter. ID lists are processed before responding; filters start a
+// background job that is polled through GetBulkJob.
+func (ac *AdminController) BulkAction(c *fiber.Ctx) error {
+	adminID, _ := c.Locals("ID").(string)
+
+	var req models.BulkUserActionRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return err
+	}
+
+	job, err := ac.service(c).RunBulkAction(&req, services.AdminActor(adminID))
+	if err != nil {
+		return err
+	}
+
+	status := fiber.StatusOK
+	if job.Status != models.BulkJobCompleted {
+		status = fiber.StatusAccepted
+	}
+	return c.Status(status).JSON(fiber.Map{"job": job})
+}
+
+
+func (ac *AdminController) GetBulkJob(c *fiber.Ctx) error {
+	job, err := ac.service(c).GetBulkJob(c.Params("id"))
+	if err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"job": job})
+}
@@ -7,11 +7,14 @@ import (
 )
 
 type AuthController struct {
-	authService *services.AuthService
+	authService  *services.AuthService
+	groupService services.IGroupService
 }
 
-func NewAuthController(authService *services.AuthService) *AuthController {
-	return &AuthController{authService: authService}
+// NewAuthController serves token refreshes. With a groupService refreshed
+// user tokens carry the user's current groups; it may be nil.
+func NewAuthController(authService *services.AuthService, groupService services.IGroupService) *AuthController {
+	return &AuthController{authService: authService, groupService: groupService}
 }
 
 func (c *AuthController) GetRefreshToken(ctx *fiber.Ctx) error {
@@ -19,9 +22,21 @@ func (c *AuthController) GetRefreshToken(ctx *fiber.Ctx) error {
 	ID := ctx.Locals("ID").(string)
 	role := ctx.Locals("role").(string)
 
-	accessToken, accessErr := utils.GenerateJWT(email, ID, role, 1)
+	opts := []utils.TokenOption{utils.WithOrganization(organizationOf(ctx))}
+	if role == "user" {
+		var err error
+		if opts, err = userTokenOptions(c.groupService, organizationOf(ctx), ID); err != nil {
+			return err
+		}
+	}
+	if sessionID, ok := ctx.Locals("sid").(string); ok {
+		c.authService.TouchSession(sessionID)
+		opts = append(opts, utils.WithSessionID(sessionID))
+	}
+
+	accessToken, accessErr := utils.GenerateJWT(email, ID, role, 1, opts...)
 	if accessErr != nil {
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate token"})
+		return accessErr
 	}
 
 	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"token": accessToken})
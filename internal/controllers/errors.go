@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/services"
+)
+
+// errInvalidBody is returned when the request body cannot be parsed at all.
+var errInvalidBody = errors.New(models.InvalidInput)
+
+const problemTypePrefix = "urn:user-management:problem:"
+
+type problemMapping struct {
+	err    error
+	status int
+	code   string
+}
+
+// problemMappings lists every error the API reports to clients. Anything not
+// listed here is treated as an internal error and its text is never exposed.
+var problemMappings = []problemMapping{
+	{errInvalidBody, fiber.StatusBadRequest, "invalid_request"},
+	{services.ErrUserExists, fiber.StatusConflict, "user_exists"},
+	{services.ErrUserNotFound, fiber.StatusNotFound, "user_not_found"},
+	{services.ErrInvalidCredentials, fiber.StatusUnauthorized, "invalid_credentials"},
+	{services.ErrEmailNotVerified, fiber.StatusForbidden, "email_not_verified"},
+	{services.ErrEmailAlreadyVerified, fiber.StatusConflict, "email_already_verified"},
+	{services.ErrUserBlocked, fiber.StatusForbidden, "user_blocked"},
+	{services.ErrInvalidToken, fiber.StatusBadRequest, "invalid_token"},
+	{services.ErrTokenExpired, fiber.StatusBadRequest, "token_expired"},
+	{services.ErrFileTooLarge, fiber.StatusRequestEntityTooLarge, "file_too_large"},
+	{services.ErrUnsupportedMediaType, fiber.StatusUnsupportedMediaType, "unsupported_media_type"},
+	{services.ErrExportNotFound, fiber.StatusNotFound, "export_not_found"},
+	{services.ErrExportNotReady, fiber.StatusConflict, "export_not_ready"},
+	{services.ErrBulkJobNotFound, fiber.StatusNotFound, "bulk_job_not_found"},
+	{services.ErrImportNotFound, fiber.StatusNotFound, "import_not_found"},
+	{services.ErrImportNotResumable, fiber.StatusConflict, "import_not_resumable"},
+	{services.ErrImpersonationDenied, fiber.StatusForbidden, "impersonation_denied"},
+	{services.ErrPasswordChangeNeeded, fiber.StatusForbidden, "password_change_required"},
+	{services.ErrNoteNotFound, fiber.StatusNotFound, "note_not_found"},
+	{services.ErrWebhookNotFound, fiber.StatusNotFound, "webhook_not_found"},
+	{services.ErrWebhookDeliveryNotFound, fiber.StatusNotFound, "webhook_delivery_not_found"},
+	{services.ErrWebhookNotReplayable, fiber.StatusConflict, "webhook_not_replayable"},
+	{services.ErrOrganizationNotFound, fiber.StatusNotFound, "organization_not_found"},
+	{services.ErrOrganizationExists, fiber.StatusConflict, "organization_exists"},
+	{services.ErrGroupNotFound, fiber.StatusNotFound, "group_not_found"},
+	{services.ErrGroupExists, fiber.StatusConflict, "group_exists"},
+	{services.ErrGroupMemberNotFound, fiber.StatusNotFound, "group_member_not_found"},
+	{services.ErrInvitationNotFound, fiber.StatusNotFound, "invitation_not_found"},
+	{services.ErrInvitationExists, fiber.StatusConflict, "invitation_exists"},
+	{services.ErrInvitationNotPending, fiber.StatusConflict, "invitation_not_pending"},
+	{services.ErrInvitationRequired, fiber.StatusForbidden, "invitation_required"},
+	{services.ErrSignupClosed, fiber.StatusForbidden, "signup_closed"},
+	{services.ErrProviderNotFound, fiber.StatusNotFound, "provider_not_found"},
+	{services.ErrSocialLoginFailed, fiber.StatusUnauthorized, "social_login_failed"},
+	{services.ErrUnauthorized, fiber.StatusUnauthorized, "unauthorized"},
+	{services.ErrMissingAuthToken, fiber.StatusUnauthorized, "missing_auth_token"},
+	{services.ErrInvalidAuthToken, fiber.StatusUnauthorized, "invalid_auth_token"},
+	{services.ErrAuthTokenExpired, fiber.StatusUnauthorized, "auth_token_expired"},
+	{services.ErrInsufficientAccess, fiber.StatusForbidden, "insufficient_privileges"},
+}
+
+// problemExtender is implemented by errors that add type-specific members to
+// their problem response.
+type problemExtender interface {
+	ProblemExtensions() map[string]interface{}
+}
+
+// ErrorHandler is the application-wide Fiber error handler. It renders every
+// error returned by a handler or middleware as an application/problem+json
+// body.
+func ErrorHandler(ctx *fiber.Ctx, err error) error {
+	problem := problemFor(err)
+	problem.Instance = ctx.Path()
+	return ctx.Status(problem.Status).JSON(problem, models.ProblemContentType)
+}
+
+func problemFor(err error) models.Problem {
+	var fieldErrors models.ValidationErrors
+	if errors.As(err, &fieldErrors) {
+		return newProblem(fiber.StatusBadRequest, "validation_failed", models.InvalidInput, fieldErrors)
+	}
+
+	for _, m := range problemMappings {
+		if errors.Is(err, m.err) {
+			problem := newProblem(m.status, m.code, m.err.Error(), nil)
+			var extender problemExtender
+			if errors.As(err, &extender) {
+				problem.Extensions = extender.ProblemExtensions()
+			}
+			return problem
+		}
+	}
+
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		title := utils.StatusMessage(fiberErr.Code)
+		return newProblem(fiberErr.Code, statusCode(title), fiberErr.Message, nil)
+	}
+
+	log.Println("Unhandled error:", err)
+	return newProblem(fiber.StatusInternalServerError, "internal_error", "An unexpected error occurred", nil)
+}
+
+func newProblem(status int, code, detail string, fieldErrors models.ValidationErrors) models.Problem {
+	return models.Problem{
+		Type:   problemTypePrefix + code,
+		Title:  utils.StatusMessage(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+		Errors: fieldErrors,
+	}
+}
+
+// statusCode turns an HTTP status phrase such as "Not Found" into "not_found".
+func statusCode(title string) string {
+	return strings.ReplaceAll(strings.ToLower(title), " ", "_")
+}
@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"io"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/services"
+)
+
+type ExportController struct {
+	exportService services.IExportService
+}
+
+func NewExportController(exportService services.IExportService) *ExportController {
+	return &ExportController{exportService: exportService}
+}
+
+// service returns the export service for the organization the request acts in.
+func (c *ExportController) service(ctx *fiber.Ctx) services.IExportService {
+	return c.exportService.ForOrganization(organizationOf(ctx))
+}
+
+// RequestExport starts an export of the signed-in user's data. The download
+// link is emailed once it is ready.
+func (c *ExportController) RequestExport(ctx *fiber.Ctx) error {
+	ID := ctx.Locals("ID").(string)
+
+	export, err := c.service(ctx).RequestExport(ID, services.UserActor(ID))
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusAccepted).JSON(fiber.Map{"message": models.DataExportStarted, "export": export})
+}
+
+// AdminRequestExport starts an export on behalf of the user in the :id
+// parameter. The link is still emailed to the user.
+func (c *ExportController) AdminRequestExport(ctx *fiber.Ctx) error {
+	adminID, _ := ctx.Locals("ID").(string)
+
+	export, err := c.service(ctx).RequestExport(ctx.Params("id"), services.AdminActor(adminID))
+	if err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusAccepted).JSON(fiber.Map{"message": models.DataExportStarted, "export": export})
+}
+
+// Download serves an archive through the token from the emailed link.
+func (c *ExportController) Download(ctx *fiber.Ctx) error {
+	body, export, err := c.exportService.OpenDownload(ctx.Params("token"))
+	if err != nil {
+		return err
+	}
+	return sendArchive(ctx, body, export)
+}
+
+// AdminDownload serves an archive by export ID.
+func (c *ExportController) AdminDownload(ctx *fiber.Ctx) error {
+	body, export, err := c.service(ctx).OpenExport(ctx.Params("id"))
+	if err != nil {
+		return err
+	}
+	return sendArchive(ctx, body, export)
+}
+
+func sendArchive(ctx *fiber.Ctx, body io.ReadCloser, export *models.DataExport) error {
+	ctx.Set(fiber.HeaderContentType, "application/zip")
+	ctx.Set(fiber.HeaderCacheControl, "no-store")
+	ctx.Attachment("data-export-" + export.ID + ".zip")
+	return ctx.SendStream(body)
+}
@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/services"
+	"github.com/liju-github/user-management/internal/utils"
+)
+
+// GroupController lets admins manage groups and who belongs to them.
+type GroupController struct {
+	groupService services.IGroupService
+}
+
+func NewGroupController(groupService services.IGroupService) *GroupController {
+	return &GroupController{groupService: groupService}
+}
+
+// service returns the group service for the organization the request acts in.
+func (c *GroupController) service(ctx *fiber.Ctx) services.IGroupService {
+	return c.groupService.ForOrganization(organizationOf(ctx))
+}
+
+func (c *GroupController) ListGroups(ctx *fiber.Ctx) error {
+	groups, err := c.service(ctx).ListGroups()
+	if err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"groups": groups})
+}
+
+func (c *GroupController) CreateGroup(ctx *fiber.Ctx) error {
+	var req models.GroupRequest
+	if err := bindAndValidate(ctx, &req); err != nil {
+		return err
+	}
+
+	group, err := c.service(ctx).CreateGroup(&req)
+	if err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusCreated).JSON(fiber.Map{"group": group})
+}
+
+// GetGroup returns the group with its members.
+func (c *GroupController) GetGroup(ctx *fiber.Ctx) error {
+	group, err := c.service(ctx).GetGroup(ctx.Params("id"))
+	if err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"group": group})
+}
+
+func (c *GroupController) UpdateGroup(ctx *fiber.Ctx) error {
+	var req models.GroupUpdateRequest
+	if err := bindAndValidate(ctx, &req); err != nil {
+		return err
+	}
+
+	group, err := c.service(ctx).UpdateGroup(ctx.Params("id"), &req)
+	if err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"group": group})
+}
+
+func (c *GroupController) DeleteGroup(ctx *fiber.Ctx) error {
+	adminID, _ := ctx.Locals("ID").(string)
+	if err := c.service(ctx).DeleteGroup(ctx.Params("id"), services.AdminActor(adminID)); err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Group deleted successfully!"})
+}
+
+// SetMember adds the user in :userId to the group, or changes their role in
+// it.
+func (c *GroupController) SetMember(ctx *fiber.Ctx) error {
+	adminID, _ := ctx.Locals("ID").(string)
+
+	var req models.GroupMemberRequest
+	if err := bindAndValidate(ctx, &req); err != nil {
+		return err
+	}
+
+	member, err := c.service(ctx).SetMember(ctx.Params("id"), ctx.Params("userId"), req.Role, services.AdminActor(adminID))
+	if err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"member": member})
+}
+
+func (c *GroupController) RemoveMember(ctx *fiber.Ctx) error {
+	adminID, _ := ctx.Locals("ID").(string)
+	if err := c.service(ctx).RemoveMember(ctx.Params("id"), ctx.Params("userId"), services.AdminActor(adminID)); err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Member removed successfully!"})
+}
+
+// GetUserGroups lists the groups the user in :id belongs to.
+func (c *GroupController) GetUserGroups(ctx *fiber.Ctx) error {
+	groups, err := c.service(ctx).GroupsForUser(ctx.Params("id"))
+	if err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"groups": groups})
+}
+
+// userTokenOptions are the claims every token issued to a user carries:
+// their organization and, when groups is set, their group memberships.
+func userTokenOptions(groups services.IGroupService, organizationID, userID string) ([]utils.TokenOption, error) {
+	opts := []utils.TokenOption{utils.WithOrganization(organizationID)}
+	if groups == nil {
+		return opts, nil
+	}
+
+	memberships, err := groups.ForOrganization(organizationID).GroupsForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	return append(opts, utils.WithGroups(memberships)), nil
+}
@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/services"
+)
+
+type ImportController struct {
+	importService services.IImportService
+}
+
+func NewImportController(importService services.IImportService) *ImportController {
+	return &ImportController{importService: importService}
+}
+
+// CreateImport accepts a CSV or NDJSON file of users in the "file" field and
+// starts importing it in the background. The "format", "dry_run" and
+// "mark_verified" form fields tune the import; the returned job is polled
+// through GetImport. Users are imported into the organization the request
+// names, or the default one.
+func (c *ImportController) CreateImport(ctx *fiber.Ctx) error {
+	adminID, _ := ctx.Locals("ID").(string)
+
+	header, err := ctx.FormFile("file")
+	if err != nil {
+		return models.ValidationErrors{{Field: "file", Rule: "required"}}
+	}
+	file, err := header.Open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	opts := services.ImportOptions{
+		Format:         ctx.FormValue("format"),
+		Filename:       header.Filename,
+		DryRun:         formBool(ctx, "dry_run"),
+		MarkVerified:   formBool(ctx, "mark_verified"),
+		OrganizationID: organizationOf(ctx),
+	}
+	job, err := c.importService.CreateImport(ctx.UserContext(), file, header.Size, opts, services.AdminActor(adminID))
+	if err != nil {
+		return err
+	}
+	c.importService.StartImport(job)
+
+	return ctx.Status(fiber.StatusAccepted).JSON(fiber.Map{"job": job})
+}
+
+func (c *ImportController) GetImport(ctx *fiber.Ctx) error {
+	job, err := c.importService.GetImportJob(ctx.Params("id"))
+	if err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"job": job})
+}
+
+// ResumeImport continues a paused, failed or stalled import from where it
+// stopped.
+func (c *ImportController) ResumeImport(ctx *fiber.Ctx) error {
+	job, err := c.importService.ResumeImport(ctx.Params("id"))
+	if err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusAccepted).JSON(fiber.Map{"job": job})
+}
+
+// formBool reads a checkbox-style form field: "true", "1" and "on" are true.
+func formBool(ctx *fiber.Ctx, field string) bool {
+	switch ctx.FormValue(field) {
+	case "true", "1", "on":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/services"
+)
+
+// InvitationController lets admins, and group owners for their groups,
+// invite people to sign up, and shows invitation links to their holders.
+type InvitationController struct {
+	invitationService services.IInvitationService
+}
+
+func NewInvitationController(invitationService services.IInvitationService) *InvitationController {
+	return &InvitationController{invitationService: invitationService}
+}
+
+// service returns the invitation service for the organization the request
+// acts in.
+func (c *InvitationController) service(ctx *fiber.Ctx) services.IInvitationService {
+	return c.invitationService.ForOrganization(organizationOf(ctx))
+}
+
+// ListInvitations returns the organization's invitations, optionally only
+// those in ?status.
+func (c *InvitationController) ListInvitations(ctx *fiber.Ctx) error {
+	invitations, err := c.service(ctx).ListInvitations(ctx.Query("status"))
+	if err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"invitations": invitations})
+}
+
+func (c *InvitationController) CreateInvitation(ctx *fiber.Ctx) error {
+	adminID, _ := ctx.Locals("ID").(string)
+
+	var req models.InvitationRequest
+	if err := bindAndValidate(ctx, &req); err != nil {
+		return err
+	}
+
+	invitation, err := c.service(ctx).Invite(&req, services.AdminActor(adminID))
+	if err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusCreated).JSON(fiber.Map{"invitation": invitation})
+}
+
+// ResendInvitation emails a new link for a pending invitation.
+func (c *InvitationController) ResendInvitation(ctx *fiber.Ctx) error {
+	adminID, _ := ctx.Locals("ID").(string)
+	invitation, err := c.service(ctx).Resend(ctx.Params("id"), services.AdminActor(adminID))
+	if err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"invitation": invitation})
+}
+
+func (c *InvitationController) RevokeInvitation(ctx *fiber.Ctx) error {
+	adminID, _ := ctx.Locals("ID").(string)
+	if err := c.service(ctx).Revoke(ctx.Params("id"), services.AdminActor(adminID)); err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Invitation revoked successfully!"})
+}
+
+// InviteToGroup lets the owner of the group in :id invite someone into it.
+func (c *InvitationController) InviteToGroup(ctx *fiber.Ctx) error {
+	ID := ctx.Locals("ID").(string)
+
+	var req models.InvitationRequest
+	if err := bindAndValidate(ctx, &req); err != nil {
+		return err
+	}
+
+	invitation, err := c.service(ctx).InviteToGroup(ID, ctx.Params("id"), &req)
+	if err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusCreated).JSON(fiber.Map{"invitation": invitation})
+}
+
+// PreviewInvitation shows the holder of an invitation link what they were
+// invited to, before they sign up with it.
+func (c *InvitationController) PreviewInvitation(ctx *fiber.Ctx) error {
+	preview, err := c.invitationService.Preview(ctx.Params("token"))
+	if err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"invitation": preview})
+}
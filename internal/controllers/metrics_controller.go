@@ -0,0 +1,26 @@
+package controllers
+
+import (
+	"expvar"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type MetricsController struct {
+	eventCounts *expvar.Map
+}
+
+func NewMetricsController(eventCounts *expvar.Map) *MetricsController {
+	return &MetricsController{eventCounts: eventCounts}
+}
+
+// GetEventCounts returns how many times each domain event has been
+// published since the server started.
+func (c *MetricsController) GetEventCounts(ctx *fiber.Ctx) error {
+	counts := map[string]int64{}
+	c.eventCounts.Do(func(kv expvar.KeyValue) {
+		counts[kv.Key], _ = strconv.ParseInt(kv.Value.String(), 10, 64)
+	})
+	return ctx.JSON(fiber.Map{"events": counts})
+}
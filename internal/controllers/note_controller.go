@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/services"
+)
+
+// NoteController serves the admin-only notes and tags kept on users.
+type NoteController struct {
+	noteService services.INoteService
+}
+
+func NewNoteController(noteService services.INoteService) *NoteController {
+	return &NoteController{noteService: noteService}
+}
+
+// service returns the note service for the organization the request acts in.
+func (c *NoteController) service(ctx *fiber.Ctx) services.INoteService {
+	return c.noteService.ForOrganization(organizationOf(ctx))
+}
+
+func (c *NoteController) ListNotes(ctx *fiber.Ctx) error {
+	notes, err := c.service(ctx).ListNotes(ctx.Params("id"))
+	if err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"notes": notes})
+}
+
+func (c *NoteController) AddNote(ctx *fiber.Ctx) error {
+	adminID, _ := ctx.Locals("ID").(string)
+
+	var req models.UserNoteRequest
+	if err := bindAndValidate(ctx, &req); err != nil {
+		return err
+	}
+
+	note, err := c.service(ctx).AddNote(ctx.Params("id"), req.Body, services.AdminActor(adminID))
+	if err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusCreated).JSON(fiber.Map{"note": note})
+}
+
+// EditNote replaces a note's text; the previous text stays available
+// through NoteRevisions.
+func (c *NoteController) EditNote(ctx *fiber.Ctx) error {
+	adminID, _ := ctx.Locals("ID").(string)
+
+	var req models.UserNoteRequest
+	if err := bindAndValidate(ctx, &req); err != nil {
+		return err
+	}
+
+	note, err := c.service(ctx).EditNote(ctx.Params("id"), ctx.Params("noteId"), req.Body, services.AdminActor(adminID))
+	if err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"note": note})
+}
+
+func (c *NoteController) NoteRevisions(ctx *fiber.Ctx) error {
+	revisions, err := c.service(ctx).NoteRevisions(ctx.Params("id"), ctx.Params("noteId"))
+	if err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"revisions": revisions})
+}
+
+func (c *NoteController) GetTags(ctx *fiber.Ctx) error {
+	tags, err := c.service(ctx).GetTags(ctx.Params("id"))
+	if err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"tags": tags})
+}
+
+func (c *NoteController) AddTags(ctx *fiber.Ctx) error {
+	adminID, _ := ctx.Locals("ID").(string)
+
+	var req models.UserTagsRequest
+	if err := bindAndValidate(ctx, &req); err != nil {
+		return err
+	}
+
+	tags, err := c.service(ctx).AddTags(ctx.Params("id"), req.Tags, services.AdminActor(adminID))
+	if err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"tags": tags})
+}
+
+func (c *NoteController) RemoveTag(ctx *fiber.Ctx) error {
+	tags, err := c.service(ctx).RemoveTag(ctx.Params("id"), ctx.Params("tag"))
+	if err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"tags": tags})
+}
+
+// ListTags returns every tag in use, for building user list filters.
+func (c *NoteController) ListTags(ctx *fiber.Ctx) error {
+	tags, err := c.service(ctx).TagCounts()
+	if err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"tags": tags})
+}
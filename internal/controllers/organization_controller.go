@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/services"
+)
+
+// OrganizationController lets super admins manage the organizations users
+// and admins belong to.
+type OrganizationController struct {
+	organizationService services.IOrganizationService
+}
+
+func NewOrganizationController(organizationService services.IOrganizationService) *OrganizationController {
+	return &OrganizationController{organizationService: organizationService}
+}
+
+func (c *OrganizationController) ListOrganizations(ctx *fiber.Ctx) error {
+	organizations, err := c.organizationService.ListOrganizations()
+	if err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"organizations": organizations})
+}
+
+// CreateOrganization adds an organization. Its slug names it in the
+// X-Organization header and as a subdomain.
+func (c *OrganizationController) CreateOrganization(ctx *fiber.Ctx) error {
+	var req models.OrganizationRequest
+	if err := bindAndValidate(ctx, &req); err != nil {
+		return err
+	}
+
+	organization, err := c.organizationService.CreateOrganization(&req)
+	if err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusCreated).JSON(fiber.Map{"organization": organization})
+}
+
+func (c *OrganizationController) GetOrganization(ctx *fiber.Ctx) error {
+	organization, err := c.organizationService.GetOrganization(ctx.Params("id"))
+	if err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"organization": organization})
+}
+
+func (c *OrganizationController) UpdateOrganization(ctx *fiber.Ctx) error {
+	var req models.OrganizationUpdateRequest
+	if err := bindAndValidate(ctx, &req); err != nil {
+		return err
+	}
+
+	organization, err := c.organizationService.UpdateOrganization(ctx.Params("id"), &req)
+	if err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"organization": organization})
+}
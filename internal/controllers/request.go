@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/liju-github/user-management/internal/models"
+)
+
+// bindAndValidate parses the request body into req and runs its `validate`
+// tag rules. Validation failures are returned as models.ValidationErrors.
+func bindAndValidate(ctx *fiber.Ctx, req interface{}) error {
+	if err := ctx.BodyParser(req); err != nil {
+		return errInvalidBody
+	}
+
+	return models.ValidateStruct(req)
+}
+
+// organizationOf returns the organization a request acts in: the one the
+// signed-in caller was scoped to, or for public endpoints the one
+// utils.TenantMiddleware resolved. It is empty for a super admin working
+// across every organization.
+func organizationOf(ctx *fiber.Ctx) string {
+	if organizationID, ok := ctx.Locals("org").(string); ok {
+		return organizationID
+	}
+	if tenant, ok := ctx.Locals("tenant").(string); ok {
+		return tenant
+	}
+	return models.DefaultOrganizationID
+}
+
+// readFormFile returns the contents of the named multipart file field. A
+// missing field is reported as a validation error on that field.
+func readFormFile(ctx *fiber.Ctx, field string) ([]byte, error) {
+	header, err := ctx.FormFile(field)
+	if err != nil {
+		return nil, models.ValidationErrors{{Field: field, Rule: "required"}}
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return io.ReadAll(file)
+}
+
+// userFilterFromQuery reads a models.UserFilter from the query string:
+// email, email_domain, is_blocked, is_verified, the RFC 3339 timestamps
+// created_after and created_before, and a comma-separated list of tags.
+func userFilterFromQuery(ctx *fiber.Ctx) (*models.UserFilter, error) {
+	filter := &models.UserFilter{
+		Email:       ctx.Query("email"),
+		EmailDomain: ctx.Query("email_domain"),
+		Tags:        queryList(ctx, "tags"),
+	}
+
+	var errs models.ValidationErrors
+	flags := []struct {
+		field  string
+		target **bool
+	}{{"is_blocked", &filter.IsBlocked}, {"is_verified", &filter.IsVerified}}
+	for _, flag := range flags {
+		field, target := flag.field, flag.target
+		if value := ctx.Query(field); value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				errs = append(errs, models.FieldError{Field: field, Rule: "boolean"})
+				continue
+			}
+			*target = &parsed
+		}
+	}
+	times := []struct {
+		field  string
+		target **time.Time
+	}{{"created_after", &filter.CreatedAfter}, {"created_before", &filter.CreatedBefore}}
+	for _, bound := range times {
+		field, target := bound.field, bound.target
+		if value := ctx.Query(field); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				errs = append(errs, models.FieldError{Field: field, Rule: "datetime", Param: time.RFC3339})
+				continue
+			}
+			*target = &parsed
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	if err := models.ValidateStruct(filter); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// queryList splits a comma-separated query parameter, dropping empty items.
+func queryList(ctx *fiber.Ctx, key string) []string {
+	var items []string
+	for _, item := range strings.Split(ctx.Query(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
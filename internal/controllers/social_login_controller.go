@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/liju-github/user-management/internal/services"
+)
+
+// socialLoginCookie holds a hash of the state of the sign-in the browser
+// began, so the callback only completes sign-ins begun by the same browser
+// and nobody can sign a victim in to the attacker's account.
+const socialLoginCookie = "oidc_state"
+
+// SocialLoginController signs users in with OpenID Connect providers.
+type SocialLoginController struct {
+	socialLoginService services.ISocialLoginService
+	userService        services.IUserService
+	groupService       services.IGroupService
+	// loginTTL is how long the state cookie lives, matching how long the
+	// service keeps a sign-in open.
+	loginTTL time.Duration
+}
+
+func NewSocialLoginController(socialLoginService services.ISocialLoginService, userService services.IUserService, groupService services.IGroupService, loginTTL time.Duration) *SocialLoginController {
+	return &SocialLoginController{socialLoginService: socialLoginService, userService: userService, groupService: groupService, loginTTL: loginTTL}
+}
+
+// ListProviders returns the names of the providers users can sign in with.
+func (c *SocialLoginController) ListProviders(ctx *fiber.Ctx) error {
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"providers": c.socialLoginService.Providers()})
+}
+
+// Begin redirects the user to sign in at the provider in :provider, for the
+// organization the request is for.
+func (c *SocialLoginController) Begin(ctx *fiber.Ctx) error {
+	authURL, err := c.socialLoginService.ForOrganization(organizationOf(ctx)).Begin(ctx.Params("provider"))
+	if err != nil {
+		return err
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		return err
+	}
+
+	c.setStateCookie(ctx, hashState(parsed.Query().Get("state")), time.Now().Add(c.loginTTL))
+	return ctx.Redirect(authURL, fiber.StatusFound)
+}
+
+// Callback is where the provider sends the user back to. It signs them in
+// to the organization the sign-in was begun for and responds with tokens,
+// like Login.
+func (c *SocialLoginController) Callback(ctx *fiber.Ctx) error {
+	provider := ctx.Params("provider")
+	expected := ctx.Cookies(socialLoginCookie)
+	c.setStateCookie(ctx, "", time.Unix(0, 0))
+
+	if reason := ctx.Query("error"); reason != "" {
+		log.Printf("Sign-in with %s failed: %s %s", provider, reason, ctx.Query("error_description"))
+		return services.ErrSocialLoginFailed
+	}
+	state := ctx.Query("state")
+	if expected == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(hashState(state))) != 1 {
+		return services.ErrInvalidToken
+	}
+
+	user, err := c.socialLoginService.Complete(provider, state, ctx.Query("code"))
+	if err != nil {
+		return err
+	}
+	return signIn(ctx, c.userService.ForOrganization(user.OrganizationID), c.groupService, user)
+}
+
+// setStateCookie sets the state cookie on the provider's routes, which
+// include its callback, or clears it when expires has passed.
+func (c *SocialLoginController) setStateCookie(ctx *fiber.Ctx, value string, expires time.Time) {
+	ctx.Cookie(&fiber.Cookie{
+		Name:     socialLoginCookie,
+		Value:    value,
+		Path:     "/api/auth/oidc/" + ctx.Params("provider"),
+		Expires:  expires,
+		Secure:   ctx.Protocol() == "https",
+		HTTPOnly: true,
+		// Lax still sends the cookie on the provider's top-level redirect
+		// back to the callback.
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+}
+
+func hashState(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(sum[:])
+}
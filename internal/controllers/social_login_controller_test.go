@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/services"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSocialLogin begins every sign-in with the same state and fails to
+// complete it, recording the attempt.
+type fakeSocialLogin struct {
+	completed []string
+}
+
+func (f *fakeSocialLogin) Providers() []string { return []string{"corp"} }
+
+func (f *fakeSocialLogin) Begin(provider string) (string, error) {
+	return "https://idp.example.com/authorize?client_id=client-1&state=state-1", nil
+}
+
+func (f *fakeSocialLogin) Complete(provider, state, code string) (*models.User, error) {
+	f.completed = append(f.completed, state)
+	return nil, services.ErrSocialLoginFailed
+}
+
+func (f *fakeSocialLogin) ForOrganization(string) services.ISocialLoginService { return f }
+
+func TestSocialLoginCallbackNeedsBrowserState(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	social := &fakeSocialLogin{}
+	controller := NewSocialLoginController(social, nil, nil, 10*time.Minute)
+	app.Get("/api/auth/oidc/:provider", controller.Begin)
+	app.Get("/api/auth/oidc/:provider/callback", controller.Callback)
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/api/auth/oidc/corp", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusFound, resp.StatusCode)
+	var cookie *http.Cookie
+	for _, c := range resp.Cookies() {
+		if c.Name == socialLoginCookie {
+			cookie = c
+		}
+	}
+	if assert.NotNil(t, cookie) {
+		assert.Equal(t, hashState("state-1"), cookie.Value)
+		assert.Equal(t, "/api/auth/oidc/corp", cookie.Path)
+		assert.True(t, cookie.HttpOnly)
+		assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+	}
+
+	callback := func(cookieValue string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/auth/oidc/corp/callback?state=state-1&code=code-1", nil)
+		if cookieValue != "" {
+			req.AddCookie(&http.Cookie{Name: socialLoginCookie, Value: cookieValue})
+		}
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		return resp.StatusCode
+	}
+
+	// A link opened in a browser that did not begin the sign-in is refused.
+	assert.Equal(t, fiber.StatusBadRequest, callback(""))
+	assert.Equal(t, fiber.StatusBadRequest, callback(hashState("state-2")))
+	assert.Empty(t, social.completed)
+
+	assert.Equal(t, fiber.StatusUnauthorized, callback(hashState("state-1")))
+	assert.Equal(t, []string{"state-1"}, social.completed)
+}
@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/services"
+)
+
+const statsDateLayout = "2006-01-02"
+
+type StatsController struct {
+	statsService services.IStatsService
+}
+
+func NewStatsController(statsService services.IStatsService) *StatsController {
+	return &StatsController{statsService: statsService}
+}
+
+// GetStats returns the admin dashboard aggregates. The "interval" query
+// parameter (day, week or month) groups signups, and "from" and "to" bound
+// the time series by date, both inclusive.
+func (c *StatsController) GetStats(ctx *fiber.Ctx) error {
+	query := &models.StatsQuery{Interval: ctx.Query("interval")}
+
+	var errs models.ValidationErrors
+	dates := []struct {
+		field  string
+		target *time.Time
+	}{{"from", &query.From}, {"to", &query.To}}
+	for _, date := range dates {
+		if value := ctx.Query(date.field); value != "" {
+			parsed, err := time.Parse(statsDateLayout, value)
+			if err != nil {
+				errs = append(errs, models.FieldError{Field: date.field, Rule: "datetime", Param: statsDateLayout})
+				continue
+			}
+			*date.target = parsed
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	stats, err := c.statsService.GetStats(query)
+	if err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"stats": stats})
+}
@@ -3,37 +3,45 @@ package controllers
 import (
 	"fmt"
 	"net/url"
+	"slices"
+	"strconv"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/liju-github/user-management/internal/media"
 	"github.com/liju-github/user-management/internal/models"
 	"github.com/liju-github/user-management/internal/services"
 	"github.com/liju-github/user-management/internal/utils"
 )
 
 type UserController struct {
-	userService services.IUserService
+	userService  services.IUserService
+	groupService services.IGroupService
 }
 
-func NewUserController(userService services.IUserService) *UserController {
-	return &UserController{userService: userService}
+// NewUserController serves the user endpoints. With a groupService the
+// user's groups are put in the tokens they sign in with and listed by
+// GetGroups; it may be nil.
+func NewUserController(userService services.IUserService, groupService services.IGroupService) *UserController {
+	return &UserController{userService: userService, groupService: groupService}
+}
+
+// service returns the user service for the organization the request is
+// in. Email verification and password reset confirmation are found by
+// their token and don't need it.
+func (c *UserController) service(ctx *fiber.Ctx) services.IUserService {
+	return c.userService.ForOrganization(organizationOf(ctx))
 }
 
 func (c *UserController) Signup(ctx *fiber.Ctx) error {
     var userReq models.UserSignupRequest
-    if err := ctx.BodyParser(&userReq); err != nil {
-        return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": models.InvalidInput})
-    }
-
-    if err := models.Validate(userReq); err != nil {
-        return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+    if err := bindAndValidate(ctx, &userReq); err != nil {
+        return err
     }
 
-    if err := c.userService.Signup(&userReq); err != nil {
-        if err.Error() == models.UserAlreadyExists {
-            return ctx.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
-        }
-        return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+    if err := c.service(ctx).Signup(&userReq); err != nil {
+        return err
     }
 
     return ctx.Status(fiber.StatusCreated).JSON(fiber.Map{"message": models.SignupSuccessful})
@@ -41,42 +49,57 @@ func (c *UserController) Signup(ctx *fiber.Ctx) error {
 
 func (c *UserController) Login(ctx *fiber.Ctx) error {
     var loginReq models.UserLoginRequest
-    if err := ctx.BodyParser(&loginReq); err != nil {
-        return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": models.InvalidInput})
+    if err := bindAndValidate(ctx, &loginReq); err != nil {
+        return err
     }
 
-    // Basic validation for login request
-    if loginReq.Email == "" || loginReq.Password == "" {
-        return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": models.InvalidInput})
-    }
-
-    user, err := c.userService.Login(loginReq.Email, loginReq.Password)
+    user, err := c.service(ctx).Login(loginReq.Email, loginReq.Password)
     if err != nil {
-        return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+        return err
     }
 
-    if user.IsBlocked {
-        return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": models.UserIsBlocked})
-    }
+    return signIn(ctx, c.service(ctx), c.groupService, user)
+}
 
-    accessToken, accessErr := utils.GenerateJWT(user.Email, user.ID, "user", 1)
-    refreshToken, refreshErr := utils.GenerateJWT(user.Email, user.ID, "user", 72)
-    if accessErr != nil || refreshErr != nil {
-        return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate token"})
-    }
+// signIn starts a session for a user who has proved who they are and
+// responds with their tokens.
+func signIn(ctx *fiber.Ctx, userService services.IUserService, groupService services.IGroupService, user *models.User) error {
+	if user.BlockActive(time.Now()) {
+		return services.NewBlockedError(user)
+	}
+
+	session, err := userService.StartSession(user.ID, ctx.Get(fiber.HeaderUserAgent), ctx.IP(), 72*time.Hour)
+	if err != nil {
+		return err
+	}
+
+	opts, err := userTokenOptions(groupService, user.OrganizationID, user.ID)
+	if err != nil {
+		return err
+	}
+	opts = append(opts, utils.WithSessionID(session.ID))
 
-    return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
-        "message":       models.LoginSuccessful,
-        "user":          user,
-        "token":         accessToken,
-        "refresh_token": refreshToken,
-    })
+	accessToken, accessErr := utils.GenerateJWT(user.Email, user.ID, "user", 1, opts...)
+	if accessErr != nil {
+		return accessErr
+	}
+	refreshToken, refreshErr := utils.GenerateJWT(user.Email, user.ID, "user", 72, opts...)
+	if refreshErr != nil {
+		return refreshErr
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":       models.LoginSuccessful,
+		"user":          user,
+		"token":         accessToken,
+		"refresh_token": refreshToken,
+	})
 }
 
 func (c *UserController) Logout(ctx *fiber.Ctx) error {
 	ID := ctx.Locals("ID").(string)
-	if err := c.userService.Logout(ID); err != nil {
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	if err := c.service(ctx).Logout(ID); err != nil {
+		return err
 	}
 
 	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"message": models.LogoutSuccessful})
@@ -85,109 +108,153 @@ func (c *UserController) Logout(ctx *fiber.Ctx) error {
 func (c *UserController) VerifyEmail(ctx *fiber.Ctx) error {
 	token := ctx.Params("token")
 	if token == "" {
-		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Token is required"})
+		return services.ErrInvalidToken
 	}
 
 	if err := c.userService.VerifyEmail(token); err != nil {
-		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"message": models.EmailVerifiedSuccessfully})
 }
 
 func (c *UserController) ResendVerification(ctx *fiber.Ctx) error {
-	var req struct {
-		Email string `json:"email"`
-	}
-	if err := ctx.BodyParser(&req); err != nil {
-		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": models.InvalidInput})
+	var req models.EmailRequest
+	if err := bindAndValidate(ctx, &req); err != nil {
+		return err
 	}
 
-	if err := c.userService.ResendVerification(req.Email); err != nil {
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	if err := c.service(ctx).ResendVerification(req.Email); err != nil {
+		return err
 	}
 
 	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"message": models.VerificationEmailResent})
 }
 
 func (c *UserController) RequestPasswordReset(ctx *fiber.Ctx) error {
-	var req struct {
-		Email string `json:"email"`
-	}
-	if err := ctx.BodyParser(&req); err != nil {
-		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": models.InvalidInput})
+	var req models.EmailRequest
+	if err := bindAndValidate(ctx, &req); err != nil {
+		return err
 	}
 
-	if err := c.userService.RequestPasswordReset(req.Email); err != nil {
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	if err := c.service(ctx).RequestPasswordReset(req.Email); err != nil {
+		return err
 	}
 
 	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"message": models.PasswordResetEmailSent})
 }
 
 func (c *UserController) ConfirmPasswordReset(ctx *fiber.Ctx) error {
-	var req struct {
-		Token       string `json:"token"`
-		NewPassword string `json:"new_password"`
-	}
-	if err := ctx.BodyParser(&req); err != nil {
-		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": models.InvalidInput})
+	var req models.PasswordResetConfirmRequest
+	if err := bindAndValidate(ctx, &req); err != nil {
+		return err
 	}
 
 	if err := c.userService.ConfirmPasswordReset(req.Token, req.NewPassword); err != nil {
-		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
 	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"message": models.PasswordResetSuccessfully})
 }
 
+func (c *UserController) ChangePassword(ctx *fiber.Ctx) error {
+	ID, ok := ctx.Locals("ID").(string)
+	if !ok || ID == "" {
+		return services.ErrUnauthorized
+	}
+
+	var req models.ChangePasswordRequest
+	if err := bindAndValidate(ctx, &req); err != nil {
+		return err
+	}
+
+	if err := c.service(ctx).ChangePassword(ID, req.CurrentPassword, req.NewPassword); err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"message": models.PasswordChangedSuccessfully})
+}
+
 func (c *UserController) GetProfile(ctx *fiber.Ctx) error {
 	ID, ok := ctx.Locals("ID").(string)
 	if !ok || ID == "" {
-		return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": models.InvalidID})
+		return services.ErrUnauthorized
 	}
 
-	user, err := c.userService.GetProfile(ID)
+	user, err := c.service(ctx).GetProfile(ID)
 	if err != nil {
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return err
 	}
 
-	profileResponse := models.UserProfileResponse{
-		ID:         user.ID,
-		Name:       user.Name,
-		Email:      user.Email,
-		Age:        user.Age,
-		Gender:     user.Gender,
-		Address:    user.Address,
-		ImageURL:   user.ImageURL,
-		IsVerified: user.IsVerified,
-		IsBlocked:  user.IsBlocked,
-		CreatedAt:  user.CreatedAt.Format(time.RFC3339),
-	}
+	profileResponse := newProfileResponse(user, c.service(ctx).AvatarURLs(user))
 
 	fmt.Println(profileResponse)
 
 	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"user": profileResponse})
 }
 
+// GetSecurityHistory lists the user's recent sessions, including any in
+// which support staff signed in as them, and their security events.
+func (c *UserController) GetSecurityHistory(ctx *fiber.Ctx) error {
+	ID := ctx.Locals("ID").(string)
+
+	history, err := c.service(ctx).GetSecurityHistory(ID)
+	if err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusOK).JSON(history)
+}
+
+// GetGroups lists the groups the signed-in user belongs to, with their role
+// in each.
+func (c *UserController) GetGroups(ctx *fiber.Ctx) error {
+	ID := ctx.Locals("ID").(string)
+
+	groups := []models.UserGroup{}
+	if c.groupService != nil {
+		var err error
+		groups, err = c.groupService.ForOrganization(organizationOf(ctx)).GroupsForUser(ID)
+		if err != nil {
+			return err
+		}
+	}
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"groups": groups})
+}
+
+// newProfileResponse is the profile shown to the user and to admins.
+func newProfileResponse(user *models.User, images map[string]string) models.UserProfileResponse {
+	profile := models.UserProfileResponse{
+		ID:          user.ID,
+		Name:        user.Name,
+		Email:       user.Email,
+		Age:         user.Age,
+		Gender:      user.Gender,
+		Address:     user.Address,
+		PhoneNumber: user.PhoneNumber,
+		ImageURL:    user.ImageURL,
+		Images:      images,
+		IsVerified:  user.IsVerified,
+		IsBlocked:   user.IsBlocked,
+		CreatedAt:   user.CreatedAt.Format(time.RFC3339),
+	}
+	if user.DeletionScheduledAt != nil {
+		profile.DeletionScheduledAt = user.DeletionScheduledAt.Format(time.RFC3339)
+	}
+	return profile
+}
+
 func (c *UserController) UpdateProfile(ctx *fiber.Ctx) error {
 	email, _ := ctx.Locals("email").(string)
 	fmt.Println(email)
 
 	var updateReq models.UserUpdateRequest
-	if err := ctx.BodyParser(&updateReq); err != nil {
-		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": models.InvalidInput + ": " + err.Error()})
+	if err := bindAndValidate(ctx, &updateReq); err != nil {
+		return err
 	}
-	ID := ""
+	ID, _ := ctx.Locals("ID").(string)
 
-	if updateReq.ID != "" {
-		ID = updateReq.ID
-	} else {
-		ID, _ = ctx.Locals("ID").(string)
-	}
-
-	if err := c.userService.UpdateProfile(ID, email, &updateReq); err != nil {
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	if err := c.service(ctx).UpdateProfile(ID, email, &updateReq); err != nil {
+		return err
 	}
 
 	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"message": models.ProfileUpdatedSuccessfully})
@@ -196,24 +263,59 @@ func (c *UserController) UpdateProfile(ctx *fiber.Ctx) error {
 func (c *UserController) UploadProfilePicture(ctx *fiber.Ctx) error {
 	ID := ctx.Locals("ID").(string)
 
-	type ImageUploadRequest struct {
-		ImageURL string `json:"image_url"`
+	image, err := readFormFile(ctx, "image")
+	if err != nil {
+		return err
+	}
+
+	imageURL, err := c.service(ctx).UploadProfilePicture(ID, image)
+	if err != nil {
+		return err
 	}
 
-	var req ImageUploadRequest
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":   models.ProfilePictureUploadedSuccessfully,
+		"image_url": imageURL,
+	})
+}
 
-	if err := ctx.BodyParser(&req); err != nil {
-		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+// DefaultAvatar serves the generated initials avatar used for users who
+// haven't uploaded a picture. It needs no lookup, so it is public and
+// cacheable.
+func (c *UserController) DefaultAvatar(ctx *fiber.Ctx) error {
+	size, err := strconv.Atoi(ctx.Params("size"))
+	if err != nil || !slices.Contains(media.AvatarSizes, size) {
+		return fiber.ErrNotFound
 	}
 
-	_, err := url.ParseRequestURI(req.ImageURL)
-	if err != nil {
-		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid URL format"})
+	initials, err := url.PathUnescape(ctx.Params("initials"))
+	if err != nil || initials == "" || utf8.RuneCountInString(initials) > 2 {
+		return fiber.ErrNotFound
 	}
 
-	if err := c.userService.UploadProfilePicture(ID, req.ImageURL); err != nil {
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	ctx.Set(fiber.HeaderContentType, "image/svg+xml")
+	ctx.Set(fiber.HeaderCacheControl, "public, max-age=86400")
+	return ctx.Send(media.InitialsAvatar(initials, size))
+}
+
+// DeleteAccount schedules the signed-in user's account for deletion. The
+// password is required again so a stolen token alone can't delete an
+// account.
+func (c *UserController) DeleteAccount(ctx *fiber.Ctx) error {
+	ID := ctx.Locals("ID").(string)
+
+	var req models.DeleteAccountRequest
+	if err := bindAndValidate(ctx, &req); err != nil {
+		return err
+	}
+
+	scheduledAt, err := c.service(ctx).RequestAccountDeletion(ID, req.Password)
+	if err != nil {
+		return err
 	}
 
-	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"message": models.ProfilePictureUploadedSuccessfully})
+	return ctx.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message":               models.AccountDeletionScheduled,
+		"deletion_scheduled_at": scheduledAt.Format(time.RFC3339),
+	})
 }
@@ -7,22 +7,28 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 	
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/golang-jwt/jwt/v4"
 	"github.com/golang/mock/gomock"
 	"github.com/liju-github/user-management/internal/mocks"
 	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/services"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestSignup(t *testing.T) {
-	app := fiber.New()
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
 	mockUserService := mocks.NewMockIUserService(ctrl)
+	mockUserService.EXPECT().ForOrganization(models.DefaultOrganizationID).Return(mockUserService).AnyTimes()
 	userController := &UserController{userService: mockUserService}
 	app.Post("/signup", userController.Signup)
 
@@ -66,8 +72,8 @@ func TestSignup(t *testing.T) {
 				ImageURL:    "http://image.url",
 			},
 			expectedStatusCode: fiber.StatusConflict,
-			expectedResponse:   fmt.Sprintf(`{"error":"%v"}`, models.UserAlreadyExists),
-			returnError:        errors.New(models.UserAlreadyExists),
+			expectedResponse:   problemResponse(fiber.StatusConflict, "user_exists", models.UserAlreadyExists, "/signup"),
+			returnError:        services.ErrUserExists,
 			expectSignupCall:   true,
 		},
 		{
@@ -83,9 +89,9 @@ func TestSignup(t *testing.T) {
 				ImageURL:    "http://image.url",
 			},
 			expectedStatusCode: fiber.StatusBadRequest,
-			expectedResponse:   fmt.Sprintf(`{"error":"%v"}`, fmt.Sprintf(models.ErrPasswordLength, models.MinPasswordLength, models.MaxPasswordLength)),
-			returnError:        nil,
-			expectSignupCall:   false,
+			expectedResponse:   validationResponse(models.FieldError{Field: "password", Rule: "min", Param: "8"}),
+			returnError:        models.ValidationErrors{{Field: "password", Rule: "min", Param: "8"}},
+			expectSignupCall:   true,
 		},
 		{
 			name: "password too long",
@@ -100,9 +106,9 @@ func TestSignup(t *testing.T) {
 				ImageURL:    "http://image.url",
 			},
 			expectedStatusCode: fiber.StatusBadRequest,
-			expectedResponse:   fmt.Sprintf(`{"error":"%v"}`, fmt.Sprintf(models.ErrPasswordLength, models.MinPasswordLength, models.MaxPasswordLength)),
-			returnError:        nil,
-			expectSignupCall:   false,
+			expectedResponse:   validationResponse(models.FieldError{Field: "password", Rule: "max", Param: "72"}),
+			returnError:        models.ValidationErrors{{Field: "password", Rule: "max", Param: "72"}},
+			expectSignupCall:   true,
 		},
 		{
 			name: "password missing uppercase",
@@ -117,9 +123,9 @@ func TestSignup(t *testing.T) {
 				ImageURL:    "http://image.url",
 			},
 			expectedStatusCode: fiber.StatusBadRequest,
-			expectedResponse:   fmt.Sprintf(`{"error":"%v"}`, models.ErrPasswordComplexity),
-			returnError:        nil,
-			expectSignupCall:   false,
+			expectedResponse:   validationResponse(models.FieldError{Field: "password", Rule: "upper"}),
+			returnError:        models.ValidationErrors{{Field: "password", Rule: "upper"}},
+			expectSignupCall:   true,
 		},
 		{
 			name: "password missing special character",
@@ -134,9 +140,26 @@ func TestSignup(t *testing.T) {
 				ImageURL:    "http://image.url",
 			},
 			expectedStatusCode: fiber.StatusBadRequest,
-			expectedResponse:   fmt.Sprintf(`{"error":"%v"}`, models.ErrPasswordComplexity),
-			returnError:        nil,
-			expectSignupCall:   false,
+			expectedResponse:   validationResponse(models.FieldError{Field: "password", Rule: "special"}),
+			returnError:        models.ValidationErrors{{Field: "password", Rule: "special"}},
+			expectSignupCall:   true,
+		},
+		{
+			name: "password rejected by the service",
+			requestBody: models.UserSignupRequest{
+				Name:        "John Doe",
+				Email:       "john.doe@example.com",
+				Age:         30,
+				Gender:      "Male",
+				Address:     "123 Street",
+				PhoneNumber: 1234567890,
+				Password:    "SecurePass@123",
+				ImageURL:    "http://image.url",
+			},
+			expectedStatusCode: fiber.StatusBadRequest,
+			expectedResponse:   validationResponse(models.FieldError{Field: "password", Rule: "breached"}),
+			returnError:        models.ValidationErrors{{Field: "password", Rule: "breached"}},
+			expectSignupCall:   true,
 		},
 		{
 			name: "invalid input - empty name",
@@ -144,7 +167,16 @@ func TestSignup(t *testing.T) {
 				Name: "",
 			},
 			expectedStatusCode: fiber.StatusBadRequest,
-			expectedResponse:   fmt.Sprintf(`{"error":"%v"}`, models.ErrRequiredFieldsEmpty),
+			expectedResponse: validationResponse(
+				models.FieldError{Field: "name", Rule: "required"},
+				models.FieldError{Field: "email", Rule: "required"},
+				models.FieldError{Field: "age", Rule: "required"},
+				models.FieldError{Field: "gender", Rule: "required"},
+				models.FieldError{Field: "address", Rule: "required"},
+				models.FieldError{Field: "phonenumber", Rule: "required"},
+				models.FieldError{Field: "password", Rule: "required"},
+				models.FieldError{Field: "image_url", Rule: "required"},
+			),
 			returnError:        nil,
 			expectSignupCall:   false,
 		},
@@ -161,7 +193,7 @@ func TestSignup(t *testing.T) {
 				ImageURL:    "http://image.url",
 			},
 			expectedStatusCode: fiber.StatusBadRequest,
-			expectedResponse:   fmt.Sprintf(`{"error":"%v"}`, models.ErrInvalidEmailFormat),
+			expectedResponse:   validationResponse(models.FieldError{Field: "email", Rule: "email"}),
 			returnError:        nil,
 			expectSignupCall:   false,
 		},
@@ -178,7 +210,41 @@ func TestSignup(t *testing.T) {
 				ImageURL:    "http://image.url",
 			},
 			expectedStatusCode: fiber.StatusBadRequest,
-			expectedResponse:   fmt.Sprintf(`{"error":"%v"}`, models.ErrNegativeAge),
+			expectedResponse:   validationResponse(models.FieldError{Field: "age", Rule: "required"}),
+			returnError:        nil,
+			expectSignupCall:   false,
+		},
+		{
+			name: "age below minimum",
+			requestBody: models.UserSignupRequest{
+				Name:        "John Doe",
+				Email:       "john.doe@example.com",
+				Age:         16,
+				Gender:      "Male",
+				Address:     "123 Street",
+				PhoneNumber: 1234567890,
+				Password:    "SecurePass@123",
+				ImageURL:    "http://image.url",
+			},
+			expectedStatusCode: fiber.StatusBadRequest,
+			expectedResponse:   validationResponse(models.FieldError{Field: "age", Rule: "gte", Param: "18"}),
+			returnError:        nil,
+			expectSignupCall:   false,
+		},
+		{
+			name: "invalid gender",
+			requestBody: models.UserSignupRequest{
+				Name:        "John Doe",
+				Email:       "john.doe@example.com",
+				Age:         30,
+				Gender:      "Unknown",
+				Address:     "123 Street",
+				PhoneNumber: 1234567890,
+				Password:    "SecurePass@123",
+				ImageURL:    "http://image.url",
+			},
+			expectedStatusCode: fiber.StatusBadRequest,
+			expectedResponse:   validationResponse(models.FieldError{Field: "gender", Rule: "oneof", Param: "Male Female Other"}),
 			returnError:        nil,
 			expectSignupCall:   false,
 		},
@@ -195,8 +261,8 @@ func TestSignup(t *testing.T) {
 				ImageURL:    "http://image.url",
 			},
 			expectedStatusCode: fiber.StatusInternalServerError,
-			expectedResponse:   `{"error":"some internal error"}`,
-			returnError:        errors.New("some internal error"),
+			expectedResponse:   problemResponse(fiber.StatusInternalServerError, "internal_error", "An unexpected error occurred", "/signup"),
+			returnError:        errors.New("failed to create user: Error 1062: Duplicate entry"),
 			expectSignupCall:   true,
 		},
 	}
@@ -221,6 +287,9 @@ func TestSignup(t *testing.T) {
 			}
 
 			assert.Equal(t, test.expectedStatusCode, resp.StatusCode)
+			if resp.StatusCode >= fiber.StatusBadRequest {
+				assert.Equal(t, models.ProblemContentType, resp.Header.Get(fiber.HeaderContentType))
+			}
 			buf := new(bytes.Buffer)
 			buf.ReadFrom(resp.Body)
 			assert.JSONEq(t, test.expectedResponse, buf.String())
@@ -228,13 +297,39 @@ func TestSignup(t *testing.T) {
 	}
 }
 
+func problemResponse(status int, code, detail, instance string) string {
+	body, _ := json.Marshal(models.Problem{
+		Type:     problemTypePrefix + code,
+		Title:    utils.StatusMessage(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: instance,
+		Code:     code,
+	})
+	return string(body)
+}
+
+func validationResponse(fields ...models.FieldError) string {
+	body, _ := json.Marshal(models.Problem{
+		Type:     problemTypePrefix + "validation_failed",
+		Title:    utils.StatusMessage(fiber.StatusBadRequest),
+		Status:   fiber.StatusBadRequest,
+		Detail:   models.InvalidInput,
+		Instance: "/signup",
+		Code:     "validation_failed",
+		Errors:   fields,
+	})
+	return string(body)
+}
+
 func TestLogin(t *testing.T) {
-	app := fiber.New()
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
 	mockUserService := mocks.NewMockIUserService(ctrl)
-	userController := NewUserController(mockUserService)
+	mockUserService.EXPECT().ForOrganization(models.DefaultOrganizationID).Return(mockUserService).AnyTimes()
+	userController := NewUserController(mockUserService, nil)
 	app.Post("/login", userController.Login)
 
 	tests := []struct {
@@ -274,7 +369,8 @@ func TestLogin(t *testing.T) {
 			mockError:          nil,
 			userBlocked:        false,
 			validateResponse: func(t *testing.T, response map[string]interface{}) {
-				assert.Equal(t, models.InvalidInput, response["error"])
+				assert.Equal(t, "validation_failed", response["code"])
+				assert.Equal(t, []interface{}{map[string]interface{}{"field": "password", "rule": "required", "param": ""}}, response["errors"])
 			},
 		},
 		{
@@ -287,7 +383,8 @@ func TestLogin(t *testing.T) {
 			mockError:          nil,
 			userBlocked:        false,
 			validateResponse: func(t *testing.T, response map[string]interface{}) {
-				assert.Equal(t, models.InvalidInput, response["error"])
+				assert.Equal(t, "validation_failed", response["code"])
+				assert.Equal(t, []interface{}{map[string]interface{}{"field": "email", "rule": "required", "param": ""}}, response["errors"])
 			},
 		},
 		{
@@ -296,11 +393,14 @@ func TestLogin(t *testing.T) {
 				Email:    "blocked@example.com",
 				Password: "SecurePass@123",
 			},
-			expectedStatusCode: fiber.StatusUnauthorized,
+			expectedStatusCode: fiber.StatusForbidden,
 			mockError:          nil,
 			userBlocked:        true,
 			validateResponse: func(t *testing.T, response map[string]interface{}) {
-				assert.Equal(t, models.UserIsBlocked, response["error"])
+				assert.Equal(t, "user_blocked", response["code"])
+				assert.Equal(t, models.UserIsBlocked, response["detail"])
+				assert.Equal(t, models.BlockReasonAbuse, response["block_reason"])
+				assert.Equal(t, "2030-01-02T15:04:05Z", response["blocked_until"])
 			},
 		},
 		{
@@ -310,10 +410,25 @@ func TestLogin(t *testing.T) {
 				Password: "WrongPass@123",
 			},
 			expectedStatusCode: fiber.StatusUnauthorized,
-			mockError:          errors.New(models.InvalidInput),
+			mockError:          services.ErrInvalidCredentials,
 			userBlocked:        false,
 			validateResponse: func(t *testing.T, response map[string]interface{}) {
-				assert.Equal(t, models.InvalidInput, response["error"])
+				assert.Equal(t, "invalid_credentials", response["code"])
+				assert.Equal(t, fmt.Sprint(fiber.StatusUnauthorized), fmt.Sprint(response["status"]))
+			},
+		},
+		{
+			name: "database failure is not leaked",
+			requestBody: models.UserLoginRequest{
+				Email:    "test@example.com",
+				Password: "SecurePass@123",
+			},
+			expectedStatusCode: fiber.StatusInternalServerError,
+			mockError:          errors.New("failed to find user: dial tcp 127.0.0.1:3306: connection refused"),
+			userBlocked:        false,
+			validateResponse: func(t *testing.T, response map[string]interface{}) {
+				assert.Equal(t, "internal_error", response["code"])
+				assert.NotContains(t, response["detail"], "3306")
 			},
 		},
 	}
@@ -329,9 +444,18 @@ func TestLogin(t *testing.T) {
 					Email:     test.requestBody.Email,
 					IsBlocked: test.userBlocked,
 				}
+				if test.userBlocked {
+					until := time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC)
+					user.BlockReason, user.BlockedUntil = models.BlockReasonAbuse, &until
+				}
 				mockUserService.EXPECT().
 					Login(test.requestBody.Email, test.requestBody.Password).
 					Return(user, nil)
+				if !test.userBlocked {
+					mockUserService.EXPECT().
+						StartSession(user.ID, gomock.Any(), gomock.Any(), 72*time.Hour).
+						Return(&models.Session{ID: "session-1", UserID: user.ID}, nil)
+				}
 			}
 
 			reqBody, _ := json.Marshal(test.requestBody)
@@ -411,3 +535,100 @@ func TestGetProfile(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateProfileIgnoresBodyID(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUserService := mocks.NewMockIUserService(ctrl)
+	mockUserService.EXPECT().ForOrganization(models.DefaultOrganizationID).Return(mockUserService).AnyTimes()
+	userController := NewUserController(mockUserService, nil)
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("ID", "user-1")
+		return c.Next()
+	})
+	app.Put("/update", userController.UpdateProfile)
+
+	mockUserService.EXPECT().
+		UpdateProfile("user-1", gomock.Any(), gomock.Any()).
+		Return(nil)
+
+	body := `{"id":"9b2f1c1e-3f5e-4c1a-9d7e-2b8f0c6a1d23","name":"John Doe","age":30,"gender":"Male","address":"1 Main Street"}`
+	req := httptest.NewRequest(http.MethodPut, "/update", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := app.Test(req, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+}
+
+func TestUpdateProfileAcceptsPartialBody(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUserService := mocks.NewMockIUserService(ctrl)
+	mockUserService.EXPECT().ForOrganization(models.DefaultOrganizationID).Return(mockUserService).AnyTimes()
+	userController := NewUserController(mockUserService, nil)
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("ID", "user-1")
+		return c.Next()
+	})
+	app.Put("/update", userController.UpdateProfile)
+
+	address := "2 High Street"
+	mockUserService.EXPECT().
+		UpdateProfile("user-1", gomock.Any(), &models.UserUpdateRequest{Address: &address}).
+		Return(nil)
+
+	req := httptest.NewRequest(http.MethodPut, "/update", strings.NewReader(`{"address":"2 High Street"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	req = httptest.NewRequest(http.MethodPut, "/update", strings.NewReader(`{"age":12}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = app.Test(req, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusBadRequest, resp.StatusCode)
+}
+
+func TestLoginInRequestOrganization(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUserService := mocks.NewMockIUserService(ctrl)
+	scopedService := mocks.NewMockIUserService(ctrl)
+	userController := NewUserController(mockUserService, nil)
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("tenant", "org-1")
+		return c.Next()
+	})
+	app.Post("/login", userController.Login)
+
+	user := &models.User{ID: "user-1", Email: "test@example.com", OrganizationID: "org-1"}
+	mockUserService.EXPECT().ForOrganization("org-1").Return(scopedService).AnyTimes()
+	scopedService.EXPECT().Login("test@example.com", "SecurePass@123").Return(user, nil)
+	scopedService.EXPECT().
+		StartSession("user-1", gomock.Any(), gomock.Any(), 72*time.Hour).
+		Return(&models.Session{ID: "session-1", UserID: "user-1"}, nil)
+
+	body := `{"email":"test@example.com","password":"SecurePass@123"}`
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := app.Test(req, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	var response map[string]interface{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&response))
+	token, _ := response["token"].(string)
+	claims := jwt.MapClaims{}
+	_, _, err = jwt.NewParser().ParseUnverified(token, claims)
+	assert.NoError(t, err)
+	assert.Equal(t, "org-1", claims["org"])
+}
@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/services"
+)
+
+// WebhookController lets admins manage webhook endpoints and inspect and
+// replay their deliveries.
+type WebhookController struct {
+	webhookService services.IWebhookService
+}
+
+func NewWebhookController(webhookService services.IWebhookService) *WebhookController {
+	return &WebhookController{webhookService: webhookService}
+}
+
+// CreateEndpoint registers an endpoint. The response carries the signing
+// secret, which is not shown again.
+func (c *WebhookController) CreateEndpoint(ctx *fiber.Ctx) error {
+	adminID, _ := ctx.Locals("ID").(string)
+
+	var req models.WebhookEndpointRequest
+	if err := bindAndValidate(ctx, &req); err != nil {
+		return err
+	}
+
+	endpoint, secret, err := c.webhookService.CreateEndpoint(&req, services.AdminActor(adminID))
+	if err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusCreated).JSON(fiber.Map{"webhook": endpoint, "secret": secret})
+}
+
+func (c *WebhookController) ListEndpoints(ctx *fiber.Ctx) error {
+	endpoints, err := c.webhookService.ListEndpoints()
+	if err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"webhooks": endpoints})
+}
+
+func (c *WebhookController) GetEndpoint(ctx *fiber.Ctx) error {
+	endpoint, err := c.webhookService.GetEndpoint(ctx.Params("id"))
+	if err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"webhook": endpoint})
+}
+
+func (c *WebhookController) UpdateEndpoint(ctx *fiber.Ctx) error {
+	var req models.WebhookEndpointUpdateRequest
+	if err := bindAndValidate(ctx, &req); err != nil {
+		return err
+	}
+
+	endpoint, err := c.webhookService.UpdateEndpoint(ctx.Params("id"), &req)
+	if err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"webhook": endpoint})
+}
+
+func (c *WebhookController) RotateSecret(ctx *fiber.Ctx) error {
+	secret, err := c.webhookService.RotateSecret(ctx.Params("id"))
+	if err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"secret": secret})
+}
+
+func (c *WebhookController) DeleteEndpoint(ctx *fiber.Ctx) error {
+	if err := c.webhookService.DeleteEndpoint(ctx.Params("id")); err != nil {
+		return err
+	}
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// ListDeliveries returns the endpoint's delivery log, optionally filtered by
+// the "status" query parameter.
+func (c *WebhookController) ListDeliveries(ctx *fiber.Ctx) error {
+	deliveries, err := c.webhookService.ListDeliveries(ctx.Params("id"), ctx.Query("status"))
+	if err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"deliveries": deliveries})
+}
+
+// ReplayDelivery sends a failed delivery again.
+func (c *WebhookController) ReplayDelivery(ctx *fiber.Ctx) error {
+	delivery, err := c.webhookService.ReplayDelivery(ctx.Params("id"))
+	if err != nil {
+		return err
+	}
+	return ctx.Status(fiber.StatusAccepted).JSON(fiber.Map{"delivery": delivery})
+}
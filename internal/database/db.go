@@ -6,6 +6,7 @@ import (
 
 	"github.com/liju-github/user-management/internal/config"
 	models "github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/tenancy"
 
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
@@ -24,6 +25,12 @@ func ConnectDatabase(env config.Env) *gorm.DB {
 		return nil
 	}
 
+	// Scope queries made for one organization to its rows
+	if err := tenancy.Register(db); err != nil {
+		log.Fatalf("Failed to register tenant scoping: %v", err)
+		return nil
+	}
+
 	// Automigrate the models (creates tables if not exists)
 	err = AutoMigrate(db)
 	if err != nil {
@@ -36,9 +43,90 @@ func ConnectDatabase(env config.Env) *gorm.DB {
 
 // AutoMigrate handles the automatic migration of models
 func AutoMigrate(db *gorm.DB) error {
-	return db.AutoMigrate(
+	if err := dropLegacyEmailIndexes(db); err != nil {
+		return err
+	}
+
+	err := db.AutoMigrate(
+		&models.Organization{},
 		&models.User{},
 		&models.Admin{},
 		&models.PasswordReset{},
+		&models.PasswordHistory{},
+		&models.AuditEvent{},
+		&models.DataExport{},
+		&models.UserBlock{},
+		&models.BulkJob{},
+		&models.ImportJob{},
+		&models.Session{},
+		&models.UserNote{},
+		&models.UserNoteRevision{},
+		&models.UserTag{},
+		&models.WebhookEndpoint{},
+		&models.WebhookDelivery{},
+		&models.OutboxEvent{},
+		&models.Group{},
+		&models.GroupMember{},
+		&models.Invitation{},
+		&models.UserIdentity{},
+		&models.SocialLogin{},
 	)
+	if err != nil {
+		return err
+	}
+	return createDefaultOrganization(db)
+}
+
+// dropLegacyEmailIndexes removes old unique indexes on email addresses.
+// The first ones on users.email covered soft-deleted rows too, so a deleted
+// user's email could never be registered again, and the later ones made
+// emails unique across organizations. Uniqueness is now enforced per
+// organization on users.active_email and admins.email.
+func dropLegacyEmailIndexes(db *gorm.DB) error {
+	migrator := db.Migrator()
+	legacy := []struct {
+		model   interface{}
+		indexes []string
+	}{
+		{&models.User{}, []string{"email", "uni_users_email", "idx_users_active_email"}},
+		{&models.Admin{}, []string{"email", "uni_admins_email"}},
+	}
+
+	for _, table := range legacy {
+		if !migrator.HasTable(table.model) {
+			continue
+		}
+		for _, name := range table.indexes {
+			if migrator.HasIndex(table.model, name) {
+				if err := migrator.DropIndex(table.model, name); err != nil {
+					return fmt.Errorf("failed to drop index %s: %w", name, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// createDefaultOrganization adds the organization existing users and admins
+// were moved into when organizations were introduced. Admins from before
+// then could manage every user, so they become super admins.
+func createDefaultOrganization(db *gorm.DB) error {
+	var count int64
+	if err := db.Model(&models.Organization{}).Where("id = ?", models.DefaultOrganizationID).Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to find default organization: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		organization := &models.Organization{ID: models.DefaultOrganizationID, Name: "Default", Slug: "default"}
+		if err := tx.Create(organization).Error; err != nil {
+			return fmt.Errorf("failed to create default organization: %w", err)
+		}
+		if err := tx.Model(&models.Admin{}).Where("1 = 1").Update("super_admin", true).Error; err != nil {
+			return fmt.Errorf("failed to promote existing admins: %w", err)
+		}
+		return nil
+	})
 }
@@ -0,0 +1,200 @@
+// Package events is an in-process bus for domain events. Services publish
+// typed events describing what happened, and side effects such as emails,
+// audit records, webhooks and metrics subscribe to them at startup.
+//
+// By default events are dispatched as soon as they are published. With
+// UseOutbox the services instead store them in an outbox table in the same
+// transaction as the change they describe, and Relay dispatches them once
+// that transaction has committed.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/liju-github/user-management/internal/models"
+)
+
+// Event is a domain event. EventName is stable and used to store events in
+// the outbox.
+type Event interface {
+	EventName() string
+}
+
+// Handler reacts to an event. Errors are logged; they never undo the change
+// the event describes or stop other handlers.
+type Handler func(Event) error
+
+// Bus dispatches events to the handlers subscribed to them.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+	all      []Handler
+
+	outbox bool
+	wake   chan struct{}
+}
+
+func NewBus() *Bus {
+	return &Bus{handlers: make(map[string][]Handler), wake: make(chan struct{}, 1)}
+}
+
+// Subscribe calls fn for every published event of type E.
+func Subscribe[E Event](b *Bus, fn func(E) error) {
+	var zero E
+	name := zero.EventName()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[name] = append(b.handlers[name], func(e Event) error {
+		return fn(e.(E))
+	})
+}
+
+// SubscribeAll calls fn for every published event.
+func (b *Bus) SubscribeAll(fn Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.all = append(b.all, fn)
+}
+
+// UseOutbox makes the services store events in the outbox for Relay to
+// dispatch instead of dispatching them directly.
+func (b *Bus) UseOutbox() {
+	b.outbox = true
+}
+
+// Outbox reports whether events go through the outbox. It is false on a
+// nil *Bus.
+func (b *Bus) Outbox() bool {
+	return b != nil && b.outbox
+}
+
+// Publish dispatches events to their handlers now, in order. It is a no-op
+// on a nil *Bus.
+func (b *Bus) Publish(events ...Event) {
+	if b == nil {
+		return
+	}
+	for _, event := range events {
+		b.mu.RLock()
+		handlers := append(append([]Handler(nil), b.handlers[event.EventName()]...), b.all...)
+		b.mu.RUnlock()
+
+		for _, handler := range handlers {
+			if err := handler(event); err != nil {
+				log.Printf("events: handler for %s failed: %v", event.EventName(), err)
+			}
+		}
+	}
+}
+
+// Encode turns events into outbox records to be stored with the change
+// they describe.
+func Encode(events ...Event) ([]models.OutboxEvent, error) {
+	records := make([]models.OutboxEvent, len(events))
+	for i, event := range events {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %w", event.EventName(), err)
+		}
+		records[i] = models.OutboxEvent{Name: event.EventName(), Payload: string(payload)}
+	}
+	return records, nil
+}
+
+// Decode turns an outbox record back into its event.
+func Decode(record *models.OutboxEvent) (Event, error) {
+	eventType, ok := registry[record.Name]
+	if !ok {
+		return nil, fmt.Errorf("unknown event %q", record.Name)
+	}
+	event := reflect.New(eventType)
+	if err := json.Unmarshal([]byte(record.Payload), event.Interface()); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", record.Name, err)
+	}
+	return event.Elem().Interface().(Event), nil
+}
+
+// Notify tells Relay that new events were stored, so it doesn't wait for
+// its next poll. It is a no-op on a nil *Bus.
+func (b *Bus) Notify() {
+	if b == nil {
+		return
+	}
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+// OutboxStore is where Relay reads committed events from.
+type OutboxStore interface {
+	// ClaimOutboxEvents hides up to limit unpublished events from other
+	// relays until until and returns them, oldest first.
+	ClaimOutboxEvents(now, until time.Time, limit int) ([]models.OutboxEvent, error)
+	MarkOutboxEventsPublished(ids []string, at time.Time) error
+}
+
+const (
+	relayBatchSize = 100
+	// relayClaimTTL is how long a claimed batch is hidden from other relays.
+	// A relay that dies mid-batch leaves it to be dispatched again, so
+	// handlers may see an event more than once.
+	relayClaimTTL = time.Minute
+)
+
+// Relay dispatches committed outbox events until ctx is cancelled, polling
+// every interval and waking early on Notify.
+func (b *Bus) Relay(ctx context.Context, store OutboxStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := b.RelayPending(store); err != nil && ctx.Err() == nil {
+			log.Printf("events: outbox relay failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-b.wake:
+		}
+	}
+}
+
+// RelayPending dispatches every unpublished outbox event and returns how
+// many it dispatched.
+func (b *Bus) RelayPending(store OutboxStore) (int, error) {
+	relayed := 0
+	for {
+		now := time.Now()
+		records, err := store.ClaimOutboxEvents(now, now.Add(relayClaimTTL), relayBatchSize)
+		if err != nil {
+			return relayed, err
+		}
+		if len(records) == 0 {
+			return relayed, nil
+		}
+
+		ids := make([]string, len(records))
+		for i := range records {
+			ids[i] = records[i].ID
+			event, err := Decode(&records[i])
+			if err != nil {
+				log.Printf("events: skipping outbox event %s: %v", records[i].ID, err)
+				continue
+			}
+			b.Publish(event)
+			relayed++
+		}
+		if err := store.MarkOutboxEventsPublished(ids, time.Now()); err != nil {
+			return relayed, err
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package events
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublishDispatchesByType(t *testing.T) {
+	bus := NewBus()
+	var signedUp []string
+	var all []string
+	Subscribe(bus, func(e UserSignedUp) error {
+		signedUp = append(signedUp, e.User.ID)
+		return errors.New("ignored")
+	})
+	bus.SubscribeAll(func(e Event) error {
+		all = append(all, e.EventName())
+		return nil
+	})
+
+	bus.Publish(UserSignedUp{User: models.UserSnapshot{ID: "user-1"}}, UserLoggedIn{User: models.UserSnapshot{ID: "user-1"}})
+
+	assert.Equal(t, []string{"user-1"}, signedUp)
+	assert.Equal(t, []string{"user.signed_up", "user.logged_in"}, all)
+
+	var nilBus *Bus
+	nilBus.Publish(UserSignedUp{})
+	assert.False(t, nilBus.Outbox())
+}
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	until := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	event := UserBlocked{
+		User:   models.UserSnapshot{ID: "user-1", Email: "john@example.com", IsBlocked: true},
+		Actor:  Actor{ID: "admin-1", Role: "admin"},
+		Reason: "spam",
+		Until:  &until,
+	}
+
+	records, err := Encode(event)
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+	assert.Equal(t, "user.blocked", records[0].Name)
+
+	decoded, err := Decode(&records[0])
+	assert.NoError(t, err)
+	assert.Equal(t, event, decoded)
+
+	_, err = Decode(&models.OutboxEvent{Name: "user.unknown", Payload: "{}"})
+	assert.Error(t, err)
+}
+
+type fakeOutbox struct {
+	records   []models.OutboxEvent
+	published map[string]bool
+}
+
+func (f *fakeOutbox) ClaimOutboxEvents(now, until time.Time, limit int) ([]models.OutboxEvent, error) {
+	var claimed []models.OutboxEvent
+	for _, record := range f.records {
+		if !f.published[record.ID] && len(claimed) < limit {
+			claimed = append(claimed, record)
+		}
+	}
+	return claimed, nil
+}
+
+func (f *fakeOutbox) MarkOutboxEventsPublished(ids []string, at time.Time) error {
+	for _, id := range ids {
+		f.published[id] = true
+	}
+	return nil
+}
+
+func TestRelayPendingDispatchesStoredEvents(t *testing.T) {
+	records, err := Encode(
+		UserSignedUp{User: models.UserSnapshot{ID: "user-1"}},
+		UserSignedUp{User: models.UserSnapshot{ID: "user-2"}},
+	)
+	assert.NoError(t, err)
+	records[0].ID, records[1].ID = "event-1", "event-2"
+	// An event this build doesn't know is skipped rather than blocking the
+	// ones after it.
+	records = append(records, models.OutboxEvent{ID: "event-3", Name: "user.unknown", Payload: "{}"})
+	store := &fakeOutbox{records: records, published: map[string]bool{}}
+
+	bus := NewBus()
+	var ids []string
+	Subscribe(bus, func(e UserSignedUp) error {
+		ids = append(ids, e.User.ID)
+		return nil
+	})
+
+	relayed, err := bus.RelayPending(store)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, relayed)
+	assert.Equal(t, []string{"user-1", "user-2"}, ids)
+	assert.Len(t, store.published, 3)
+
+	relayed, err = bus.RelayPending(store)
+	assert.NoError(t, err)
+	assert.Zero(t, relayed)
+}
@@ -0,0 +1,41 @@
+package events
+
+import (
+	"reflect"
+
+	"github.com/liju-github/user-management/internal/models"
+)
+
+// GroupMemberAdded is a user joining a group; Group.Role is their role in it.
+type GroupMemberAdded struct {
+	UserID string
+	Group  models.UserGroup
+	Actor  Actor
+}
+
+// GroupMemberRoleChanged is a member's role in a group changing from
+// Previous to Group.Role.
+type GroupMemberRoleChanged struct {
+	UserID   string
+	Group    models.UserGroup
+	Previous string
+	Actor    Actor
+}
+
+// GroupMemberRemoved is a user leaving a group, including when the group
+// is deleted.
+type GroupMemberRemoved struct {
+	UserID string
+	Group  models.UserGroup
+	Actor  Actor
+}
+
+func (GroupMemberAdded) EventName() string       { return "group.member_added" }
+func (GroupMemberRoleChanged) EventName() string { return "group.member_role_changed" }
+func (GroupMemberRemoved) EventName() string     { return "group.member_removed" }
+
+func init() {
+	for _, event := range []Event{GroupMemberAdded{}, GroupMemberRoleChanged{}, GroupMemberRemoved{}} {
+		registry[event.EventName()] = reflect.TypeOf(event)
+	}
+}
@@ -0,0 +1,22 @@
+package events
+
+import (
+	"reflect"
+
+	"github.com/liju-github/user-management/internal/models"
+)
+
+// IdentityLinked is a provider identity being linked to a user. Signup is
+// set when signing in with the identity created the account.
+type IdentityLinked struct {
+	User     models.UserSnapshot
+	Provider string
+	Email    string
+	Signup   bool
+}
+
+func (IdentityLinked) EventName() string { return "identity.linked" }
+
+func init() {
+	registry[IdentityLinked{}.EventName()] = reflect.TypeOf(IdentityLinked{})
+}
@@ -0,0 +1,37 @@
+package events
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/liju-github/user-management/internal/models"
+)
+
+// InvitationSent is an invitation link being issued, when an invitation is
+// created or resent. Organization and Group are names for the email.
+type InvitationSent struct {
+	InvitationID string
+	Email        string
+	Organization string
+	Group        string
+	Token        string
+	ExpiresAt    time.Time
+	Actor        Actor
+}
+
+// InvitationAccepted is someone signing up with an invitation; InvitedBy
+// sent it.
+type InvitationAccepted struct {
+	User         models.UserSnapshot
+	InvitationID string
+	InvitedBy    Actor
+}
+
+func (InvitationSent) EventName() string     { return "invitation.sent" }
+func (InvitationAccepted) EventName() string { return "invitation.accepted" }
+
+func init() {
+	for _, event := range []Event{InvitationSent{}, InvitationAccepted{}} {
+		registry[event.EventName()] = reflect.TypeOf(event)
+	}
+}
@@ -0,0 +1,138 @@
+package events
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/liju-github/user-management/internal/models"
+)
+
+// Actor identifies who caused an event.
+type Actor struct {
+	ID   string
+	Role string
+}
+
+// Reasons a password reset link is sent.
+const (
+	// ResetRequested is the user asking for a link themselves.
+	ResetRequested = "requested"
+	// ResetForced is an admin invalidating the password and sending a link.
+	ResetForced = "forced"
+	// ResetSentByAdmin is an admin sending a link while the password keeps
+	// working.
+	ResetSentByAdmin = "admin"
+)
+
+// UserSignedUp is a new account being created.
+type UserSignedUp struct {
+	User models.UserSnapshot
+}
+
+// SignupAttempted is someone trying to sign up with the email of an
+// existing account.
+type SignupAttempted struct {
+	User models.UserSnapshot
+}
+
+// UserLoggedIn is a successful sign-in.
+type UserLoggedIn struct {
+	User models.UserSnapshot
+}
+
+// VerificationRequested is a new email verification token being issued.
+type VerificationRequested struct {
+	User  models.UserSnapshot
+	Token string
+}
+
+type UserVerified struct {
+	User  models.UserSnapshot
+	Actor Actor
+}
+
+type UserUnverified struct {
+	User  models.UserSnapshot
+	Actor Actor
+}
+
+// PasswordResetRequested is a password reset token being issued; Reason is
+// one of the Reset constants.
+type PasswordResetRequested struct {
+	User   models.UserSnapshot
+	Actor  Actor
+	Reason string
+	Token  string
+}
+
+type UserBlocked struct {
+	User   models.UserSnapshot
+	Actor  Actor
+	Reason string
+	Until  *time.Time
+}
+
+// UserUnblocked is a block being lifted, by an admin or by running out.
+type UserUnblocked struct {
+	User  models.UserSnapshot
+	Actor Actor
+}
+
+// ProfileUpdated lists the profile fields that changed.
+type ProfileUpdated struct {
+	User   models.UserSnapshot
+	Actor  Actor
+	Fields []string
+}
+
+type AccountDeletionScheduled struct {
+	User        models.UserSnapshot
+	ScheduledAt time.Time
+}
+
+type AccountDeletionCancelled struct {
+	User models.UserSnapshot
+}
+
+// UserDeleted is an account being deleted. Purged is set when it was
+// removed for good rather than soft-deleted.
+type UserDeleted struct {
+	User   models.UserSnapshot
+	Actor  Actor
+	Purged bool
+}
+
+type UserRestored struct {
+	User  models.UserSnapshot
+	Actor Actor
+}
+
+func (UserSignedUp) EventName() string             { return "user.signed_up" }
+func (SignupAttempted) EventName() string          { return "user.signup_attempted" }
+func (UserLoggedIn) EventName() string             { return "user.logged_in" }
+func (VerificationRequested) EventName() string    { return "user.verification_requested" }
+func (UserVerified) EventName() string             { return "user.verified" }
+func (UserUnverified) EventName() string           { return "user.unverified" }
+func (PasswordResetRequested) EventName() string   { return "user.password_reset_requested" }
+func (UserBlocked) EventName() string              { return "user.blocked" }
+func (UserUnblocked) EventName() string            { return "user.unblocked" }
+func (ProfileUpdated) EventName() string           { return "user.profile_updated" }
+func (AccountDeletionScheduled) EventName() string { return "user.deletion_scheduled" }
+func (AccountDeletionCancelled) EventName() string { return "user.deletion_cancelled" }
+func (UserDeleted) EventName() string              { return "user.deleted" }
+func (UserRestored) EventName() string             { return "user.restored" }
+
+// registry maps event names to their types so outbox records can be
+// decoded.
+var registry = map[string]reflect.Type{}
+
+func init() {
+	for _, event := range []Event{
+		UserSignedUp{}, SignupAttempted{}, UserLoggedIn{}, VerificationRequested{},
+		UserVerified{}, UserUnverified{}, PasswordResetRequested{}, UserBlocked{},
+		UserUnblocked{}, ProfileUpdated{}, AccountDeletionScheduled{},
+		AccountDeletionCancelled{}, UserDeleted{}, UserRestored{},
+	} {
+		registry[event.EventName()] = reflect.TypeOf(event)
+	}
+}
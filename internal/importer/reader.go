@@ -0,0 +1,188 @@
+// Package importer reads user records for bulk import from CSV or NDJSON.
+package importer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Supported input formats.
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// ErrUnknownFormat is returned for formats other than CSV and NDJSON.
+var ErrUnknownFormat = errors.New("unknown import format")
+
+// Record is one user read from the input. Line is the 1-based line it
+// started on, for reporting.
+type Record struct {
+	Line         int    `json:"-"`
+	Name         string `json:"name"`
+	Email        string `json:"email"`
+	Phone        string `json:"phone"`
+	Age          string `json:"age"`
+	Gender       string `json:"gender"`
+	Address      string `json:"address"`
+	PasswordHash string `json:"password_hash"`
+}
+
+// RecordError reports a line that could not be parsed at all. Reading can
+// continue with the next record.
+type RecordError struct {
+	Line int
+	Err  error
+}
+
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *RecordError) Unwrap() error { return e.Err }
+
+// Reader returns records one at a time. Next returns io.EOF after the last
+// record and a *RecordError for a malformed one.
+type Reader interface {
+	Next() (Record, error)
+}
+
+// NewReader returns a Reader for the given format. CSV input must start with
+// a header row naming its columns: name, email, phone, age, gender, address
+// and optionally password_hash, in any order.
+func NewReader(r io.Reader, format string) (Reader, error) {
+	switch strings.ToLower(format) {
+	case FormatCSV:
+		return newCSVReader(r)
+	case FormatNDJSON, "jsonl":
+		return &ndjsonReader{scanner: newLineScanner(r)}, nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+// FormatFromFilename guesses the format from a file extension.
+func FormatFromFilename(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".csv"):
+		return FormatCSV
+	case strings.HasSuffix(lower, ".ndjson"), strings.HasSuffix(lower, ".jsonl"):
+		return FormatNDJSON
+	}
+	return ""
+}
+
+var csvColumns = []string{"name", "email", "phone", "age", "gender", "address", "password_hash"}
+
+type csvReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		columns[name] = i
+	}
+	for _, required := range csvColumns[:6] {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("CSV header is missing the %q column", required)
+		}
+	}
+	return &csvReader{reader: reader, columns: columns}, nil
+}
+
+func (c *csvReader) Next() (Record, error) {
+	fields, err := c.reader.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return Record{}, &RecordError{Line: parseErr.StartLine, Err: parseErr.Err}
+		}
+		return Record{}, err
+	}
+	line, _ := c.reader.FieldPos(0)
+
+	field := func(name string) string {
+		if i, ok := c.columns[name]; ok && i < len(fields) {
+			return strings.TrimSpace(fields[i])
+		}
+		return ""
+	}
+	return Record{
+		Line:         line,
+		Name:         field("name"),
+		Email:        field("email"),
+		Phone:        field("phone"),
+		Age:          field("age"),
+		Gender:       field("gender"),
+		Address:      field("address"),
+		PasswordHash: field("password_hash"),
+	}, nil
+}
+
+type ndjsonReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return scanner
+}
+
+func (n *ndjsonReader) Next() (Record, error) {
+	for n.scanner.Scan() {
+		n.line++
+		line := strings.TrimSpace(n.scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var raw map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &raw); err != nil {
+			return Record{}, &RecordError{Line: n.line, Err: err}
+		}
+		field := func(name string) string {
+			switch v := raw[name].(type) {
+			case string:
+				return strings.TrimSpace(v)
+			case float64:
+				return strconv.FormatFloat(v, 'f', -1, 64)
+			}
+			return ""
+		}
+		return Record{
+			Line:         n.line,
+			Name:         field("name"),
+			Email:        field("email"),
+			Phone:        field("phone"),
+			Age:          field("age"),
+			Gender:       field("gender"),
+			Address:      field("address"),
+			PasswordHash: field("password_hash"),
+		}, nil
+	}
+	if err := n.scanner.Err(); err != nil {
+		return Record{}, err
+	}
+	return Record{}, io.EOF
+}
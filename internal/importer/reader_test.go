@@ -0,0 +1,66 @@
+package importer
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readAll(t *testing.T, r Reader) ([]Record, []int) {
+	var records []Record
+	var badLines []int
+	for {
+		record, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return records, badLines
+		}
+		var recordErr *RecordError
+		if errors.As(err, &recordErr) {
+			badLines = append(badLines, recordErr.Line)
+			continue
+		}
+		assert.NoError(t, err)
+		records = append(records, record)
+	}
+}
+
+func TestCSVReader(t *testing.T) {
+	input := "\ufeffEmail, Name,phone,age,gender,address\n" +
+		"alice@example.com,Alice,9876543210,30,Female,\"1 Main Street, Town\"\n" +
+		"bob@example.com,Bob,9876543211,41,Male,2 High Street\n"
+
+	r, err := NewReader(strings.NewReader(input), "CSV")
+	assert.NoError(t, err)
+	records, bad := readAll(t, r)
+	assert.Empty(t, bad)
+	assert.Len(t, records, 2)
+	assert.Equal(t, Record{Line: 2, Name: "Alice", Email: "alice@example.com", Phone: "9876543210", Age: "30", Gender: "Female", Address: "1 Main Street, Town"}, records[0])
+	assert.Equal(t, 3, records[1].Line)
+
+	_, err = NewReader(strings.NewReader("name,email\n"), FormatCSV)
+	assert.ErrorContains(t, err, `"phone"`)
+}
+
+func TestNDJSONReader(t *testing.T) {
+	input := `{"name":"Alice","email":"alice@example.com","age":30,"phone":9876543210,"password_hash":"$2a$10$x"}
+
+{"name":
+{"name":"Bob","email":"bob@example.com"}
+`
+	r, err := NewReader(strings.NewReader(input), "jsonl")
+	assert.NoError(t, err)
+	records, bad := readAll(t, r)
+	assert.Equal(t, []int{3}, bad)
+	assert.Len(t, records, 2)
+	assert.Equal(t, "30", records[0].Age)
+	assert.Equal(t, "9876543210", records[0].Phone)
+	assert.Equal(t, "$2a$10$x", records[0].PasswordHash)
+	assert.Equal(t, 4, records[1].Line)
+
+	_, err = NewReader(strings.NewReader(input), "xml")
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+	assert.Equal(t, FormatNDJSON, FormatFromFilename("Users.JSONL"))
+}
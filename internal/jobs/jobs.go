@@ -0,0 +1,27 @@
+// Package jobs runs periodic background work.
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Every runs fn immediately and then once per interval until ctx is
+// cancelled. Errors are logged and never stop the schedule.
+func Every(ctx context.Context, name string, interval time.Duration, fn func(context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := fn(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("job %s failed: %v", name, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
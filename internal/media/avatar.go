@@ -0,0 +1,139 @@
+package media
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"unicode"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+// AvatarSizes are the square variants generated for every uploaded avatar,
+// in pixels.
+var AvatarSizes = []int{64, 128, 512}
+
+// MaxPixels bounds the decoded size of an upload so a small, highly
+// compressed file can't exhaust memory.
+const MaxPixels = 40_000_000
+
+const avatarQuality = 85
+
+// Decode decodes a JPEG, PNG or WebP image after checking its dimensions
+// against MaxPixels.
+func Decode(data []byte, contentType string) (image.Image, error) {
+	var (
+		decodeConfig func([]byte) (image.Config, error)
+		decode       func([]byte) (image.Image, error)
+	)
+	switch contentType {
+	case TypeJPEG:
+		decodeConfig = func(b []byte) (image.Config, error) { return jpeg.DecodeConfig(bytes.NewReader(b)) }
+		decode = func(b []byte) (image.Image, error) { return jpeg.Decode(bytes.NewReader(b)) }
+	case TypePNG:
+		decodeConfig = func(b []byte) (image.Config, error) { return png.DecodeConfig(bytes.NewReader(b)) }
+		decode = func(b []byte) (image.Image, error) { return png.Decode(bytes.NewReader(b)) }
+	case TypeWebP:
+		decodeConfig = func(b []byte) (image.Config, error) { return webp.DecodeConfig(bytes.NewReader(b)) }
+		decode = func(b []byte) (image.Image, error) { return webp.Decode(bytes.NewReader(b)) }
+	default:
+		return nil, ErrUnsupportedType
+	}
+
+	cfg, err := decodeConfig(data)
+	if err != nil || cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > MaxPixels {
+		return nil, ErrCorruptImage
+	}
+	img, err := decode(data)
+	if err != nil {
+		return nil, ErrCorruptImage
+	}
+	return img, nil
+}
+
+// AvatarVariant renders img as a size×size JPEG, center-cropping it to a
+// square first. Transparent areas are composited onto white.
+func AvatarVariant(img image.Image, size int) ([]byte, error) {
+	bounds := img.Bounds()
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+	crop := image.Rect(0, 0, side, side).Add(image.Pt(
+		bounds.Min.X+(bounds.Dx()-side)/2,
+		bounds.Min.Y+(bounds.Dy()-side)/2,
+	))
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, crop, draw.Over, nil)
+
+	return EncodeJPEG(dst)
+}
+
+// EncodeJPEG encodes img as a JPEG at the quality used for avatars. The
+// result carries no metadata.
+func EncodeJPEG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: avatarQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// avatarPalette holds the background colours for generated avatars.
+var avatarPalette = []string{
+	"#1abc9c", "#2ecc71", "#3498db", "#9b59b6", "#34495e",
+	"#16a085", "#27ae60", "#2980b9", "#8e44ad", "#e67e22",
+	"#e74c3c", "#d35400", "#c0392b", "#7f8c8d",
+}
+
+// Initials returns up to two upper-case initials for name: the first letter
+// of the first and last words.
+func Initials(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return "?"
+	}
+
+	initials := []rune{firstRune(words[0])}
+	if len(words) > 1 {
+		initials = append(initials, firstRune(words[len(words)-1]))
+	}
+	return strings.ToUpper(string(initials))
+}
+
+func firstRune(s string) rune {
+	for _, r := range s {
+		return r
+	}
+	return '?'
+}
+
+// InitialsAvatar renders a square SVG avatar showing initials on a
+// background colour derived from the initials themselves, so the same
+// initials always get the same colour.
+func InitialsAvatar(initials string, size int) []byte {
+	var hash uint32 = 2166136261
+	for i := 0; i < len(initials); i++ {
+		hash ^= uint32(initials[i])
+		hash *= 16777619
+	}
+	background := avatarPalette[hash%uint32(len(avatarPalette))]
+
+	return []byte(fmt.Sprintf(
+		`<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="%[1]d" viewBox="0 0 100 100">`+
+			`<rect width="100" height="100" fill="%[2]s"/>`+
+			`<text x="50" y="50" dy=".35em" text-anchor="middle" fill="#ffffff" `+
+			`font-family="Helvetica, Arial, sans-serif" font-size="42">%[3]s</text></svg>`,
+		size, background, html.EscapeString(initials),
+	))
+}
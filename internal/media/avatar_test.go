@@ -0,0 +1,94 @@
+package media
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAvatarVariantCropsToSquare(t *testing.T) {
+	// A wide image whose left and right thirds are black: the center crop
+	// should keep only the white middle.
+	src := image.NewRGBA(image.Rect(0, 0, 300, 100))
+	for x := 100; x < 200; x++ {
+		for y := 0; y < 100; y++ {
+			src.Set(x, y, color.White)
+		}
+	}
+	var encoded bytes.Buffer
+	assert.NoError(t, png.Encode(&encoded, src))
+
+	decoded, err := Decode(encoded.Bytes(), TypePNG)
+	assert.NoError(t, err)
+
+	for _, size := range AvatarSizes {
+		variant, err := AvatarVariant(decoded, size)
+		assert.NoError(t, err)
+
+		img, err := jpeg.Decode(bytes.NewReader(variant))
+		assert.NoError(t, err)
+		assert.Equal(t, image.Rect(0, 0, size, size), img.Bounds())
+		r, g, b, _ := img.At(2, size/2).RGBA()
+		assert.Greater(t, r+g+b, uint32(3*0xf000))
+	}
+}
+
+func TestDecodeRejectsCorruptImages(t *testing.T) {
+	_, err := Decode([]byte("\x89PNG\r\n\x1a\ngarbage"), TypePNG)
+	assert.ErrorIs(t, err, ErrCorruptImage)
+}
+
+func TestInitials(t *testing.T) {
+	assert.Equal(t, "JD", Initials("john doe"))
+	assert.Equal(t, "JS", Initials("Jane Q. Smith"))
+	assert.Equal(t, "C", Initials("cher"))
+	assert.Equal(t, "?", Initials("  "))
+}
+
+// exifJPEG encodes img as a JPEG with an EXIF segment that carries only the
+// orientation tag, as a phone camera would write it.
+func exifJPEG(t *testing.T, img image.Image, orientation uint16) []byte {
+	t.Helper()
+	var encoded bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&encoded, img, nil))
+
+	tiff := []byte{'M', 'M', 0, 42, 0, 0, 0, 8, // header, IFD0 at offset 8
+		0, 1, // one entry
+		0x01, 0x12, 0, 3, 0, 0, 0, 1, byte(orientation >> 8), byte(orientation), 0, 0, // orientation, SHORT
+		0, 0, 0, 0} // no next IFD
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := append([]byte{0xFF, 0xE1, byte((len(payload) + 2) >> 8), byte(len(payload) + 2)}, payload...)
+	return append(append([]byte{0xFF, 0xD8}, segment...), encoded.Bytes()[2:]...)
+}
+
+func TestOrientTurnsPortraitPhotosUpright(t *testing.T) {
+	// Stored sideways: the top of the scene is on the left, in white.
+	src := image.NewGray(image.Rect(0, 0, 200, 100))
+	for x := 0; x < 100; x++ {
+		for y := 0; y < 100; y++ {
+			src.Set(x, y, color.White)
+		}
+	}
+	data := exifJPEG(t, src, 6)
+	assert.Equal(t, 6, JPEGOrientation(data))
+
+	stripped, err := StripMetadata(data, TypeJPEG)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, JPEGOrientation(stripped))
+	decoded, err := Decode(stripped, TypeJPEG)
+	assert.NoError(t, err)
+
+	upright := Orient(decoded, 6)
+	assert.Equal(t, image.Rect(0, 0, 100, 200), upright.Bounds())
+	top, _, _, _ := upright.At(50, 20).RGBA()
+	bottom, _, _, _ := upright.At(50, 180).RGBA()
+	assert.Greater(t, top, uint32(0xf000))
+	assert.Less(t, bottom, uint32(0x1000))
+
+	assert.Equal(t, 1, JPEGOrientation([]byte{0xFF, 0xD8, 0xFF, 0xE1, 0x00, 0x0A, 'E', 'x', 'i', 'f', 0, 0, 'G', 'P'}))
+}
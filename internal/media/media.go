@@ -0,0 +1,197 @@
+// Package media inspects and sanitises uploaded images.
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net/http"
+)
+
+// Supported image content types.
+const (
+	TypeJPEG = "image/jpeg"
+	TypePNG  = "image/png"
+	TypeWebP = "image/webp"
+)
+
+var (
+	// ErrUnsupportedType is returned for content that is not a JPEG, PNG or
+	// WebP image.
+	ErrUnsupportedType = errors.New("unsupported image type")
+	// ErrCorruptImage is returned when an image's container can't be parsed.
+	ErrCorruptImage = errors.New("corrupt image")
+)
+
+// Extensions maps supported content types to file extensions.
+var Extensions = map[string]string{
+	TypeJPEG: ".jpg",
+	TypePNG:  ".png",
+	TypeWebP: ".webp",
+}
+
+// Sniff detects the content type from the data itself, ignoring whatever
+// the client claimed, and rejects anything but JPEG, PNG and WebP.
+func Sniff(data []byte) (string, error) {
+	contentType := http.DetectContentType(data)
+	if _, ok := Extensions[contentType]; !ok {
+		return "", ErrUnsupportedType
+	}
+	return contentType, nil
+}
+
+// StripMetadata removes EXIF, XMP, IPTC and text metadata from an image
+// without re-encoding its pixels.
+func StripMetadata(data []byte, contentType string) ([]byte, error) {
+	switch contentType {
+	case TypeJPEG:
+		return stripJPEG(data)
+	case TypePNG:
+		return stripPNG(data)
+	case TypeWebP:
+		return stripWebP(data)
+	}
+	return nil, ErrUnsupportedType
+}
+
+// stripJPEG drops APPn segments other than APP0 (JFIF), APP2 (ICC profile)
+// and APP14 (Adobe colour transform), plus comments.
+func stripJPEG(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, ErrCorruptImage
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+
+	for i := 2; i < len(data); {
+		if data[i] != 0xFF || i+1 >= len(data) {
+			return nil, ErrCorruptImage
+		}
+		marker := data[i+1]
+
+		// Fill bytes and standalone markers carry no length.
+		if marker == 0xFF {
+			i++
+			continue
+		}
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			out.Write(data[i : i+2])
+			i += 2
+			continue
+		}
+
+		// Start of scan: the rest is entropy-coded image data.
+		if marker == 0xDA {
+			out.Write(data[i:])
+			return out.Bytes(), nil
+		}
+
+		if i+4 > len(data) {
+			return nil, ErrCorruptImage
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:i+4]))
+		if end > len(data) {
+			return nil, ErrCorruptImage
+		}
+
+		isApp := marker >= 0xE0 && marker <= 0xEF
+		keep := !isApp || marker == 0xE0 || marker == 0xE2 || marker == 0xEE
+		if marker == 0xFE { // COM
+			keep = false
+		}
+		if keep {
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+
+	return out.Bytes(), nil
+}
+
+var pngSignature = []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1A, '\n'}
+
+// pngMetadataChunks are ancillary chunks that can carry personal data.
+var pngMetadataChunks = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, ErrCorruptImage
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(pngSignature)
+
+	for i := len(pngSignature); i < len(data); {
+		if i+8 > len(data) {
+			return nil, ErrCorruptImage
+		}
+		length := int(binary.BigEndian.Uint32(data[i : i+4]))
+		chunkType := string(data[i+4 : i+8])
+		end := i + 12 + length // length, type, data, CRC
+		if length < 0 || end > len(data) {
+			return nil, ErrCorruptImage
+		}
+
+		if !pngMetadataChunks[chunkType] {
+			out.Write(data[i:end])
+		}
+		i = end
+
+		if chunkType == "IEND" {
+			break
+		}
+	}
+
+	return out.Bytes(), nil
+}
+
+// stripWebP drops the EXIF and XMP chunks of an extended (VP8X) WebP and
+// clears their flags.
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, ErrCorruptImage
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:12])
+
+	for i := 12; i < len(data); {
+		if i+8 > len(data) {
+			return nil, ErrCorruptImage
+		}
+		fourCC := string(data[i : i+4])
+		size := int(binary.LittleEndian.Uint32(data[i+4 : i+8]))
+		end := i + 8 + size + size%2 // chunks are padded to even sizes
+		if end > len(data) {
+			if i+8+size == len(data) {
+				end = len(data)
+			} else {
+				return nil, ErrCorruptImage
+			}
+		}
+
+		switch fourCC {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte(nil), data[i:end]...)
+			if len(chunk) > 8 {
+				chunk[8] &^= 0x08 | 0x04 // EXIF and XMP flags
+			}
+			out.Write(chunk)
+		default:
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+
+	result := out.Bytes()
+	binary.LittleEndian.PutUint32(result[4:8], uint32(len(result)-8))
+	return result, nil
+}
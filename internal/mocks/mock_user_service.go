@@ -11,8 +11,10 @@ package mocks
 
 import (
 	reflect "reflect"
+	time "time"
 
 	models "github.com/liju-github/user-management/internal/models"
+	services "github.com/liju-github/user-management/internal/services"
 	gomock "github.com/golang/mock/gomock" )
 
 // MockIUserService is a mock of IUserService interface.
@@ -39,6 +41,34 @@ func (m *MockIUserService) EXPECT() *MockIUserServiceMockRecorder {
 	return m.recorder
 }
 
+// AvatarURLs mocks base method.
+func (m *MockIUserService) AvatarURLs(user *models.User) map[string]string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AvatarURLs", user)
+	ret0, _ := ret[0].(map[string]string)
+	return ret0
+}
+
+// AvatarURLs indicates an expected call of AvatarURLs.
+func (mr *MockIUserServiceMockRecorder) AvatarURLs(user any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AvatarURLs", reflect.TypeOf((*MockIUserService)(nil).AvatarURLs), user)
+}
+
+// ChangePassword mocks base method.
+func (m *MockIUserService) ChangePassword(userID, currentPassword, newPassword string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ChangePassword", userID, currentPassword, newPassword)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ChangePassword indicates an expected call of ChangePassword.
+func (mr *MockIUserServiceMockRecorder) ChangePassword(userID, currentPassword, newPassword any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangePassword", reflect.TypeOf((*MockIUserService)(nil).ChangePassword), userID, currentPassword, newPassword)
+}
+
 // ConfirmPasswordReset mocks base method.
 func (m *MockIUserService) ConfirmPasswordReset(token, newPassword string) error {
 	m.ctrl.T.Helper()
@@ -53,6 +83,20 @@ func (mr *MockIUserServiceMockRecorder) ConfirmPasswordReset(token, newPassword
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConfirmPasswordReset", reflect.TypeOf((*MockIUserService)(nil).ConfirmPasswordReset), token, newPassword)
 }
 
+// ForOrganization mocks base method.
+func (m *MockIUserService) ForOrganization(organizationID string) services.IUserService {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ForOrganization", organizationID)
+	ret0, _ := ret[0].(services.IUserService)
+	return ret0
+}
+
+// ForOrganization indicates an expected call of ForOrganization.
+func (mr *MockIUserServiceMockRecorder) ForOrganization(organizationID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ForOrganization", reflect.TypeOf((*MockIUserService)(nil).ForOrganization), organizationID)
+}
+
 // GetProfile mocks base method.
 func (m *MockIUserService) GetProfile(userID string) (*models.User, error) {
 	m.ctrl.T.Helper()
@@ -68,6 +112,21 @@ func (mr *MockIUserServiceMockRecorder) GetProfile(userID any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProfile", reflect.TypeOf((*MockIUserService)(nil).GetProfile), userID)
 }
 
+// GetSecurityHistory mocks base method.
+func (m *MockIUserService) GetSecurityHistory(userID string) (*models.SecurityHistoryResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSecurityHistory", userID)
+	ret0, _ := ret[0].(*models.SecurityHistoryResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSecurityHistory indicates an expected call of GetSecurityHistory.
+func (mr *MockIUserServiceMockRecorder) GetSecurityHistory(userID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSecurityHistory", reflect.TypeOf((*MockIUserService)(nil).GetSecurityHistory), userID)
+}
+
 // Login mocks base method.
 func (m *MockIUserService) Login(email, password string) (*models.User, error) {
 	m.ctrl.T.Helper()
@@ -111,6 +170,21 @@ func (mr *MockIUserServiceMockRecorder) RequestPasswordReset(email any) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RequestPasswordReset", reflect.TypeOf((*MockIUserService)(nil).RequestPasswordReset), email)
 }
 
+// RequestAccountDeletion mocks base method.
+func (m *MockIUserService) RequestAccountDeletion(userID, password string) (time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RequestAccountDeletion", userID, password)
+	ret0, _ := ret[0].(time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RequestAccountDeletion indicates an expected call of RequestAccountDeletion.
+func (mr *MockIUserServiceMockRecorder) RequestAccountDeletion(userID, password any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RequestAccountDeletion", reflect.TypeOf((*MockIUserService)(nil).RequestAccountDeletion), userID, password)
+}
+
 // ResendVerification mocks base method.
 func (m *MockIUserService) ResendVerification(email string) error {
 	m.ctrl.T.Helper()
@@ -139,6 +213,21 @@ func (mr *MockIUserServiceMockRecorder) Signup(user any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Signup", reflect.TypeOf((*MockIUserService)(nil).Signup), user)
 }
 
+// StartSession mocks base method.
+func (m *MockIUserService) StartSession(userID, userAgent, ipAddress string, ttl time.Duration) (*models.Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StartSession", userID, userAgent, ipAddress, ttl)
+	ret0, _ := ret[0].(*models.Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// StartSession indicates an expected call of StartSession.
+func (mr *MockIUserServiceMockRecorder) StartSession(userID, userAgent, ipAddress, ttl any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StartSession", reflect.TypeOf((*MockIUserService)(nil).StartSession), userID, userAgent, ipAddress, ttl)
+}
+
 // UpdateProfile mocks base method.
 func (m *MockIUserService) UpdateProfile(userID, email string, req *models.UserUpdateRequest) error {
 	m.ctrl.T.Helper()
@@ -154,17 +243,18 @@ func (mr *MockIUserServiceMockRecorder) UpdateProfile(userID, email, req any) *g
 }
 
 // UploadProfilePicture mocks base method.
-func (m *MockIUserService) UploadProfilePicture(userID, cdnURL string) error {
+func (m *MockIUserService) UploadProfilePicture(userID string, image []byte) (string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UploadProfilePicture", userID, cdnURL)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret := m.ctrl.Call(m, "UploadProfilePicture", userID, image)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // UploadProfilePicture indicates an expected call of UploadProfilePicture.
-func (mr *MockIUserServiceMockRecorder) UploadProfilePicture(userID, cdnURL any) *gomock.Call {
+func (mr *MockIUserServiceMockRecorder) UploadProfilePicture(userID, image any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadProfilePicture", reflect.TypeOf((*MockIUserService)(nil).UploadProfilePicture), userID, cdnURL)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UploadProfilePicture", reflect.TypeOf((*MockIUserService)(nil).UploadProfilePicture), userID, image)
 }
 
 // VerifyEmail mocks base method.
@@ -10,19 +10,54 @@ import (
 type Admin struct {
 	ID        string `gorm:"type:char(36);primaryKey" json:"id"` 
 	Name      string `gorm:"type:varchar(100);not null" json:"name"`
-	Email     string `gorm:"type:varchar(255);unique;not null" json:"email"`
+	Email     string `gorm:"type:varchar(255);not null;uniqueIndex:idx_admins_org_email,priority:2" json:"email"`
 	Password  string `gorm:"type:varchar(100);not null" json:"password"`
 	CreatedAt int64  `json:"created_at"` 
+	// Permissions grants access beyond what every admin has. They are
+	// assigned directly in the database.
+	Permissions []string `gorm:"serializer:json;type:text" json:"permissions"`
+	// OrganizationID is the tenant whose users the admin manages.
+	OrganizationID string `gorm:"type:char(36);not null;default:'00000000-0000-0000-0000-000000000000';uniqueIndex:idx_admins_org_email,priority:1" json:"organization_id"`
+	// SuperAdmin lets the admin manage organizations and the users of every
+	// organization.
+	SuperAdmin bool `gorm:"default:false" json:"super_admin"`
+}
+
+// Admin permissions.
+const (
+	// PermissionViewPII shows personal data unmasked in user exports.
+	PermissionViewPII = "users:view_pii"
+	// PermissionManageCredentials allows sending reset links, requiring a
+	// password change and revoking a user's sessions.
+	PermissionManageCredentials = "users:manage_credentials"
+	// PermissionVerifyUsers allows marking emails verified or unverified.
+	PermissionVerifyUsers = "users:verify"
+	// PermissionManageWebhooks allows registering webhook endpoints, which
+	// receive users' personal data, and replaying their deliveries.
+	PermissionManageWebhooks = "webhooks:manage"
+)
+
+// HasPermission reports whether the admin has been granted permission.
+func (a *Admin) HasPermission(permission string) bool {
+	for _, p := range a.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
 }
 
 type AdminRequest struct {
-	Email    string `gorm:"type:varchar(255);unique;not null" json:"email"`
-	Password string `json:"password"`
+	Email    string `gorm:"type:varchar(255);unique;not null" json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
 }
 
 
 func (a *Admin) BeforeCreate(tx *gorm.DB) (err error) {
 	a.ID = uuid.New().String()      
+	if a.OrganizationID == "" {
+		a.OrganizationID = DefaultOrganizationID
+	}
 	a.CreatedAt = time.Now().Unix() 
 	return nil
 }
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Audit actions recorded against a user.
+const (
+	AuditPasswordChanged          = "password.changed"
+	AuditPasswordReset            = "password.reset"
+	AuditAccountDeletionRequested = "account.deletion_requested"
+	AuditAccountDeletionCancelled = "account.deletion_cancelled"
+	AuditDataExportRequested      = "data_export.requested"
+	AuditUserDeleted              = "user.deleted"
+	AuditUserRestored             = "user.restored"
+	AuditUserPurged               = "user.purged"
+	AuditUserBlocked              = "user.blocked"
+	AuditUserUnblocked            = "user.unblocked"
+	AuditUserVerified             = "user.verified"
+	AuditPasswordResetForced      = "password.reset_forced"
+	AuditProfileUpdated           = "profile.updated"
+	AuditImpersonationStarted     = "impersonation.started"
+	AuditImpersonatedRequest      = "impersonation.request"
+	AuditUserUnverified           = "user.unverified"
+	AuditPasswordResetSent        = "password.reset_sent"
+	AuditPasswordChangeRequired   = "password.change_required"
+	AuditSessionsRevoked          = "sessions.revoked"
+	AuditGroupMemberAdded         = "group.member_added"
+	AuditGroupRoleChanged         = "group.role_changed"
+	AuditGroupMemberRemoved       = "group.member_removed"
+	AuditInvitationAccepted       = "invitation.accepted"
+	AuditIdentityLinked           = "identity.linked"
+)
+
+// Actor roles recorded on audit events.
+const (
+	ActorUser   = "user"
+	ActorAdmin  = "admin"
+	ActorSystem = "system"
+)
+
+// AuditEvent records a security-relevant action taken on a user's account.
+// UserID is the account affected; ActorID and ActorRole identify who acted.
+type AuditEvent struct {
+	ID        string    `gorm:"type:char(36);primaryKey" json:"id"`
+	UserID    string    `gorm:"type:char(36);not null;index" json:"user_id"`
+	ActorID   string    `gorm:"type:char(36)" json:"actor_id,omitempty"`
+	ActorRole string    `gorm:"type:varchar(20);not null" json:"actor_role"`
+	Action    string    `gorm:"type:varchar(64);not null;index" json:"action"`
+	Details   string    `gorm:"type:text" json:"details,omitempty"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
+
+func (e *AuditEvent) BeforeCreate(tx *gorm.DB) (err error) {
+	e.ID = uuid.New().String()
+
+	return nil
+}
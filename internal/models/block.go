@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Reason codes an admin can give for blocking a user.
+const (
+	BlockReasonSpam           = "spam"
+	BlockReasonAbuse          = "abuse"
+	BlockReasonFraud          = "fraud"
+	BlockReasonSecurity       = "security"
+	BlockReasonTermsViolation = "terms_violation"
+	BlockReasonOther          = "other"
+)
+
+// UserBlock is one entry in a user's block history. A block is active until
+// it is lifted by an admin or its Until time passes, whichever comes first.
+type UserBlock struct {
+	ID        string     `gorm:"type:char(36);primaryKey" json:"id"`
+	UserID    string     `gorm:"type:char(36);not null;index" json:"user_id"`
+	Reason    string     `gorm:"type:varchar(50);not null" json:"reason"`
+	Note      string     `gorm:"type:text" json:"note,omitempty"`
+	BlockedBy string     `gorm:"type:char(36)" json:"blocked_by"`
+	Until     *time.Time `json:"until,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	LiftedAt  *time.Time `json:"lifted_at,omitempty"`
+	LiftedBy  string     `gorm:"type:char(36)" json:"lifted_by,omitempty"`
+}
+
+func (b *UserBlock) BeforeCreate(tx *gorm.DB) (err error) {
+	b.ID = uuid.New().String()
+
+	return nil
+}
+
+type BlockUserRequest struct {
+	Reason string     `json:"reason" validate:"required,oneof=spam abuse fraud security terms_violation other"`
+	Note   string     `json:"note" validate:"max=1000"`
+	Until  *time.Time `json:"until"`
+}
@@ -14,12 +14,8 @@ const (
 	ProfileUpdatedSuccessfully         = "Profile updated successfully"
 	ProfilePictureUploadedSuccessfully = "Profile picture uploaded successfully"
 	SignupSuccessful                   = "User signed up successfully!"
-	MinPasswordLength                  = 8
-	MaxPasswordLength                  = 72
-	ErrRequiredFieldsEmpty             = "required fields cannot be empty"
-	ErrInvalidEmailFormat              = "invalid email format"
-	ErrNegativeAge                     = "age must be positive"
-	ErrPasswordComplexity              = "password must contain at least one uppercase letter, one lowercase letter, one number, and one special character"
-	ErrPasswordLength                  = "password must be between %d and %d characters"
+	AccountDeletionScheduled    = "Account deletion scheduled"
+	DataExportStarted           = "Data export started; a download link will be emailed when it is ready"
+	PasswordChangedSuccessfully        = "Password changed successfully"
 	InvalidID = "Unauthorized or invalid user ID"
 )
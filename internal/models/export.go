@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Data export statuses.
+const (
+	ExportPending = "pending"
+	ExportRunning = "running"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+// DataExport tracks a personal data export requested by a user or by an
+// admin on their behalf.
+type DataExport struct {
+	ID            string     `gorm:"type:char(36);primaryKey" json:"id"`
+	UserID        string     `gorm:"type:char(36);not null;index" json:"user_id"`
+	RequestedBy   string     `gorm:"type:char(36)" json:"requested_by"`
+	Status        string     `gorm:"type:varchar(20);not null" json:"status"`
+	StorageKey    string     `gorm:"type:varchar(255)" json:"-"`
+	DownloadToken string     `gorm:"type:varchar(255);index" json:"-"`
+	ExpiresAt     *time.Time `gorm:"index" json:"expires_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	CompletedAt   *time.Time `json:"completed_at,omitempty"`
+}
+
+func (e *DataExport) BeforeCreate(tx *gorm.DB) (err error) {
+	e.ID = uuid.New().String()
+
+	return nil
+}
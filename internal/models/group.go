@@ -0,0 +1,76 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Roles a user can have within a group.
+const (
+	GroupRoleOwner  = "owner"
+	GroupRoleMember = "member"
+)
+
+// Group is a team of users within an organization. Applications use group
+// memberships, carried in the "groups" token claim, to make authorization
+// decisions.
+type Group struct {
+	ID             string `gorm:"type:char(36);primaryKey" json:"id"`
+	OrganizationID string `gorm:"type:char(36);not null;uniqueIndex:idx_groups_org_name,priority:1" json:"organization_id"`
+	Name           string `gorm:"type:varchar(100);not null;uniqueIndex:idx_groups_org_name,priority:2" json:"name"`
+	Description    string `gorm:"type:varchar(500)" json:"description"`
+	// MemberCount is filled in when groups are listed.
+	MemberCount int64     `gorm:"->;-:migration" json:"member_count"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (g *Group) BeforeCreate(tx *gorm.DB) (err error) {
+	if g.ID == "" {
+		g.ID = uuid.New().String()
+	}
+
+	return nil
+}
+
+// GroupMember is a user's membership of a group and their role in it.
+type GroupMember struct {
+	GroupID   string    `gorm:"type:char(36);primaryKey" json:"group_id"`
+	UserID    string    `gorm:"type:char(36);primaryKey;index" json:"user_id"`
+	Role      string    `gorm:"type:varchar(20);not null" json:"role"`
+	AddedBy   string    `gorm:"type:char(36)" json:"added_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// UserGroup is a group a user belongs to, as shown to the user and put in
+// their tokens.
+type UserGroup struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+// GroupDetail is a group with its members.
+type GroupDetail struct {
+	Group
+	Members []GroupMember `json:"members"`
+}
+
+type GroupRequest struct {
+	Name        string `json:"name" validate:"required,max=100"`
+	Description string `json:"description" validate:"max=500"`
+}
+
+// GroupUpdateRequest changes only the fields that are present.
+type GroupUpdateRequest struct {
+	Name        *string `json:"name" validate:"omitnil,min=1,max=100"`
+	Description *string `json:"description" validate:"omitnil,max=500"`
+}
+
+// GroupMemberRequest adds a user to a group or changes their role in it.
+type GroupMemberRequest struct {
+	Role string `json:"role" validate:"required,oneof=owner member"`
+}
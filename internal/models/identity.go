@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// UserIdentity links a user to their account at an OpenID Connect
+// provider, so they can sign in there instead of with a password.
+type UserIdentity struct {
+	ID             string `gorm:"type:char(36);primaryKey" json:"id"`
+	OrganizationID string `gorm:"type:char(36);not null;uniqueIndex:idx_identities_org_provider_subject,priority:1" json:"organization_id"`
+	UserID         string `gorm:"type:char(36);not null;index" json:"user_id"`
+	Provider       string `gorm:"type:varchar(50);not null;uniqueIndex:idx_identities_org_provider_subject,priority:2" json:"provider"`
+	// Subject is the provider's stable ID for the account.
+	Subject string `gorm:"type:varchar(255);not null;uniqueIndex:idx_identities_org_provider_subject,priority:3" json:"subject"`
+	// Email is the address the provider vouched for when the identity was
+	// linked.
+	Email     string    `gorm:"type:varchar(255)" json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (i *UserIdentity) BeforeCreate(tx *gorm.DB) (err error) {
+	if i.ID == "" {
+		i.ID = uuid.New().String()
+	}
+
+	return nil
+}
+
+// SocialLogin is a sign-in with a provider that has been started but not
+// yet completed. It is looked up by State when the provider sends the user
+// back, and used once.
+type SocialLogin struct {
+	State          string    `gorm:"type:varchar(64);primaryKey"`
+	OrganizationID string    `gorm:"type:char(36);not null"`
+	Provider       string    `gorm:"type:varchar(50);not null"`
+	Nonce          string    `gorm:"type:varchar(64);not null"`
+	CodeVerifier   string    `gorm:"type:varchar(128);not null"`
+	ExpiresAt      time.Time `gorm:"not null;index"`
+	CreatedAt      time.Time
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Import job statuses. A running job that stops part-way, for example
+// because the process exits, keeps its progress and can be resumed once it
+// has stopped saving it.
+const (
+	ImportPending   = "pending"
+	ImportRunning   = "running"
+	ImportPaused    = "paused"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+)
+
+// ImportUserRecord is one row of a user import once its fields have been
+// parsed. It is validated with the same rules as sign-up.
+type ImportUserRecord struct {
+	Name        string `json:"name" validate:"required,min=3,max=50"`
+	Email       string `json:"email" validate:"required,email,max=255"`
+	PhoneNumber uint   `json:"phone" validate:"required,min=1000000000,max=9999999999"`
+	Age         uint   `json:"age" validate:"required,gte=18,lte=120"`
+	Gender      string `json:"gender" validate:"required,oneof=Male Female Other"`
+	Address     string `json:"address" validate:"required,min=5,max=100"`
+}
+
+// ImportIssue explains why a row was not imported.
+type ImportIssue struct {
+	Line   int              `json:"line"`
+	Email  string           `json:"email,omitempty"`
+	Errors ValidationErrors `json:"errors"`
+}
+
+// ImportJob tracks a bulk user import. Processed counts the input records
+// already handled and is committed together with each chunk of users, so a
+// resumed job continues exactly where it stopped. In a dry run Imported
+// counts the users that would have been created.
+type ImportJob struct {
+	ID           string `gorm:"type:char(36);primaryKey" json:"id"`
+	Format       string `gorm:"type:varchar(10);not null" json:"format"`
+	Filename     string `gorm:"type:varchar(255)" json:"filename"`
+	StorageKey   string `gorm:"type:varchar(255);not null" json:"-"`
+	DryRun       bool   `json:"dry_run"`
+	MarkVerified bool   `json:"mark_verified"`
+	RequestedBy  string `gorm:"type:char(36)" json:"requested_by"`
+	// OrganizationID is the tenant the users are imported into.
+	OrganizationID string        `gorm:"type:char(36);not null;default:'00000000-0000-0000-0000-000000000000'" json:"organization_id"`
+	Status         string        `gorm:"type:varchar(20);not null" json:"status"`
+	Processed      int           `json:"processed"`
+	Imported       int           `json:"imported"`
+	Skipped        int           `json:"skipped"`
+	Invalid        int           `json:"invalid"`
+	Issues         []ImportIssue `gorm:"serializer:json;type:longtext" json:"issues"`
+	LastError      string        `gorm:"type:text" json:"last_error,omitempty"`
+	CreatedAt      time.Time     `json:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at"`
+	CompletedAt    *time.Time    `json:"completed_at,omitempty"`
+}
+
+func (j *ImportJob) BeforeCreate(tx *gorm.DB) (err error) {
+	j.ID = uuid.New().String()
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Signup modes, set for the whole deployment with SIGNUPMODE and overridable
+// per organization.
+const (
+	// SignupOpen lets anyone sign up; an invitation is optional.
+	SignupOpen = "open"
+	// SignupInvite only lets people with an invitation sign up.
+	SignupInvite = "invite"
+	// SignupClosed turns signup off, invitations included.
+	SignupClosed = "closed"
+)
+
+// Invitation states, derived from the timestamps by Status.
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationRevoked  = "revoked"
+	InvitationExpired  = "expired"
+)
+
+// Invitation lets someone sign up to an organization with the invited
+// email address, skipping email verification. It can put them straight
+// into a group with a role.
+type Invitation struct {
+	ID             string `gorm:"type:char(36);primaryKey" json:"id"`
+	OrganizationID string `gorm:"type:char(36);not null;index" json:"organization_id"`
+	Email          string `gorm:"type:varchar(255);not null;index" json:"email"`
+	GroupID        string `gorm:"type:char(36)" json:"group_id,omitempty"`
+	GroupRole      string `gorm:"type:varchar(20)" json:"group_role,omitempty"`
+	// InvitedBy is the admin, or the group owner, who sent the invitation.
+	InvitedBy   string `gorm:"type:char(36);not null" json:"invited_by"`
+	InviterRole string `gorm:"type:varchar(10);not null" json:"inviter_role"`
+	// Nonce is part of the signed link and changes when the invitation is
+	// resent, so only the latest link works.
+	Nonce          string     `gorm:"type:varchar(64);not null" json:"-"`
+	ExpiresAt      time.Time  `gorm:"not null" json:"expires_at"`
+	SentCount      int        `gorm:"not null;default:0" json:"sent_count"`
+	AcceptedAt     *time.Time `json:"accepted_at,omitempty"`
+	AcceptedUserID string     `gorm:"type:char(36)" json:"accepted_user_id,omitempty"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+func (i *Invitation) BeforeCreate(tx *gorm.DB) (err error) {
+	if i.ID == "" {
+		i.ID = uuid.New().String()
+	}
+
+	return nil
+}
+
+// Status reports whether the invitation can still be used at now.
+func (i *Invitation) Status(now time.Time) string {
+	switch {
+	case i.AcceptedAt != nil:
+		return InvitationAccepted
+	case i.RevokedAt != nil:
+		return InvitationRevoked
+	case !now.Before(i.ExpiresAt):
+		return InvitationExpired
+	}
+	return InvitationPending
+}
+
+// InvitationRequest invites an email address, optionally into a group.
+type InvitationRequest struct {
+	Email     string `json:"email" validate:"required,email"`
+	GroupID   string `json:"group_id" validate:"omitempty,uuid"`
+	GroupRole string `json:"group_role" validate:"omitempty,oneof=owner member"`
+}
+
+// InvitationResponse is an invitation with its current status.
+type InvitationResponse struct {
+	Invitation
+	Status string `json:"status"`
+}
+
+// InvitationPreview is what the holder of an invitation link is shown
+// before signing up.
+type InvitationPreview struct {
+	Email        string    `json:"email"`
+	Organization string    `json:"organization"`
+	Group        string    `json:"group,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
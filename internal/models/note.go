@@ -0,0 +1,90 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// UserNote is a private note support staff keep about a user. Notes are
+// only ever shown to admins.
+type UserNote struct {
+	ID       string `gorm:"type:char(36);primaryKey" json:"id"`
+	UserID   string `gorm:"type:char(36);not null;index" json:"user_id"`
+	AuthorID string `gorm:"type:char(36);not null" json:"author_id"`
+	Body     string `gorm:"type:text;not null" json:"body"`
+	// EditorID is the admin who last edited the note, empty until it is
+	// first edited.
+	EditorID  string    `gorm:"type:char(36)" json:"editor_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (n *UserNote) BeforeCreate(tx *gorm.DB) (err error) {
+	n.ID = uuid.New().String()
+
+	return nil
+}
+
+// UserNoteRevision is an earlier version of a note, kept when it is edited.
+// AuthorID wrote this version at CreatedAt.
+type UserNoteRevision struct {
+	ID        string    `gorm:"type:char(36);primaryKey" json:"id"`
+	NoteID    string    `gorm:"type:char(36);not null;index" json:"note_id"`
+	AuthorID  string    `gorm:"type:char(36);not null" json:"author_id"`
+	Body      string    `gorm:"type:text;not null" json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (r *UserNoteRevision) BeforeCreate(tx *gorm.DB) (err error) {
+	r.ID = uuid.New().String()
+
+	return nil
+}
+
+// UserTag is a free-form label admins put on a user, such as "vip" or
+// "fraud-review". Tags are stored normalized by NormalizeTag.
+type UserTag struct {
+	UserID    string    `gorm:"type:char(36);primaryKey" json:"user_id"`
+	Tag       string    `gorm:"type:varchar(50);primaryKey;index" json:"tag"`
+	AddedBy   string    `gorm:"type:char(36)" json:"added_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TagCount is how many users carry a tag.
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int64  `json:"count"`
+}
+
+// NormalizeTag trims and lowercases a tag so "VIP " and "vip" match.
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// ValidTag reports whether a normalized tag is usable: 1 to 50 letters,
+// digits, dashes, underscores or dots, starting with a letter or digit.
+func ValidTag(tag string) bool {
+	if tag == "" || len(tag) > 50 {
+		return false
+	}
+	for i, r := range tag {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+		case i > 0 && (r == '-' || r == '_' || r == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+type UserNoteRequest struct {
+	Body string `json:"body" validate:"required,max=10000"`
+}
+
+type UserTagsRequest struct {
+	Tags []string `json:"tags" validate:"required,min=1,max=20,dive,required"`
+}
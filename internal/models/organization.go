@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DefaultOrganizationID is the organization that users and admins from
+// before organizations existed belong to, and that requests naming no
+// organization are served by.
+const DefaultOrganizationID = "00000000-0000-0000-0000-000000000000"
+
+// Organization is a tenant, one of the brands this deployment serves.
+// Users and admins each belong to one, and an email address only has to be
+// unique within it.
+type Organization struct {
+	ID   string `gorm:"type:char(36);primaryKey" json:"id"`
+	Name string `gorm:"type:varchar(100);not null" json:"name"`
+	// Slug names the organization in the X-Organization header and as a
+	// subdomain.
+	Slug string `gorm:"type:varchar(63);not null;uniqueIndex" json:"slug"`
+	// SignupMode overrides SIGNUPMODE for the organization when set.
+	SignupMode string    `gorm:"type:varchar(10)" json:"signup_mode,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func (o *Organization) BeforeCreate(tx *gorm.DB) (err error) {
+	if o.ID == "" {
+		o.ID = uuid.New().String()
+	}
+
+	return nil
+}
+
+// ValidSlug reports whether slug can name an organization: 2 to 63
+// lowercase letters, digits or dashes, starting and ending with a letter or
+// digit, so it also works as a subdomain.
+func ValidSlug(slug string) bool {
+	if len(slug) < 2 || len(slug) > 63 {
+		return false
+	}
+	for i, r := range slug {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+		case r == '-' && i > 0 && i < len(slug)-1:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+type OrganizationRequest struct {
+	Name       string `json:"name" validate:"required,max=100"`
+	Slug       string `json:"slug" validate:"required"`
+	SignupMode string `json:"signup_mode" validate:"omitempty,oneof=open invite closed"`
+}
+
+// OrganizationUpdateRequest changes only the fields that are present. A
+// signup_mode of "default" clears the override.
+type OrganizationUpdateRequest struct {
+	Name       *string `json:"name" validate:"omitnil,min=1,max=100"`
+	Slug       *string `json:"slug" validate:"omitnil"`
+	SignupMode *string `json:"signup_mode" validate:"omitnil,oneof=default open invite closed"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// OutboxEvent is a domain event stored in the same transaction as the
+// change it describes, waiting to be dispatched once that commits.
+type OutboxEvent struct {
+	ID      string `gorm:"type:char(36);primaryKey" json:"id"`
+	Name    string `gorm:"type:varchar(100);not null" json:"name"`
+	Payload string `gorm:"type:mediumtext;not null" json:"payload"`
+	// ClaimToken and ClaimedUntil mark an event a relay is dispatching.
+	ClaimToken   string     `gorm:"type:char(36);index" json:"-"`
+	ClaimedUntil *time.Time `json:"-"`
+	CreatedAt    time.Time  `gorm:"index" json:"created_at"`
+	PublishedAt  *time.Time `gorm:"index" json:"published_at,omitempty"`
+}
+
+func (e *OutboxEvent) BeforeCreate(tx *gorm.DB) (err error) {
+	e.ID = uuid.New().String()
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package models
+
+import "encoding/json"
+
+// ProblemContentType is the media type of RFC 7807 error responses.
+const ProblemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details body. Code is a stable,
+// machine-readable identifier clients can branch on instead of Title or
+// Detail, which are meant for humans and may change. Extensions are extra
+// members specific to the problem type and are serialised alongside the
+// standard ones.
+type Problem struct {
+	Type       string                 `json:"type"`
+	Title      string                 `json:"title"`
+	Status     int                    `json:"status"`
+	Detail     string                 `json:"detail,omitempty"`
+	Instance   string                 `json:"instance,omitempty"`
+	Code       string                 `json:"code"`
+	Errors     ValidationErrors       `json:"errors,omitempty"`
+	Extensions map[string]interface{} `json:"-"`
+}
+
+// MarshalJSON flattens Extensions into the top-level object. Extensions
+// never override the standard members.
+func (p Problem) MarshalJSON() ([]byte, error) {
+	type problem Problem
+	standard, err := json.Marshal(problem(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return standard, err
+	}
+
+	members := make(map[string]json.RawMessage, len(p.Extensions))
+	for name, value := range p.Extensions {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		members[name] = encoded
+	}
+	if err := json.Unmarshal(standard, &members); err != nil {
+		return nil, err
+	}
+	return json.Marshal(members)
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Session is one sign-in. Its ID travels in the "sid" claim of the tokens
+// issued for it, so revoking the session invalidates them.
+type Session struct {
+	ID         string     `gorm:"type:char(36);primaryKey" json:"id"`
+	UserID     string     `gorm:"type:char(36);not null;index" json:"user_id"`
+	UserAgent  string     `gorm:"type:varchar(255)" json:"user_agent,omitempty"`
+	IPAddress  string     `gorm:"type:varchar(45)" json:"ip_address,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	// ImpersonatorID is the admin acting as the user in an impersonation
+	// session, and empty for the user's own sign-ins.
+	ImpersonatorID string `gorm:"type:char(36)" json:"impersonator_id,omitempty"`
+}
+
+// SessionResponse is a session as shown to its user.
+type SessionResponse struct {
+	ID           string     `json:"id"`
+	UserAgent    string     `json:"user_agent,omitempty"`
+	IPAddress    string     `json:"ip_address,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastSeenAt   time.Time  `json:"last_seen_at"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	Impersonated bool       `json:"impersonated"`
+}
+
+// NewSessionResponse shows session to its user.
+func NewSessionResponse(session *Session) SessionResponse {
+	return SessionResponse{
+		ID:           session.ID,
+		UserAgent:    session.UserAgent,
+		IPAddress:    session.IPAddress,
+		CreatedAt:    session.CreatedAt,
+		LastSeenAt:   session.LastSeenAt,
+		ExpiresAt:    session.ExpiresAt,
+		RevokedAt:    session.RevokedAt,
+		Impersonated: session.ImpersonatorID != "",
+	}
+}
+
+// SecurityHistoryResponse lists a user's recent sign-ins, including support
+// staff signing in as them, and the security events on their account.
+type SecurityHistoryResponse struct {
+	Sessions []SessionResponse `json:"sessions"`
+	Events   []AuditEvent      `json:"events"`
+}
+
+// ImpersonationResponse carries a token that lets an admin act as a user.
+type ImpersonationResponse struct {
+	Token     string    `json:"token"`
+	SessionID string    `json:"session_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Active reports whether tokens for the session are still accepted.
+func (s *Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+func (s *Session) BeforeCreate(tx *gorm.DB) (err error) {
+	s.ID = uuid.New().String()
+
+	return nil
+}
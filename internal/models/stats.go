@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// Intervals the admin dashboard can group signups by.
+const (
+	StatsDay   = "day"
+	StatsWeek  = "week"
+	StatsMonth = "month"
+)
+
+// StatsQuery selects the time series shown on the admin dashboard. From and
+// To are the first and last day included, in UTC.
+type StatsQuery struct {
+	Interval string
+	From     time.Time
+	To       time.Time
+}
+
+// UserCounts are totals over the user base. Total, Verified and Blocked
+// only count live accounts; Deleted counts soft-deleted ones not yet purged.
+type UserCounts struct {
+	Total    int64 `json:"total"`
+	Verified int64 `json:"verified"`
+	Blocked  int64 `json:"blocked"`
+	Deleted  int64 `json:"deleted"`
+}
+
+// StatsBucket is one point of a time series or distribution. Time series
+// keys are "2006-01-02" for days, "2006-W01" for ISO weeks and "2006-01"
+// for months.
+type StatsBucket struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+}
+
+// AdminStatsResponse is the admin dashboard summary.
+type AdminStatsResponse struct {
+	Counts      UserCounts    `json:"counts"`
+	Interval    string        `json:"interval"`
+	From        string        `json:"from"`
+	To          string        `json:"to"`
+	Signups     []StatsBucket `json:"signups"`
+	LoginsByDay []StatsBucket `json:"logins_by_day"`
+	Genders     []StatsBucket `json:"genders"`
+	AgeGroups   []StatsBucket `json:"age_groups"`
+	GeneratedAt time.Time     `json:"generated_at"`
+}
@@ -11,9 +11,10 @@ type User struct {
 	gorm.Model
 	ID                 string          `gorm:"type:char(36);primaryKey;unique" json:"id"`
 	Name               string          `gorm:"type:varchar(100);not null" json:"name"`
-	Email              string          `gorm:"type:varchar(255);unique;not null" json:"email"`
+	Email              string          `gorm:"type:varchar(255);not null;index" json:"email"`
 	Address            string          `json:"address"`
 	ImageURL           string          `json:"imageurl"`
+	ImageKey           string          `gorm:"type:varchar(255)" json:"-"`
 	Age                uint            `json:"age"`
 	Gender             string          `json:"gender"`
 	PhoneNumber        uint            `json:"phonenumber"`
@@ -23,10 +24,73 @@ type User struct {
 	VerificationToken  string          `gorm:"type:varchar(255)" json:"verification_token"`
 	VerificationExpiry int64           `json:"verification_expiry"`
 	PasswordResets     []PasswordReset `gorm:"foreignKey:UserID" json:"password_resets"`
+	// DeletionScheduledAt is set while the user has asked for their account
+	// to be deleted; the account is purged once it passes.
+	DeletionScheduledAt *time.Time `gorm:"index" json:"deletion_scheduled_at,omitempty"`
+	// ActiveEmail mirrors Email while the user is not soft-deleted and is NULL
+	// afterwards, so the unique index on it only covers live accounts of the
+	// organization.
+	ActiveEmail *string `gorm:"->;type:varchar(255) GENERATED ALWAYS AS (IF(deleted_at IS NULL, email, NULL)) STORED;uniqueIndex:idx_users_org_active_email,priority:2" json:"-"`
+	// BlockReason and BlockedUntil describe the current block while IsBlocked
+	// is set; the full history is kept in UserBlock.
+	BlockReason  string     `gorm:"type:varchar(50)" json:"block_reason,omitempty"`
+	BlockedUntil *time.Time `json:"blocked_until,omitempty"`
+	// ImportedAt is set on users brought in by a bulk import, who may need
+	// to reset their password or verify their email again.
+	ImportedAt *time.Time `gorm:"index" json:"imported_at,omitempty"`
+	// MustChangePassword stops the user signing in until they pick a new
+	// password.
+	MustChangePassword bool `gorm:"default:false" json:"must_change_password"`
+	// SessionsRevokedAt is when all the user's sessions were last revoked.
+	// Tokens that predate sessions are refused once it is set.
+	SessionsRevokedAt *time.Time `json:"-"`
+	// OrganizationID is the tenant the user belongs to.
+	OrganizationID string `gorm:"type:char(36);not null;default:'00000000-0000-0000-0000-000000000000';uniqueIndex:idx_users_org_active_email,priority:1" json:"organization_id"`
+}
+
+// UserSnapshot is the part of a user carried by domain events and webhook
+// payloads, as it was when the event happened.
+type UserSnapshot struct {
+	ID             string    `json:"id"`
+	OrganizationID string    `json:"organization_id"`
+	Email          string    `json:"email"`
+	Name           string    `json:"name"`
+	IsVerified     bool      `json:"is_verified"`
+	IsBlocked      bool      `json:"is_blocked"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+func NewUserSnapshot(u *User) UserSnapshot {
+	return UserSnapshot{
+		ID:             u.ID,
+		OrganizationID: u.OrganizationID,
+		Email:          u.Email,
+		Name:           u.Name,
+		IsVerified:     u.IsVerified,
+		IsBlocked:      u.IsBlocked,
+		CreatedAt:      u.CreatedAt,
+	}
+}
+
+// BlockActive reports whether the user is blocked at the given time. A block
+// whose end time has passed no longer counts, even before it is cleared.
+func (u *User) BlockActive(now time.Time) bool {
+	return u.IsBlocked && (u.BlockedUntil == nil || now.Before(*u.BlockedUntil))
+}
+
+// DeletionDue reports whether the user's deletion grace period has ended at
+// the given time. The account is as good as gone, even before it is purged.
+func (u *User) DeletionDue(now time.Time) bool {
+	return u.DeletionScheduledAt != nil && !now.Before(*u.DeletionScheduledAt)
 }
 
 func (u *User) BeforeCreate(tx *gorm.DB) (err error) {
-	u.ID = uuid.New().String()
+	if u.ID == "" {
+		u.ID = uuid.New().String()
+	}
+	if u.OrganizationID == "" {
+		u.OrganizationID = DefaultOrganizationID
+	}
 
 	return nil
 }
@@ -45,6 +109,21 @@ func (pr *PasswordReset) BeforeCreate(tx *gorm.DB) (err error) {
 	return nil
 }
 
+// PasswordHistory keeps hashes of a user's previous passwords so they can't
+// be reused.
+type PasswordHistory struct {
+	ID           string    `gorm:"type:char(36);primaryKey" json:"id"`
+	UserID       string    `gorm:"type:char(36);not null;index" json:"user_id"`
+	PasswordHash string    `gorm:"type:varchar(255);not null" json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (ph *PasswordHistory) BeforeCreate(tx *gorm.DB) (err error) {
+	ph.ID = uuid.New().String()
+
+	return nil
+}
+
 type UserSignupRequest struct {
 	Name        string `json:"name" validate:"required,min=3,max=50"`
 	Email       string `json:"email" validate:"required,email"`
@@ -52,13 +131,16 @@ type UserSignupRequest struct {
 	Gender      string `json:"gender" validate:"required,oneof=Male Female Other"`
 	Address     string `json:"address" validate:"required,min=5,max=100"`
 	PhoneNumber uint   `json:"phonenumber" validate:"required,numeric,min=1000000000,max=9999999999"` // Validating as a number
-	Password    string `json:"password" validate:"required,min=8"`
+	Password    string `json:"password" validate:"required"` // Checked against the password policy by the service
 	ImageURL    string `json:"image_url" validate:"required,url"`
+	// InvitationToken comes from an invitation link. It lets the invited
+	// email sign up where signup is invite-only.
+	InvitationToken string `json:"invitation_token"`
 }
 
 type UserLoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
 }
 
 type UserProfileResponse struct {
@@ -70,16 +152,73 @@ type UserProfileResponse struct {
 	Address     string `json:"address"`
 	PhoneNumber uint   `json:"phonenumber"`
 	ImageURL    string `json:"image_url,omitempty"`
-	IsVerified  bool   `json:"is_verified"`
-	IsBlocked   bool   `json:"is_blocked"`
-	CreatedAt   string `json:"created_at"`
+	// Images maps avatar sizes in pixels ("64", "128", "512") to URLs.
+	Images     map[string]string `json:"images,omitempty"`
+	IsVerified bool              `json:"is_verified"`
+	IsBlocked  bool              `json:"is_blocked"`
+	CreatedAt  string            `json:"created_at"`
+	// DeletionScheduledAt is set while the account is pending deletion.
+	DeletionScheduledAt string `json:"deletion_scheduled_at,omitempty"`
+	// DeletedAt is set on soft-deleted users listed to admins.
+	DeletedAt string `json:"deleted_at,omitempty"`
 }
 
+// UserUpdateRequest changes the user's own profile. Only the fields present
+// in the request are changed.
 type UserUpdateRequest struct {
-	ID       string `json:"id"`
-	Name     string `json:"name"`
-	Age      uint   `json:"age"`
-	Gender   string `json:"gender"`
-	Address  string `json:"address"`
-	ImageURL string `json:"image_url,omitempty"`
+	Name    *string `json:"name" validate:"omitnil,min=3,max=50"`
+	Age     *uint   `json:"age" validate:"omitnil,gte=18,lte=120"`
+	Gender  *string `json:"gender" validate:"omitnil,oneof=Male Female Other"`
+	Address *string `json:"address" validate:"omitnil,min=5,max=100"`
+}
+
+// AdminUserUpdateRequest lets an admin change any profile field. Only the
+// fields present in the request are changed.
+type AdminUserUpdateRequest struct {
+	Name        *string `json:"name" validate:"omitnil,min=3,max=50"`
+	Email       *string `json:"email" validate:"omitnil,email,max=255"`
+	Age         *uint   `json:"age" validate:"omitnil,gte=18,lte=120"`
+	Gender      *string `json:"gender" validate:"omitnil,oneof=Male Female Other"`
+	Address     *string `json:"address" validate:"omitnil,min=5,max=100"`
+	PhoneNumber *uint   `json:"phonenumber" validate:"omitnil,min=1000000000,max=9999999999"`
+	ImageURL    *string `json:"image_url" validate:"omitnil,url"`
+	IsVerified  *bool   `json:"is_verified"`
+}
+
+// UserStatusResponse is the account state shown to admins.
+type UserStatusResponse struct {
+	IsVerified          bool       `json:"is_verified"`
+	MustChangePassword  bool       `json:"must_change_password"`
+	IsBlocked           bool       `json:"is_blocked"`
+	BlockReason         string     `json:"block_reason,omitempty"`
+	BlockedUntil        *time.Time `json:"blocked_until,omitempty"`
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+	ImportedAt          *time.Time `json:"imported_at,omitempty"`
+}
+
+// AdminUserDetailResponse is everything an admin sees about one user.
+type AdminUserDetailResponse struct {
+	User        UserProfileResponse `json:"user"`
+	Status      UserStatusResponse  `json:"status"`
+	Tags        []string            `json:"tags"`
+	Sessions    []Session           `json:"sessions"`
+	RecentAudit []AuditEvent        `json:"recent_audit"`
+}
+
+type EmailRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type PasswordResetConfirmRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required"`
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required"`
 }
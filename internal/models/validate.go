@@ -3,58 +3,83 @@ package models
 import (
 	"errors"
 	"fmt"
+	"net/url"
+	"reflect"
 	"strings"
-	"unicode"
+
+	"github.com/go-playground/validator/v10"
 )
 
-func ValidatePassword(password string) error {
-	if len(password) < MinPasswordLength || len(password) > MaxPasswordLength {
-		return fmt.Errorf(ErrPasswordLength, MinPasswordLength, MaxPasswordLength)
-	}
+// FieldError describes a single failed validation rule on a request field.
+// Field is the JSON name of the field so clients can map it onto form inputs.
+type FieldError struct {
+	Field string `json:"field"`
+	Rule  string `json:"rule"`
+	Param string `json:"param"`
+}
+
+// ValidationErrors is returned by ValidateStruct when one or more fields fail
+// their `validate` tag rules.
+type ValidationErrors []FieldError
 
-	var (
-		hasUpper   bool
-		hasLower   bool
-		hasNumber  bool
-		hasSpecial bool
-	)
-
-	for _, char := range password {
-		switch {
-		case unicode.IsUpper(char):
-			hasUpper = true
-		case unicode.IsLower(char):
-			hasLower = true
-		case unicode.IsNumber(char):
-			hasNumber = true
-		case unicode.IsPunct(char) || unicode.IsSymbol(char):
-			hasSpecial = true
+func (v ValidationErrors) Error() string {
+	parts := make([]string, len(v))
+	for i, fe := range v {
+		if fe.Param != "" {
+			parts[i] = fmt.Sprintf("%s: %s=%s", fe.Field, fe.Rule, fe.Param)
+		} else {
+			parts[i] = fmt.Sprintf("%s: %s", fe.Field, fe.Rule)
 		}
 	}
+	return "validation failed: " + strings.Join(parts, ", ")
+}
 
-	if !hasUpper || !hasLower || !hasNumber || !hasSpecial {
-		return errors.New(ErrPasswordComplexity)
-	}
+var validate = newValidator()
 
-	return nil
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+
+	// Report fields by their JSON name instead of the Go struct field name.
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return f.Name
+		}
+		return name
+	})
+
+	// https_url is http_url restricted to the https scheme.
+	v.RegisterValidation("https_url", func(fl validator.FieldLevel) bool {
+		u, err := url.Parse(fl.Field().String())
+		return err == nil && u.Scheme == "https" && u.Hostname() != ""
+	})
+
+	return v
 }
 
-func Validate(u UserSignupRequest) error {
-	if u.Name == "" || u.Email == "" || u.Password == "" {
-		return errors.New( ErrRequiredFieldsEmpty)
+// ValidateStruct runs the `validate` tag rules on s and returns
+// ValidationErrors describing every failed field, or nil.
+func ValidateStruct(s interface{}) error {
+	err := validate.Struct(s)
+	if err == nil {
+		return nil
 	}
 
-	if err := ValidatePassword(u.Password); err != nil {
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
 		return err
 	}
 
-	if !strings.Contains(u.Email, "@") || !strings.Contains(u.Email, ".") {
-		return errors.New(ErrInvalidEmailFormat)
-	}
-
-	if u.Age <= 0 {
-		return errors.New(ErrNegativeAge)
+	fieldErrors := make(ValidationErrors, len(verrs))
+	for i, fe := range verrs {
+		fieldErrors[i] = FieldError{
+			Field: fe.Field(),
+			Rule:  fe.Tag(),
+			Param: fe.Param(),
+		}
 	}
-
-	return nil
+	return fieldErrors
 }
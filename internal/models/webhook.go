@@ -0,0 +1,112 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// User lifecycle events webhook endpoints can subscribe to.
+const (
+	WebhookUserSignedUp      = "user.signed_up"
+	WebhookUserVerified      = "user.verified"
+	WebhookUserProfileUpdate = "user.profile_updated"
+	WebhookUserBlocked       = "user.blocked"
+	WebhookUserUnblocked     = "user.unblocked"
+	WebhookUserDeleted       = "user.deleted"
+)
+
+// Webhook delivery statuses.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// WebhookEndpoint is a URL registered by an admin to receive user lifecycle
+// events. Requests to it are signed with Secret.
+type WebhookEndpoint struct {
+	ID          string    `gorm:"type:char(36);primaryKey" json:"id"`
+	URL         string    `gorm:"type:varchar(2048);not null" json:"url"`
+	Description string    `gorm:"type:varchar(255)" json:"description,omitempty"`
+	EventTypes  []string  `gorm:"serializer:json;type:text" json:"event_types"`
+	Secret      string    `gorm:"type:varchar(100);not null" json:"-"`
+	Active      bool      `gorm:"default:true" json:"active"`
+	CreatedBy   string    `gorm:"type:char(36)" json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Subscribed reports whether the endpoint should receive eventType.
+func (e *WebhookEndpoint) Subscribed(eventType string) bool {
+	if !e.Active {
+		return false
+	}
+	for _, t := range e.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *WebhookEndpoint) BeforeCreate(tx *gorm.DB) (err error) {
+	e.ID = uuid.New().String()
+
+	return nil
+}
+
+// WebhookDelivery is one event sent, or still to be sent, to one endpoint.
+// Failed attempts are retried at NextAttemptAt until the delivery succeeds
+// or runs out of attempts.
+type WebhookDelivery struct {
+	ID         string `gorm:"type:char(36);primaryKey" json:"id"`
+	EndpointID string `gorm:"type:char(36);not null;index" json:"endpoint_id"`
+	EventID    string `gorm:"type:char(36);not null" json:"event_id"`
+	EventType  string `gorm:"type:varchar(50);not null" json:"event_type"`
+	Payload    string `gorm:"type:mediumtext;not null" json:"payload"`
+	Status     string `gorm:"type:varchar(20);not null;index:idx_webhook_deliveries_due,priority:1" json:"status"`
+	Attempts   int    `json:"attempts"`
+	// NextAttemptAt is when a pending delivery is due to be sent.
+	NextAttemptAt  *time.Time `gorm:"index:idx_webhook_deliveries_due,priority:2" json:"next_attempt_at,omitempty"`
+	LastAttemptAt  *time.Time `json:"last_attempt_at,omitempty"`
+	LastStatusCode int        `json:"last_status_code,omitempty"`
+	LastError      string     `gorm:"type:varchar(1000)" json:"last_error,omitempty"`
+	// ReplayOf is the failed delivery this one replays.
+	ReplayOf    string     `gorm:"type:char(36)" json:"replay_of,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+}
+
+func (d *WebhookDelivery) BeforeCreate(tx *gorm.DB) (err error) {
+	d.ID = uuid.New().String()
+
+	return nil
+}
+
+// WebhookEvent is the JSON body posted to webhook endpoints.
+type WebhookEvent struct {
+	ID        string           `json:"id"`
+	Type      string           `json:"type"`
+	CreatedAt time.Time        `json:"created_at"`
+	Data      WebhookEventData `json:"data"`
+}
+
+type WebhookEventData struct {
+	User UserSnapshot `json:"user"`
+}
+
+type WebhookEndpointRequest struct {
+	URL         string   `json:"url" validate:"required,https_url,max=2048"`
+	Description string   `json:"description" validate:"max=255"`
+	EventTypes  []string `json:"event_types" validate:"required,min=1,dive,oneof=user.signed_up user.verified user.profile_updated user.blocked user.unblocked user.deleted"`
+}
+
+// WebhookEndpointUpdateRequest changes only the fields that are present.
+type WebhookEndpointUpdateRequest struct {
+	URL         *string  `json:"url" validate:"omitnil,https_url,max=2048"`
+	Description *string  `json:"description" validate:"omitnil,max=255"`
+	EventTypes  []string `json:"event_types" validate:"omitempty,min=1,dive,oneof=user.signed_up user.verified user.profile_updated user.blocked user.unblocked user.deleted"`
+	Active      *bool    `json:"active"`
+}
@@ -0,0 +1,59 @@
+package oidc_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/liju-github/user-management/internal/oidc"
+	"github.com/liju-github/user-management/internal/oidc/oidctest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	idp := oidctest.NewProvider("client-1", "secret-1")
+	defer idp.Close()
+	idp.SignIn(oidctest.User{Subject: "sub-1", Email: "jane@example.com", EmailVerified: true, Name: "Jane Roe"})
+
+	ctx := context.Background()
+	provider := oidc.NewProvider(oidc.Config{
+		Name:         "corp",
+		Issuer:       idp.Issuer() + "/",
+		ClientID:     "client-1",
+		ClientSecret: "secret-1",
+		Scopes:       []string{"email", "profile"},
+		RedirectURL:  "https://app.example.com/callback",
+	})
+
+	authorize := func(nonce, verifier string) string {
+		t.Helper()
+		authURL, err := provider.AuthCodeURL(ctx, "state-1", nonce, verifier)
+		assert.NoError(t, err)
+		back, err := idp.Authorize(authURL)
+		assert.NoError(t, err)
+		assert.Equal(t, "app.example.com", back.Host)
+		assert.Equal(t, "state-1", back.Query().Get("state"))
+		return back.Query().Get("code")
+	}
+
+	verifier := oidc.NewVerifier()
+	claims, err := provider.Exchange(ctx, authorize("nonce-1", verifier), verifier, "nonce-1")
+	assert.NoError(t, err)
+	assert.Equal(t, &oidc.Claims{Subject: "sub-1", Email: "jane@example.com", EmailVerified: true, Name: "Jane Roe"}, claims)
+
+	// A code is only good once, with its own verifier and nonce.
+	code := authorize("nonce-2", verifier)
+	_, err = provider.Exchange(ctx, code, verifier, "nonce-3")
+	assert.ErrorContains(t, err, "wrong nonce")
+	_, err = provider.Exchange(ctx, code, verifier, "nonce-2")
+	assert.ErrorContains(t, err, "invalid_grant")
+	_, err = provider.Exchange(ctx, authorize("nonce-4", verifier), oidc.NewVerifier(), "nonce-4")
+	assert.ErrorContains(t, err, "invalid_grant")
+
+	wrongClient := oidc.NewProvider(oidc.Config{Name: "corp", Issuer: idp.Issuer(), ClientID: "client-1", ClientSecret: "wrong", RedirectURL: "https://app.example.com/callback"})
+	_, err = wrongClient.Exchange(ctx, authorize("nonce-5", verifier), verifier, "nonce-5")
+	assert.ErrorContains(t, err, "invalid_client")
+
+	impostor := oidc.NewProvider(oidc.Config{Name: "corp", Issuer: "https://idp.example.com", RedirectURL: "https://app.example.com/callback"})
+	_, err = impostor.AuthCodeURL(ctx, "state-1", "nonce-1", verifier)
+	assert.Error(t, err)
+}
@@ -0,0 +1,174 @@
+package passwords
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const argon2idPrefix = "$argon2id$"
+
+// Upper bounds on the costs a stored argon2id hash may ask for. Verifying a
+// hash spends whatever it encodes, so an imported hash with absurd costs
+// could otherwise exhaust the server's memory or CPU on a single login.
+const (
+	MaxArgon2Memory      = 1024 * 1024 // KiB, 1 GiB
+	MaxArgon2Iterations  = 64
+	MaxArgon2Parallelism = 64
+	MaxArgon2KeyLength   = 128
+	MaxArgon2SaltLength  = 128
+)
+
+// Argon2idParams are the tunable argon2id costs. Memory is in KiB.
+type Argon2idParams struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// Validate reports whether the costs are ones a stored hash may use.
+func (p Argon2idParams) Validate() error {
+	switch {
+	case p.Memory < 1 || p.Memory > MaxArgon2Memory:
+		return fmt.Errorf("argon2id memory must be between 1 and %d KiB", MaxArgon2Memory)
+	case p.Iterations < 1 || p.Iterations > MaxArgon2Iterations:
+		return fmt.Errorf("argon2id iterations must be between 1 and %d", MaxArgon2Iterations)
+	case p.Parallelism < 1 || p.Parallelism > MaxArgon2Parallelism:
+		return fmt.Errorf("argon2id parallelism must be between 1 and %d", MaxArgon2Parallelism)
+	case p.SaltLength > MaxArgon2SaltLength:
+		return fmt.Errorf("argon2id salt must be at most %d bytes", MaxArgon2SaltLength)
+	case p.KeyLength < 1 || p.KeyLength > MaxArgon2KeyLength:
+		return fmt.Errorf("argon2id key must be between 1 and %d bytes", MaxArgon2KeyLength)
+	}
+	return nil
+}
+
+// DefaultArgon2idParams follow the OWASP baseline for argon2id.
+var DefaultArgon2idParams = Argon2idParams{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Argon2idHasher hashes passwords with argon2id and encodes them in PHC
+// string format: $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>.
+type Argon2idHasher struct {
+	params Argon2idParams
+}
+
+// NewArgon2idHasher returns an Argon2idHasher; zero fields in params fall
+// back to DefaultArgon2idParams. The resulting params must pass Validate, or
+// the hashes it produces will not verify.
+func NewArgon2idHasher(params Argon2idParams) *Argon2idHasher {
+	if params.Memory == 0 {
+		params.Memory = DefaultArgon2idParams.Memory
+	}
+	if params.Iterations == 0 {
+		params.Iterations = DefaultArgon2idParams.Iterations
+	}
+	if params.Parallelism == 0 {
+		params.Parallelism = DefaultArgon2idParams.Parallelism
+	}
+	if params.SaltLength == 0 {
+		params.SaltLength = DefaultArgon2idParams.SaltLength
+	}
+	if params.KeyLength == 0 {
+		params.KeyLength = DefaultArgon2idParams.KeyLength
+	}
+	return &Argon2idHasher{params: params}
+}
+
+// Params returns the costs new hashes are made with.
+func (h *Argon2idHasher) Params() Argon2idParams {
+	return h.params
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, h.params.KeyLength)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix, argon2.Version,
+		h.params.Memory, h.params.Iterations, h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *Argon2idHasher) Verify(password, encoded string) (bool, error) {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, candidate) == 1, nil
+}
+
+func (h *Argon2idHasher) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, argon2idPrefix)
+}
+
+func (h *Argon2idHasher) Check(encoded string) error {
+	_, _, _, err := decodeArgon2id(encoded)
+	return err
+}
+
+func (h *Argon2idHasher) NeedsRehash(encoded string) bool {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return params.Memory < h.params.Memory ||
+		params.Iterations < h.params.Iterations ||
+		params.Parallelism < h.params.Parallelism ||
+		uint32(len(salt)) < h.params.SaltLength ||
+		uint32(len(key)) < h.params.KeyLength
+}
+
+func decodeArgon2id(encoded string) (Argon2idParams, []byte, []byte, error) {
+	var params Argon2idParams
+
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, hash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, ErrMalformedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrMalformedHash
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, ErrMalformedHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrMalformedHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, ErrMalformedHash
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	if params.Validate() != nil {
+		return params, nil, nil, ErrMalformedHash
+	}
+	return params, salt, key, nil
+}
@@ -0,0 +1,83 @@
+package passwords
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MaxBcryptPasswordLength is the most bytes of a password bcrypt uses; it
+// ignores the rest.
+const MaxBcryptPasswordLength = 72
+
+// MaxBcryptCost is the highest cost a stored bcrypt hash may ask for. Each
+// step doubles the work, so an imported $2a$31$ hash would otherwise tie up
+// a CPU for days on a single login.
+const MaxBcryptCost = 16
+
+// ErrPasswordTooLong is returned by BcryptHasher for passwords bcrypt would
+// otherwise silently truncate.
+var ErrPasswordTooLong = fmt.Errorf("password exceeds %d bytes", MaxBcryptPasswordLength)
+
+// BcryptHasher hashes passwords with bcrypt. It is kept so existing hashes
+// keep verifying; new deployments should prefer argon2id.
+type BcryptHasher struct {
+	cost int
+}
+
+// NewBcryptHasher returns a BcryptHasher; a zero cost means
+// bcrypt.DefaultCost. The cost must not exceed MaxBcryptCost, or the hashes
+// it produces will not verify.
+func NewBcryptHasher(cost int) *BcryptHasher {
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	return &BcryptHasher{cost: cost}
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	if len(password) > MaxBcryptPasswordLength {
+		return "", ErrPasswordTooLong
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (h *BcryptHasher) Verify(password, encoded string) (bool, error) {
+	if err := h.Check(encoded); err != nil {
+		return false, err
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+		return false, nil
+	default:
+		return false, ErrMalformedHash
+	}
+}
+
+func (h *BcryptHasher) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") ||
+		strings.HasPrefix(encoded, "$2b$") ||
+		strings.HasPrefix(encoded, "$2y$")
+}
+
+func (h *BcryptHasher) Check(encoded string) error {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	if err != nil || cost > MaxBcryptCost {
+		return ErrMalformedHash
+	}
+	return nil
+}
+
+func (h *BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost < h.cost
+}
@@ -0,0 +1,117 @@
+package passwords
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+)
+
+var bloomMagic = [4]byte{'P', 'W', 'B', 'F'}
+
+const bloomVersion = 1
+
+// ErrInvalidBloomFilter is returned when a filter file cannot be decoded.
+var ErrInvalidBloomFilter = errors.New("invalid bloom filter file")
+
+// BloomFilter is a probabilistic set of breached passwords. It never misses a
+// password that was added and reports a small, configurable fraction of
+// other passwords as breached.
+//
+// On disk the filter is "PWBF", a version byte, the hash count (1 byte), the
+// bit count (uint64, big endian) and then the bit array.
+type BloomFilter struct {
+	bits   []byte
+	m      uint64
+	hashes uint8
+}
+
+// NewBloomFilter sizes a filter for n entries at the given false positive
+// rate.
+func NewBloomFilter(n uint64, falsePositiveRate float64) *BloomFilter {
+	if n == 0 {
+		n = 1
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	k := uint8(math.Max(1, math.Round(float64(m)/float64(n)*math.Ln2)))
+	return &BloomFilter{bits: make([]byte, (m+7)/8), m: m, hashes: k}
+}
+
+// Add inserts password into the filter.
+func (f *BloomFilter) Add(password string) {
+	h1, h2 := bloomHashes(password)
+	for i := uint64(0); i < uint64(f.hashes); i++ {
+		bit := (h1 + i*h2) % f.m
+		f.bits[bit/8] |= 1 << (bit % 8)
+	}
+}
+
+// Test reports whether password may be in the filter.
+func (f *BloomFilter) Test(password string) bool {
+	h1, h2 := bloomHashes(password)
+	for i := uint64(0); i < uint64(f.hashes); i++ {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func bloomHashes(password string) (uint64, uint64) {
+	sum := sha256.Sum256([]byte(password))
+	h1 := binary.BigEndian.Uint64(sum[0:8])
+	h2 := binary.BigEndian.Uint64(sum[8:16]) | 1
+	return h1, h2
+}
+
+// WriteTo writes the filter in its file format.
+func (f *BloomFilter) WriteTo(w io.Writer) (int64, error) {
+	header := make([]byte, 14)
+	copy(header, bloomMagic[:])
+	header[4] = bloomVersion
+	header[5] = f.hashes
+	binary.BigEndian.PutUint64(header[6:], f.m)
+
+	n, err := w.Write(header)
+	if err != nil {
+		return int64(n), err
+	}
+	m, err := w.Write(f.bits)
+	return int64(n + m), err
+}
+
+// ReadBloomFilter decodes a filter written by WriteTo.
+func ReadBloomFilter(r io.Reader) (*BloomFilter, error) {
+	header := make([]byte, 14)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, ErrInvalidBloomFilter
+	}
+	if [4]byte(header[:4]) != bloomMagic || header[4] != bloomVersion || header[5] == 0 {
+		return nil, ErrInvalidBloomFilter
+	}
+
+	f := &BloomFilter{hashes: header[5], m: binary.BigEndian.Uint64(header[6:])}
+	if f.m == 0 {
+		return nil, ErrInvalidBloomFilter
+	}
+	f.bits = make([]byte, (f.m+7)/8)
+	if _, err := io.ReadFull(r, f.bits); err != nil {
+		return nil, ErrInvalidBloomFilter
+	}
+	return f, nil
+}
+
+// LoadBloomFilter reads a filter file from disk.
+func LoadBloomFilter(path string) (*BloomFilter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadBloomFilter(bufio.NewReader(file))
+}
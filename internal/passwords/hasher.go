@@ -0,0 +1,109 @@
+// Package passwords hashes and verifies user passwords.
+package passwords
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrUnknownHashFormat is returned when a stored hash matches none of the
+	// configured algorithms.
+	ErrUnknownHashFormat = errors.New("unknown password hash format")
+	// ErrMalformedHash is returned when a stored hash claims a known
+	// algorithm but cannot be parsed.
+	ErrMalformedHash = errors.New("malformed password hash")
+)
+
+// Unusable is stored instead of a hash for accounts that have no password
+// yet, such as imported users. No password verifies against it.
+const Unusable = "!"
+
+// Hasher is a single password hashing algorithm. Hashes are encoded as
+// self-describing strings (PHC string format for argon2id, the modular crypt
+// format for bcrypt) so the algorithm and its parameters travel with them.
+type Hasher interface {
+	// Hash returns the encoded hash of password.
+	Hash(password string) (string, error)
+	// Verify reports whether password matches the encoded hash.
+	Verify(password, encoded string) (bool, error)
+	// Recognizes reports whether encoded was produced by this algorithm.
+	Recognizes(encoded string) bool
+	// Check returns ErrMalformedHash if encoded, which this algorithm
+	// recognizes, cannot be parsed or asks for costs beyond the hasher's
+	// limits.
+	Check(encoded string) error
+	// NeedsRehash reports whether encoded uses weaker parameters than the
+	// hasher is currently configured with.
+	NeedsRehash(encoded string) bool
+}
+
+// Manager hashes new passwords with a preferred algorithm and verifies hashes
+// produced by any of the algorithms it knows about.
+type Manager struct {
+	preferred Hasher
+	others    []Hasher
+}
+
+// NewManager returns a Manager that hashes with preferred and also accepts
+// hashes produced by others.
+func NewManager(preferred Hasher, others ...Hasher) *Manager {
+	return &Manager{preferred: preferred, others: others}
+}
+
+// Hash hashes password with the preferred algorithm.
+func (m *Manager) Hash(password string) (string, error) {
+	return m.preferred.Hash(password)
+}
+
+// Verify checks password against encoded. needsRehash is true when the
+// password matched but encoded should be replaced by a fresh Hash, either
+// because it uses another algorithm or weaker parameters.
+func (m *Manager) Verify(password, encoded string) (ok bool, needsRehash bool, err error) {
+	hasher, err := m.hasherFor(encoded)
+	if err != nil {
+		return false, false, err
+	}
+
+	ok, err = hasher.Verify(password, encoded)
+	if err != nil || !ok {
+		return false, false, err
+	}
+
+	return true, hasher != m.preferred || hasher.NeedsRehash(encoded), nil
+}
+
+// Check returns an error unless encoded is a well-formed hash, within the
+// cost limits, that the manager can verify. Hashes from outside the
+// application, such as imported ones, should pass Check before being stored.
+func (m *Manager) Check(encoded string) error {
+	hasher, err := m.hasherFor(encoded)
+	if err != nil {
+		return err
+	}
+	return hasher.Check(encoded)
+}
+
+func (m *Manager) hasherFor(encoded string) (Hasher, error) {
+	if m.preferred.Recognizes(encoded) {
+		return m.preferred, nil
+	}
+	for _, h := range m.others {
+		if h.Recognizes(encoded) {
+			return h, nil
+		}
+	}
+	return nil, ErrUnknownHashFormat
+}
+
+// NewManagerFromConfig builds a Manager that prefers the named algorithm
+// ("argon2id" or "bcrypt") and can verify hashes from both.
+func NewManagerFromConfig(algorithm string, argon Argon2idParams, bcryptCost int) *Manager {
+	argonHasher := NewArgon2idHasher(argon)
+	bcryptHasher := NewBcryptHasher(bcryptCost)
+
+	if strings.EqualFold(algorithm, "bcrypt") {
+		return NewManager(bcryptHasher, argonHasher)
+	}
+	return NewManager(argonHasher, bcryptHasher)
+}
@@ -0,0 +1,100 @@
+package passwords
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var fastArgon2id = Argon2idParams{Memory: 1024, Iterations: 1, Parallelism: 1}
+
+func TestArgon2idPHCFormat(t *testing.T) {
+	h := NewArgon2idHasher(fastArgon2id)
+
+	encoded, err := h.Hash("SecurePass@123")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(encoded, "$argon2id$v=19$m=1024,t=1,p=1$"))
+
+	ok, err := h.Verify("SecurePass@123", encoded)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = h.Verify("WrongPass@123", encoded)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = h.Verify("SecurePass@123", "$argon2id$v=19$garbage")
+	assert.ErrorIs(t, err, ErrMalformedHash)
+}
+
+func TestManagerFlagsWeakerHashesForRehash(t *testing.T) {
+	legacy := NewManager(NewBcryptHasher(4))
+	bcryptHash, _ := legacy.Hash("SecurePass@123")
+
+	weak := NewManager(NewArgon2idHasher(fastArgon2id))
+	weakHash, _ := weak.Hash("SecurePass@123")
+
+	stronger := Argon2idParams{Memory: 2048, Iterations: 2, Parallelism: 1}
+	m := NewManager(NewArgon2idHasher(stronger), NewBcryptHasher(4))
+	currentHash, _ := m.Hash("SecurePass@123")
+
+	tests := []struct {
+		name        string
+		encoded     string
+		needsRehash bool
+	}{
+		{"bcrypt hash", bcryptHash, true},
+		{"argon2id with weaker params", weakHash, true},
+		{"argon2id with current params", currentHash, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ok, needsRehash, err := m.Verify("SecurePass@123", test.encoded)
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, test.needsRehash, needsRehash)
+
+			ok, needsRehash, err = m.Verify("WrongPass@123", test.encoded)
+			assert.NoError(t, err)
+			assert.False(t, ok)
+			assert.False(t, needsRehash)
+		})
+	}
+
+	_, _, err := m.Verify("SecurePass@123", "plaintext")
+	assert.ErrorIs(t, err, ErrUnknownHashFormat)
+}
+
+func TestBcryptRejectsPasswordsItWouldTruncate(t *testing.T) {
+	_, err := NewBcryptHasher(4).Hash(strings.Repeat("a", 73))
+	assert.ErrorIs(t, err, ErrPasswordTooLong)
+}
+
+func TestBcryptRejectsOutOfRangeCost(t *testing.T) {
+	m := NewManager(NewArgon2idHasher(fastArgon2id), NewBcryptHasher(4))
+	// A well-formed hash that would take 2^31 rounds to verify.
+	encoded := "$2a$31$" + strings.Repeat("a", 53)
+	assert.ErrorIs(t, m.Check(encoded), ErrMalformedHash)
+	_, _, err := m.Verify("SecurePass@123", encoded)
+	assert.ErrorIs(t, err, ErrMalformedHash)
+}
+
+func TestArgon2idRejectsOutOfRangeCosts(t *testing.T) {
+	m := NewManager(NewArgon2idHasher(fastArgon2id), NewBcryptHasher(4))
+	valid, _ := m.Hash("SecurePass@123")
+	assert.NoError(t, m.Check(valid))
+
+	for _, costs := range []string{"m=1024,t=0,p=1", "m=1024,t=1,p=0", "m=4194304,t=1,p=1", "m=1024,t=1000,p=1"} {
+		encoded := "$argon2id$v=19$" + costs + "$c29tZXNhbHQ$a2V5a2V5a2V5a2V5"
+		assert.ErrorIs(t, m.Check(encoded), ErrMalformedHash, costs)
+		_, _, err := m.Verify("SecurePass@123", encoded)
+		assert.ErrorIs(t, err, ErrMalformedHash, costs)
+	}
+
+	longKey := "$argon2id$v=19$m=1024,t=1,p=1$c29tZXNhbHQ$" + strings.Repeat("a2V5", 64)
+	assert.ErrorIs(t, m.Check(longKey), ErrMalformedHash)
+	assert.ErrorIs(t, m.Check("$2a$10$short"), ErrMalformedHash)
+	assert.ErrorIs(t, m.Check("plaintext"), ErrUnknownHashFormat)
+}
@@ -0,0 +1,118 @@
+package passwords
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Character classes a Policy can require.
+const (
+	ClassUpper   = "upper"
+	ClassLower   = "lower"
+	ClassDigit   = "digit"
+	ClassSpecial = "special"
+)
+
+// Violation is a single broken policy rule. Rule and Param line up with the
+// struct-tag validation errors so clients can render both the same way.
+type Violation struct {
+	Rule  string
+	Param string
+}
+
+// Policy describes what a new password must look like. Reuse of previous
+// passwords needs the stored hashes and is checked by the caller using
+// HistorySize.
+type Policy struct {
+	MinLength          int
+	MaxLength          int
+	RequiredClasses    []string
+	RejectPersonalInfo bool
+	// HistorySize is how many of the latest passwords, the current one
+	// included, can't be chosen again.
+	HistorySize int
+	// Breached, when set, holds known-compromised passwords.
+	Breached *BloomFilter
+}
+
+// DefaultPolicy matches the rules the API enforced before the policy became
+// configurable.
+func DefaultPolicy() *Policy {
+	return &Policy{
+		MinLength:          8,
+		MaxLength:          MaxBcryptPasswordLength,
+		RequiredClasses:    []string{ClassUpper, ClassLower, ClassDigit, ClassSpecial},
+		RejectPersonalInfo: true,
+		HistorySize:        5,
+	}
+}
+
+// Check returns every rule password breaks. name and email belong to the
+// account the password is for and may be empty.
+func (p *Policy) Check(password, name, email string) []Violation {
+	var violations []Violation
+
+	length := len([]rune(password))
+	if p.MinLength > 0 && length < p.MinLength {
+		violations = append(violations, Violation{Rule: "min", Param: strconv.Itoa(p.MinLength)})
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, Violation{Rule: "max", Param: strconv.Itoa(p.MaxLength)})
+	}
+
+	present := characterClasses(password)
+	for _, class := range p.RequiredClasses {
+		if !present[class] {
+			violations = append(violations, Violation{Rule: class})
+		}
+	}
+
+	if p.RejectPersonalInfo && containsPersonalInfo(password, name, email) {
+		violations = append(violations, Violation{Rule: "personal_info"})
+	}
+
+	if p.Breached != nil && p.Breached.Test(password) {
+		violations = append(violations, Violation{Rule: "breached"})
+	}
+
+	return violations
+}
+
+func characterClasses(password string) map[string]bool {
+	present := map[string]bool{}
+	for _, char := range password {
+		switch {
+		case unicode.IsUpper(char):
+			present[ClassUpper] = true
+		case unicode.IsLower(char):
+			present[ClassLower] = true
+		case unicode.IsNumber(char):
+			present[ClassDigit] = true
+		case unicode.IsPunct(char) || unicode.IsSymbol(char):
+			present[ClassSpecial] = true
+		}
+	}
+	return present
+}
+
+// containsPersonalInfo reports whether password contains the email, its
+// local part, or any part of the name at least three characters long.
+func containsPersonalInfo(password, name, email string) bool {
+	lowered := strings.ToLower(password)
+
+	candidates := strings.Fields(strings.ToLower(name))
+	if email = strings.ToLower(email); email != "" {
+		candidates = append(candidates, email)
+		if at := strings.Index(email, "@"); at > 0 {
+			candidates = append(candidates, email[:at])
+		}
+	}
+
+	for _, c := range candidates {
+		if len(c) >= 3 && strings.Contains(lowered, c) {
+			return true
+		}
+	}
+	return false
+}
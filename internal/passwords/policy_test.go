@@ -0,0 +1,54 @@
+package passwords
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	breached := NewBloomFilter(10, 0.001)
+	breached.Add("P@ssw0rd123")
+
+	policy := DefaultPolicy()
+	policy.Breached = breached
+
+	tests := []struct {
+		name       string
+		password   string
+		violations []Violation
+	}{
+		{"valid", "Correct#Horse9", nil},
+		{"too short", "Ab1!", []Violation{{Rule: "min", Param: "8"}}},
+		{"missing classes", "alllowercase", []Violation{{Rule: ClassUpper}, {Rule: ClassDigit}, {Rule: ClassSpecial}}},
+		{"contains name", "Jonathan#2024", []Violation{{Rule: "personal_info"}}},
+		{"contains email local part", "xJSMITH!99a", []Violation{{Rule: "personal_info"}}},
+		{"breached", "P@ssw0rd123", []Violation{{Rule: "breached"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.violations, policy.Check(test.password, "Jonathan Smith", "jsmith@example.com"))
+		})
+	}
+}
+
+func TestBloomFilterRoundTrip(t *testing.T) {
+	filter := NewBloomFilter(100, 0.01)
+	filter.Add("hunter2")
+	filter.Add("letmein")
+
+	var buf bytes.Buffer
+	_, err := filter.WriteTo(&buf)
+	assert.NoError(t, err)
+
+	loaded, err := ReadBloomFilter(&buf)
+	assert.NoError(t, err)
+	assert.True(t, loaded.Test("hunter2"))
+	assert.True(t, loaded.Test("letmein"))
+	assert.False(t, loaded.Test("Correct#Horse9"))
+
+	_, err = ReadBloomFilter(bytes.NewReader([]byte("not a filter")))
+	assert.ErrorIs(t, err, ErrInvalidBloomFilter)
+}
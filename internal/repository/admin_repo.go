@@ -1,6 +1,9 @@
 package repository
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/liju-github/user-management/internal/models"
 	"gorm.io/gorm"
 )
@@ -20,10 +23,27 @@ func NewAdminRepository(db *gorm.DB) *AdminRepository {
 }
 
 
-func (repo *AdminRepository) FindAdminByEmail(email string) (*models.Admin, error) {
+func (repo *AdminRepository) FindAdminByID(adminID string) (*models.Admin, error) {
+	var admin models.Admin
+	if err := repo.MySQLDatabase.Where("id = ?", adminID).First(&admin).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find admin: %w", err)
+	}
+	return &admin, nil
+}
+
+
+// FindAdminByEmail finds an admin of the organization; the same email may
+// belong to admins of other organizations.
+func (repo *AdminRepository) FindAdminByEmail(organizationID, email string) (*models.Admin, error) {
 	var admin models.Admin
-	if err := repo.MySQLDatabase.Where("email = ?", email).First(&admin).Error; err != nil {
-		return nil, err 
+	if err := repo.MySQLDatabase.Where("organization_id = ? AND email = ?", organizationID, email).First(&admin).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find admin: %w", err)
 	}
 	return &admin, nil 
 }
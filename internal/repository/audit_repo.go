@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/liju-github/user-management/internal/models"
+	"gorm.io/gorm"
+)
+
+type AuditRepository struct {
+	MySQLDatabase *gorm.DB
+}
+
+type IAuditRepository interface {
+	CreateAuditEvent(*models.AuditEvent) error
+	FindAuditEventsByUser(userID string) ([]models.AuditEvent, error)
+	FindRecentAuditEventsByUser(userID string, limit int) ([]models.AuditEvent, error)
+}
+
+func NewAuditRepository(db *gorm.DB) *AuditRepository {
+	return &AuditRepository{MySQLDatabase: db}
+}
+
+func (repo *AuditRepository) CreateAuditEvent(event *models.AuditEvent) error {
+	if err := repo.MySQLDatabase.Create(event).Error; err != nil {
+		return fmt.Errorf("failed to create audit event: %w", err)
+	}
+	return nil
+}
+
+// FindAuditEventsByUser returns every event recorded against the user, oldest
+// first.
+func (repo *AuditRepository) FindAuditEventsByUser(userID string) ([]models.AuditEvent, error) {
+	var events []models.AuditEvent
+	if err := repo.MySQLDatabase.Where("user_id = ?", userID).Order("created_at").Find(&events).Error; err != nil {
+		return nil, fmt.Errorf("failed to find audit events: %w", err)
+	}
+	return events, nil
+}
+
+// FindRecentAuditEventsByUser returns the user's latest events, newest
+// first.
+func (repo *AuditRepository) FindRecentAuditEventsByUser(userID string, limit int) ([]models.AuditEvent, error) {
+	var events []models.AuditEvent
+	if err := repo.MySQLDatabase.Where("user_id = ?", userID).Order("created_at DESC").Limit(limit).Find(&events).Error; err != nil {
+		return nil, fmt.Errorf("failed to find audit events: %w", err)
+	}
+	return events, nil
+}
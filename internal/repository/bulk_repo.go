@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/tenancy"
+	"gorm.io/gorm"
+)
+
+type BulkJobRepository struct {
+	MySQLDatabase *gorm.DB
+}
+
+type IBulkJobRepository interface {
+	CreateBulkJob(*models.BulkJob) error
+	UpdateBulkJob(*models.BulkJob) error
+	FindBulkJobByID(string) (*models.BulkJob, error)
+	FailStaleBulkJobs(before time.Time) (int64, error)
+	ForOrganization(organizationID string) IBulkJobRepository
+}
+
+func NewBulkJobRepository(db *gorm.DB) *BulkJobRepository {
+	return &BulkJobRepository{MySQLDatabase: db}
+}
+
+// ForOrganization returns a repository that only sees and creates bulk jobs
+// of the organization. An empty organizationID sees every organization.
+func (repo *BulkJobRepository) ForOrganization(organizationID string) IBulkJobRepository {
+	return &BulkJobRepository{MySQLDatabase: tenancy.Scoped(repo.MySQLDatabase, organizationID)}
+}
+
+func (repo *BulkJobRepository) CreateBulkJob(job *models.BulkJob) error {
+	if err := repo.MySQLDatabase.Create(job).Error; err != nil {
+		return fmt.Errorf("failed to create bulk job: %w", err)
+	}
+	return nil
+}
+
+func (repo *BulkJobRepository) UpdateBulkJob(job *models.BulkJob) error {
+	if err := repo.MySQLDatabase.Save(job).Error; err != nil {
+		return fmt.Errorf("failed to update bulk job: %w", err)
+	}
+	return nil
+}
+
+func (repo *BulkJobRepository) FindBulkJobByID(jobID string) (*models.BulkJob, error) {
+	var job models.BulkJob
+	if err := repo.MySQLDatabase.Where("id = ?", jobID).First(&job).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find bulk job: %w", err)
+	}
+	return &job, nil
+}
+
+// FailStaleBulkJobs marks pending and running jobs that have not been saved
+// since before as failed and returns how many there were.
+func (repo *BulkJobRepository) FailStaleBulkJobs(before time.Time) (int64, error) {
+	result := repo.MySQLDatabase.Model(&models.BulkJob{}).
+		Where("status IN ? AND (updated_at IS NULL OR updated_at < ?)", []string{models.BulkJobPending, models.BulkJobRunning}, before).
+		Updates(map[string]interface{}{"status": models.BulkJobFailed, "completed_at": time.Now()})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to fail stale bulk jobs: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/liju-github/user-management/internal/models"
+	"gorm.io/gorm"
+)
+
+type ExportRepository struct {
+	MySQLDatabase *gorm.DB
+}
+
+type IExportRepository interface {
+	CreateExport(*models.DataExport) error
+	UpdateExport(*models.DataExport) error
+	FindExportByID(string) (*models.DataExport, error)
+	FindExportByToken(string) (*models.DataExport, error)
+	FindActiveExport(userID string) (*models.DataExport, error)
+	FindExpiredExports(before time.Time, limit int) ([]models.DataExport, error)
+	FindExportsByUser(userID string) ([]models.DataExport, error)
+	DeleteExport(string) error
+}
+
+func NewExportRepository(db *gorm.DB) *ExportRepository {
+	return &ExportRepository{MySQLDatabase: db}
+}
+
+func (repo *ExportRepository) CreateExport(export *models.DataExport) error {
+	if err := repo.MySQLDatabase.Create(export).Error; err != nil {
+		return fmt.Errorf("failed to create data export: %w", err)
+	}
+	return nil
+}
+
+func (repo *ExportRepository) UpdateExport(export *models.DataExport) error {
+	if err := repo.MySQLDatabase.Save(export).Error; err != nil {
+		return fmt.Errorf("failed to update data export: %w", err)
+	}
+	return nil
+}
+
+func (repo *ExportRepository) findExport(query string, args ...interface{}) (*models.DataExport, error) {
+	var export models.DataExport
+	if err := repo.MySQLDatabase.Where(query, args...).Order("created_at DESC").First(&export).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find data export: %w", err)
+	}
+	return &export, nil
+}
+
+func (repo *ExportRepository) FindExportByID(exportID string) (*models.DataExport, error) {
+	return repo.findExport("id = ?", exportID)
+}
+
+func (repo *ExportRepository) FindExportByToken(token string) (*models.DataExport, error) {
+	return repo.findExport("download_token = ?", token)
+}
+
+// FindActiveExport returns the user's export that is still pending or
+// running, if any.
+func (repo *ExportRepository) FindActiveExport(userID string) (*models.DataExport, error) {
+	return repo.findExport("user_id = ? AND status IN ?", userID, []string{models.ExportPending, models.ExportRunning})
+}
+
+// FindExpiredExports returns exports whose download link expired before the
+// given time.
+func (repo *ExportRepository) FindExpiredExports(before time.Time, limit int) ([]models.DataExport, error) {
+	var exports []models.DataExport
+	if err := repo.MySQLDatabase.Where("expires_at <= ?", before).Limit(limit).Find(&exports).Error; err != nil {
+		return nil, fmt.Errorf("failed to find expired data exports: %w", err)
+	}
+	return exports, nil
+}
+
+// FindExportsByUser returns all of the user's exports, whatever their status.
+func (repo *ExportRepository) FindExportsByUser(userID string) ([]models.DataExport, error) {
+	var exports []models.DataExport
+	if err := repo.MySQLDatabase.Where("user_id = ?", userID).Find(&exports).Error; err != nil {
+		return nil, fmt.Errorf("failed to find data exports: %w", err)
+	}
+	return exports, nil
+}
+
+func (repo *ExportRepository) DeleteExport(exportID string) error {
+	if err := repo.MySQLDatabase.Where("id = ?", exportID).Delete(&models.DataExport{}).Error; err != nil {
+		return fmt.Errorf("failed to delete data export: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/tenancy"
+	"gorm.io/gorm"
+)
+
+// GroupRepository stores groups and their memberships. Groups belong to an
+// organization; memberships are reached through their group.
+type GroupRepository struct {
+	MySQLDatabase *gorm.DB
+}
+
+type IGroupRepository interface {
+	CreateGroup(*models.Group) error
+	UpdateGroup(*models.Group) error
+	DeleteGroup(groupID string) error
+	FindGroupByID(string) (*models.Group, error)
+	FindGroupByName(string) (*models.Group, error)
+	FindGroups() ([]models.Group, error)
+	FindMembers(groupID string) ([]models.GroupMember, error)
+	FindMember(groupID, userID string) (*models.GroupMember, error)
+	SaveMember(*models.GroupMember) error
+	RemoveMember(groupID, userID string) error
+	FindGroupsByUser(userID string) ([]models.UserGroup, error)
+	ForOrganization(organizationID string) IGroupRepository
+}
+
+func NewGroupRepository(db *gorm.DB) *GroupRepository {
+	return &GroupRepository{MySQLDatabase: db}
+}
+
+// ForOrganization returns a repository that only sees and creates groups of
+// the organization. An empty organizationID sees every organization.
+func (repo *GroupRepository) ForOrganization(organizationID string) IGroupRepository {
+	return &GroupRepository{MySQLDatabase: tenancy.Scoped(repo.MySQLDatabase, organizationID)}
+}
+
+func (repo *GroupRepository) CreateGroup(group *models.Group) error {
+	if err := repo.MySQLDatabase.Create(group).Error; err != nil {
+		return fmt.Errorf("failed to create group: %w", err)
+	}
+	return nil
+}
+
+func (repo *GroupRepository) UpdateGroup(group *models.Group) error {
+	if err := repo.MySQLDatabase.Save(group).Error; err != nil {
+		return fmt.Errorf("failed to update group: %w", err)
+	}
+	return nil
+}
+
+// DeleteGroup removes the group together with its memberships.
+func (repo *GroupRepository) DeleteGroup(groupID string) error {
+	err := repo.MySQLDatabase.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ?", groupID).Delete(&models.GroupMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", groupID).Delete(&models.Group{}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete group: %w", err)
+	}
+	return nil
+}
+
+func (repo *GroupRepository) FindGroupByID(groupID string) (*models.Group, error) {
+	return repo.findGroup("id = ?", groupID)
+}
+
+func (repo *GroupRepository) FindGroupByName(name string) (*models.Group, error) {
+	return repo.findGroup("name = ?", name)
+}
+
+func (repo *GroupRepository) findGroup(query string, arg string) (*models.Group, error) {
+	var group models.Group
+	if err := repo.MySQLDatabase.Where(query, arg).First(&group).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find group: %w", err)
+	}
+	return &group, nil
+}
+
+// FindGroups returns the groups with their member counts, by name.
+func (repo *GroupRepository) FindGroups() ([]models.Group, error) {
+	var groups []models.Group
+	members := repo.MySQLDatabase.Model(&models.GroupMember{}).Select("COUNT(*)").Where("group_members.group_id = `groups`.id")
+	err := repo.MySQLDatabase.Model(&models.Group{}).
+		Select("`groups`.*, (?) AS member_count", members).
+		Order("name").Find(&groups).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find groups: %w", err)
+	}
+	return groups, nil
+}
+
+// FindMembers returns the group's members, owners first.
+func (repo *GroupRepository) FindMembers(groupID string) ([]models.GroupMember, error) {
+	var members []models.GroupMember
+	err := repo.MySQLDatabase.Where("group_id = ?", groupID).
+		Order(fmt.Sprintf("role = '%s' DESC, created_at", models.GroupRoleOwner)).
+		Find(&members).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find group members: %w", err)
+	}
+	return members, nil
+}
+
+func (repo *GroupRepository) FindMember(groupID, userID string) (*models.GroupMember, error) {
+	var member models.GroupMember
+	if err := repo.MySQLDatabase.Where("group_id = ? AND user_id = ?", groupID, userID).First(&member).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find group member: %w", err)
+	}
+	return &member, nil
+}
+
+// SaveMember adds the membership, or updates the role of an existing one.
+func (repo *GroupRepository) SaveMember(member *models.GroupMember) error {
+	if err := repo.MySQLDatabase.Save(member).Error; err != nil {
+		return fmt.Errorf("failed to save group member: %w", err)
+	}
+	return nil
+}
+
+func (repo *GroupRepository) RemoveMember(groupID, userID string) error {
+	if err := repo.MySQLDatabase.Where("group_id = ? AND user_id = ?", groupID, userID).Delete(&models.GroupMember{}).Error; err != nil {
+		return fmt.Errorf("failed to remove group member: %w", err)
+	}
+	return nil
+}
+
+// FindGroupsByUser returns the groups the user belongs to, by name.
+func (repo *GroupRepository) FindGroupsByUser(userID string) ([]models.UserGroup, error) {
+	var groups []models.UserGroup
+	err := repo.MySQLDatabase.Model(&models.Group{}).
+		Select("`groups`.id AS id, `groups`.name AS name, group_members.role AS role").
+		Joins("JOIN group_members ON group_members.group_id = `groups`.id").
+		Where("group_members.user_id = ?", userID).
+		Order("`groups`.name").
+		Scan(&groups).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find user groups: %w", err)
+	}
+	return groups, nil
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/tenancy"
+	"gorm.io/gorm"
+)
+
+// IdentityRepository stores the provider identities users sign in with and
+// the sign-ins in progress.
+type IdentityRepository struct {
+	MySQLDatabase *gorm.DB
+}
+
+type IIdentityRepository interface {
+	CreateSocialLogin(*models.SocialLogin) error
+	TakeSocialLogin(state string) (*models.SocialLogin, error)
+	DeleteExpiredSocialLogins(before time.Time) (int64, error)
+	FindIdentity(provider, subject string) (*models.UserIdentity, error)
+	FindIdentitiesByUser(userID string) ([]models.UserIdentity, error)
+	ForOrganization(organizationID string) IIdentityRepository
+}
+
+func NewIdentityRepository(db *gorm.DB) *IdentityRepository {
+	return &IdentityRepository{MySQLDatabase: db}
+}
+
+// ForOrganization returns a repository that only sees and creates
+// identities and sign-ins of the organization. An empty organizationID sees
+// every organization.
+func (repo *IdentityRepository) ForOrganization(organizationID string) IIdentityRepository {
+	return &IdentityRepository{MySQLDatabase: tenancy.Scoped(repo.MySQLDatabase, organizationID)}
+}
+
+func (repo *IdentityRepository) CreateSocialLogin(login *models.SocialLogin) error {
+	if err := repo.MySQLDatabase.Create(login).Error; err != nil {
+		return fmt.Errorf("failed to create social login: %w", err)
+	}
+	return nil
+}
+
+// TakeSocialLogin finds the sign-in started with state and deletes it, so
+// the state can only be used once.
+func (repo *IdentityRepository) TakeSocialLogin(state string) (*models.SocialLogin, error) {
+	var login models.SocialLogin
+	err := repo.MySQLDatabase.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("state = ?", state).First(&login).Error; err != nil {
+			return err
+		}
+		result := tx.Where("state = ?", state).Delete(&models.SocialLogin{})
+		if result.Error == nil && result.RowsAffected == 0 {
+			// Someone else took it first.
+			return gorm.ErrRecordNotFound
+		}
+		return result.Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to take social login: %w", err)
+	}
+	return &login, nil
+}
+
+// DeleteExpiredSocialLogins removes sign-ins that were never completed.
+func (repo *IdentityRepository) DeleteExpiredSocialLogins(before time.Time) (int64, error) {
+	result := repo.MySQLDatabase.Where("expires_at < ?", before).Delete(&models.SocialLogin{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete expired social logins: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+func (repo *IdentityRepository) FindIdentity(provider, subject string) (*models.UserIdentity, error) {
+	var identity models.UserIdentity
+	if err := repo.MySQLDatabase.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find identity: %w", err)
+	}
+	return &identity, nil
+}
+
+func (repo *IdentityRepository) FindIdentitiesByUser(userID string) ([]models.UserIdentity, error) {
+	var identities []models.UserIdentity
+	if err := repo.MySQLDatabase.Where("user_id = ?", userID).Order("created_at").Find(&identities).Error; err != nil {
+		return nil, fmt.Errorf("failed to find identities: %w", err)
+	}
+	return identities, nil
+}
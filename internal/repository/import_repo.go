@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/liju-github/user-management/internal/models"
+	"gorm.io/gorm"
+)
+
+type ImportRepository struct {
+	MySQLDatabase *gorm.DB
+}
+
+type IImportRepository interface {
+	CreateImportJob(*models.ImportJob) error
+	UpdateImportJob(*models.ImportJob) error
+	FindImportJobByID(string) (*models.ImportJob, error)
+	FindExistingEmails(organizationID string, emails []string) ([]string, error)
+	ImportChunk(job *models.ImportJob, users []models.User) error
+	ClaimImportJob(jobID string, staleBefore time.Time) (bool, error)
+}
+
+func NewImportRepository(db *gorm.DB) *ImportRepository {
+	return &ImportRepository{MySQLDatabase: db}
+}
+
+func (repo *ImportRepository) CreateImportJob(job *models.ImportJob) error {
+	if err := repo.MySQLDatabase.Create(job).Error; err != nil {
+		return fmt.Errorf("failed to create import job: %w", err)
+	}
+	return nil
+}
+
+func (repo *ImportRepository) UpdateImportJob(job *models.ImportJob) error {
+	if err := repo.MySQLDatabase.Save(job).Error; err != nil {
+		return fmt.Errorf("failed to update import job: %w", err)
+	}
+	return nil
+}
+
+// ClaimImportJob marks a job as running if it is paused, failed, or running
+// without having been saved since staleBefore. It reports whether the job
+// was claimed, so two callers never resume the same job.
+func (repo *ImportRepository) ClaimImportJob(jobID string, staleBefore time.Time) (bool, error) {
+	result := repo.MySQLDatabase.Model(&models.ImportJob{}).
+		Where("id = ? AND (status IN ? OR (status = ? AND (updated_at IS NULL OR updated_at < ?)))",
+			jobID, []string{models.ImportPaused, models.ImportFailed}, models.ImportRunning, staleBefore).
+		Update("status", models.ImportRunning)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to claim import job: %w", result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (repo *ImportRepository) FindImportJobByID(jobID string) (*models.ImportJob, error) {
+	var job models.ImportJob
+	if err := repo.MySQLDatabase.Where("id = ?", jobID).First(&job).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find import job: %w", err)
+	}
+	return &job, nil
+}
+
+// FindExistingEmails returns which of the given emails already belong to a
+// live user of the organization.
+func (repo *ImportRepository) FindExistingEmails(organizationID string, emails []string) ([]string, error) {
+	var existing []string
+	if len(emails) == 0 {
+		return existing, nil
+	}
+	if err := repo.MySQLDatabase.Model(&models.User{}).Where("organization_id = ? AND email IN ?", organizationID, emails).Pluck("email", &existing).Error; err != nil {
+		return nil, fmt.Errorf("failed to find existing emails: %w", err)
+	}
+	return existing, nil
+}
+
+// ImportChunk inserts a chunk of users and saves the job's progress in one
+// transaction, so a resumed job never inserts the same users twice.
+func (repo *ImportRepository) ImportChunk(job *models.ImportJob, users []models.User) error {
+	return repo.MySQLDatabase.Transaction(func(tx *gorm.DB) error {
+		if len(users) > 0 {
+			if err := tx.CreateInBatches(users, len(users)).Error; err != nil {
+				return fmt.Errorf("failed to insert imported users: %w", err)
+			}
+		}
+		if err := tx.Save(job).Error; err != nil {
+			return fmt.Errorf("failed to update import job: %w", err)
+		}
+		return nil
+	})
+}
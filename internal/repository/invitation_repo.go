@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/tenancy"
+	"gorm.io/gorm"
+)
+
+type InvitationRepository struct {
+	MySQLDatabase *gorm.DB
+}
+
+type IInvitationRepository interface {
+	CreateInvitation(*models.Invitation) error
+	UpdateInvitation(*models.Invitation) error
+	FindInvitationByID(string) (*models.Invitation, error)
+	FindPendingInvitation(email string, now time.Time) (*models.Invitation, error)
+	FindInvitations(status string, now time.Time) ([]models.Invitation, error)
+	FindInvitationsByUser(userID string) ([]models.Invitation, error)
+	ForOrganization(organizationID string) IInvitationRepository
+}
+
+func NewInvitationRepository(db *gorm.DB) *InvitationRepository {
+	return &InvitationRepository{MySQLDatabase: db}
+}
+
+// ForOrganization returns a repository that only sees and creates
+// invitations of the organization. An empty organizationID sees every
+// organization.
+func (repo *InvitationRepository) ForOrganization(organizationID string) IInvitationRepository {
+	return &InvitationRepository{MySQLDatabase: tenancy.Scoped(repo.MySQLDatabase, organizationID)}
+}
+
+func (repo *InvitationRepository) CreateInvitation(invitation *models.Invitation) error {
+	if err := repo.MySQLDatabase.Create(invitation).Error; err != nil {
+		return fmt.Errorf("failed to create invitation: %w", err)
+	}
+	return nil
+}
+
+func (repo *InvitationRepository) UpdateInvitation(invitation *models.Invitation) error {
+	if err := repo.MySQLDatabase.Save(invitation).Error; err != nil {
+		return fmt.Errorf("failed to update invitation: %w", err)
+	}
+	return nil
+}
+
+func (repo *InvitationRepository) FindInvitationByID(invitationID string) (*models.Invitation, error) {
+	var invitation models.Invitation
+	if err := repo.MySQLDatabase.Where("id = ?", invitationID).First(&invitation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find invitation: %w", err)
+	}
+	return &invitation, nil
+}
+
+// FindPendingInvitation finds an invitation for email that can still be
+// accepted.
+func (repo *InvitationRepository) FindPendingInvitation(email string, now time.Time) (*models.Invitation, error) {
+	var invitation models.Invitation
+	err := pendingInvitations(repo.MySQLDatabase, now).Where("email = ?", email).First(&invitation).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find invitation: %w", err)
+	}
+	return &invitation, nil
+}
+
+// FindInvitations returns the invitations in status, or all of them when it
+// is empty, newest first.
+func (repo *InvitationRepository) FindInvitations(status string, now time.Time) ([]models.Invitation, error) {
+	query := repo.MySQLDatabase
+	switch status {
+	case models.InvitationPending:
+		query = pendingInvitations(query, now)
+	case models.InvitationAccepted:
+		query = query.Where("accepted_at IS NOT NULL")
+	case models.InvitationRevoked:
+		query = query.Where("revoked_at IS NOT NULL")
+	case models.InvitationExpired:
+		query = query.Where("accepted_at IS NULL AND revoked_at IS NULL AND expires_at <= ?", now)
+	}
+
+	var invitations []models.Invitation
+	if err := query.Order("created_at DESC").Find(&invitations).Error; err != nil {
+		return nil, fmt.Errorf("failed to find invitations: %w", err)
+	}
+	return invitations, nil
+}
+
+func pendingInvitations(db *gorm.DB, now time.Time) *gorm.DB {
+	return db.Where("accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", now)
+}
+
+// FindInvitationsByUser returns the invitations the user signed up with.
+func (repo *InvitationRepository) FindInvitationsByUser(userID string) ([]models.Invitation, error) {
+	var invitations []models.Invitation
+	if err := repo.MySQLDatabase.Where("accepted_user_id = ?", userID).Order("created_at").Find(&invitations).Error; err != nil {
+		return nil, fmt.Errorf("failed to find invitations: %w", err)
+	}
+	return invitations, nil
+}
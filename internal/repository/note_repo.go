@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/liju-github/user-management/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// NoteRepository stores the private notes and tags admins keep on users.
+type NoteRepository struct {
+	MySQLDatabase *gorm.DB
+}
+
+type INoteRepository interface {
+	CreateNote(*models.UserNote) error
+	FindNoteByID(string) (*models.UserNote, error)
+	FindNotesByUser(userID string) ([]models.UserNote, error)
+	UpdateNote(note *models.UserNote, previous *models.UserNoteRevision) error
+	FindNoteRevisions(noteID string) ([]models.UserNoteRevision, error)
+	FindTagsByUser(userID string) ([]string, error)
+	AddTags(tags []models.UserTag) error
+	RemoveTag(userID, tag string) error
+	CountTags() ([]models.TagCount, error)
+}
+
+func NewNoteRepository(db *gorm.DB) *NoteRepository {
+	return &NoteRepository{MySQLDatabase: db}
+}
+
+func (repo *NoteRepository) CreateNote(note *models.UserNote) error {
+	if err := repo.MySQLDatabase.Create(note).Error; err != nil {
+		return fmt.Errorf("failed to create note: %w", err)
+	}
+	return nil
+}
+
+func (repo *NoteRepository) FindNoteByID(noteID string) (*models.UserNote, error) {
+	var note models.UserNote
+	if err := repo.MySQLDatabase.Where("id = ?", noteID).First(&note).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find note: %w", err)
+	}
+	return &note, nil
+}
+
+// FindNotesByUser returns the user's notes, newest first.
+func (repo *NoteRepository) FindNotesByUser(userID string) ([]models.UserNote, error) {
+	var notes []models.UserNote
+	if err := repo.MySQLDatabase.Where("user_id = ?", userID).Order("created_at DESC").Find(&notes).Error; err != nil {
+		return nil, fmt.Errorf("failed to find notes: %w", err)
+	}
+	return notes, nil
+}
+
+// UpdateNote saves an edited note together with the revision holding the
+// text it replaced.
+func (repo *NoteRepository) UpdateNote(note *models.UserNote, previous *models.UserNoteRevision) error {
+	err := repo.MySQLDatabase.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(previous).Error; err != nil {
+			return err
+		}
+		return tx.Save(note).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update note: %w", err)
+	}
+	return nil
+}
+
+// FindNoteRevisions returns the earlier versions of a note, newest first.
+func (repo *NoteRepository) FindNoteRevisions(noteID string) ([]models.UserNoteRevision, error) {
+	var revisions []models.UserNoteRevision
+	if err := repo.MySQLDatabase.Where("note_id = ?", noteID).Order("created_at DESC").Find(&revisions).Error; err != nil {
+		return nil, fmt.Errorf("failed to find note revisions: %w", err)
+	}
+	return revisions, nil
+}
+
+// FindTagsByUser returns the user's tags in alphabetical order.
+func (repo *NoteRepository) FindTagsByUser(userID string) ([]string, error) {
+	var tags []string
+	if err := repo.MySQLDatabase.Model(&models.UserTag{}).Where("user_id = ?", userID).Order("tag").Pluck("tag", &tags).Error; err != nil {
+		return nil, fmt.Errorf("failed to find tags: %w", err)
+	}
+	return tags, nil
+}
+
+// AddTags tags users, leaving tags they already carry untouched.
+func (repo *NoteRepository) AddTags(tags []models.UserTag) error {
+	if err := repo.MySQLDatabase.Clauses(clause.OnConflict{DoNothing: true}).Create(&tags).Error; err != nil {
+		return fmt.Errorf("failed to add tags: %w", err)
+	}
+	return nil
+}
+
+func (repo *NoteRepository) RemoveTag(userID, tag string) error {
+	if err := repo.MySQLDatabase.Where("user_id = ? AND tag = ?", userID, tag).Delete(&models.UserTag{}).Error; err != nil {
+		return fmt.Errorf("failed to remove tag: %w", err)
+	}
+	return nil
+}
+
+// CountTags returns every tag on a live user with how many users carry it,
+// most used first.
+func (repo *NoteRepository) CountTags() ([]models.TagCount, error) {
+	var counts []models.TagCount
+	err := repo.MySQLDatabase.Model(&models.UserTag{}).
+		Select("user_tags.tag AS tag, COUNT(*) AS count").
+		Joins("JOIN users ON users.id = user_tags.user_id AND users.deleted_at IS NULL").
+		Group("user_tags.tag").Order("count DESC, tag").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count tags: %w", err)
+	}
+	return counts, nil
+}
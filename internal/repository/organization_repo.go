@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/liju-github/user-management/internal/models"
+	"gorm.io/gorm"
+)
+
+type OrganizationRepository struct {
+	MySQLDatabase *gorm.DB
+}
+
+type IOrganizationRepository interface {
+	CreateOrganization(*models.Organization) error
+	UpdateOrganization(*models.Organization) error
+	FindOrganizationByID(string) (*models.Organization, error)
+	FindOrganizationBySlug(string) (*models.Organization, error)
+	FindOrganizations() ([]models.Organization, error)
+}
+
+func NewOrganizationRepository(db *gorm.DB) *OrganizationRepository {
+	return &OrganizationRepository{MySQLDatabase: db}
+}
+
+func (repo *OrganizationRepository) CreateOrganization(organization *models.Organization) error {
+	if err := repo.MySQLDatabase.Create(organization).Error; err != nil {
+		return fmt.Errorf("failed to create organization: %w", err)
+	}
+	return nil
+}
+
+func (repo *OrganizationRepository) UpdateOrganization(organization *models.Organization) error {
+	if err := repo.MySQLDatabase.Save(organization).Error; err != nil {
+		return fmt.Errorf("failed to update organization: %w", err)
+	}
+	return nil
+}
+
+func (repo *OrganizationRepository) FindOrganizationByID(organizationID string) (*models.Organization, error) {
+	return repo.findOrganization("id", organizationID)
+}
+
+func (repo *OrganizationRepository) FindOrganizationBySlug(slug string) (*models.Organization, error) {
+	return repo.findOrganization("slug", slug)
+}
+
+func (repo *OrganizationRepository) findOrganization(field, value string) (*models.Organization, error) {
+	var organization models.Organization
+	if err := repo.MySQLDatabase.Where(field+" = ?", value).First(&organization).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find organization: %w", err)
+	}
+	return &organization, nil
+}
+
+func (repo *OrganizationRepository) FindOrganizations() ([]models.Organization, error) {
+	var organizations []models.Organization
+	if err := repo.MySQLDatabase.Order("created_at").Find(&organizations).Error; err != nil {
+		return nil, fmt.Errorf("failed to find organizations: %w", err)
+	}
+	return organizations, nil
+}
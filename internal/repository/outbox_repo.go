@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/liju-github/user-management/internal/models"
+	"gorm.io/gorm"
+)
+
+// OutboxRepository is where the event relay reads committed events from.
+// Events are written by UserRepository.CreateOutboxEvents inside the
+// transaction of the change they describe.
+type OutboxRepository struct {
+	MySQLDatabase *gorm.DB
+}
+
+func NewOutboxRepository(db *gorm.DB) *OutboxRepository {
+	return &OutboxRepository{MySQLDatabase: db}
+}
+
+// ClaimOutboxEvents marks up to limit unpublished events that nobody else
+// holds as claimed until until and returns them, oldest first.
+func (repo *OutboxRepository) ClaimOutboxEvents(now, until time.Time, limit int) ([]models.OutboxEvent, error) {
+	token := uuid.New().String()
+	err := repo.MySQLDatabase.Model(&models.OutboxEvent{}).
+		Where("published_at IS NULL AND (claimed_until IS NULL OR claimed_until < ?)", now).
+		Order("created_at").
+		Limit(limit).
+		Updates(map[string]interface{}{"claim_token": token, "claimed_until": until}).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim outbox events: %w", err)
+	}
+
+	var records []models.OutboxEvent
+	if err := repo.MySQLDatabase.Where("claim_token = ?", token).Order("created_at").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to find outbox events: %w", err)
+	}
+	return records, nil
+}
+
+func (repo *OutboxRepository) MarkOutboxEventsPublished(ids []string, at time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := repo.MySQLDatabase.Model(&models.OutboxEvent{}).Where("id IN ?", ids).Update("published_at", at).Error; err != nil {
+		return fmt.Errorf("failed to mark outbox events published: %w", err)
+	}
+	return nil
+}
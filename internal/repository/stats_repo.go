@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/liju-github/user-management/internal/models"
+	"gorm.io/gorm"
+)
+
+// StatsRepository computes the admin dashboard aggregates in SQL.
+type StatsRepository struct {
+	MySQLDatabase *gorm.DB
+}
+
+type IStatsRepository interface {
+	CountUsers(now time.Time) (*models.UserCounts, error)
+	CountSignups(interval string, from, to time.Time) ([]models.StatsBucket, error)
+	CountLoginsByDay(from, to time.Time) ([]models.StatsBucket, error)
+	CountGenders() ([]models.StatsBucket, error)
+	CountAgeGroups() ([]models.StatsBucket, error)
+}
+
+func NewStatsRepository(db *gorm.DB) *StatsRepository {
+	return &StatsRepository{MySQLDatabase: db}
+}
+
+// statsKeyFormats are the MySQL DATE_FORMAT patterns producing the
+// models.StatsBucket keys for each interval.
+var statsKeyFormats = map[string]string{
+	models.StatsDay:   "%Y-%m-%d",
+	models.StatsWeek:  "%x-W%v",
+	models.StatsMonth: "%Y-%m",
+}
+
+// CountUsers counts live, verified, actively blocked and soft-deleted users
+// in one pass over the table.
+func (repo *StatsRepository) CountUsers(now time.Time) (*models.UserCounts, error) {
+	var counts models.UserCounts
+	err := repo.MySQLDatabase.Unscoped().Model(&models.User{}).
+		Select(`COUNT(CASE WHEN deleted_at IS NULL THEN 1 END) AS total,
+			COUNT(CASE WHEN deleted_at IS NULL AND is_verified THEN 1 END) AS verified,
+			COUNT(CASE WHEN deleted_at IS NULL AND is_blocked AND (blocked_until IS NULL OR blocked_until > ?) THEN 1 END) AS blocked,
+			COUNT(CASE WHEN deleted_at IS NOT NULL THEN 1 END) AS deleted`, now).
+		Scan(&counts).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count users: %w", err)
+	}
+	return &counts, nil
+}
+
+// CountSignups counts the users created in [from, to) per interval,
+// including those deleted since. Intervals without signups are omitted.
+func (repo *StatsRepository) CountSignups(interval string, from, to time.Time) ([]models.StatsBucket, error) {
+	format, ok := statsKeyFormats[interval]
+	if !ok {
+		return nil, fmt.Errorf("failed to count signups: unknown interval %q", interval)
+	}
+
+	var buckets []models.StatsBucket
+	err := repo.MySQLDatabase.Unscoped().Model(&models.User{}).
+		Select("DATE_FORMAT(created_at, ?) AS `key`, COUNT(*) AS count", format).
+		Where("created_at >= ? AND created_at < ?", from, to).
+		Group("`key`").Order("`key`").
+		Scan(&buckets).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count signups: %w", err)
+	}
+	return buckets, nil
+}
+
+// CountLoginsByDay counts the sessions users started themselves in
+// [from, to) per day. Impersonation sessions are left out.
+func (repo *StatsRepository) CountLoginsByDay(from, to time.Time) ([]models.StatsBucket, error) {
+	var buckets []models.StatsBucket
+	err := repo.MySQLDatabase.Model(&models.Session{}).
+		Select("DATE_FORMAT(created_at, ?) AS `key`, COUNT(*) AS count", statsKeyFormats[models.StatsDay]).
+		Where("created_at >= ? AND created_at < ?", from, to).
+		Where("impersonator_id = '' OR impersonator_id IS NULL").
+		Group("`key`").Order("`key`").
+		Scan(&buckets).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count logins: %w", err)
+	}
+	return buckets, nil
+}
+
+// CountGenders counts live users per gender.
+func (repo *StatsRepository) CountGenders() ([]models.StatsBucket, error) {
+	var buckets []models.StatsBucket
+	err := repo.MySQLDatabase.Model(&models.User{}).
+		Select("COALESCE(NULLIF(gender, ''), 'unknown') AS `key`, COUNT(*) AS count").
+		Group("`key`").Order("count DESC").
+		Scan(&buckets).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count genders: %w", err)
+	}
+	return buckets, nil
+}
+
+// CountAgeGroups counts live users per age group. Users without an age
+// are counted as "unknown".
+func (repo *StatsRepository) CountAgeGroups() ([]models.StatsBucket, error) {
+	var buckets []models.StatsBucket
+	err := repo.MySQLDatabase.Model(&models.User{}).
+		Select(`CASE
+			WHEN age IS NULL OR age = 0 THEN 'unknown'
+			WHEN age < 18 THEN 'under_18'
+			WHEN age < 25 THEN '18-24'
+			WHEN age < 35 THEN '25-34'
+			WHEN age < 45 THEN '35-44'
+			WHEN age < 55 THEN '45-54'
+			WHEN age < 65 THEN '55-64'
+			ELSE '65+' END AS ` + "`key`" + `, COUNT(*) AS count`).
+		Group("`key`").
+		Scan(&buckets).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count age groups: %w", err)
+	}
+	return buckets, nil
+}
@@ -2,11 +2,18 @@ package repository
 
 import (
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/tenancy"
 	"gorm.io/gorm"
 )
 
+// ErrNotFound is returned when the requested record does not exist.
+var ErrNotFound = errors.New("record not found")
+
 type UserRepository struct {
 	MySQLDatabase *gorm.DB
 }
@@ -19,7 +26,26 @@ type IUserRepository interface {
     FindUserByVerificationToken(string) (*models.User, error)
     CreatePasswordReset(*models.PasswordReset) error
     FindPasswordResetByToken(string) (*models.PasswordReset, error)
+    FindPasswordResetsByUser(userID string) ([]models.PasswordReset, error)
     DeletePasswordReset(string) error
+    FindPasswordHistory(userID string, limit int) ([]models.PasswordHistory, error)
+    UpdatePassword(user *models.User, previousHash string, keep int) error
+    FindUsersDueForPurge(before time.Time, limit int) ([]models.User, error)
+    PurgeUser(userID string) error
+    FindDeletedUserByEmail(string) (*models.User, error)
+    DeleteUser(userID string) error
+    RestoreUser(userID string) error
+    BlockUser(user *models.User, block *models.UserBlock) error
+    UnblockUser(user *models.User, liftedBy string) error
+    FindBlocksByUser(userID string) ([]models.UserBlock, error)
+    CreateSession(*models.Session) error
+    FindSessionsByUser(userID string, limit int) ([]models.Session, error)
+    RevokeSessions(userID string, at time.Time) (int64, error)
+    CreateOutboxEvents([]models.OutboxEvent) error
+    Transaction(fn func(IUserRepository) error) error
+    ForOrganization(organizationID string) IUserRepository
+    AcceptInvitation(invitation *models.Invitation, member *models.GroupMember) error
+    CreateIdentity(identity *models.UserIdentity) error
 }
 
 func NewUserRepository(db *gorm.DB) *UserRepository {
@@ -27,9 +53,78 @@ func NewUserRepository(db *gorm.DB) *UserRepository {
 }
 
 
+// ForOrganization returns a repository that only sees and creates users of
+// the organization. An empty organizationID sees every organization.
+func (repo *UserRepository) ForOrganization(organizationID string) IUserRepository {
+	return repo.InOrganization(organizationID)
+}
+
+
+// InOrganization is ForOrganization for callers that need the concrete
+// repository.
+func (repo *UserRepository) InOrganization(organizationID string) *UserRepository {
+	return &UserRepository{MySQLDatabase: tenancy.Scoped(repo.MySQLDatabase, organizationID)}
+}
+
+
+// Transaction runs fn against a repository whose writes commit together, or
+// not at all if fn returns an error.
+func (repo *UserRepository) Transaction(fn func(IUserRepository) error) error {
+	return repo.MySQLDatabase.Transaction(func(tx *gorm.DB) error {
+		return fn(&UserRepository{MySQLDatabase: tx})
+	})
+}
+
+
+// CreateOutboxEvents stores domain events for the relay to dispatch. Call it
+// inside Transaction so they are only seen once the change commits.
+func (repo *UserRepository) CreateOutboxEvents(records []models.OutboxEvent) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if err := repo.MySQLDatabase.Create(&records).Error; err != nil {
+		return fmt.Errorf("failed to create outbox events: %w", err)
+	}
+	return nil
+}
+
+
+// AcceptInvitation records that invitation was used to sign up and adds the
+// group membership it grants, if any. It returns ErrNotFound when the
+// invitation has been accepted or revoked in the meantime, so call it in
+// the same Transaction that creates the user.
+func (repo *UserRepository) AcceptInvitation(invitation *models.Invitation, member *models.GroupMember) error {
+	result := repo.MySQLDatabase.Model(&models.Invitation{}).
+		Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", invitation.ID).
+		Updates(map[string]interface{}{"accepted_at": invitation.AcceptedAt, "accepted_user_id": invitation.AcceptedUserID})
+	if result.Error != nil {
+		return fmt.Errorf("failed to accept invitation: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	if member != nil {
+		if err := repo.MySQLDatabase.Create(member).Error; err != nil {
+			return fmt.Errorf("failed to add group member: %w", err)
+		}
+	}
+	return nil
+}
+
+// CreateIdentity links the user to a provider identity. It is here rather
+// than in IdentityRepository so a new user and their identity can be
+// created in one Transaction.
+func (repo *UserRepository) CreateIdentity(identity *models.UserIdentity) error {
+	if err := repo.MySQLDatabase.Create(identity).Error; err != nil {
+		return fmt.Errorf("failed to create identity: %w", err)
+	}
+	return nil
+}
+
+
 func (repo *UserRepository) CreateUser(user *models.User) error {
 	if err := repo.MySQLDatabase.Create(user).Error; err != nil {
-		return errors.New("failed to create user: " + err.Error())
+		return fmt.Errorf("failed to create user: %w", err)
 	}
 	return nil
 }
@@ -39,9 +134,9 @@ func (repo *UserRepository) FindUser(field string, value interface{}) (*models.U
 	var user models.User
 	if err := repo.MySQLDatabase.Where(field+" = ?", value).First(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("user not found")
+			return nil, ErrNotFound
 		}
-		return nil, errors.New("failed to find user: " + err.Error())
+		return nil, fmt.Errorf("failed to find user: %w", err)
 	}
 	return &user, nil
 }
@@ -59,16 +154,19 @@ func (repo *UserRepository) FindUserByID(userID string) (*models.User, error) {
 
 func (repo *UserRepository) UpdateUser(user *models.User) error {
 	if err := repo.MySQLDatabase.Save(user).Error; err != nil {
-		return errors.New("failed to update user: " + err.Error())
+		return fmt.Errorf("failed to update user: %w", err)
 	}
 	return nil
 }
 
 
 func (repo *UserRepository) DeleteUser(userID string) error {
-	
-	if err := repo.MySQLDatabase.Where("id = ?", userID).Delete(&models.User{}).Error; err != nil {
-		return errors.New("failed to delete user: " + err.Error())
+	result := repo.MySQLDatabase.Where("id = ?", userID).Delete(&models.User{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete user: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
 	}
 	return nil
 }
@@ -82,7 +180,7 @@ func (repo *UserRepository) FindUserByVerificationToken(token string) (*models.U
 
 func (repo *UserRepository) CreatePasswordReset(passwordReset *models.PasswordReset) error {
 	if err := repo.MySQLDatabase.Create(passwordReset).Error; err != nil {
-		return errors.New("failed to create password reset: " + err.Error())
+		return fmt.Errorf("failed to create password reset: %w", err)
 	}
 	return nil
 }
@@ -92,48 +190,385 @@ func (repo *UserRepository) FindPasswordResetByToken(token string) (*models.Pass
 	var passwordReset models.PasswordReset
 	if err := repo.MySQLDatabase.Where("reset_token = ?", token).First(&passwordReset).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("password reset not found")
+			return nil, ErrNotFound
 		}
-		return nil, errors.New("failed to find password reset by token: " + err.Error())
+		return nil, fmt.Errorf("failed to find password reset by token: %w", err)
 	}
 	return &passwordReset, nil
 }
 
 
+func (repo *UserRepository) FindPasswordResetsByUser(userID string) ([]models.PasswordReset, error) {
+	var passwordResets []models.PasswordReset
+	if err := repo.MySQLDatabase.Where("user_id = ?", userID).Order("created_at").Find(&passwordResets).Error; err != nil {
+		return nil, fmt.Errorf("failed to find password resets: %w", err)
+	}
+	return passwordResets, nil
+}
+
+
 func (repo *UserRepository) DeletePasswordReset(resetID string) error {
-	if err := repo.MySQLDatabase.Delete(&models.PasswordReset{}, resetID).Error; err != nil {
-		return errors.New("failed to delete password reset: " + err.Error())
+	if err := repo.MySQLDatabase.Where("id = ?", resetID).Delete(&models.PasswordReset{}).Error; err != nil {
+		return fmt.Errorf("failed to delete password reset: %w", err)
 	}
 	return nil
 }
 
 
-func (repo *UserRepository) BlockUser(userID string) error {
-	return repo.changeUserBlockStatus(userID, true)
+// FindPasswordHistory returns the user's most recent previous password hashes,
+// newest first.
+func (repo *UserRepository) FindPasswordHistory(userID string, limit int) ([]models.PasswordHistory, error) {
+	var history []models.PasswordHistory
+	if err := repo.MySQLDatabase.Where("user_id = ?", userID).Order("created_at DESC").Limit(limit).Find(&history).Error; err != nil {
+		return nil, fmt.Errorf("failed to find password history: %w", err)
+	}
+	return history, nil
 }
 
 
-func (repo *UserRepository) UnblockUser(userID string) error {
-	return repo.changeUserBlockStatus(userID, false)
+// UpdatePassword saves the user's new password hash, records previousHash in
+// the password history and trims the history to the newest keep entries, all
+// in one transaction.
+func (repo *UserRepository) UpdatePassword(user *models.User, previousHash string, keep int) error {
+	err := repo.MySQLDatabase.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(user).Error; err != nil {
+			return err
+		}
+
+		if keep <= 0 {
+			return tx.Where("user_id = ?", user.ID).Delete(&models.PasswordHistory{}).Error
+		}
+
+		if previousHash != "" {
+			if err := tx.Create(&models.PasswordHistory{UserID: user.ID, PasswordHash: previousHash}).Error; err != nil {
+				return err
+			}
+		}
+
+		var stale []string
+		if err := tx.Model(&models.PasswordHistory{}).Where("user_id = ?", user.ID).
+			Order("created_at DESC").Offset(keep).Limit(1000).Pluck("id", &stale).Error; err != nil {
+			return err
+		}
+		if len(stale) == 0 {
+			return nil
+		}
+		return tx.Where("id IN ?", stale).Delete(&models.PasswordHistory{}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	return nil
+}
+
+
+// FindUsersDueForPurge returns users whose deletion grace period ended
+// before the given time.
+func (repo *UserRepository) FindUsersDueForPurge(before time.Time, limit int) ([]models.User, error) {
+	var users []models.User
+	if err := repo.MySQLDatabase.Unscoped().Where("deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= ?", before).
+		Order("deletion_scheduled_at").Limit(limit).Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to find users due for purge: %w", err)
+	}
+	return users, nil
 }
 
 
-func (repo *UserRepository) FindAllUsers() ([]*models.User, error) {
+// PurgeUser permanently deletes a user and every row that refers to them.
+func (repo *UserRepository) PurgeUser(userID string) error {
+	err := repo.MySQLDatabase.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.PasswordReset{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.PasswordHistory{}).Error; err != nil {
+			return err
+		}
+		// The record of the purge itself is kept.
+		if err := tx.Where("user_id = ? AND action <> ?", userID, models.AuditUserPurged).Delete(&models.AuditEvent{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.UserBlock{}).Error; err != nil {
+			return err
+		}
+		notes := tx.Model(&models.UserNote{}).Select("id").Where("user_id = ?", userID)
+		if err := tx.Where("note_id IN (?)", notes).Delete(&models.UserNoteRevision{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.UserNote{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.UserTag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.GroupMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.UserIdentity{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.Session{}).Error; err != nil {
+			return err
+		}
+		// Archives are deleted by the services before the purge.
+		if err := tx.Where("user_id = ?", userID).Delete(&models.DataExport{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("id = ?", userID).Delete(&models.User{}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to purge user: %w", err)
+	}
+	return nil
+}
+
+
+// FindDeletedUsers returns soft-deleted users, most recently deleted first.
+func (repo *UserRepository) FindDeletedUsers() ([]*models.User, error) {
 	var users []*models.User
-	if err := repo.MySQLDatabase.Find(&users).Error; err != nil {
-		return nil, errors.New("failed to retrieve all users: " + err.Error())
+	if err := repo.MySQLDatabase.Unscoped().Where("deleted_at IS NOT NULL").Order("deleted_at DESC").Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to retrieve deleted users: %w", err)
 	}
 	return users, nil
 }
 
 
-func (repo *UserRepository) changeUserBlockStatus(userID string, isBlocked bool) error {
-	result := repo.MySQLDatabase.Model(&models.User{}).Where("id = ?", userID).Update("is_blocked", isBlocked)
+func (repo *UserRepository) findDeletedUser(field string, value interface{}) (*models.User, error) {
+	var user models.User
+	if err := repo.MySQLDatabase.Unscoped().Where(field+" = ? AND deleted_at IS NOT NULL", value).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find deleted user: %w", err)
+	}
+	return &user, nil
+}
+
+
+func (repo *UserRepository) FindDeletedUserByID(userID string) (*models.User, error) {
+	return repo.findDeletedUser("id", userID)
+}
+
+
+func (repo *UserRepository) FindDeletedUserByEmail(email string) (*models.User, error) {
+	return repo.findDeletedUser("email", email)
+}
+
+
+// RestoreUser clears deleted_at on a soft-deleted user.
+func (repo *UserRepository) RestoreUser(userID string) error {
+	result := repo.MySQLDatabase.Unscoped().Model(&models.User{}).
+		Where("id = ? AND deleted_at IS NOT NULL", userID).Update("deleted_at", nil)
 	if result.Error != nil {
-		return errors.New("failed to change user block status: " + result.Error.Error())
+		return fmt.Errorf("failed to restore user: %w", result.Error)
 	}
 	if result.RowsAffected == 0 {
-		return errors.New("user not found or already in the desired block state")
+		return ErrNotFound
 	}
 	return nil
 }
+
+
+// BlockUser records a new block in the user's history and marks the user
+// blocked. Any block still open is closed first, lifted by whoever placed
+// the new one.
+func (repo *UserRepository) BlockUser(user *models.User, block *models.UserBlock) error {
+	err := repo.MySQLDatabase.Transaction(func(tx *gorm.DB) error {
+		if err := liftOpenBlocks(tx, user.ID, block.BlockedBy); err != nil {
+			return err
+		}
+		if err := tx.Create(block).Error; err != nil {
+			return err
+		}
+
+		user.IsBlocked = true
+		user.BlockReason = block.Reason
+		user.BlockedUntil = block.Until
+		return tx.Save(user).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to block user: %w", err)
+	}
+	return nil
+}
+
+
+// UnblockUser clears the user's block and closes it in the history. liftedBy
+// is empty when an expired block is cleared automatically.
+func (repo *UserRepository) UnblockUser(user *models.User, liftedBy string) error {
+	err := repo.MySQLDatabase.Transaction(func(tx *gorm.DB) error {
+		if err := liftOpenBlocks(tx, user.ID, liftedBy); err != nil {
+			return err
+		}
+
+		user.IsBlocked = false
+		user.BlockReason = ""
+		user.BlockedUntil = nil
+		return tx.Save(user).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to unblock user: %w", err)
+	}
+	return nil
+}
+
+
+func liftOpenBlocks(tx *gorm.DB, userID, liftedBy string) error {
+	return tx.Model(&models.UserBlock{}).Where("user_id = ? AND lifted_at IS NULL", userID).
+		Updates(map[string]interface{}{"lifted_at": time.Now(), "lifted_by": liftedBy}).Error
+}
+
+
+// FindBlocksByUser returns the user's block history, newest first.
+func (repo *UserRepository) FindBlocksByUser(userID string) ([]models.UserBlock, error) {
+	var blocks []models.UserBlock
+	if err := repo.MySQLDatabase.Where("user_id = ?", userID).Order("created_at DESC").Find(&blocks).Error; err != nil {
+		return nil, fmt.Errorf("failed to find user blocks: %w", err)
+	}
+	return blocks, nil
+}
+
+
+// filterUsers narrows a query to the users matching filter.
+func filterUsers(db *gorm.DB, filter *models.UserFilter) *gorm.DB {
+	query := db.Model(&models.User{})
+	if filter.Email != "" {
+		query = query.Where("email LIKE ?", "%"+escapeLike(filter.Email)+"%")
+	}
+	if filter.EmailDomain != "" {
+		query = query.Where("email LIKE ?", "%@"+escapeLike(filter.EmailDomain))
+	}
+	if filter.IsBlocked != nil {
+		query = query.Where("is_blocked = ?", *filter.IsBlocked)
+	}
+	if filter.IsVerified != nil {
+		query = query.Where("is_verified = ?", *filter.IsVerified)
+	}
+	if filter.CreatedAfter != nil {
+		query = query.Where("created_at >= ?", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		query = query.Where("created_at < ?", *filter.CreatedBefore)
+	}
+	for _, tag := range filter.Tags {
+		query = query.Where("id IN (?)", db.Model(&models.UserTag{}).Select("user_id").Where("tag = ?", models.NormalizeTag(tag)))
+	}
+	return query
+}
+
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+
+// CountUsers returns how many users match filter.
+func (repo *UserRepository) CountUsers(filter *models.UserFilter) (int64, error) {
+	var count int64
+	if err := filterUsers(repo.MySQLDatabase, filter).Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("failed to count users: %w", err)
+	}
+	return count, nil
+}
+
+
+// FindUserIDs returns the IDs of up to limit users matching filter.
+func (repo *UserRepository) FindUserIDs(filter *models.UserFilter, limit int) ([]string, error) {
+	var ids []string
+	if err := filterUsers(repo.MySQLDatabase, filter).Order("created_at").Limit(limit).Pluck("id", &ids).Error; err != nil {
+		return nil, fmt.Errorf("failed to find users: %w", err)
+	}
+	return ids, nil
+}
+
+
+// FindUsers returns every user matching filter.
+func (repo *UserRepository) FindUsers(filter *models.UserFilter) ([]*models.User, error) {
+	var users []*models.User
+	if err := filterUsers(repo.MySQLDatabase, filter).Order("created_at").Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to find users: %w", err)
+	}
+	return users, nil
+}
+
+
+// EachUser calls fn for every user matching filter, reading them from a
+// cursor one at a time rather than loading the whole result. It stops at
+// the first error fn returns.
+func (repo *UserRepository) EachUser(filter *models.UserFilter, fn func(*models.User) error) error {
+	query := filterUsers(repo.MySQLDatabase, filter).Order("created_at")
+	rows, err := query.Rows()
+	if err != nil {
+		return fmt.Errorf("failed to query users: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user models.User
+		if err := query.ScanRows(rows, &user); err != nil {
+			return fmt.Errorf("failed to read user: %w", err)
+		}
+		if err := fn(&user); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+
+func (repo *UserRepository) CreateSession(session *models.Session) error {
+	if err := repo.MySQLDatabase.Create(session).Error; err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	return nil
+}
+
+
+func (repo *UserRepository) FindSessionByID(sessionID string) (*models.Session, error) {
+	var session models.Session
+	if err := repo.MySQLDatabase.Where("id = ?", sessionID).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find session: %w", err)
+	}
+	return &session, nil
+}
+
+
+// FindSessionsByUser returns the user's sessions, newest first.
+func (repo *UserRepository) FindSessionsByUser(userID string, limit int) ([]models.Session, error) {
+	var sessions []models.Session
+	if err := repo.MySQLDatabase.Where("user_id = ?", userID).Order("created_at DESC").Limit(limit).Find(&sessions).Error; err != nil {
+		return nil, fmt.Errorf("failed to find sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+
+// TouchSession records that the session was just used.
+func (repo *UserRepository) TouchSession(sessionID string, at time.Time) error {
+	if err := repo.MySQLDatabase.Model(&models.Session{}).Where("id = ?", sessionID).Update("last_seen_at", at).Error; err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+	return nil
+}
+
+
+// RevokeSessions revokes every active session of the user and records when,
+// so tokens issued before sessions existed are refused too. It returns how
+// many sessions were revoked.
+func (repo *UserRepository) RevokeSessions(userID string, at time.Time) (int64, error) {
+	var revoked int64
+	err := repo.MySQLDatabase.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, at).Update("revoked_at", at)
+		if result.Error != nil {
+			return result.Error
+		}
+		revoked = result.RowsAffected
+		return tx.Model(&models.User{}).Where("id = ?", userID).Update("sessions_revoked_at", at).Error
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	return revoked, nil
+}
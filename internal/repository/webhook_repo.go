@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/liju-github/user-management/internal/models"
+	"gorm.io/gorm"
+)
+
+type WebhookRepository struct {
+	MySQLDatabase *gorm.DB
+}
+
+type IWebhookRepository interface {
+	CreateWebhookEndpoint(*models.WebhookEndpoint) error
+	UpdateWebhookEndpoint(*models.WebhookEndpoint) error
+	DeleteWebhookEndpoint(endpointID string) error
+	FindWebhookEndpointByID(string) (*models.WebhookEndpoint, error)
+	FindWebhookEndpoints() ([]models.WebhookEndpoint, error)
+	CreateWebhookDeliveries([]models.WebhookDelivery) error
+	UpdateWebhookDelivery(*models.WebhookDelivery) error
+	FindWebhookDeliveryByID(string) (*models.WebhookDelivery, error)
+	FindWebhookDeliveries(endpointID, status string, limit int) ([]models.WebhookDelivery, error)
+	FindDueWebhookDeliveries(now time.Time, limit int) ([]models.WebhookDelivery, error)
+	ClaimWebhookDelivery(delivery *models.WebhookDelivery, until time.Time) (bool, error)
+}
+
+func NewWebhookRepository(db *gorm.DB) *WebhookRepository {
+	return &WebhookRepository{MySQLDatabase: db}
+}
+
+func (repo *WebhookRepository) CreateWebhookEndpoint(endpoint *models.WebhookEndpoint) error {
+	if err := repo.MySQLDatabase.Create(endpoint).Error; err != nil {
+		return fmt.Errorf("failed to create webhook endpoint: %w", err)
+	}
+	return nil
+}
+
+func (repo *WebhookRepository) UpdateWebhookEndpoint(endpoint *models.WebhookEndpoint) error {
+	if err := repo.MySQLDatabase.Save(endpoint).Error; err != nil {
+		return fmt.Errorf("failed to update webhook endpoint: %w", err)
+	}
+	return nil
+}
+
+// DeleteWebhookEndpoint removes an endpoint together with its deliveries.
+func (repo *WebhookRepository) DeleteWebhookEndpoint(endpointID string) error {
+	err := repo.MySQLDatabase.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("endpoint_id = ?", endpointID).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		result := tx.Where("id = ?", endpointID).Delete(&models.WebhookEndpoint{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+	if errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook endpoint: %w", err)
+	}
+	return nil
+}
+
+func (repo *WebhookRepository) FindWebhookEndpointByID(endpointID string) (*models.WebhookEndpoint, error) {
+	var endpoint models.WebhookEndpoint
+	if err := repo.MySQLDatabase.Where("id = ?", endpointID).First(&endpoint).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find webhook endpoint: %w", err)
+	}
+	return &endpoint, nil
+}
+
+func (repo *WebhookRepository) FindWebhookEndpoints() ([]models.WebhookEndpoint, error) {
+	var endpoints []models.WebhookEndpoint
+	if err := repo.MySQLDatabase.Order("created_at").Find(&endpoints).Error; err != nil {
+		return nil, fmt.Errorf("failed to find webhook endpoints: %w", err)
+	}
+	return endpoints, nil
+}
+
+func (repo *WebhookRepository) CreateWebhookDeliveries(deliveries []models.WebhookDelivery) error {
+	if err := repo.MySQLDatabase.Create(&deliveries).Error; err != nil {
+		return fmt.Errorf("failed to create webhook deliveries: %w", err)
+	}
+	return nil
+}
+
+func (repo *WebhookRepository) UpdateWebhookDelivery(delivery *models.WebhookDelivery) error {
+	if err := repo.MySQLDatabase.Save(delivery).Error; err != nil {
+		return fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+	return nil
+}
+
+func (repo *WebhookRepository) FindWebhookDeliveryByID(deliveryID string) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	if err := repo.MySQLDatabase.Where("id = ?", deliveryID).First(&delivery).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find webhook delivery: %w", err)
+	}
+	return &delivery, nil
+}
+
+// FindWebhookDeliveries returns an endpoint's latest deliveries, newest
+// first, optionally only those with the given status.
+func (repo *WebhookRepository) FindWebhookDeliveries(endpointID, status string, limit int) ([]models.WebhookDelivery, error) {
+	query := repo.MySQLDatabase.Where("endpoint_id = ?", endpointID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var deliveries []models.WebhookDelivery
+	if err := query.Order("created_at DESC").Limit(limit).Find(&deliveries).Error; err != nil {
+		return nil, fmt.Errorf("failed to find webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// FindDueWebhookDeliveries returns pending deliveries whose next attempt is
+// due, oldest first.
+func (repo *WebhookRepository) FindDueWebhookDeliveries(now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	err := repo.MySQLDatabase.
+		Where("status = ? AND next_attempt_at <= ?", models.WebhookDeliveryPending, now).
+		Order("next_attempt_at").Limit(limit).
+		Find(&deliveries).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find due webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// ClaimWebhookDelivery pushes a due delivery's next attempt back to until so
+// no other worker picks it up while it is being sent. It reports false when
+// another worker claimed it first.
+func (repo *WebhookRepository) ClaimWebhookDelivery(delivery *models.WebhookDelivery, until time.Time) (bool, error) {
+	result := repo.MySQLDatabase.Model(&models.WebhookDelivery{}).
+		Where("id = ? AND status = ? AND next_attempt_at = ?", delivery.ID, models.WebhookDeliveryPending, delivery.NextAttemptAt).
+		Update("next_attempt_at", until)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to claim webhook delivery: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	delivery.NextAttemptAt = &until
+	return true, nil
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/liju-github/user-management/internal/events"
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/repository"
+)
+
+// purgeBatchSize caps how many accounts one purge run deletes.
+const purgeBatchSize = 100
+
+// RequestAccountDeletion schedules the user's account for deletion after the
+// grace period, once their password has been confirmed. Asking again while a
+// deletion is pending keeps the original date. It returns when the account
+// will be purged.
+func (s *UserService) RequestAccountDeletion(userID, password string) (time.Time, error) {
+	user, err := s.userRepo.FindUserByID(userID)
+	if err != nil {
+		return time.Time{}, userLookupError(err)
+	}
+
+	ok, _, err := s.passwords.Verify(password, user.PasswordHash)
+	if err != nil || !ok {
+		return time.Time{}, ErrInvalidCredentials
+	}
+
+	if user.DeletionScheduledAt != nil {
+		return *user.DeletionScheduledAt, nil
+	}
+
+	scheduledAt := time.Now().Add(s.deletionGrace).UTC()
+	user.DeletionScheduledAt = &scheduledAt
+	err = publishAfter(s.events, s.userRepo, func(repo repository.IUserRepository) error {
+		return repo.UpdateUser(user)
+	}, events.AccountDeletionScheduled{User: models.NewUserSnapshot(user), ScheduledAt: scheduledAt})
+	if err != nil {
+		return time.Time{}, err
+	}
+	return scheduledAt, nil
+}
+
+// cancelAccountDeletion clears a pending deletion; signing in during the
+// grace period is how a user changes their mind. Login and admit refuse
+// users whose grace period has ended, so it is never called for them.
+func (s *UserService) cancelAccountDeletion(user *models.User) {
+	user.DeletionScheduledAt = nil
+	err := publishAfter(s.events, s.userRepo, func(repo repository.IUserRepository) error {
+		return repo.UpdateUser(user)
+	}, events.AccountDeletionCancelled{User: models.NewUserSnapshot(user)})
+	if err != nil {
+		log.Println("Failed to cancel account deletion:", err)
+	}
+}
+
+// PurgeDueAccounts permanently deletes accounts whose grace period has ended,
+// along with their stored avatars and data exports, and returns how many were purged.
+func (s *UserService) PurgeDueAccounts(ctx context.Context) (int, error) {
+	users, err := s.userRepo.FindUsersDueForPurge(time.Now(), purgeBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for i := range users {
+		if err := ctx.Err(); err != nil {
+			return purged, err
+		}
+
+		user := &users[i]
+		if s.exports != nil {
+			if err := s.exports.DeleteUserExports(ctx, user.ID); err != nil {
+				return purged, err
+			}
+		}
+		err := publishAfter(s.events, s.userRepo, func(repo repository.IUserRepository) error {
+			return repo.PurgeUser(user.ID)
+		}, events.UserDeleted{User: models.NewUserSnapshot(user), Actor: SystemActor, Purged: true})
+		if err != nil {
+			return purged, err
+		}
+		if user.ImageKey != "" && s.storage != nil {
+			s.deleteAvatar(user.ImageKey)
+		}
+		purged++
+	}
+	return purged, nil
+}
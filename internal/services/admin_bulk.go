@@ -0,0 +1,206 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/repository"
+)
+
+// bulkProgressInterval is how many users a background bulk job processes
+// between saving its progress. It also saves at least every
+// bulkHeartbeatInterval, so a job not saved for bulkJobTimeout has no live
+// worker.
+const (
+	bulkProgressInterval  = 100
+	bulkHeartbeatInterval = time.Minute
+	bulkJobTimeout        = 10 * time.Minute
+)
+
+// bulkPermissions lists the actions that need a permission beyond being an
+// admin, the same one the single-user endpoint requires.
+var bulkPermissions = map[string]string{
+	models.BulkResetPassword: models.PermissionManageCredentials,
+	models.BulkVerify:        models.PermissionVerifyUsers,
+}
+
+// RunBulkAction applies one action to many users and records the per-user
+// results in a BulkJob. Explicit ID lists are processed before returning;
+// filters are resolved to IDs up front and processed in the background, so
+// the returned job has to be polled with GetBulkJob.
+func (a *AdminService) RunBulkAction(req *models.BulkUserActionRequest, by Actor) (*models.BulkJob, error) {
+	if a.bulkRepo == nil {
+		return nil, errors.New("bulk jobs are not configured")
+	}
+	if err := a.checkBulkRequest(req); err != nil {
+		return nil, err
+	}
+	if permission, ok := bulkPermissions[req.Action]; ok {
+		allowed, err := a.HasPermission(by.ID, permission)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			return nil, ErrInsufficientAccess
+		}
+	}
+
+	ids := uniqueIDs(req.IDs)
+	limitParam := strconv.Itoa(a.bulkLimit)
+	if req.Filter != nil {
+		count, err := a.userRepo.CountUsers(req.Filter)
+		if err != nil {
+			return nil, err
+		}
+		if count > int64(a.bulkLimit) {
+			return nil, models.ValidationErrors{{Field: "filter", Rule: "max", Param: limitParam}}
+		}
+		if ids, err = a.userRepo.FindUserIDs(req.Filter, a.bulkLimit); err != nil {
+			return nil, err
+		}
+	} else if len(ids) > a.bulkLimit {
+		return nil, models.ValidationErrors{{Field: "ids", Rule: "max", Param: limitParam}}
+	}
+
+	organizationID := a.organizationID
+	if organizationID == "" {
+		organizationID = models.DefaultOrganizationID
+	}
+	job := &models.BulkJob{
+		OrganizationID: organizationID,
+		Action:         req.Action,
+		RequestedBy:    by.ID,
+		Status:         models.BulkJobPending,
+		Total:          len(ids),
+		Results:        []models.BulkResult{},
+	}
+	if err := a.bulkRepo.CreateBulkJob(job); err != nil {
+		return nil, err
+	}
+
+	if req.Filter != nil {
+		go a.runBulkJob(*job, ids, req, by)
+		return job, nil
+	}
+
+	a.runBulkJob(*job, ids, req, by)
+	return a.bulkRepo.FindBulkJobByID(job.ID)
+}
+
+// GetBulkJob returns a bulk job with the results recorded so far. Jobs of
+// other organizations are not found.
+func (a *AdminService) GetBulkJob(jobID string) (*models.BulkJob, error) {
+	job, err := a.bulkRepo.FindBulkJobByID(jobID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrBulkJobNotFound
+	}
+	return job, err
+}
+
+// FailStaleBulkJobs marks background jobs that stopped saving progress,
+// such as those left running when the process restarted, as failed. Their
+// users are not resumed: the results show which ones were processed. It
+// returns how many jobs were failed.
+func (a *AdminService) FailStaleBulkJobs(ctx context.Context) (int, error) {
+	if a.bulkRepo == nil {
+		return 0, nil
+	}
+	failed, err := a.bulkRepo.FailStaleBulkJobs(time.Now().Add(-bulkJobTimeout))
+	return int(failed), err
+}
+
+func (a *AdminService) checkBulkRequest(req *models.BulkUserActionRequest) error {
+	switch {
+	case len(req.IDs) > 0 && req.Filter != nil:
+		return models.ValidationErrors{{Field: "ids", Rule: "excluded_with", Param: "filter"}}
+	case len(req.IDs) == 0 && req.Filter == nil:
+		return models.ValidationErrors{{Field: "ids", Rule: "required_without", Param: "filter"}}
+	case req.Filter != nil && req.Filter.Empty():
+		// An empty filter would select every user.
+		return models.ValidationErrors{{Field: "filter", Rule: "required"}}
+	case req.Action == models.BulkBlock && req.Block.Until != nil && !req.Block.Until.After(time.Now()):
+		return models.ValidationErrors{{Field: "until", Rule: "future"}}
+	case req.Action == models.BulkResetPassword && a.userService == nil:
+		return errors.New("password resets are not configured for bulk actions")
+	}
+	return nil
+}
+
+func (a *AdminService) runBulkJob(job models.BulkJob, ids []string, req *models.BulkUserActionRequest, by Actor) {
+	job.Status = models.BulkJobRunning
+	if err := a.bulkRepo.UpdateBulkJob(&job); err != nil {
+		log.Println("Failed to start bulk job:", err)
+		return
+	}
+
+	saved := time.Now()
+	for i, id := range ids {
+		result := models.BulkResult{UserID: id, OK: true}
+		if err := a.applyBulkAction(id, req, by); err != nil {
+			result.OK = false
+			result.Error = bulkError(err)
+			job.Failed++
+		} else {
+			job.Succeeded++
+		}
+		job.Results = append(job.Results, result)
+
+		if (i+1)%bulkProgressInterval == 0 || time.Since(saved) >= bulkHeartbeatInterval {
+			if err := a.bulkRepo.UpdateBulkJob(&job); err != nil {
+				log.Println("Failed to save bulk job progress:", err)
+			}
+			saved = time.Now()
+		}
+	}
+
+	now := time.Now()
+	job.Status = models.BulkJobCompleted
+	job.CompletedAt = &now
+	if err := a.bulkRepo.UpdateBulkJob(&job); err != nil {
+		log.Println("Failed to finish bulk job:", err)
+	}
+}
+
+func (a *AdminService) applyBulkAction(userID string, req *models.BulkUserActionRequest, by Actor) error {
+	switch req.Action {
+	case models.BulkBlock:
+		return a.BlockUser(userID, req.Block, by)
+	case models.BulkUnblock:
+		return a.UnblockUser(userID, by)
+	case models.BulkDelete:
+		return a.DeleteUser(userID, by)
+	case models.BulkResetPassword:
+		return a.userService.ForcePasswordReset(userID, by)
+	case models.BulkVerify:
+		return a.VerifyUser(userID, by)
+	}
+	return errors.New("unknown bulk action " + req.Action)
+}
+
+// bulkError is the message stored for a failed user. Only errors meant for
+// clients are kept; anything else is logged and reported generically, the
+// same way the API's error handler treats it.
+func bulkError(err error) string {
+	var fieldErrors models.ValidationErrors
+	if errors.As(err, &fieldErrors) || errors.Is(err, ErrUserNotFound) {
+		return err.Error()
+	}
+	log.Println("Bulk action failed:", err)
+	return "An unexpected error occurred"
+}
+
+func uniqueIDs(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	unique := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
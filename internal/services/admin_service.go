@@ -1,58 +1,338 @@
 package services
 
 import (
+	"context"
 	"errors"
+	"time"
 
+	"github.com/liju-github/user-management/internal/events"
 	"github.com/liju-github/user-management/internal/models"
 	"github.com/liju-github/user-management/internal/repository"
+	"github.com/liju-github/user-management/internal/storage"
 )
 
 
 type AdminService struct {
 	adminRepo *repository.AdminRepository 
 	userRepo  *repository.UserRepository
+	storage   storage.Storage
+	audit     *AuditService
+	exports   *ExportService
+
+	userService *UserService
+	bulkRepo    repository.IBulkJobRepository
+	bulkLimit   int
+
+	impersonationTTL time.Duration
+
+	noteRepo repository.INoteRepository
+	webhooks *WebhookService
+	events   *events.Bus
+
+	// organizationID limits the service to one tenant; see ForOrganization.
+	organizationID string
+}
+
+// AdminServiceOption configures optional AdminService behaviour.
+type AdminServiceOption func(*AdminService)
+
+// WithAdminStorage lets purges delete the user's stored avatar.
+func WithAdminStorage(store storage.Storage) AdminServiceOption {
+	return func(a *AdminService) { a.storage = store }
+}
+
+// WithAdminExports lets purges delete the user's data exports and their
+// archives.
+func WithAdminExports(exports *ExportService) AdminServiceOption {
+	return func(a *AdminService) { a.exports = exports }
+}
+
+// WithAdminAudit records admin actions in the audit log.
+func WithAdminAudit(audit *AuditService) AdminServiceOption {
+	return func(a *AdminService) { a.audit = audit }
+}
+
+// WithAdminUserService lets admins act through the user service, for
+// example to force a password reset.
+func WithAdminUserService(userService *UserService) AdminServiceOption {
+	return func(a *AdminService) { a.userService = userService }
+}
+
+// WithAdminBulkJobs enables bulk actions on up to limit users at a time.
+func WithAdminBulkJobs(bulkRepo repository.IBulkJobRepository, limit int) AdminServiceOption {
+	return func(a *AdminService) {
+		a.bulkRepo = bulkRepo
+		a.bulkLimit = limit
+	}
+}
+
+
+// WithAdminTags shows a user's tags in their admin detail view.
+func WithAdminTags(noteRepo repository.INoteRepository) AdminServiceOption {
+	return func(a *AdminService) { a.noteRepo = noteRepo }
+}
+
+
+// WithAdminWebhooks announces changes admins make to users to webhook
+// endpoints when the service has no bus from WithAdminEvents.
+func WithAdminWebhooks(webhooks *WebhookService) AdminServiceOption {
+	return func(a *AdminService) { a.webhooks = webhooks }
+}
+
+
+// WithAdminEvents publishes domain events for admin actions on bus.
+// Without it the service uses a bus of its own wired to its audit log and
+// webhooks.
+func WithAdminEvents(bus *events.Bus) AdminServiceOption {
+	return func(a *AdminService) { a.events = bus }
 }
 
 
-func NewAdminService(adminRepo *repository.AdminRepository, userRepo *repository.UserRepository) *AdminService {
-	return &AdminService{
+// WithImpersonationTTL sets how long an impersonation token lasts.
+func WithImpersonationTTL(ttl time.Duration) AdminServiceOption {
+	return func(a *AdminService) { a.impersonationTTL = ttl }
+}
+
+
+func NewAdminService(adminRepo *repository.AdminRepository, userRepo *repository.UserRepository, opts ...AdminServiceOption) *AdminService {
+	a := &AdminService{
 		adminRepo: adminRepo, 
 		userRepo:  userRepo,
+		impersonationTTL: 15 * time.Minute,
+	}
+	for _, opt := range opts {
+		opt(a)
 	}
+	if a.events == nil {
+		a.events = events.NewBus()
+		SubscribeAudit(a.events, a.audit)
+		SubscribeWebhooks(a.events, a.webhooks)
+	}
+	return a
 }
 
 
-func (a *AdminService) BlockUser(userID string) error {
+// ForOrganization returns the service as seen by an admin of one
+// organization, who can only find and change its users and see its bulk
+// jobs. An empty
+// organizationID returns a, which sees every organization.
+func (a *AdminService) ForOrganization(organizationID string) *AdminService {
+	if organizationID == "" {
+		return a
+	}
+	scoped := *a
+	scoped.organizationID = organizationID
+	scoped.userRepo = a.userRepo.InOrganization(organizationID)
+	if a.userService != nil {
+		scoped.userService = a.userService.InOrganization(organizationID)
+	}
+	if a.bulkRepo != nil {
+		scoped.bulkRepo = a.bulkRepo.ForOrganization(organizationID)
+	}
+	return &scoped
+}
+
 
-	return a.userRepo.BlockUser(userID)
+// BlockUser blocks the user until req.Until, or indefinitely when it is
+// not set. Blocking an already blocked user replaces the current block.
+func (a *AdminService) BlockUser(userID string, req *models.BlockUserRequest, by Actor) error {
+	if req.Until != nil && !req.Until.After(time.Now()) {
+		return models.ValidationErrors{{Field: "until", Rule: "future"}}
+	}
+
+	user, err := a.userRepo.FindUserByID(userID)
+	if err != nil {
+		return userLookupError(err)
+	}
+
+	block := &models.UserBlock{
+		UserID:    user.ID,
+		Reason:    req.Reason,
+		Note:      req.Note,
+		BlockedBy: by.ID,
+		Until:     req.Until,
+	}
+	snapshot := models.NewUserSnapshot(user)
+	snapshot.IsBlocked = true
+	return publishAfter(a.events, a.userRepo, func(repo repository.IUserRepository) error {
+		return repo.BlockUser(user, block)
+	}, events.UserBlocked{User: snapshot, Actor: by, Reason: req.Reason, Until: req.Until})
 }
 
 
-func (a *AdminService) UnblockUser(userID string) error {
-	return a.userRepo.UnblockUser(userID)
+func (a *AdminService) UnblockUser(userID string, by Actor) error {
+	user, err := a.userRepo.FindUserByID(userID)
+	if err != nil {
+		return userLookupError(err)
+	}
+	return unblock(a.events, a.userRepo, user, by)
 }
 
 
-func (a *AdminService) DeleteUser(userID string) error {
-	return a.userRepo.DeleteUser(userID)
+// VerifyUser marks the user's email as verified.
+func (a *AdminService) VerifyUser(userID string, by Actor) error {
+	user, err := a.userRepo.FindUserByID(userID)
+	if err != nil {
+		return userLookupError(err)
+	}
+
+	user.IsVerified = true
+	user.VerificationToken = ""
+	user.VerificationExpiry = 0
+	return publishAfter(a.events, a.userRepo, func(repo repository.IUserRepository) error {
+		return repo.UpdateUser(user)
+	}, events.UserVerified{User: models.NewUserSnapshot(user), Actor: by})
 }
 
 
-func (a *AdminService) GetAllUsers() ([]*models.User, error) {
-	return a.userRepo.FindAllUsers()
+// UnverifyUser marks the user's email as unverified, for example when it
+// turns out to belong to someone else. The user can ask for a new
+// verification email.
+func (a *AdminService) UnverifyUser(userID string, by Actor) error {
+	user, err := a.userRepo.FindUserByID(userID)
+	if err != nil {
+		return userLookupError(err)
+	}
+
+	user.IsVerified = false
+	return publishAfter(a.events, a.userRepo, func(repo repository.IUserRepository) error {
+		return repo.UpdateUser(user)
+	}, events.UserUnverified{User: models.NewUserSnapshot(user), Actor: by})
 }
 
 
+// SendPasswordResetLink emails the user a password reset link.
+func (a *AdminService) SendPasswordResetLink(userID string, by Actor) error {
+	return a.userService.SendPasswordResetLink(userID, by)
+}
+
+
+// RequirePasswordChange makes the user pick a new password at next sign-in.
+func (a *AdminService) RequirePasswordChange(userID string, by Actor) error {
+	return a.userService.RequirePasswordChange(userID, by)
+}
+
+
+// RevokeSessions signs the user out of every session.
+func (a *AdminService) RevokeSessions(userID string, by Actor) (int, error) {
+	return a.userService.RevokeSessions(userID, by)
+}
+
+
+// GetBlockHistory returns every block placed on the user, newest first.
+func (a *AdminService) GetBlockHistory(userID string) ([]models.UserBlock, error) {
+	if _, err := a.userRepo.FindUserByID(userID); err != nil {
+		return nil, userLookupError(err)
+	}
+	return a.userRepo.FindBlocksByUser(userID)
+}
+
+
+func (a *AdminService) DeleteUser(userID string, by Actor) error {
+	user, err := a.userRepo.FindUserByID(userID)
+	if err != nil {
+		return userLookupError(err)
+	}
+	err = publishAfter(a.events, a.userRepo, func(repo repository.IUserRepository) error {
+		return repo.DeleteUser(user.ID)
+	}, events.UserDeleted{User: models.NewUserSnapshot(user), Actor: by})
+	return userLookupError(err)
+}
+
+
+// GetDeletedUsers lists soft-deleted users, most recently deleted first.
+func (a *AdminService) GetDeletedUsers() ([]*models.User, error) {
+	return a.userRepo.FindDeletedUsers()
+}
+
+
+// RestoreUser undoes a soft delete. It fails with ErrUserExists if the email
+// has since been registered by another account.
+func (a *AdminService) RestoreUser(userID string, by Actor) error {
+	user, err := a.userRepo.FindDeletedUserByID(userID)
+	if err != nil {
+		return userLookupError(err)
+	}
+
+	if _, err := a.userRepo.FindUserByEmail(user.Email); err == nil {
+		return ErrUserExists
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+
+	err = publishAfter(a.events, a.userRepo, func(repo repository.IUserRepository) error {
+		return repo.RestoreUser(user.ID)
+	}, events.UserRestored{User: models.NewUserSnapshot(user), Actor: by})
+	return userLookupError(err)
+}
+
+
+// PurgeUser permanently deletes a soft-deleted user with all of their rows
+// and stored files. Live users have to be deleted first. Only the audit
+// record of the purge is kept.
+func (a *AdminService) PurgeUser(userID string, by Actor) error {
+	user, err := a.userRepo.FindDeletedUserByID(userID)
+	if err != nil {
+		return userLookupError(err)
+	}
+
+	if a.exports != nil {
+		if err := a.exports.DeleteUserExports(context.Background(), user.ID); err != nil {
+			return err
+		}
+	}
+	err = publishAfter(a.events, a.userRepo, func(repo repository.IUserRepository) error {
+		return repo.PurgeUser(user.ID)
+	}, events.UserDeleted{User: models.NewUserSnapshot(user), Actor: by, Purged: true})
+	if err != nil {
+		return err
+	}
+	if user.ImageKey != "" && a.storage != nil {
+		deleteAvatar(a.storage, user.ImageKey)
+	}
+	return nil
+}
+
+
+// GetAllUsers returns the users matching filter; an empty filter matches
+// everyone.
+func (a *AdminService) GetAllUsers(filter *models.UserFilter) ([]*models.User, error) {
+	return a.userRepo.FindUsers(filter)
+}
+
+
+// HasPermission reports whether the admin has been granted permission.
+func (a *AdminService) HasPermission(adminID, permission string) (bool, error) {
+	admin, err := a.adminRepo.FindAdminByID(adminID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return admin.HasPermission(permission), nil
+}
+
+
+// Login signs in an admin of the service's organization, or of the default
+// organization when it has none.
 func (a *AdminService) Login(email string, password string) (*models.Admin, error) {
-	
-	admin, err := a.adminRepo.FindAdminByEmail(email)
+	organizationID := a.organizationID
+	if organizationID == "" {
+		organizationID = models.DefaultOrganizationID
+	}
+
+	admin, err := a.adminRepo.FindAdminByEmail(organizationID, email)
 	if err != nil {
-		return nil, err 
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
 	}
 
 	
 	if admin.Password != password {
-		return nil, errors.New("invalid password")
+		return nil, ErrInvalidCredentials
 	}
 
 	return admin, nil
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/liju-github/user-management/internal/events"
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/repository"
+)
+
+// How much history GetUserDetail includes.
+const (
+	detailSessionLimit = 20
+	detailAuditLimit   = 20
+)
+
+// UserDetail is a user together with their tags and recent sessions and
+// audit events.
+type UserDetail struct {
+	User        *models.User
+	Images      map[string]string
+	Tags        []string
+	Sessions    []models.Session
+	RecentAudit []models.AuditEvent
+}
+
+// GetUserDetail returns everything an admin needs to look into one user.
+func (a *AdminService) GetUserDetail(userID string) (*UserDetail, error) {
+	user, err := a.userRepo.FindUserByID(userID)
+	if err != nil {
+		return nil, userLookupError(err)
+	}
+
+	sessions, err := a.userRepo.FindSessionsByUser(user.ID, detailSessionLimit)
+	if err != nil {
+		return nil, err
+	}
+	events, err := a.audit.RecentEventsForUser(user.ID, detailAuditLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	detail := &UserDetail{User: user, Sessions: sessions, RecentAudit: events}
+	if a.noteRepo != nil {
+		if detail.Tags, err = a.noteRepo.FindTagsByUser(user.ID); err != nil {
+			return nil, err
+		}
+	}
+	if a.userService != nil {
+		detail.Images = a.userService.AvatarURLs(user)
+	}
+	return detail, nil
+}
+
+// UpdateUser changes the profile fields present in req. A new email must not
+// belong to another live account, and changing the verification status
+// needs models.PermissionVerifyUsers. The changed fields are audited.
+func (a *AdminService) UpdateUser(userID string, req *models.AdminUserUpdateRequest, by Actor) (*models.User, error) {
+	if req.IsVerified != nil {
+		allowed, err := a.HasPermission(by.ID, models.PermissionVerifyUsers)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			return nil, ErrInsufficientAccess
+		}
+	}
+
+	user, err := a.userRepo.FindUserByID(userID)
+	if err != nil {
+		return nil, userLookupError(err)
+	}
+
+	changed := map[string]bool{}
+	setString := func(field string, target *string, value *string) {
+		if value != nil && *value != *target {
+			*target = *value
+			changed[field] = true
+		}
+	}
+	setUint := func(field string, target *uint, value *uint) {
+		if value != nil && *value != *target {
+			*target = *value
+			changed[field] = true
+		}
+	}
+
+	if req.Email != nil && !strings.EqualFold(*req.Email, user.Email) {
+		existing, err := a.userRepo.FindUserByEmail(*req.Email)
+		if err == nil && existing.ID != user.ID {
+			return nil, ErrUserExists
+		}
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return nil, err
+		}
+	}
+	setString("email", &user.Email, req.Email)
+	setString("name", &user.Name, req.Name)
+	setString("gender", &user.Gender, req.Gender)
+	setString("address", &user.Address, req.Address)
+	setString("image_url", &user.ImageURL, req.ImageURL)
+	setUint("age", &user.Age, req.Age)
+	setUint("phonenumber", &user.PhoneNumber, req.PhoneNumber)
+	if req.IsVerified != nil && *req.IsVerified != user.IsVerified {
+		user.IsVerified = *req.IsVerified
+		user.VerificationToken = ""
+		user.VerificationExpiry = 0
+		changed["is_verified"] = true
+	}
+
+	if len(changed) == 0 {
+		return user, nil
+	}
+
+	fields := make([]string, 0, len(changed))
+	for field := range changed {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	snapshot := models.NewUserSnapshot(user)
+	evts := []events.Event{events.ProfileUpdated{User: snapshot, Actor: by, Fields: fields}}
+	if changed["is_verified"] && user.IsVerified {
+		evts = append(evts, events.UserVerified{User: snapshot, Actor: by})
+	}
+
+	err = publishAfter(a.events, a.userRepo, func(repo repository.IUserRepository) error {
+		return repo.UpdateUser(user)
+	}, evts...)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
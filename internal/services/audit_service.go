@@ -0,0 +1,75 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/liju-github/user-management/internal/events"
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/repository"
+)
+
+// Actor identifies who performed an audited action.
+type Actor = events.Actor
+
+// UserActor is a user acting on their own account.
+func UserActor(userID string) Actor {
+	return Actor{ID: userID, Role: models.ActorUser}
+}
+
+// AdminActor is an admin acting on someone else's account.
+func AdminActor(adminID string) Actor {
+	return Actor{ID: adminID, Role: models.ActorAdmin}
+}
+
+// SystemActor is a background job acting without a person behind it.
+var SystemActor = Actor{Role: models.ActorSystem}
+
+// AuditService records security-relevant actions against user accounts.
+type AuditService struct {
+	auditRepo repository.IAuditRepository
+}
+
+func NewAuditService(auditRepo repository.IAuditRepository) *AuditService {
+	return &AuditService{auditRepo: auditRepo}
+}
+
+// Record stores an audit event for userID. Failing to record is logged rather
+// than returned so it never undoes the action being audited. Record on a nil
+// AuditService does nothing.
+func (a *AuditService) Record(userID string, actor Actor, action string, details map[string]string) {
+	if a == nil {
+		return
+	}
+
+	event := &models.AuditEvent{
+		UserID:    userID,
+		ActorID:   actor.ID,
+		ActorRole: actor.Role,
+		Action:    action,
+	}
+	if len(details) > 0 {
+		encoded, _ := json.Marshal(details)
+		event.Details = string(encoded)
+	}
+
+	if err := a.auditRepo.CreateAuditEvent(event); err != nil {
+		log.Println("Failed to record audit event", action+":", err)
+	}
+}
+
+// EventsForUser returns every event recorded against the user, oldest first.
+func (a *AuditService) EventsForUser(userID string) ([]models.AuditEvent, error) {
+	if a == nil {
+		return nil, nil
+	}
+	return a.auditRepo.FindAuditEventsByUser(userID)
+}
+
+// RecentEventsForUser returns the user's latest events, newest first.
+func (a *AuditService) RecentEventsForUser(userID string, limit int) ([]models.AuditEvent, error) {
+	if a == nil {
+		return nil, nil
+	}
+	return a.auditRepo.FindRecentAuditEventsByUser(userID, limit)
+}
@@ -1,6 +1,11 @@
 package services
 
-import "github.com/liju-github/user-management/internal/repository"
+import (
+	"log"
+	"time"
+
+	"github.com/liju-github/user-management/internal/repository"
+)
 
 type AuthService struct {
 	adminRepo *repository.AdminRepository
@@ -13,3 +18,10 @@ func NewAuthService(adminRepo *repository.AdminRepository, userRepo *repository.
 		userRepo:  userRepo,
 	}
 }
+
+// TouchSession records that a session was just used to refresh a token.
+func (s *AuthService) TouchSession(sessionID string) {
+	if err := s.userRepo.TouchSession(sessionID, time.Now()); err != nil {
+		log.Println("Failed to update session", sessionID+":", err)
+	}
+}
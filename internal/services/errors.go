@@ -0,0 +1,100 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/liju-github/user-management/internal/models"
+)
+
+// Sentinel errors returned by the services. Callers should compare them with
+// errors.Is; the controllers map each of them to an HTTP status and a stable
+// machine-readable code.
+var (
+	ErrUserExists              = errors.New(models.UserAlreadyExists)
+	ErrUserNotFound            = errors.New(models.UserDoesntExist)
+	ErrInvalidCredentials      = errors.New("invalid credentials")
+	ErrEmailNotVerified        = errors.New("email not verified")
+	ErrEmailAlreadyVerified    = errors.New("email already verified")
+	ErrUserBlocked             = errors.New(models.UserIsBlocked)
+	ErrInvalidToken            = errors.New("invalid or already used token")
+	ErrTokenExpired            = errors.New("token expired")
+	ErrFileTooLarge            = errors.New("file is too large")
+	ErrUnsupportedMediaType    = errors.New("only JPEG, PNG and WebP images are supported")
+	ErrExportNotFound          = errors.New("data export not found")
+	ErrExportNotReady          = errors.New("data export is not ready yet")
+	ErrBulkJobNotFound         = errors.New("bulk job not found")
+	ErrImportNotFound          = errors.New("import job not found")
+	ErrImportNotResumable      = errors.New("only paused, failed or stalled imports can be resumed")
+	ErrImpersonationDenied     = errors.New("not allowed while impersonating a user")
+	ErrPasswordChangeNeeded    = errors.New("password must be changed before signing in")
+	ErrNoteNotFound            = errors.New("note not found")
+	ErrWebhookNotFound         = errors.New("webhook endpoint not found")
+	ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
+	ErrWebhookNotReplayable    = errors.New("only failed deliveries can be replayed")
+	ErrOrganizationNotFound    = errors.New("organization not found")
+	ErrOrganizationExists      = errors.New("an organization with this slug already exists")
+	ErrGroupNotFound           = errors.New("group not found")
+	ErrGroupExists             = errors.New("a group with this name already exists")
+	ErrGroupMemberNotFound     = errors.New("user is not a member of this group")
+	ErrInvitationNotFound      = errors.New("invitation not found")
+	ErrInvitationExists        = errors.New("this email already has a pending invitation")
+	ErrInvitationNotPending    = errors.New("only pending invitations can be resent or revoked")
+	ErrInvitationRequired      = errors.New("signup requires an invitation")
+	ErrSignupClosed            = errors.New("signup is closed")
+	ErrProviderNotFound        = errors.New("sign-in provider not found")
+	ErrSocialLoginFailed       = errors.New("sign-in with the provider failed")
+
+	ErrUnauthorized       = errors.New(models.InvalidID)
+	ErrMissingAuthToken   = errors.New("missing or invalid token")
+	ErrInvalidAuthToken   = errors.New("invalid authentication token")
+	ErrAuthTokenExpired   = errors.New("token has expired")
+	ErrInsufficientAccess = errors.New("insufficient privileges")
+)
+
+// BlockedError is returned when a blocked user tries to sign in or use a
+// token. It matches ErrUserBlocked with errors.Is and carries the reason
+// code and end time so the user can be told why and for how long. The
+// admin's note is internal and never included.
+type BlockedError struct {
+	Reason string
+	Until  *time.Time
+}
+
+// NewBlockedError describes the user's current block.
+func NewBlockedError(user *models.User) *BlockedError {
+	return &BlockedError{Reason: user.BlockReason, Until: user.BlockedUntil}
+}
+
+func (e *BlockedError) Error() string { return ErrUserBlocked.Error() }
+
+func (e *BlockedError) Unwrap() error { return ErrUserBlocked }
+
+// PasswordChangeRequiredError is returned by Login when an admin has
+// required the user to choose a new password. The password was correct, so
+// it carries a short-lived reset token the client can use straight away
+// with the confirm-reset-password endpoint.
+type PasswordChangeRequiredError struct {
+	ResetToken string
+}
+
+func (e *PasswordChangeRequiredError) Error() string { return ErrPasswordChangeNeeded.Error() }
+
+func (e *PasswordChangeRequiredError) Unwrap() error { return ErrPasswordChangeNeeded }
+
+// ProblemExtensions adds the reset token to the error response.
+func (e *PasswordChangeRequiredError) ProblemExtensions() map[string]interface{} {
+	return map[string]interface{}{"reset_token": e.ResetToken}
+}
+
+// ProblemExtensions adds the block details to the error response.
+func (e *BlockedError) ProblemExtensions() map[string]interface{} {
+	extensions := map[string]interface{}{}
+	if e.Reason != "" {
+		extensions["block_reason"] = e.Reason
+	}
+	if e.Until != nil {
+		extensions["blocked_until"] = e.Until.UTC().Format(time.RFC3339)
+	}
+	return extensions
+}
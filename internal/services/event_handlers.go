@@ -0,0 +1,239 @@
+package services
+
+import (
+	"expvar"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/liju-github/user-management/internal/events"
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/repository"
+)
+
+// publishAfter runs write and then publishes evts. With the outbox the events
+// are stored in the same transaction as write instead, and the relay
+// dispatches them once it has committed. write may be nil when there is
+// nothing to store.
+func publishAfter(bus *events.Bus, repo repository.IUserRepository, write func(repository.IUserRepository) error, evts ...events.Event) error {
+	if !bus.Outbox() {
+		if write != nil {
+			if err := write(repo); err != nil {
+				return err
+			}
+		}
+		bus.Publish(evts...)
+		return nil
+	}
+
+	records, err := events.Encode(evts...)
+	if err != nil {
+		return err
+	}
+	err = repo.Transaction(func(tx repository.IUserRepository) error {
+		if write != nil {
+			if err := write(tx); err != nil {
+				return err
+			}
+		}
+		return tx.CreateOutboxEvents(records)
+	})
+	if err != nil {
+		return err
+	}
+	bus.Notify()
+	return nil
+}
+
+// SubscribeEmails sends the emails users get about their account. They are
+// sent in the background so the time a request takes does not reveal
+// whether an email went out.
+func SubscribeEmails(bus *events.Bus, mailer Mailer, baseURL string) {
+	send := func(to, subject, body string) error {
+		go func() {
+			if err := mailer.Send(to, subject, body); err != nil {
+				log.Printf("Failed to send %q email: %v", subject, err)
+			}
+		}()
+		return nil
+	}
+
+	events.Subscribe(bus, func(e events.VerificationRequested) error {
+		return send(e.User.Email, "Email Verification",
+			"Please verify your email by clicking the following link:\r\n"+
+				baseURL+"/api/auth/verify-email/"+e.Token)
+	})
+	events.Subscribe(bus, func(e events.SignupAttempted) error {
+		return send(e.User.Email, "Sign-up attempt",
+			"Someone tried to create an account with this email address, but you already have one.\r\n"+
+				"If this was you, sign in or reset your password at:\r\n"+
+				baseURL+"/reset-password")
+	})
+	events.Subscribe(bus, func(e events.PasswordResetRequested) error {
+		if e.Reason == events.ResetForced {
+			return send(e.User.Email, "Password reset required",
+				"For your security your password has been reset and must be changed before you can sign in again.\r\n"+
+					"Choose a new password within 24 hours using this link:\r\n"+
+					baseURL+"/reset-password?token="+e.Token)
+		}
+		return send(e.User.Email, "Password Reset",
+			"Use the following link to reset your password. It expires in one hour:\r\n"+
+				baseURL+"/reset-password?token="+e.Token)
+	})
+	events.Subscribe(bus, func(e events.AccountDeletionScheduled) error {
+		return send(e.User.Email, "Account deletion scheduled",
+			"Your account and its data will be permanently deleted on "+e.ScheduledAt.Format("2 January 2006")+".\r\n"+
+				"If you change your mind, sign in before then and the deletion will be cancelled.")
+	})
+	events.Subscribe(bus, func(e events.AccountDeletionCancelled) error {
+		return send(e.User.Email, "Account deletion cancelled",
+			"You signed in, so your account is no longer scheduled for deletion.")
+	})
+	events.Subscribe(bus, func(e events.IdentityLinked) error {
+		if e.Signup {
+			return nil
+		}
+		return send(e.User.Email, "New sign-in method",
+			"You can now sign in to your account with "+e.Provider+" as "+e.Email+".\r\n"+
+				"If this wasn't you, contact support immediately.")
+	})
+	events.Subscribe(bus, func(e events.InvitationSent) error {
+		to := e.Organization
+		if e.Group != "" {
+			to = e.Group + " at " + e.Organization
+		}
+		return send(e.Email, "You're invited",
+			"You have been invited to join "+to+".\r\n"+
+				"Create your account before "+e.ExpiresAt.Format("2 January 2006")+" using this link:\r\n"+
+				baseURL+"/signup?invitation="+url.QueryEscape(e.Token))
+	})
+}
+
+// SubscribeAudit records account changes in the audit log.
+func SubscribeAudit(bus *events.Bus, audit *AuditService) {
+	events.Subscribe(bus, func(e events.PasswordResetRequested) error {
+		switch e.Reason {
+		case events.ResetForced:
+			audit.Record(e.User.ID, e.Actor, models.AuditPasswordResetForced, nil)
+		case events.ResetSentByAdmin:
+			audit.Record(e.User.ID, e.Actor, models.AuditPasswordResetSent, nil)
+		}
+		return nil
+	})
+	events.Subscribe(bus, func(e events.UserVerified) error {
+		audit.Record(e.User.ID, e.Actor, models.AuditUserVerified, nil)
+		return nil
+	})
+	events.Subscribe(bus, func(e events.UserUnverified) error {
+		audit.Record(e.User.ID, e.Actor, models.AuditUserUnverified, nil)
+		return nil
+	})
+	events.Subscribe(bus, func(e events.UserBlocked) error {
+		details := map[string]string{"reason": e.Reason}
+		if e.Until != nil {
+			details["until"] = e.Until.UTC().Format(time.RFC3339)
+		}
+		audit.Record(e.User.ID, e.Actor, models.AuditUserBlocked, details)
+		return nil
+	})
+	events.Subscribe(bus, func(e events.UserUnblocked) error {
+		audit.Record(e.User.ID, e.Actor, models.AuditUserUnblocked, nil)
+		return nil
+	})
+	events.Subscribe(bus, func(e events.ProfileUpdated) error {
+		audit.Record(e.User.ID, e.Actor, models.AuditProfileUpdated, map[string]string{"fields": strings.Join(e.Fields, ",")})
+		return nil
+	})
+	events.Subscribe(bus, func(e events.AccountDeletionScheduled) error {
+		audit.Record(e.User.ID, UserActor(e.User.ID), models.AuditAccountDeletionRequested,
+			map[string]string{"scheduled_at": e.ScheduledAt.Format(time.RFC3339)})
+		return nil
+	})
+	events.Subscribe(bus, func(e events.AccountDeletionCancelled) error {
+		audit.Record(e.User.ID, UserActor(e.User.ID), models.AuditAccountDeletionCancelled, nil)
+		return nil
+	})
+	events.Subscribe(bus, func(e events.UserDeleted) error {
+		// A purged account's audit trail goes with it; only the record of
+		// the purge is kept.
+		action := models.AuditUserDeleted
+		if e.Purged {
+			action = models.AuditUserPurged
+		}
+		audit.Record(e.User.ID, e.Actor, action, nil)
+		return nil
+	})
+	events.Subscribe(bus, func(e events.UserRestored) error {
+		audit.Record(e.User.ID, e.Actor, models.AuditUserRestored, nil)
+		return nil
+	})
+	events.Subscribe(bus, func(e events.IdentityLinked) error {
+		audit.Record(e.User.ID, UserActor(e.User.ID), models.AuditIdentityLinked, map[string]string{"provider": e.Provider, "email": e.Email})
+		return nil
+	})
+	events.Subscribe(bus, func(e events.InvitationAccepted) error {
+		audit.Record(e.User.ID, e.InvitedBy, models.AuditInvitationAccepted, map[string]string{"invitation_id": e.InvitationID})
+		return nil
+	})
+	events.Subscribe(bus, func(e events.GroupMemberAdded) error {
+		audit.Record(e.UserID, e.Actor, models.AuditGroupMemberAdded, groupDetails(e.Group))
+		return nil
+	})
+	events.Subscribe(bus, func(e events.GroupMemberRoleChanged) error {
+		details := groupDetails(e.Group)
+		details["previous_role"] = e.Previous
+		audit.Record(e.UserID, e.Actor, models.AuditGroupRoleChanged, details)
+		return nil
+	})
+	events.Subscribe(bus, func(e events.GroupMemberRemoved) error {
+		audit.Record(e.UserID, e.Actor, models.AuditGroupMemberRemoved, groupDetails(e.Group))
+		return nil
+	})
+}
+
+func groupDetails(group models.UserGroup) map[string]string {
+	return map[string]string{"group_id": group.ID, "group": group.Name, "role": group.Role}
+}
+
+// SubscribeWebhooks announces user lifecycle events to webhook endpoints.
+func SubscribeWebhooks(bus *events.Bus, webhooks *WebhookService) {
+	events.Subscribe(bus, func(e events.UserSignedUp) error {
+		webhooks.Publish(models.WebhookUserSignedUp, e.User)
+		return nil
+	})
+	events.Subscribe(bus, func(e events.UserVerified) error {
+		webhooks.Publish(models.WebhookUserVerified, e.User)
+		return nil
+	})
+	events.Subscribe(bus, func(e events.ProfileUpdated) error {
+		// A change to is_verified alone is announced as user.verified.
+		for _, field := range e.Fields {
+			if field != "is_verified" {
+				webhooks.Publish(models.WebhookUserProfileUpdate, e.User)
+				break
+			}
+		}
+		return nil
+	})
+	events.Subscribe(bus, func(e events.UserBlocked) error {
+		webhooks.Publish(models.WebhookUserBlocked, e.User)
+		return nil
+	})
+	events.Subscribe(bus, func(e events.UserUnblocked) error {
+		webhooks.Publish(models.WebhookUserUnblocked, e.User)
+		return nil
+	})
+	events.Subscribe(bus, func(e events.UserDeleted) error {
+		webhooks.Publish(models.WebhookUserDeleted, e.User)
+		return nil
+	})
+}
+
+// SubscribeMetrics counts published events by name.
+func SubscribeMetrics(bus *events.Bus, counts *expvar.Map) {
+	bus.SubscribeAll(func(e events.Event) error {
+		counts.Add(e.EventName(), 1)
+		return nil
+	})
+}
@@ -0,0 +1,436 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"time"
+
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/repository"
+	"github.com/liju-github/user-management/internal/storage"
+)
+
+// exportTimeout is how long an export may stay pending or running. One
+// left behind by a restart is failed after it, so the user can ask again.
+const exportTimeout = time.Hour
+
+// ExportSection is one part of a personal data export. Collect returns
+// whatever is held about the user for that part; it is written to the
+// archive as <Name>.json.
+type ExportSection struct {
+	Name    string
+	Collect func(userID string) (interface{}, error)
+}
+
+type IExportService interface {
+	RequestExport(userID string, requestedBy Actor) (*models.DataExport, error)
+	OpenDownload(token string) (io.ReadCloser, *models.DataExport, error)
+	OpenExport(exportID string) (io.ReadCloser, *models.DataExport, error)
+	ForOrganization(organizationID string) IExportService
+}
+
+// ExportService assembles personal data exports in the background, stores
+// them as zip archives and emails the user a time-limited download link.
+// Its store must not be served publicly: archives are only handed out by
+// OpenDownload and OpenExport.
+type ExportService struct {
+	exportRepo repository.IExportRepository
+	userRepo   repository.IUserRepository
+	storage    storage.Storage
+	mailer     Mailer
+	baseURL    string
+	linkTTL    time.Duration
+	audit      *AuditService
+	sections   []ExportSection
+
+	// organizationID limits the service to one tenant; see ForOrganization.
+	organizationID string
+}
+
+// ExportServiceOption configures optional ExportService behaviour.
+type ExportServiceOption func(*ExportService)
+
+// WithExportMailer sets the mailer used to send download links.
+func WithExportMailer(mailer Mailer) ExportServiceOption {
+	return func(s *ExportService) { s.mailer = mailer }
+}
+
+// WithExportBaseURL sets the public URL used to build download links.
+func WithExportBaseURL(baseURL string) ExportServiceOption {
+	return func(s *ExportService) { s.baseURL = baseURL }
+}
+
+// WithExportLinkTTL sets how long a download link stays valid. The archive
+// is deleted once it expires.
+func WithExportLinkTTL(ttl time.Duration) ExportServiceOption {
+	return func(s *ExportService) { s.linkTTL = ttl }
+}
+
+// WithExportAudit records export requests in the audit log and includes the
+// user's audit events in their export.
+func WithExportAudit(audit *AuditService) ExportServiceOption {
+	return func(s *ExportService) { s.audit = audit }
+}
+
+func NewExportService(exportRepo repository.IExportRepository, userRepo repository.IUserRepository, store storage.Storage, opts ...ExportServiceOption) *ExportService {
+	s := &ExportService{
+		exportRepo: exportRepo,
+		userRepo:   userRepo,
+		storage:    store,
+		mailer:     LogMailer{},
+		baseURL:    "http://localhost:8080",
+		linkTTL:    48 * time.Hour,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.RegisterSection(ExportSection{Name: "profile", Collect: s.collectProfile})
+	s.RegisterSection(ExportSection{Name: "password_resets", Collect: s.collectPasswordResets})
+	s.RegisterSection(ExportSection{Name: "password_history", Collect: s.collectPasswordHistory})
+	s.RegisterSection(ExportSection{Name: "blocks", Collect: s.collectBlocks})
+	s.RegisterSection(ExportSection{Name: "sessions", Collect: s.collectSessions})
+	s.RegisterSection(ExportSection{Name: "audit_events", Collect: func(userID string) (interface{}, error) {
+		return s.audit.EventsForUser(userID)
+	}})
+	return s
+}
+
+// ForOrganization returns the service as seen by an admin of one
+// organization, who can only export its users and download their exports.
+// An empty organizationID returns s.
+func (s *ExportService) ForOrganization(organizationID string) IExportService {
+	if organizationID == "" {
+		return s
+	}
+	scoped := *s
+	scoped.organizationID = organizationID
+	scoped.userRepo = s.userRepo.ForOrganization(organizationID)
+	return &scoped
+}
+
+// RegisterSection adds a section to every export. Features that store more
+// data about a user register a section for it here.
+func (s *ExportService) RegisterSection(section ExportSection) {
+	s.sections = append(s.sections, section)
+}
+
+// RequestExport starts an export of everything held about the user. If one
+// is already in progress it is returned instead of starting another; one
+// that has been in progress for longer than exportTimeout is failed and
+// replaced.
+func (s *ExportService) RequestExport(userID string, requestedBy Actor) (*models.DataExport, error) {
+	if _, err := s.userRepo.FindUserByID(userID); err != nil {
+		return nil, userLookupError(err)
+	}
+
+	active, err := s.exportRepo.FindActiveExport(userID)
+	if err == nil {
+		if time.Since(active.CreatedAt) < exportTimeout {
+			return active, nil
+		}
+		if err := s.fail(active); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+
+	export := &models.DataExport{
+		UserID:      userID,
+		RequestedBy: requestedBy.ID,
+		Status:      models.ExportPending,
+	}
+	if err := s.exportRepo.CreateExport(export); err != nil {
+		return nil, err
+	}
+	s.audit.Record(userID, requestedBy, models.AuditDataExportRequested, map[string]string{"export_id": export.ID})
+
+	go s.run(*export)
+
+	return export, nil
+}
+
+// run builds and stores the archive, then emails the download link. Failed
+// exports are kept until their expiry so the user can see what happened.
+func (s *ExportService) run(export models.DataExport) {
+	export.Status = models.ExportRunning
+	if err := s.exportRepo.UpdateExport(&export); err != nil {
+		log.Println("Failed to start data export:", err)
+		return
+	}
+
+	err := s.build(&export)
+
+	now := time.Now()
+	expiresAt := now.Add(s.linkTTL)
+	export.CompletedAt = &now
+	export.ExpiresAt = &expiresAt
+	export.Status = models.ExportReady
+	if err != nil {
+		log.Println("Data export", export.ID, "failed:", err)
+		export.Status = models.ExportFailed
+	} else {
+		export.DownloadToken = generateToken()
+	}
+	if err := s.exportRepo.UpdateExport(&export); err != nil {
+		log.Println("Failed to finish data export:", err)
+		return
+	}
+
+	if export.Status == models.ExportReady {
+		if err := s.sendExportReadyEmail(export); err != nil {
+			log.Println("Failed to send data export email:", err)
+		}
+	}
+}
+
+// fail marks an export that never finished, usually because the process
+// running it stopped, as failed. It expires like any other failed export.
+func (s *ExportService) fail(export *models.DataExport) error {
+	log.Println("Data export", export.ID, "timed out")
+	now := time.Now()
+	expiresAt := now.Add(s.linkTTL)
+	export.Status = models.ExportFailed
+	export.CompletedAt = &now
+	export.ExpiresAt = &expiresAt
+	return s.exportRepo.UpdateExport(export)
+}
+
+func (s *ExportService) build(export *models.DataExport) error {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+
+	names := make([]string, len(s.sections))
+	for i, section := range s.sections {
+		data, err := section.Collect(export.UserID)
+		if err != nil {
+			return err
+		}
+		if err := writeJSON(archive, section.Name+".json", data); err != nil {
+			return err
+		}
+		names[i] = section.Name
+	}
+
+	manifest := map[string]interface{}{
+		"export_id":    export.ID,
+		"user_id":      export.UserID,
+		"generated_at": time.Now().UTC().Format(time.RFC3339),
+		"sections":     names,
+	}
+	if err := writeJSON(archive, "manifest.json", manifest); err != nil {
+		return err
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+
+	export.StorageKey = "exports/" + export.UserID + "/" + export.ID + ".zip"
+	return s.storage.Put(context.Background(), export.StorageKey, &buf, int64(buf.Len()), "application/zip")
+}
+
+func writeJSON(archive *zip.Writer, name string, data interface{}) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data)
+}
+
+// OpenDownload returns the archive behind an emailed download link.
+func (s *ExportService) OpenDownload(token string) (io.ReadCloser, *models.DataExport, error) {
+	export, err := s.exportRepo.FindExportByToken(token)
+	if err != nil {
+		return nil, nil, tokenLookupError(err)
+	}
+	if export.ExpiresAt == nil || time.Now().After(*export.ExpiresAt) {
+		return nil, nil, ErrTokenExpired
+	}
+	return s.open(export)
+}
+
+// OpenExport returns an export's archive by ID, for admins.
+func (s *ExportService) OpenExport(exportID string) (io.ReadCloser, *models.DataExport, error) {
+	export, err := s.exportRepo.FindExportByID(exportID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil, ErrExportNotFound
+		}
+		return nil, nil, err
+	}
+	if s.organizationID != "" {
+		if _, err := s.userRepo.FindUserByID(export.UserID); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return nil, nil, ErrExportNotFound
+			}
+			return nil, nil, err
+		}
+	}
+	return s.open(export)
+}
+
+func (s *ExportService) open(export *models.DataExport) (io.ReadCloser, *models.DataExport, error) {
+	if export.Status != models.ExportReady {
+		return nil, nil, ErrExportNotReady
+	}
+	body, err := s.storage.Get(context.Background(), export.StorageKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, nil, ErrExportNotFound
+		}
+		return nil, nil, err
+	}
+	return body, export, nil
+}
+
+// DeleteExpiredExports removes archives whose download link has expired and
+// returns how many were deleted.
+func (s *ExportService) DeleteExpiredExports(ctx context.Context) (int, error) {
+	exports, err := s.exportRepo.FindExpiredExports(time.Now(), purgeBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, export := range exports {
+		if export.StorageKey != "" {
+			if err := s.storage.Delete(ctx, export.StorageKey); err != nil {
+				return deleted, err
+			}
+		}
+		if err := s.exportRepo.DeleteExport(export.ID); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// DeleteUserExports removes all of the user's exports and their archives.
+// Purges call it before deleting the user.
+func (s *ExportService) DeleteUserExports(ctx context.Context, userID string) error {
+	exports, err := s.exportRepo.FindExportsByUser(userID)
+	if err != nil {
+		return err
+	}
+	for _, export := range exports {
+		if export.StorageKey != "" {
+			if err := s.storage.Delete(ctx, export.StorageKey); err != nil {
+				return err
+			}
+		}
+		if err := s.exportRepo.DeleteExport(export.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *ExportService) sendExportReadyEmail(export models.DataExport) error {
+	user, err := s.userRepo.FindUserByID(export.UserID)
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(user.Email, "Your data export is ready",
+		"A copy of the personal data we hold about you is ready. Download it within "+
+			export.ExpiresAt.Sub(*export.CompletedAt).Round(time.Hour).String()+" using this link:\r\n"+
+			s.baseURL+"/api/exports/"+export.DownloadToken)
+}
+
+func (s *ExportService) collectProfile(userID string) (interface{}, error) {
+	user, err := s.userRepo.FindUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	profile := map[string]interface{}{
+		"id":          user.ID,
+		"name":        user.Name,
+		"email":       user.Email,
+		"age":         user.Age,
+		"gender":      user.Gender,
+		"phonenumber": user.PhoneNumber,
+		"address":     user.Address,
+		"image_url":   user.ImageURL,
+		"is_verified": user.IsVerified,
+		"is_blocked":  user.IsBlocked,
+		"created_at":  user.CreatedAt,
+		"updated_at":  user.UpdatedAt,
+	}
+	if user.DeletionScheduledAt != nil {
+		profile["deletion_scheduled_at"] = user.DeletionScheduledAt
+	}
+	return profile, nil
+}
+
+// collectPasswordResets lists when resets were requested. The tokens
+// themselves are credentials and are left out.
+func (s *ExportService) collectPasswordResets(userID string) (interface{}, error) {
+	resets, err := s.userRepo.FindPasswordResetsByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]map[string]interface{}, len(resets))
+	for i, pr := range resets {
+		entries[i] = map[string]interface{}{
+			"requested_at": pr.CreatedAt,
+			"expires_at":   time.Unix(pr.Expiry, 0).UTC(),
+		}
+	}
+	return entries, nil
+}
+
+// collectPasswordHistory lists when previous passwords were replaced, without
+// their hashes.
+func (s *ExportService) collectPasswordHistory(userID string) (interface{}, error) {
+	history, err := s.userRepo.FindPasswordHistory(userID, 1000)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]map[string]interface{}, len(history))
+	for i, h := range history {
+		entries[i] = map[string]interface{}{"replaced_at": h.CreatedAt}
+	}
+	return entries, nil
+}
+
+// collectBlocks lists the user's block history without the IDs of the admins
+// involved or their internal notes.
+func (s *ExportService) collectBlocks(userID string) (interface{}, error) {
+	blocks, err := s.userRepo.FindBlocksByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]map[string]interface{}, len(blocks))
+	for i, b := range blocks {
+		entries[i] = map[string]interface{}{
+			"reason":     b.Reason,
+			"until":      b.Until,
+			"blocked_at": b.CreatedAt,
+			"lifted_at":  b.LiftedAt,
+		}
+	}
+	return entries, nil
+}
+
+// collectSessions lists the user's sign-ins with the address and browser
+// they came from. Sessions support staff opened as the user are flagged
+// without saying who opened them.
+func (s *ExportService) collectSessions(userID string) (interface{}, error) {
+	sessions, err := s.userRepo.FindSessionsByUser(userID, 1000)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]models.SessionResponse, len(sessions))
+	for i := range sessions {
+		entries[i] = models.NewSessionResponse(&sessions[i])
+	}
+	return entries, nil
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/repository"
+	"github.com/liju-github/user-management/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeExportRepo struct {
+	mu      sync.Mutex
+	exports map[string]models.DataExport
+}
+
+func (r *fakeExportRepo) CreateExport(e *models.DataExport) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e.ID = generateToken()
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	r.exports[e.ID] = *e
+	return nil
+}
+
+func (r *fakeExportRepo) UpdateExport(e *models.DataExport) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.exports[e.ID] = *e
+	return nil
+}
+
+func (r *fakeExportRepo) find(match func(models.DataExport) bool) (*models.DataExport, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range r.exports {
+		if match(e) {
+			return &e, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *fakeExportRepo) FindExportByID(id string) (*models.DataExport, error) {
+	return r.find(func(e models.DataExport) bool { return e.ID == id })
+}
+
+func (r *fakeExportRepo) FindExportByToken(token string) (*models.DataExport, error) {
+	return r.find(func(e models.DataExport) bool { return e.DownloadToken == token })
+}
+
+func (r *fakeExportRepo) FindActiveExport(userID string) (*models.DataExport, error) {
+	return r.find(func(e models.DataExport) bool {
+		return e.UserID == userID && (e.Status == models.ExportPending || e.Status == models.ExportRunning)
+	})
+}
+
+func (r *fakeExportRepo) FindExpiredExports(before time.Time, limit int) ([]models.DataExport, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var expired []models.DataExport
+	for _, e := range r.exports {
+		if e.ExpiresAt != nil && !e.ExpiresAt.After(before) {
+			expired = append(expired, e)
+		}
+	}
+	return expired, nil
+}
+
+func (r *fakeExportRepo) FindExportsByUser(userID string) ([]models.DataExport, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var exports []models.DataExport
+	for _, e := range r.exports {
+		if e.UserID == userID {
+			exports = append(exports, e)
+		}
+	}
+	return exports, nil
+}
+
+func (r *fakeExportRepo) DeleteExport(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.exports, id)
+	return nil
+}
+
+type fakeAuditRepo struct {
+	events []models.AuditEvent
+}
+
+func (r *fakeAuditRepo) CreateAuditEvent(e *models.AuditEvent) error {
+	r.events = append(r.events, *e)
+	return nil
+}
+
+func (r *fakeAuditRepo) FindAuditEventsByUser(userID string) ([]models.AuditEvent, error) {
+	var events []models.AuditEvent
+	for _, e := range r.events {
+		if e.UserID == userID {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (r *fakeAuditRepo) FindRecentAuditEventsByUser(userID string, limit int) ([]models.AuditEvent, error) {
+	events, _ := r.FindAuditEventsByUser(userID)
+	var recent []models.AuditEvent
+	for i := len(events) - 1; i >= 0 && len(recent) < limit; i-- {
+		recent = append(recent, events[i])
+	}
+	return recent, nil
+}
+
+func TestDataExport(t *testing.T) {
+	store, err := storage.NewLocalStorage(t.TempDir(), "/media")
+	assert.NoError(t, err)
+	exportRepo := &fakeExportRepo{exports: map[string]models.DataExport{}}
+	audit := NewAuditService(&fakeAuditRepo{})
+	mailer := newRecordingMailer()
+	userRepo := newFakeUserRepo(existingUser(t))
+	assert.NoError(t, userRepo.BlockUser(userRepo.users["user-1"], &models.UserBlock{Reason: models.BlockReasonSpam, Note: "internal: matched spam ring"}))
+	assert.NoError(t, userRepo.CreateSession(&models.Session{UserID: "user-1", IPAddress: "203.0.113.7", ImpersonatorID: "admin-1"}))
+	svc := NewExportService(exportRepo, userRepo, store,
+		WithExportMailer(mailer), WithExportBaseURL("https://api.example.com"), WithExportAudit(audit))
+
+	_, err = svc.RequestExport("missing", SystemActor)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	export, err := svc.RequestExport("user-1", AdminActor("admin-1"))
+	assert.NoError(t, err)
+	assert.Equal(t, "admin-1", export.RequestedBy)
+
+	mail := mailer.wait(t)
+	assert.Equal(t, "john@example.com", mail.to)
+	assert.Equal(t, "Your data export is ready", mail.subject)
+
+	ready, err := exportRepo.FindExportByID(export.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ExportReady, ready.Status)
+
+	body, _, err := svc.OpenDownload(ready.DownloadToken)
+	assert.NoError(t, err)
+	data, _ := io.ReadAll(body)
+	body.Close()
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	assert.NoError(t, err)
+	files := map[string]string{}
+	for _, f := range archive.File {
+		r, _ := f.Open()
+		content, _ := io.ReadAll(r)
+		r.Close()
+		files[f.Name] = string(content)
+	}
+	assert.Contains(t, files["profile.json"], `"email": "john@example.com"`)
+	assert.NotContains(t, files["profile.json"], "password")
+	assert.Contains(t, files["audit_events.json"], models.AuditDataExportRequested)
+	assert.Contains(t, files["blocks.json"], models.BlockReasonSpam)
+	assert.NotContains(t, files["blocks.json"], "spam ring")
+	assert.Contains(t, files["sessions.json"], "203.0.113.7")
+	assert.Contains(t, files["sessions.json"], `"impersonated": true`)
+	assert.NotContains(t, files["sessions.json"], "admin-1")
+	assert.Contains(t, files, "manifest.json")
+
+	_, _, err = svc.OpenDownload("wrong-token")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// Once the link expires the archive is gone.
+	past := time.Now().Add(-time.Minute)
+	ready.ExpiresAt = &past
+	assert.NoError(t, exportRepo.UpdateExport(ready))
+	_, _, err = svc.OpenDownload(ready.DownloadToken)
+	assert.ErrorIs(t, err, ErrTokenExpired)
+
+	deleted, err := svc.DeleteExpiredExports(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	_, err = store.Get(context.Background(), ready.StorageKey)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	assert.True(t, strings.HasPrefix(ready.StorageKey, "exports/user-1/"))
+}
+
+func TestStaleExportIsReplaced(t *testing.T) {
+	store, err := storage.NewLocalStorage(t.TempDir(), "/media")
+	assert.NoError(t, err)
+	exportRepo := &fakeExportRepo{exports: map[string]models.DataExport{}}
+	mailer := newRecordingMailer()
+	svc := NewExportService(exportRepo, newFakeUserRepo(existingUser(t)), store, WithExportMailer(mailer))
+
+	// Left running by a process that has since stopped.
+	stale := &models.DataExport{UserID: "user-1", Status: models.ExportRunning, CreatedAt: time.Now().Add(-2 * exportTimeout)}
+	assert.NoError(t, exportRepo.CreateExport(stale))
+
+	export, err := svc.RequestExport("user-1", SystemActor)
+	assert.NoError(t, err)
+	assert.NotEqual(t, stale.ID, export.ID)
+	mailer.wait(t)
+
+	failed, err := exportRepo.FindExportByID(stale.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ExportFailed, failed.Status)
+	assert.NotNil(t, failed.ExpiresAt)
+}
@@ -0,0 +1,257 @@
+package services
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/liju-github/user-management/internal/events"
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/repository"
+)
+
+type IGroupService interface {
+	CreateGroup(req *models.GroupRequest) (*models.Group, error)
+	ListGroups() ([]models.Group, error)
+	GetGroup(groupID string) (*models.GroupDetail, error)
+	UpdateGroup(groupID string, req *models.GroupUpdateRequest) (*models.Group, error)
+	DeleteGroup(groupID string, by Actor) error
+	SetMember(groupID, userID, role string, by Actor) (*models.GroupMember, error)
+	RemoveMember(groupID, userID string, by Actor) error
+	GroupsForUser(userID string) ([]models.UserGroup, error)
+	ForOrganization(organizationID string) IGroupService
+}
+
+// GroupService manages groups of users and their roles in them. Admins
+// manage groups; users can only see the groups they belong to.
+type GroupService struct {
+	groupRepo repository.IGroupRepository
+	userRepo  repository.IUserRepository
+	events    *events.Bus
+
+	// organizationID limits the service to one tenant; see ForOrganization.
+	organizationID string
+}
+
+// GroupServiceOption configures optional GroupService behaviour.
+type GroupServiceOption func(*GroupService)
+
+// WithGroupEvents publishes membership changes to bus.
+func WithGroupEvents(bus *events.Bus) GroupServiceOption {
+	return func(s *GroupService) { s.events = bus }
+}
+
+func NewGroupService(groupRepo repository.IGroupRepository, userRepo repository.IUserRepository, opts ...GroupServiceOption) *GroupService {
+	s := &GroupService{groupRepo: groupRepo, userRepo: userRepo}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// ForOrganization returns the service as seen by one organization, which
+// only reaches its own groups and users. An empty organizationID returns s,
+// which sees every organization.
+func (s *GroupService) ForOrganization(organizationID string) IGroupService {
+	if organizationID == "" {
+		return s
+	}
+	scoped := *s
+	scoped.organizationID = organizationID
+	scoped.groupRepo = s.groupRepo.ForOrganization(organizationID)
+	scoped.userRepo = s.userRepo.ForOrganization(organizationID)
+	return &scoped
+}
+
+// CreateGroup adds a group to the service's organization, or to the default
+// organization when it has none. Group names are unique within an
+// organization.
+func (s *GroupService) CreateGroup(req *models.GroupRequest) (*models.Group, error) {
+	organizationID := s.organizationID
+	if organizationID == "" {
+		organizationID = models.DefaultOrganizationID
+	}
+
+	group := &models.Group{OrganizationID: organizationID, Name: strings.TrimSpace(req.Name), Description: req.Description}
+	if err := s.checkName(organizationID, group.Name, ""); err != nil {
+		return nil, err
+	}
+	if err := s.groupRepo.CreateGroup(group); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+func (s *GroupService) ListGroups() ([]models.Group, error) {
+	groups, err := s.groupRepo.FindGroups()
+	if err != nil {
+		return nil, err
+	}
+	if groups == nil {
+		groups = []models.Group{}
+	}
+	return groups, nil
+}
+
+// GetGroup returns the group with its members, owners first.
+func (s *GroupService) GetGroup(groupID string) (*models.GroupDetail, error) {
+	group, err := s.findGroup(groupID)
+	if err != nil {
+		return nil, err
+	}
+	members, err := s.groupRepo.FindMembers(group.ID)
+	if err != nil {
+		return nil, err
+	}
+	if members == nil {
+		members = []models.GroupMember{}
+	}
+	group.MemberCount = int64(len(members))
+	return &models.GroupDetail{Group: *group, Members: members}, nil
+}
+
+func (s *GroupService) UpdateGroup(groupID string, req *models.GroupUpdateRequest) (*models.Group, error) {
+	group, err := s.findGroup(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if err := s.checkName(group.OrganizationID, name, group.ID); err != nil {
+			return nil, err
+		}
+		group.Name = name
+	}
+	if req.Description != nil {
+		group.Description = *req.Description
+	}
+	if err := s.groupRepo.UpdateGroup(group); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// DeleteGroup removes the group; each of its members is recorded as
+// leaving it.
+func (s *GroupService) DeleteGroup(groupID string, by Actor) error {
+	group, err := s.findGroup(groupID)
+	if err != nil {
+		return err
+	}
+	members, err := s.groupRepo.FindMembers(group.ID)
+	if err != nil {
+		return err
+	}
+	if err := s.groupRepo.DeleteGroup(group.ID); err != nil {
+		return err
+	}
+
+	removed := make([]events.Event, len(members))
+	for i, member := range members {
+		removed[i] = events.GroupMemberRemoved{UserID: member.UserID, Group: userGroup(group, member.Role), Actor: by}
+	}
+	return publishAfter(s.events, s.userRepo, nil, removed...)
+}
+
+// SetMember adds the user to the group with role, or changes their role if
+// they already belong to it. The user must be in the group's organization.
+func (s *GroupService) SetMember(groupID, userID, role string, by Actor) (*models.GroupMember, error) {
+	group, err := s.findGroup(groupID)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.userRepo.FindUserByID(userID)
+	if err != nil {
+		return nil, userLookupError(err)
+	}
+	if user.OrganizationID != group.OrganizationID {
+		return nil, ErrUserNotFound
+	}
+
+	member, err := s.groupRepo.FindMember(group.ID, user.ID)
+	var evt events.Event
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		member = &models.GroupMember{GroupID: group.ID, UserID: user.ID, Role: role, AddedBy: by.ID}
+		evt = events.GroupMemberAdded{UserID: user.ID, Group: userGroup(group, role), Actor: by}
+	case err != nil:
+		return nil, err
+	case member.Role == role:
+		return member, nil
+	default:
+		evt = events.GroupMemberRoleChanged{UserID: user.ID, Group: userGroup(group, role), Previous: member.Role, Actor: by}
+		member.Role = role
+	}
+
+	if err := s.groupRepo.SaveMember(member); err != nil {
+		return nil, err
+	}
+	if err := publishAfter(s.events, s.userRepo, nil, evt); err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+func (s *GroupService) RemoveMember(groupID, userID string, by Actor) error {
+	group, err := s.findGroup(groupID)
+	if err != nil {
+		return err
+	}
+	member, err := s.groupRepo.FindMember(group.ID, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrGroupMemberNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.groupRepo.RemoveMember(group.ID, userID); err != nil {
+		return err
+	}
+	return publishAfter(s.events, s.userRepo, nil,
+		events.GroupMemberRemoved{UserID: userID, Group: userGroup(group, member.Role), Actor: by})
+}
+
+// GroupsForUser returns the groups the user belongs to with their role in
+// each, by name.
+func (s *GroupService) GroupsForUser(userID string) ([]models.UserGroup, error) {
+	if _, err := s.userRepo.FindUserByID(userID); err != nil {
+		return nil, userLookupError(err)
+	}
+	groups, err := s.groupRepo.FindGroupsByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if groups == nil {
+		groups = []models.UserGroup{}
+	}
+	return groups, nil
+}
+
+func (s *GroupService) findGroup(groupID string) (*models.Group, error) {
+	group, err := s.groupRepo.FindGroupByID(groupID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrGroupNotFound
+	}
+	return group, err
+}
+
+// checkName makes sure no group of the organization other than groupID is
+// called name.
+func (s *GroupService) checkName(organizationID, name, groupID string) error {
+	if name == "" {
+		return models.ValidationErrors{{Field: "name", Rule: "required"}}
+	}
+	existing, err := s.groupRepo.ForOrganization(organizationID).FindGroupByName(name)
+	if err == nil && existing.ID != groupID {
+		return ErrGroupExists
+	}
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+func userGroup(group *models.Group, role string) models.UserGroup {
+	return models.UserGroup{ID: group.ID, Name: group.Name, Role: role}
+}
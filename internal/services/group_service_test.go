@@ -0,0 +1,155 @@
+package services
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/liju-github/user-management/internal/events"
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeGroupRepo struct {
+	groups  map[string]*models.Group
+	members map[string]map[string]*models.GroupMember
+}
+
+func newFakeGroupRepo() *fakeGroupRepo {
+	return &fakeGroupRepo{groups: map[string]*models.Group{}, members: map[string]map[string]*models.GroupMember{}}
+}
+
+// ForOrganization returns r: the fake holds a single organization's groups.
+func (r *fakeGroupRepo) ForOrganization(string) repository.IGroupRepository {
+	return r
+}
+
+func (r *fakeGroupRepo) CreateGroup(g *models.Group) error {
+	g.ID = generateToken()
+	r.groups[g.ID] = g
+	return nil
+}
+
+func (r *fakeGroupRepo) UpdateGroup(g *models.Group) error {
+	r.groups[g.ID] = g
+	return nil
+}
+
+func (r *fakeGroupRepo) DeleteGroup(groupID string) error {
+	delete(r.groups, groupID)
+	delete(r.members, groupID)
+	return nil
+}
+
+func (r *fakeGroupRepo) FindGroupByID(id string) (*models.Group, error) {
+	if g, ok := r.groups[id]; ok {
+		copied := *g
+		return &copied, nil
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *fakeGroupRepo) FindGroupByName(name string) (*models.Group, error) {
+	for _, g := range r.groups {
+		if g.Name == name {
+			copied := *g
+			return &copied, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *fakeGroupRepo) FindGroups() ([]models.Group, error) {
+	var groups []models.Group
+	for _, g := range r.groups {
+		group := *g
+		group.MemberCount = int64(len(r.members[g.ID]))
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups, nil
+}
+
+func (r *fakeGroupRepo) FindMembers(groupID string) ([]models.GroupMember, error) {
+	var members []models.GroupMember
+	for _, m := range r.members[groupID] {
+		members = append(members, *m)
+	}
+	return members, nil
+}
+
+func (r *fakeGroupRepo) FindMember(groupID, userID string) (*models.GroupMember, error) {
+	if m, ok := r.members[groupID][userID]; ok {
+		copied := *m
+		return &copied, nil
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *fakeGroupRepo) SaveMember(m *models.GroupMember) error {
+	if r.members[m.GroupID] == nil {
+		r.members[m.GroupID] = map[string]*models.GroupMember{}
+	}
+	copied := *m
+	r.members[m.GroupID][m.UserID] = &copied
+	return nil
+}
+
+func (r *fakeGroupRepo) RemoveMember(groupID, userID string) error {
+	delete(r.members[groupID], userID)
+	return nil
+}
+
+func (r *fakeGroupRepo) FindGroupsByUser(userID string) ([]models.UserGroup, error) {
+	var groups []models.UserGroup
+	for groupID, members := range r.members {
+		if m, ok := members[userID]; ok {
+			groups = append(groups, models.UserGroup{ID: groupID, Name: r.groups[groupID].Name, Role: m.Role})
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups, nil
+}
+
+func TestGroupMembership(t *testing.T) {
+	user := existingUser(t)
+	user.OrganizationID = models.DefaultOrganizationID
+	outsider := &models.User{ID: "user-2", Email: "jane@example.com", OrganizationID: "org-2"}
+
+	bus := events.NewBus()
+	var names []string
+	bus.SubscribeAll(func(e events.Event) error {
+		names = append(names, e.EventName())
+		return nil
+	})
+	svc := NewGroupService(newFakeGroupRepo(), newFakeUserRepo(user, outsider), WithGroupEvents(bus))
+
+	platform, err := svc.CreateGroup(&models.GroupRequest{Name: " Platform "})
+	assert.NoError(t, err)
+	assert.Equal(t, "Platform", platform.Name)
+	assert.Equal(t, models.DefaultOrganizationID, platform.OrganizationID)
+	_, err = svc.CreateGroup(&models.GroupRequest{Name: "Platform"})
+	assert.ErrorIs(t, err, ErrGroupExists)
+
+	member, err := svc.SetMember(platform.ID, "user-1", models.GroupRoleMember, AdminActor("admin-1"))
+	assert.NoError(t, err)
+	assert.Equal(t, "admin-1", member.AddedBy)
+	_, err = svc.SetMember(platform.ID, "user-1", models.GroupRoleMember, AdminActor("admin-1"))
+	assert.NoError(t, err)
+	_, err = svc.SetMember(platform.ID, "user-1", models.GroupRoleOwner, AdminActor("admin-1"))
+	assert.NoError(t, err)
+	_, err = svc.SetMember(platform.ID, "user-2", models.GroupRoleMember, AdminActor("admin-1"))
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	groups, err := svc.GroupsForUser("user-1")
+	assert.NoError(t, err)
+	assert.Equal(t, []models.UserGroup{{ID: platform.ID, Name: "Platform", Role: models.GroupRoleOwner}}, groups)
+
+	assert.ErrorIs(t, svc.RemoveMember(platform.ID, "user-2", AdminActor("admin-1")), ErrGroupMemberNotFound)
+	assert.NoError(t, svc.RemoveMember(platform.ID, "user-1", AdminActor("admin-1")))
+	groups, err = svc.GroupsForUser("user-1")
+	assert.NoError(t, err)
+	assert.Empty(t, groups)
+
+	assert.Equal(t, []string{"group.member_added", "group.member_role_changed", "group.member_removed"}, names)
+}
@@ -0,0 +1,43 @@
+package services
+
+import (
+	"time"
+
+	"github.com/liju-github/user-management/internal/models"
+)
+
+// Impersonate starts a short-lived session in which the admin acts as the
+// user, for seeing exactly what they see. The session is recorded against
+// the user so it shows up in their security history.
+func (a *AdminService) Impersonate(userID, userAgent, ipAddress string, by Actor) (*models.User, *models.Session, error) {
+	user, err := a.userRepo.FindUserByID(userID)
+	if err != nil {
+		return nil, nil, userLookupError(err)
+	}
+	if user.BlockActive(time.Now()) {
+		return nil, nil, NewBlockedError(user)
+	}
+
+	now := time.Now()
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+	session := &models.Session{
+		UserID:         user.ID,
+		UserAgent:      userAgent,
+		IPAddress:      ipAddress,
+		LastSeenAt:     now,
+		ExpiresAt:      now.Add(a.impersonationTTL),
+		ImpersonatorID: by.ID,
+	}
+	if err := a.userRepo.CreateSession(session); err != nil {
+		return nil, nil, err
+	}
+
+	a.audit.Record(user.ID, by, models.AuditImpersonationStarted, map[string]string{
+		"session_id": session.ID,
+		"expires_at": session.ExpiresAt.UTC().Format(time.RFC3339),
+	})
+	return user, session, nil
+}
+
@@ -0,0 +1,429 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/liju-github/user-management/internal/importer"
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/passwords"
+	"github.com/liju-github/user-management/internal/repository"
+	"github.com/liju-github/user-management/internal/storage"
+)
+
+// maxImportIssues caps how many rejected rows are described on a job. Rows
+// past the cap are still counted.
+const maxImportIssues = 1000
+
+// importJobTimeout is how long a running job may go without saving its
+// progress before it is taken to have no live worker and can be resumed.
+// Jobs save after every chunk.
+const importJobTimeout = 10 * time.Minute
+
+// ImportOptions describes an uploaded import file.
+type ImportOptions struct {
+	// Format is "csv" or "ndjson"; when empty it is guessed from Filename.
+	Format   string
+	Filename string
+	// DryRun validates and deduplicates every row without creating users.
+	DryRun bool
+	// MarkVerified treats the imported emails as already verified.
+	MarkVerified bool
+	// OrganizationID is the tenant to import into, the default organization
+	// when empty.
+	OrganizationID string
+}
+
+type IImportService interface {
+	CreateImport(ctx context.Context, body io.Reader, size int64, opts ImportOptions, by Actor) (*models.ImportJob, error)
+	StartImport(job *models.ImportJob)
+	GetImportJob(jobID string) (*models.ImportJob, error)
+	ResumeImport(jobID string) (*models.ImportJob, error)
+}
+
+// ImportService brings users over from another system in bulk. Files are
+// kept in storage, which must not be publicly served, until the job
+// completes so an interrupted import can be resumed from the last committed
+// chunk.
+type ImportService struct {
+	importRepo repository.IImportRepository
+	storage    storage.Storage
+	passwords  *passwords.Manager
+	maxSize    int64
+	chunkSize  int
+	now        func() time.Time
+}
+
+// ImportServiceOption configures optional ImportService behaviour.
+type ImportServiceOption func(*ImportService)
+
+// WithImportMaxSize sets the largest import file accepted, in bytes.
+func WithImportMaxSize(maxBytes int64) ImportServiceOption {
+	return func(s *ImportService) { s.maxSize = maxBytes }
+}
+
+// WithImportChunkSize sets how many rows are inserted per transaction.
+func WithImportChunkSize(size int) ImportServiceOption {
+	return func(s *ImportService) {
+		if size > 0 {
+			s.chunkSize = size
+		}
+	}
+}
+
+// NewImportService returns an ImportService. Imported password hashes are
+// accepted when manager can verify them.
+func NewImportService(importRepo repository.IImportRepository, store storage.Storage, manager *passwords.Manager, opts ...ImportServiceOption) *ImportService {
+	s := &ImportService{
+		importRepo: importRepo,
+		storage:    store,
+		passwords:  manager,
+		maxSize:    100 << 20,
+		chunkSize:  1000,
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// CreateImport stores an import file and records a pending job for it. The
+// job does nothing until it is run with RunImport or StartImport.
+func (s *ImportService) CreateImport(ctx context.Context, body io.Reader, size int64, opts ImportOptions, by Actor) (*models.ImportJob, error) {
+	format := strings.ToLower(opts.Format)
+	if format == "" {
+		format = importer.FormatFromFilename(opts.Filename)
+	}
+	if format == "jsonl" {
+		format = importer.FormatNDJSON
+	}
+	if format != importer.FormatCSV && format != importer.FormatNDJSON {
+		return nil, models.ValidationErrors{{Field: "format", Rule: "oneof", Param: "csv ndjson"}}
+	}
+	if s.maxSize > 0 && size > s.maxSize {
+		return nil, ErrFileTooLarge
+	}
+
+	job := &models.ImportJob{
+		Format:       format,
+		Filename:     opts.Filename,
+		DryRun:       opts.DryRun,
+		MarkVerified: opts.MarkVerified,
+		RequestedBy:  by.ID,
+		Status:       models.ImportPending,
+		Issues:       []models.ImportIssue{},
+
+		OrganizationID: opts.OrganizationID,
+	}
+	if job.OrganizationID == "" {
+		job.OrganizationID = models.DefaultOrganizationID
+	}
+	if err := s.importRepo.CreateImportJob(job); err != nil {
+		return nil, err
+	}
+
+	job.StorageKey = fmt.Sprintf("imports/%s.%s", job.ID, format)
+	if err := s.storage.Put(ctx, job.StorageKey, body, size, "application/octet-stream"); err != nil {
+		return nil, err
+	}
+	if err := s.importRepo.UpdateImportJob(job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// GetImportJob returns an import job with its progress and report.
+func (s *ImportService) GetImportJob(jobID string) (*models.ImportJob, error) {
+	job, err := s.importRepo.FindImportJobByID(jobID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrImportNotFound
+	}
+	return job, err
+}
+
+// StartImport runs a pending job in the background and returns at once.
+func (s *ImportService) StartImport(job *models.ImportJob) {
+	go s.runInBackground(job.ID)
+}
+
+// ResumeImport continues a paused or failed job in the background from the
+// last committed chunk. A running job can be resumed too once it has not
+// saved its progress for importJobTimeout, as happens when the process
+// running it exits.
+func (s *ImportService) ResumeImport(jobID string) (*models.ImportJob, error) {
+	job, err := s.GetImportJob(jobID)
+	if err != nil {
+		return nil, err
+	}
+	claimed, err := s.importRepo.ClaimImportJob(job.ID, s.now().Add(-importJobTimeout))
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return nil, ErrImportNotResumable
+	}
+	job.Status = models.ImportRunning
+
+	go s.runInBackground(job.ID)
+	return job, nil
+}
+
+func (s *ImportService) runInBackground(jobID string) {
+	if _, err := s.RunImport(context.Background(), jobID); err != nil {
+		log.Printf("Import %s stopped: %v", jobID, err)
+	}
+}
+
+// RunImport processes a job until its file is exhausted or ctx is done. It
+// skips the rows a previous run already committed, so it can be called
+// again on a job that stopped part-way, including one left running by a
+// process that exited. A cancelled run leaves the job paused.
+func (s *ImportService) RunImport(ctx context.Context, jobID string) (*models.ImportJob, error) {
+	job, err := s.GetImportJob(jobID)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status == models.ImportCompleted {
+		return job, nil
+	}
+
+	job.Status = models.ImportRunning
+	job.LastError = ""
+	if err := s.importRepo.UpdateImportJob(job); err != nil {
+		return nil, err
+	}
+
+	if err := s.process(ctx, job); err != nil {
+		job.Status = models.ImportFailed
+		if ctx.Err() != nil {
+			job.Status = models.ImportPaused
+		}
+		job.LastError = err.Error()
+		if saveErr := s.importRepo.UpdateImportJob(job); saveErr != nil {
+			log.Printf("Failed to save import %s: %v", job.ID, saveErr)
+		}
+		return job, err
+	}
+
+	now := s.now()
+	job.Status = models.ImportCompleted
+	job.CompletedAt = &now
+	if err := s.importRepo.UpdateImportJob(job); err != nil {
+		return job, err
+	}
+	if err := s.storage.Delete(context.Background(), job.StorageKey); err != nil {
+		log.Printf("Failed to delete import file %s: %v", job.StorageKey, err)
+	}
+	return job, nil
+}
+
+// importBatch collects the users of one chunk until they are committed.
+type importBatch struct {
+	users  []models.User
+	lines  []int
+	issues []models.ImportIssue
+	rows   int
+}
+
+func (s *ImportService) process(ctx context.Context, job *models.ImportJob) error {
+	file, err := s.storage.Get(ctx, job.StorageKey)
+	if err != nil {
+		return fmt.Errorf("failed to open import file: %w", err)
+	}
+	defer file.Close()
+
+	reader, err := importer.NewReader(file, job.Format)
+	if err != nil {
+		return err
+	}
+
+	// Emails seen earlier in the file, so later duplicates are skipped. Rows
+	// committed by a previous run are replayed into it without counting.
+	seen := map[string]bool{}
+	row := 0
+	batch := &importBatch{}
+	for {
+		record, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var recordErr *importer.RecordError
+		if err != nil && !errors.As(err, &recordErr) {
+			return fmt.Errorf("failed to read import file: %w", err)
+		}
+		row++
+
+		var (
+			user  *models.User
+			issue *models.ImportIssue
+		)
+		if recordErr != nil {
+			issue = &models.ImportIssue{Line: recordErr.Line, Errors: models.ValidationErrors{{Field: "line", Rule: "malformed"}}}
+		} else {
+			user, issue = s.checkRecord(record, job, seen)
+		}
+		if row <= job.Processed {
+			continue
+		}
+
+		batch.rows++
+		switch {
+		case issue != nil:
+			batch.issues = append(batch.issues, *issue)
+		default:
+			batch.users = append(batch.users, *user)
+			batch.lines = append(batch.lines, record.Line)
+		}
+
+		if batch.rows == s.chunkSize {
+			if err := s.commit(ctx, job, batch); err != nil {
+				return err
+			}
+			batch = &importBatch{}
+		}
+	}
+	return s.commit(ctx, job, batch)
+}
+
+// checkRecord validates one record and turns it into a user. It returns an
+// issue instead when the record is invalid or repeats an earlier email.
+func (s *ImportService) checkRecord(record importer.Record, job *models.ImportJob, seen map[string]bool) (*models.User, *models.ImportIssue) {
+	var fieldErrors models.ValidationErrors
+	parsed := models.ImportUserRecord{
+		Name:    record.Name,
+		Email:   record.Email,
+		Gender:  record.Gender,
+		Address: record.Address,
+	}
+	if age, err := strconv.ParseUint(record.Age, 10, 32); err == nil {
+		parsed.Age = uint(age)
+	} else if record.Age != "" {
+		fieldErrors = append(fieldErrors, models.FieldError{Field: "age", Rule: "number"})
+	}
+	if phone, err := strconv.ParseUint(record.Phone, 10, 64); err == nil {
+		parsed.PhoneNumber = uint(phone)
+	} else if record.Phone != "" {
+		fieldErrors = append(fieldErrors, models.FieldError{Field: "phone", Rule: "numeric"})
+	}
+
+	var verrs models.ValidationErrors
+	if err := models.ValidateStruct(parsed); errors.As(err, &verrs) {
+		for _, fe := range verrs {
+			if (fe.Field == "age" || fe.Field == "phone") && hasField(fieldErrors, fe.Field) {
+				continue
+			}
+			fieldErrors = append(fieldErrors, fe)
+		}
+	}
+
+	hash := record.PasswordHash
+	if hash == "" {
+		hash = passwords.Unusable
+	} else if s.passwords.Check(hash) != nil {
+		fieldErrors = append(fieldErrors, models.FieldError{Field: "password_hash", Rule: "hash"})
+	}
+
+	if len(fieldErrors) > 0 {
+		return nil, &models.ImportIssue{Line: record.Line, Email: record.Email, Errors: fieldErrors}
+	}
+
+	key := strings.ToLower(record.Email)
+	if seen[key] {
+		return nil, &models.ImportIssue{Line: record.Line, Email: record.Email, Errors: models.ValidationErrors{{Field: "email", Rule: "duplicate"}}}
+	}
+	seen[key] = true
+
+	importedAt := s.now()
+	return &models.User{
+		Name:         parsed.Name,
+		Email:        parsed.Email,
+		Address:      parsed.Address,
+		Age:          parsed.Age,
+		Gender:       parsed.Gender,
+		PhoneNumber:  parsed.PhoneNumber,
+		PasswordHash: hash,
+		IsVerified:   job.MarkVerified,
+		ImportedAt:   &importedAt,
+
+		OrganizationID: job.OrganizationID,
+	}, nil
+}
+
+// commit drops users whose email is already registered, then inserts the
+// rest together with the job's new progress. job is only updated once the
+// chunk is committed.
+func (s *ImportService) commit(ctx context.Context, job *models.ImportJob, batch *importBatch) error {
+	if batch.rows == 0 {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	emails := make([]string, len(batch.users))
+	for i, user := range batch.users {
+		emails[i] = user.Email
+	}
+	existing, err := s.importRepo.FindExistingEmails(job.OrganizationID, emails)
+	if err != nil {
+		return err
+	}
+	taken := map[string]bool{}
+	for _, email := range existing {
+		taken[strings.ToLower(email)] = true
+	}
+
+	next := *job
+	next.Issues = append([]models.ImportIssue(nil), job.Issues...)
+	users := make([]models.User, 0, len(batch.users))
+	for i, user := range batch.users {
+		if taken[strings.ToLower(user.Email)] {
+			next.Skipped++
+			next.Issues = appendIssue(next.Issues, models.ImportIssue{Line: batch.lines[i], Email: user.Email, Errors: models.ValidationErrors{{Field: "email", Rule: "exists"}}})
+			continue
+		}
+		users = append(users, user)
+	}
+	for _, issue := range batch.issues {
+		if len(issue.Errors) == 1 && issue.Errors[0].Rule == "duplicate" {
+			next.Skipped++
+		} else {
+			next.Invalid++
+		}
+		next.Issues = appendIssue(next.Issues, issue)
+	}
+
+	next.Processed += batch.rows
+	next.Imported += len(users)
+	if next.DryRun {
+		users = nil
+	}
+	if err := s.importRepo.ImportChunk(&next, users); err != nil {
+		return err
+	}
+	*job = next
+	return nil
+}
+
+func appendIssue(issues []models.ImportIssue, issue models.ImportIssue) []models.ImportIssue {
+	if len(issues) >= maxImportIssues {
+		return issues
+	}
+	return append(issues, issue)
+}
+
+func hasField(errs models.ValidationErrors, field string) bool {
+	for _, fe := range errs {
+		if fe.Field == field {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,246 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/passwords"
+	"github.com/liju-github/user-management/internal/repository"
+	"github.com/liju-github/user-management/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type fakeImportRepo struct {
+	mu     sync.Mutex
+	jobs   map[string]models.ImportJob
+	emails []string
+	users  []models.User
+	// failChunk makes the nth ImportChunk call fail, as if the process died.
+	failChunk int
+	chunks    int
+}
+
+func (r *fakeImportRepo) CreateImportJob(job *models.ImportJob) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job.ID = generateToken()
+	job.UpdatedAt = time.Now()
+	r.jobs[job.ID] = *job
+	return nil
+}
+
+func (r *fakeImportRepo) UpdateImportJob(job *models.ImportJob) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job.UpdatedAt = time.Now()
+	r.jobs[job.ID] = *job
+	return nil
+}
+
+func (r *fakeImportRepo) ClaimImportJob(id string, staleBefore time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, ok := r.jobs[id]
+	stalled := job.Status == models.ImportRunning && job.UpdatedAt.Before(staleBefore)
+	if !ok || (job.Status != models.ImportPaused && job.Status != models.ImportFailed && !stalled) {
+		return false, nil
+	}
+	job.Status = models.ImportRunning
+	job.UpdatedAt = time.Now()
+	r.jobs[id] = job
+	return true, nil
+}
+
+func (r *fakeImportRepo) FindImportJobByID(id string) (*models.ImportJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, ok := r.jobs[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	return &job, nil
+}
+
+func (r *fakeImportRepo) FindExistingEmails(organizationID string, emails []string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var existing []string
+	for _, email := range emails {
+		for _, known := range r.emails {
+			if strings.EqualFold(email, known) {
+				existing = append(existing, known)
+			}
+		}
+	}
+	return existing, nil
+}
+
+func (r *fakeImportRepo) ImportChunk(job *models.ImportJob, users []models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.chunks++
+	if r.chunks == r.failChunk {
+		return errors.New("connection lost")
+	}
+	for _, u := range users {
+		r.emails = append(r.emails, u.Email)
+	}
+	r.users = append(r.users, users...)
+	job.UpdatedAt = time.Now()
+	r.jobs[job.ID] = *job
+	return nil
+}
+
+func importFixture(t *testing.T) string {
+	hash, err := bcrypt.GenerateFromPassword([]byte("Legacy@Pass1"), bcrypt.MinCost)
+	assert.NoError(t, err)
+
+	return strings.Join([]string{
+		"name,email,phone,age,gender,address,password_hash",
+		"Alice Smith,alice@example.com,9876543210,30,Female,1 Main Street," + string(hash),
+		"Bob Jones,bob@example.com,9876543211,41,Male,2 High Street,",
+		"Al,not-an-email,123,abc,Robot,x,",
+		"Alice Again,ALICE@example.com,9876543212,25,Female,3 Side Street,",
+		"John Doe,john@example.com,9876543213,35,Male,4 Old Road,",
+		"Carol White,carol@example.com,9876543214,52,Female,5 New Road,$md5$nope",
+		"Dave Brown,dave@example.com,9876543215,28,Male,6 Park Lane,",
+	}, "\n")
+}
+
+func newTestImportService(t *testing.T, repo *fakeImportRepo) *ImportService {
+	store, err := storage.NewLocalStorage(t.TempDir(), "/media")
+	assert.NoError(t, err)
+	manager := passwords.NewManager(passwords.NewArgon2idHasher(passwords.Argon2idParams{Memory: 64, Iterations: 1, Parallelism: 1}), passwords.NewBcryptHasher(bcrypt.MinCost))
+	return NewImportService(repo, store, manager, WithImportChunkSize(2))
+}
+
+func TestImportUsers(t *testing.T) {
+	repo := &fakeImportRepo{jobs: map[string]models.ImportJob{}, emails: []string{"john@example.com"}}
+	svc := newTestImportService(t, repo)
+	data := importFixture(t)
+
+	_, err := svc.CreateImport(context.Background(), strings.NewReader(data), int64(len(data)), ImportOptions{Filename: "users.txt"}, SystemActor)
+	assert.Equal(t, models.ValidationErrors{{Field: "format", Rule: "oneof", Param: "csv ndjson"}}, err)
+
+	job, err := svc.CreateImport(context.Background(), strings.NewReader(data), int64(len(data)), ImportOptions{Filename: "users.csv", MarkVerified: true}, AdminActor("admin-1"))
+	assert.NoError(t, err)
+	assert.Equal(t, models.ImportPending, job.Status)
+
+	job, err = svc.RunImport(context.Background(), job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ImportCompleted, job.Status)
+	assert.Equal(t, 7, job.Processed)
+	assert.Equal(t, 3, job.Imported)
+	assert.Equal(t, 2, job.Skipped)
+	assert.Equal(t, 2, job.Invalid)
+	_, err = svc.storage.Get(context.Background(), job.StorageKey)
+	assert.Error(t, err, "the uploaded file is removed once the import completes")
+
+	rules := map[int][]string{}
+	for _, issue := range job.Issues {
+		for _, fe := range issue.Errors {
+			rules[issue.Line] = append(rules[issue.Line], fe.Field+":"+fe.Rule)
+		}
+	}
+	assert.ElementsMatch(t, []string{"name:min", "email:email", "phone:min", "age:number", "gender:oneof", "address:min"}, rules[4])
+	assert.Equal(t, []string{"email:duplicate"}, rules[5])
+	assert.Equal(t, []string{"email:exists"}, rules[6])
+	assert.Equal(t, []string{"password_hash:hash"}, rules[7])
+
+	assert.Len(t, repo.users, 3)
+	assert.True(t, strings.HasPrefix(repo.users[0].PasswordHash, "$2a$"))
+	assert.Equal(t, passwords.Unusable, repo.users[1].PasswordHash)
+	for _, u := range repo.users {
+		assert.True(t, u.IsVerified)
+		assert.NotNil(t, u.ImportedAt)
+	}
+}
+
+func TestImportDryRun(t *testing.T) {
+	repo := &fakeImportRepo{jobs: map[string]models.ImportJob{}, emails: []string{"john@example.com"}}
+	svc := newTestImportService(t, repo)
+
+	data := `{"name":"Alice Smith","email":"alice@example.com","phone":9876543210,"age":30,"gender":"Female","address":"1 Main Street"}
+not json
+{"name":"Bob Jones","email":"bob@example.com","phone":"9876543211","age":"41","gender":"Male","address":"2 High Street"}
+`
+	job, err := svc.CreateImport(context.Background(), strings.NewReader(data), int64(len(data)), ImportOptions{Format: "ndjson", DryRun: true}, SystemActor)
+	assert.NoError(t, err)
+
+	job, err = svc.RunImport(context.Background(), job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, job.Imported)
+	assert.Equal(t, 1, job.Invalid)
+	assert.Equal(t, models.ImportIssue{Line: 2, Errors: models.ValidationErrors{{Field: "line", Rule: "malformed"}}}, job.Issues[0])
+	assert.Empty(t, repo.users)
+}
+
+func TestImportResume(t *testing.T) {
+	repo := &fakeImportRepo{jobs: map[string]models.ImportJob{}, emails: []string{"john@example.com"}, failChunk: 3}
+	svc := newTestImportService(t, repo)
+	data := importFixture(t)
+
+	job, err := svc.CreateImport(context.Background(), strings.NewReader(data), int64(len(data)), ImportOptions{Format: "csv"}, SystemActor)
+	assert.NoError(t, err)
+
+	job, err = svc.RunImport(context.Background(), job.ID)
+	assert.Error(t, err)
+	assert.Equal(t, models.ImportFailed, job.Status)
+
+	stored, _ := repo.FindImportJobByID(job.ID)
+	assert.Equal(t, 4, stored.Processed)
+	assert.Len(t, repo.users, 2)
+
+	_, err = svc.ResumeImport("missing")
+	assert.ErrorIs(t, err, ErrImportNotFound)
+
+	job, err = svc.RunImport(context.Background(), job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ImportCompleted, job.Status)
+	assert.Equal(t, 7, job.Processed)
+	assert.Equal(t, 3, job.Imported)
+	// The repeated Alice is still caught after resuming.
+	assert.Equal(t, 2, job.Skipped)
+	assert.Len(t, repo.users, 3)
+
+	_, err = svc.ResumeImport(job.ID)
+	assert.ErrorIs(t, err, ErrImportNotResumable)
+}
+
+func TestResumeStalledImport(t *testing.T) {
+	repo := &fakeImportRepo{jobs: map[string]models.ImportJob{}}
+	svc := newTestImportService(t, repo)
+	data := importFixture(t)
+
+	job, err := svc.CreateImport(context.Background(), strings.NewReader(data), int64(len(data)), ImportOptions{Format: "csv"}, SystemActor)
+	assert.NoError(t, err)
+
+	// A job another worker is still saving cannot be taken over.
+	job.Status = models.ImportRunning
+	assert.NoError(t, repo.UpdateImportJob(job))
+	_, err = svc.ResumeImport(job.ID)
+	assert.ErrorIs(t, err, ErrImportNotResumable)
+
+	// One left running by a process that exited can.
+	repo.mu.Lock()
+	stalled := repo.jobs[job.ID]
+	stalled.UpdatedAt = time.Now().Add(-2 * importJobTimeout)
+	repo.jobs[job.ID] = stalled
+	repo.mu.Unlock()
+	resumed, err := svc.ResumeImport(job.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.ImportRunning, resumed.Status)
+
+	assert.Eventually(t, func() bool {
+		stored, _ := repo.FindImportJobByID(job.ID)
+		return stored.Status == models.ImportCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+	stored, _ := repo.FindImportJobByID(job.ID)
+	assert.Equal(t, 7, stored.Processed)
+}
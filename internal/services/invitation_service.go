@@ -0,0 +1,379 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/liju-github/user-management/internal/events"
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/repository"
+)
+
+type IInvitationService interface {
+	Invite(req *models.InvitationRequest, by Actor) (*models.InvitationResponse, error)
+	InviteToGroup(userID, groupID string, req *models.InvitationRequest) (*models.InvitationResponse, error)
+	ListInvitations(status string) ([]models.InvitationResponse, error)
+	Resend(invitationID string, by Actor) (*models.InvitationResponse, error)
+	Revoke(invitationID string, by Actor) error
+	Preview(token string) (*models.InvitationPreview, error)
+	ForOrganization(organizationID string) IInvitationService
+}
+
+// InvitationService lets admins, and optionally group owners, invite email
+// addresses to sign up. Invitations are redeemed with a signed link, which
+// UserService.Signup checks through Lookup.
+type InvitationService struct {
+	invitationRepo   repository.IInvitationRepository
+	groupRepo        repository.IGroupRepository
+	userRepo         repository.IUserRepository
+	organizationRepo repository.IOrganizationRepository
+	events           *events.Bus
+
+	secret      []byte
+	ttl         time.Duration
+	signupMode  string
+	ownerInvite bool
+
+	// organizationID limits the service to one tenant; see ForOrganization.
+	organizationID string
+}
+
+// InvitationServiceOption configures optional InvitationService behaviour.
+type InvitationServiceOption func(*InvitationService)
+
+// WithInvitationSecret sets the key invitation links are signed with.
+// Without it a random key is used, so links stop working when the process
+// restarts; that only suits tests.
+func WithInvitationSecret(secret string) InvitationServiceOption {
+	return func(s *InvitationService) { s.secret = []byte(secret) }
+}
+
+// WithInvitationTTL sets how long an invitation can be accepted for after it
+// is sent or resent.
+func WithInvitationTTL(ttl time.Duration) InvitationServiceOption {
+	return func(s *InvitationService) { s.ttl = ttl }
+}
+
+// WithSignupMode sets the signup mode of organizations that do not set
+// their own. It is open by default.
+func WithSignupMode(mode string) InvitationServiceOption {
+	return func(s *InvitationService) { s.signupMode = mode }
+}
+
+// WithGroupOwnerInvites lets group owners invite people into their groups.
+func WithGroupOwnerInvites(enabled bool) InvitationServiceOption {
+	return func(s *InvitationService) { s.ownerInvite = enabled }
+}
+
+// WithInvitationEvents publishes sent invitations to bus, whose email
+// subscriber delivers the links.
+func WithInvitationEvents(bus *events.Bus) InvitationServiceOption {
+	return func(s *InvitationService) { s.events = bus }
+}
+
+func NewInvitationService(invitationRepo repository.IInvitationRepository, groupRepo repository.IGroupRepository, userRepo repository.IUserRepository, organizationRepo repository.IOrganizationRepository, opts ...InvitationServiceOption) *InvitationService {
+	s := &InvitationService{
+		invitationRepo:   invitationRepo,
+		groupRepo:        groupRepo,
+		userRepo:         userRepo,
+		organizationRepo: organizationRepo,
+		ttl:              7 * 24 * time.Hour,
+		signupMode:       models.SignupOpen,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if len(s.secret) == 0 {
+		s.secret = []byte(generateToken())
+	}
+	return s
+}
+
+// ForOrganization returns the service as seen by one organization, which
+// only reaches its own invitations. An empty organizationID returns s,
+// which sees every organization.
+func (s *InvitationService) ForOrganization(organizationID string) IInvitationService {
+	if organizationID == "" {
+		return s
+	}
+	scoped := *s
+	scoped.organizationID = organizationID
+	scoped.invitationRepo = s.invitationRepo.ForOrganization(organizationID)
+	scoped.groupRepo = s.groupRepo.ForOrganization(organizationID)
+	scoped.userRepo = s.userRepo.ForOrganization(organizationID)
+	return &scoped
+}
+
+// Invite invites req.Email to the service's organization, or to the default
+// organization when it has none, and emails them a link. The email must not
+// belong to a user or have a pending invitation already.
+func (s *InvitationService) Invite(req *models.InvitationRequest, by Actor) (*models.InvitationResponse, error) {
+	organizationID := s.organizationID
+	if organizationID == "" {
+		organizationID = models.DefaultOrganizationID
+	}
+	email := strings.TrimSpace(req.Email)
+
+	var group *models.Group
+	if req.GroupID != "" {
+		var err error
+		group, err = s.groupRepo.FindGroupByID(req.GroupID)
+		if errors.Is(err, repository.ErrNotFound) || (err == nil && group.OrganizationID != organizationID) {
+			return nil, ErrGroupNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := s.userRepo.ForOrganization(organizationID).FindUserByEmail(email); err == nil {
+		return nil, ErrUserExists
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	now := time.Now()
+	if _, err := s.invitationRepo.ForOrganization(organizationID).FindPendingInvitation(email, now); err == nil {
+		return nil, ErrInvitationExists
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+
+	invitation := &models.Invitation{
+		OrganizationID: organizationID,
+		Email:          email,
+		InvitedBy:      by.ID,
+		InviterRole:    by.Role,
+		Nonce:          generateToken(),
+		ExpiresAt:      now.Add(s.ttl),
+		SentCount:      1,
+	}
+	if group != nil {
+		invitation.GroupID = group.ID
+		invitation.GroupRole = req.GroupRole
+		if invitation.GroupRole == "" {
+			invitation.GroupRole = models.GroupRoleMember
+		}
+	}
+	if err := s.invitationRepo.CreateInvitation(invitation); err != nil {
+		return nil, err
+	}
+	if err := s.announce(invitation, by); err != nil {
+		return nil, err
+	}
+	return invitationResponse(invitation, now), nil
+}
+
+// InviteToGroup is Invite for a group owner inviting someone into their
+// group. It needs WithGroupOwnerInvites.
+func (s *InvitationService) InviteToGroup(userID, groupID string, req *models.InvitationRequest) (*models.InvitationResponse, error) {
+	if !s.ownerInvite {
+		return nil, ErrInsufficientAccess
+	}
+	group, err := s.groupRepo.FindGroupByID(groupID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrGroupNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	member, err := s.groupRepo.FindMember(group.ID, userID)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && member.Role != models.GroupRoleOwner) {
+		return nil, ErrInsufficientAccess
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	scoped := s
+	if s.organizationID == "" {
+		scoped = s.ForOrganization(group.OrganizationID).(*InvitationService)
+	}
+	invite := *req
+	invite.GroupID = group.ID
+	return scoped.Invite(&invite, UserActor(userID))
+}
+
+// ListInvitations returns the invitations in status, or all of them when it
+// is empty, newest first.
+func (s *InvitationService) ListInvitations(status string) ([]models.InvitationResponse, error) {
+	switch status {
+	case "", models.InvitationPending, models.InvitationAccepted, models.InvitationRevoked, models.InvitationExpired:
+	default:
+		return nil, models.ValidationErrors{{Field: "status", Rule: "oneof", Param: "pending accepted revoked expired"}}
+	}
+	now := time.Now()
+	invitations, err := s.invitationRepo.FindInvitations(status, now)
+	if err != nil {
+		return nil, err
+	}
+	responses := make([]models.InvitationResponse, len(invitations))
+	for i := range invitations {
+		responses[i] = *invitationResponse(&invitations[i], now)
+	}
+	return responses, nil
+}
+
+// InvitationsForUser returns the invitations the user signed up with, for
+// their data export.
+func (s *InvitationService) InvitationsForUser(userID string) ([]models.InvitationResponse, error) {
+	invitations, err := s.invitationRepo.FindInvitationsByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	responses := make([]models.InvitationResponse, len(invitations))
+	for i := range invitations {
+		responses[i] = *invitationResponse(&invitations[i], now)
+	}
+	return responses, nil
+}
+
+// Resend emails a pending invitation again with a new link and a new
+// expiry; links sent before stop working.
+func (s *InvitationService) Resend(invitationID string, by Actor) (*models.InvitationResponse, error) {
+	invitation, err := s.findPending(invitationID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	invitation.Nonce = generateToken()
+	invitation.ExpiresAt = now.Add(s.ttl)
+	invitation.SentCount++
+	if err := s.invitationRepo.UpdateInvitation(invitation); err != nil {
+		return nil, err
+	}
+	if err := s.announce(invitation, by); err != nil {
+		return nil, err
+	}
+	return invitationResponse(invitation, now), nil
+}
+
+// Revoke stops a pending invitation from being accepted.
+func (s *InvitationService) Revoke(invitationID string, by Actor) error {
+	invitation, err := s.findPending(invitationID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	invitation.RevokedAt = &now
+	return s.invitationRepo.UpdateInvitation(invitation)
+}
+
+// Lookup returns the pending invitation behind a link token. Tokens that
+// are forged, superseded by a resend, revoked or already used are invalid.
+func (s *InvitationService) Lookup(token string) (*models.Invitation, error) {
+	invitationID, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	invitation, err := s.invitationRepo.FindInvitationByID(invitationID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.sign(invitation))) {
+		return nil, ErrInvalidToken
+	}
+
+	switch invitation.Status(time.Now()) {
+	case models.InvitationPending:
+		return invitation, nil
+	case models.InvitationExpired:
+		return nil, ErrTokenExpired
+	}
+	return nil, ErrInvalidToken
+}
+
+// Preview describes the invitation behind a link token to its holder.
+func (s *InvitationService) Preview(token string) (*models.InvitationPreview, error) {
+	invitation, err := s.Lookup(token)
+	if err != nil {
+		return nil, err
+	}
+	organization, group, err := s.names(invitation)
+	if err != nil {
+		return nil, err
+	}
+	return &models.InvitationPreview{Email: invitation.Email, Organization: organization, Group: group, ExpiresAt: invitation.ExpiresAt}, nil
+}
+
+// SignupMode returns how people can sign up to the organization: its own
+// mode if it has one, otherwise the deployment's.
+func (s *InvitationService) SignupMode(organizationID string) (string, error) {
+	organization, err := s.organizationRepo.FindOrganizationByID(organizationID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return "", err
+	}
+	if organization != nil && organization.SignupMode != "" {
+		return organization.SignupMode, nil
+	}
+	return s.signupMode, nil
+}
+
+func (s *InvitationService) findPending(invitationID string) (*models.Invitation, error) {
+	invitation, err := s.invitationRepo.FindInvitationByID(invitationID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvitationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if invitation.Status(time.Now()) != models.InvitationPending {
+		return nil, ErrInvitationNotPending
+	}
+	return invitation, nil
+}
+
+// announce publishes the invitation with a fresh link for the email
+// subscriber to send.
+func (s *InvitationService) announce(invitation *models.Invitation, by Actor) error {
+	organization, group, err := s.names(invitation)
+	if err != nil {
+		return err
+	}
+	return publishAfter(s.events, s.userRepo, nil, events.InvitationSent{
+		InvitationID: invitation.ID,
+		Email:        invitation.Email,
+		Organization: organization,
+		Group:        group,
+		Token:        invitation.ID + "." + s.sign(invitation),
+		ExpiresAt:    invitation.ExpiresAt,
+		Actor:        by,
+	})
+}
+
+// names returns the names of the invitation's organization and group.
+func (s *InvitationService) names(invitation *models.Invitation) (organization, group string, err error) {
+	org, err := s.organizationRepo.FindOrganizationByID(invitation.OrganizationID)
+	if err != nil {
+		return "", "", err
+	}
+	if invitation.GroupID != "" {
+		g, err := s.groupRepo.ForOrganization(invitation.OrganizationID).FindGroupByID(invitation.GroupID)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return "", "", err
+		}
+		if g != nil {
+			group = g.Name
+		}
+	}
+	return org.Name, group, nil
+}
+
+// sign is the signature of an invitation link. It covers the nonce, so a
+// resend invalidates older links.
+func (s *InvitationService) sign(invitation *models.Invitation) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(invitation.ID + "." + invitation.Nonce))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func invitationResponse(invitation *models.Invitation, now time.Time) *models.InvitationResponse {
+	return &models.InvitationResponse{Invitation: *invitation, Status: invitation.Status(now)}
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/liju-github/user-management/internal/events"
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeInvitationRepo struct {
+	invitations map[string]*models.Invitation
+}
+
+func newFakeInvitationRepo() *fakeInvitationRepo {
+	return &fakeInvitationRepo{invitations: map[string]*models.Invitation{}}
+}
+
+// ForOrganization returns r: the fake holds a single organization's
+// invitations.
+func (r *fakeInvitationRepo) ForOrganization(string) repository.IInvitationRepository {
+	return r
+}
+
+func (r *fakeInvitationRepo) CreateInvitation(i *models.Invitation) error {
+	i.ID = generateToken()[:36]
+	copied := *i
+	r.invitations[i.ID] = &copied
+	return nil
+}
+
+func (r *fakeInvitationRepo) UpdateInvitation(i *models.Invitation) error {
+	copied := *i
+	r.invitations[i.ID] = &copied
+	return nil
+}
+
+func (r *fakeInvitationRepo) FindInvitationByID(id string) (*models.Invitation, error) {
+	if i, ok := r.invitations[id]; ok {
+		copied := *i
+		return &copied, nil
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *fakeInvitationRepo) FindPendingInvitation(email string, now time.Time) (*models.Invitation, error) {
+	for _, i := range r.invitations {
+		if i.Email == email && i.Status(now) == models.InvitationPending {
+			copied := *i
+			return &copied, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *fakeInvitationRepo) FindInvitations(status string, now time.Time) ([]models.Invitation, error) {
+	var invitations []models.Invitation
+	for _, i := range r.invitations {
+		if status == "" || i.Status(now) == status {
+			invitations = append(invitations, *i)
+		}
+	}
+	sort.Slice(invitations, func(a, b int) bool { return invitations[a].Email < invitations[b].Email })
+	return invitations, nil
+}
+
+func (r *fakeInvitationRepo) FindInvitationsByUser(userID string) ([]models.Invitation, error) {
+	var invitations []models.Invitation
+	for _, i := range r.invitations {
+		if i.AcceptedUserID == userID {
+			invitations = append(invitations, *i)
+		}
+	}
+	return invitations, nil
+}
+
+type invitationFixture struct {
+	invitations *InvitationService
+	users       *UserService
+	userRepo    *fakeUserRepo
+	groupRepo   *fakeGroupRepo
+	orgs        *fakeOrganizationRepo
+	tokens      map[string]string
+}
+
+func newInvitationFixture(t *testing.T, mode string, opts ...InvitationServiceOption) *invitationFixture {
+	t.Helper()
+	f := &invitationFixture{
+		userRepo:  newFakeUserRepo(),
+		groupRepo: newFakeGroupRepo(),
+		orgs:      newFakeOrganizationRepo(),
+		tokens:    map[string]string{},
+	}
+	f.orgs.organizations[models.DefaultOrganizationID] = &models.Organization{ID: models.DefaultOrganizationID, Name: "Acme", Slug: "acme"}
+
+	bus := events.NewBus()
+	events.Subscribe(bus, func(e events.InvitationSent) error {
+		f.tokens[e.Email] = e.Token
+		return nil
+	})
+	opts = append([]InvitationServiceOption{WithSignupMode(mode), WithInvitationEvents(bus)}, opts...)
+	f.invitations = NewInvitationService(newFakeInvitationRepo(), f.groupRepo, f.userRepo, f.orgs, opts...)
+	f.users = NewUserService(f.userRepo, WithInvitations(f.invitations), WithEvents(bus))
+	return f
+}
+
+func signupRequest(email, token string) *models.UserSignupRequest {
+	return &models.UserSignupRequest{Name: "Jane Roe", Email: email, Password: "SecurePass@123", InvitationToken: token}
+}
+
+func TestInvitationSignup(t *testing.T) {
+	f := newInvitationFixture(t, models.SignupInvite)
+	group := &models.Group{OrganizationID: models.DefaultOrganizationID, Name: "Platform"}
+	assert.NoError(t, f.groupRepo.CreateGroup(group))
+
+	assert.ErrorIs(t, f.users.Signup(signupRequest("jane@example.com", "")), ErrInvitationRequired)
+
+	invitation, err := f.invitations.Invite(&models.InvitationRequest{Email: "jane@example.com", GroupID: group.ID, GroupRole: models.GroupRoleOwner}, AdminActor("admin-1"))
+	assert.NoError(t, err)
+	assert.Equal(t, models.InvitationPending, invitation.Status)
+	_, err = f.invitations.Invite(&models.InvitationRequest{Email: "jane@example.com"}, AdminActor("admin-1"))
+	assert.ErrorIs(t, err, ErrInvitationExists)
+
+	token := f.tokens["jane@example.com"]
+	preview, err := f.invitations.Preview(token)
+	assert.NoError(t, err)
+	assert.Equal(t, &models.InvitationPreview{Email: "jane@example.com", Organization: "Acme", Group: "Platform", ExpiresAt: invitation.ExpiresAt}, preview)
+
+	assert.ErrorIs(t, f.users.Signup(signupRequest("john@example.com", token)), ErrInvalidToken)
+	assert.ErrorIs(t, f.users.Signup(signupRequest("jane@example.com", token+"x")), ErrInvalidToken)
+	assert.NoError(t, f.users.Signup(signupRequest("Jane@Example.com", token)))
+
+	user, err := f.userRepo.FindUserByEmail("Jane@Example.com")
+	assert.NoError(t, err)
+	assert.True(t, user.IsVerified)
+	if assert.Len(t, f.userRepo.accepted, 1) && assert.Len(t, f.userRepo.members, 1) {
+		assert.Equal(t, user.ID, f.userRepo.accepted[0].AcceptedUserID)
+		assert.Equal(t, models.GroupMember{GroupID: group.ID, UserID: user.ID, Role: models.GroupRoleOwner, AddedBy: "admin-1"}, f.userRepo.members[0])
+	}
+}
+
+func TestInvitationResendAndRevoke(t *testing.T) {
+	f := newInvitationFixture(t, models.SignupOpen)
+
+	invitation, err := f.invitations.Invite(&models.InvitationRequest{Email: "jane@example.com"}, AdminActor("admin-1"))
+	assert.NoError(t, err)
+	first := f.tokens["jane@example.com"]
+
+	resent, err := f.invitations.Resend(invitation.ID, AdminActor("admin-1"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, resent.SentCount)
+	second := f.tokens["jane@example.com"]
+	assert.NotEqual(t, first, second)
+	_, err = f.invitations.Lookup(first)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, err = f.invitations.Lookup(second)
+	assert.NoError(t, err)
+
+	assert.NoError(t, f.invitations.Revoke(invitation.ID, AdminActor("admin-1")))
+	_, err = f.invitations.Lookup(second)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	assert.ErrorIs(t, f.invitations.Revoke(invitation.ID, AdminActor("admin-1")), ErrInvitationNotPending)
+	_, err = f.invitations.Resend("missing", AdminActor("admin-1"))
+	assert.ErrorIs(t, err, ErrInvitationNotFound)
+
+	revoked, err := f.invitations.ListInvitations(models.InvitationRevoked)
+	assert.NoError(t, err)
+	assert.Len(t, revoked, 1)
+	_, err = f.invitations.ListInvitations("bogus")
+	assert.Error(t, err)
+
+	// Open signup still works without an invitation.
+	assert.NoError(t, f.users.Signup(signupRequest("jane@example.com", "")))
+}
+
+func TestInvitationExpiry(t *testing.T) {
+	f := newInvitationFixture(t, models.SignupOpen, WithInvitationTTL(-time.Minute))
+
+	_, err := f.invitations.Invite(&models.InvitationRequest{Email: "jane@example.com"}, AdminActor("admin-1"))
+	assert.NoError(t, err)
+	assert.ErrorIs(t, f.users.Signup(signupRequest("jane@example.com", f.tokens["jane@example.com"])), ErrTokenExpired)
+}
+
+func TestSignupModes(t *testing.T) {
+	f := newInvitationFixture(t, models.SignupOpen)
+	_, err := f.invitations.Invite(&models.InvitationRequest{Email: "jane@example.com"}, AdminActor("admin-1"))
+	assert.NoError(t, err)
+
+	// The organization's own mode wins over the deployment's.
+	f.orgs.organizations[models.DefaultOrganizationID].SignupMode = models.SignupClosed
+	assert.ErrorIs(t, f.users.Signup(signupRequest("john@example.com", "")), ErrSignupClosed)
+	assert.ErrorIs(t, f.users.Signup(signupRequest("jane@example.com", f.tokens["jane@example.com"])), ErrSignupClosed)
+
+	f.orgs.organizations[models.DefaultOrganizationID].SignupMode = ""
+	assert.NoError(t, f.users.Signup(signupRequest("john@example.com", "")))
+}
+
+func TestGroupOwnerInvites(t *testing.T) {
+	f := newInvitationFixture(t, models.SignupInvite, WithGroupOwnerInvites(true))
+	group := &models.Group{OrganizationID: models.DefaultOrganizationID, Name: "Platform"}
+	assert.NoError(t, f.groupRepo.CreateGroup(group))
+	assert.NoError(t, f.groupRepo.SaveMember(&models.GroupMember{GroupID: group.ID, UserID: "owner-1", Role: models.GroupRoleOwner}))
+	assert.NoError(t, f.groupRepo.SaveMember(&models.GroupMember{GroupID: group.ID, UserID: "member-1", Role: models.GroupRoleMember}))
+	req := &models.InvitationRequest{Email: "jane@example.com"}
+
+	disabled := *f.invitations
+	disabled.ownerInvite = false
+	_, err := disabled.InviteToGroup("owner-1", group.ID, req)
+	assert.ErrorIs(t, err, ErrInsufficientAccess)
+
+	_, err = f.invitations.InviteToGroup("member-1", group.ID, req)
+	assert.ErrorIs(t, err, ErrInsufficientAccess)
+	invitation, err := f.invitations.InviteToGroup("owner-1", group.ID, req)
+	assert.NoError(t, err)
+	assert.Equal(t, group.ID, invitation.GroupID)
+	assert.Equal(t, models.GroupRoleMember, invitation.GroupRole)
+	assert.Equal(t, "owner-1", invitation.InvitedBy)
+	assert.Equal(t, models.ActorUser, invitation.InviterRole)
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"log"
+	"net/smtp"
+
+	"github.com/liju-github/user-management/internal/config"
+)
+
+// Mailer sends plain-text emails.
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// SMTPMailer delivers mail through an SMTP relay using PLAIN auth.
+type SMTPMailer struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+}
+
+// NewMailer returns an SMTPMailer configured from env, or a LogMailer when no
+// SMTP host is configured so local setups don't need a relay.
+func NewMailer(env config.Env) Mailer {
+	if env.SMTPHOST == "" {
+		return LogMailer{}
+	}
+	return &SMTPMailer{
+		host:     env.SMTPHOST,
+		port:     env.SMTPPORT,
+		username: env.SMTPUSER,
+		password: env.SMTPPASSWORD,
+		from:     env.MAILFROM,
+	}
+}
+
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	message := []byte("From: " + m.from + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"\r\n" +
+		body)
+
+	auth := smtp.PlainAuth("", m.username, m.password, m.host)
+	return smtp.SendMail(m.host+":"+m.port, auth, m.from, []string{to}, message)
+}
+
+// LogMailer writes emails to the standard logger instead of sending them.
+type LogMailer struct{}
+
+func (LogMailer) Send(to, subject, body string) error {
+	log.Printf("mail to %s: %s\n%s", to, subject, body)
+	return nil
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/repository"
+)
+
+type INoteService interface {
+	ListNotes(userID string) ([]models.UserNote, error)
+	AddNote(userID, body string, by Actor) (*models.UserNote, error)
+	EditNote(userID, noteID, body string, by Actor) (*models.UserNote, error)
+	NoteRevisions(userID, noteID string) ([]models.UserNoteRevision, error)
+	GetTags(userID string) ([]string, error)
+	AddTags(userID string, tags []string, by Actor) ([]string, error)
+	RemoveTag(userID, tag string) ([]string, error)
+	TagCounts() ([]models.TagCount, error)
+	ForOrganization(organizationID string) INoteService
+}
+
+// NoteService manages the private notes and tags admins keep on users.
+// None of it is shown to users or included in their data exports, so note
+// changes are tracked through revisions rather than the user's audit log.
+type NoteService struct {
+	noteRepo repository.INoteRepository
+	userRepo repository.IUserRepository
+}
+
+func NewNoteService(noteRepo repository.INoteRepository, userRepo repository.IUserRepository) *NoteService {
+	return &NoteService{noteRepo: noteRepo, userRepo: userRepo}
+}
+
+// ForOrganization returns the service as seen by an admin of one
+// organization, who can only reach its users' notes and tags. An empty
+// organizationID returns s.
+func (s *NoteService) ForOrganization(organizationID string) INoteService {
+	if organizationID == "" {
+		return s
+	}
+	return &NoteService{noteRepo: s.noteRepo, userRepo: s.userRepo.ForOrganization(organizationID)}
+}
+
+// ListNotes returns the user's notes, newest first.
+func (s *NoteService) ListNotes(userID string) ([]models.UserNote, error) {
+	if _, err := s.userRepo.FindUserByID(userID); err != nil {
+		return nil, userLookupError(err)
+	}
+	return s.noteRepo.FindNotesByUser(userID)
+}
+
+func (s *NoteService) AddNote(userID, body string, by Actor) (*models.UserNote, error) {
+	if _, err := s.userRepo.FindUserByID(userID); err != nil {
+		return nil, userLookupError(err)
+	}
+
+	note := &models.UserNote{UserID: userID, AuthorID: by.ID, Body: body}
+	if err := s.noteRepo.CreateNote(note); err != nil {
+		return nil, err
+	}
+	return note, nil
+}
+
+// EditNote replaces the note's text, keeping the previous text as a
+// revision.
+func (s *NoteService) EditNote(userID, noteID, body string, by Actor) (*models.UserNote, error) {
+	note, err := s.findNote(userID, noteID)
+	if err != nil {
+		return nil, err
+	}
+	if note.Body == body {
+		return note, nil
+	}
+
+	previous := &models.UserNoteRevision{NoteID: note.ID, AuthorID: note.AuthorID, Body: note.Body, CreatedAt: note.UpdatedAt}
+	if note.EditorID != "" {
+		previous.AuthorID = note.EditorID
+	}
+	note.Body = body
+	note.EditorID = by.ID
+	if err := s.noteRepo.UpdateNote(note, previous); err != nil {
+		return nil, err
+	}
+	return note, nil
+}
+
+// NoteRevisions returns the earlier versions of a note, newest first.
+func (s *NoteService) NoteRevisions(userID, noteID string) ([]models.UserNoteRevision, error) {
+	note, err := s.findNote(userID, noteID)
+	if err != nil {
+		return nil, err
+	}
+	return s.noteRepo.FindNoteRevisions(note.ID)
+}
+
+func (s *NoteService) findNote(userID, noteID string) (*models.UserNote, error) {
+	// The user check keeps notes of other organizations' users out of reach.
+	_, err := s.userRepo.FindUserByID(userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrNoteNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	note, err := s.noteRepo.FindNoteByID(noteID)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && note.UserID != userID) {
+		return nil, ErrNoteNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return note, nil
+}
+
+// GetTags returns the user's tags in alphabetical order.
+func (s *NoteService) GetTags(userID string) ([]string, error) {
+	if _, err := s.userRepo.FindUserByID(userID); err != nil {
+		return nil, userLookupError(err)
+	}
+	return s.noteRepo.FindTagsByUser(userID)
+}
+
+// AddTags puts tags on the user and returns all of the user's tags. Tags
+// are normalized with models.NormalizeTag first.
+func (s *NoteService) AddTags(userID string, tags []string, by Actor) ([]string, error) {
+	userTags := make([]models.UserTag, 0, len(tags))
+	for _, tag := range tags {
+		tag = models.NormalizeTag(tag)
+		if !models.ValidTag(tag) {
+			return nil, models.ValidationErrors{{Field: "tags", Rule: "tag"}}
+		}
+		userTags = append(userTags, models.UserTag{UserID: userID, Tag: tag, AddedBy: by.ID})
+	}
+
+	if _, err := s.userRepo.FindUserByID(userID); err != nil {
+		return nil, userLookupError(err)
+	}
+	if err := s.noteRepo.AddTags(userTags); err != nil {
+		return nil, err
+	}
+	return s.noteRepo.FindTagsByUser(userID)
+}
+
+// RemoveTag takes a tag off the user and returns the tags left.
+func (s *NoteService) RemoveTag(userID, tag string) ([]string, error) {
+	if _, err := s.userRepo.FindUserByID(userID); err != nil {
+		return nil, userLookupError(err)
+	}
+	if err := s.noteRepo.RemoveTag(userID, models.NormalizeTag(tag)); err != nil {
+		return nil, err
+	}
+	return s.noteRepo.FindTagsByUser(userID)
+}
+
+// TagCounts lists the tags in use with how many users carry each.
+func (s *NoteService) TagCounts() ([]models.TagCount, error) {
+	return s.noteRepo.CountTags()
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeNoteRepo struct {
+	notes     map[string]*models.UserNote
+	revisions []models.UserNoteRevision
+	tags      map[string]map[string]bool
+}
+
+func newFakeNoteRepo() *fakeNoteRepo {
+	return &fakeNoteRepo{notes: map[string]*models.UserNote{}, tags: map[string]map[string]bool{}}
+}
+
+func (r *fakeNoteRepo) CreateNote(n *models.UserNote) error {
+	n.ID = generateToken()
+	n.CreatedAt, n.UpdatedAt = time.Now(), time.Now()
+	r.notes[n.ID] = n
+	return nil
+}
+
+func (r *fakeNoteRepo) FindNoteByID(id string) (*models.UserNote, error) {
+	if n, ok := r.notes[id]; ok {
+		copied := *n
+		return &copied, nil
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *fakeNoteRepo) FindNotesByUser(userID string) ([]models.UserNote, error) {
+	var notes []models.UserNote
+	for _, n := range r.notes {
+		if n.UserID == userID {
+			notes = append(notes, *n)
+		}
+	}
+	return notes, nil
+}
+
+func (r *fakeNoteRepo) UpdateNote(n *models.UserNote, previous *models.UserNoteRevision) error {
+	r.revisions = append([]models.UserNoteRevision{*previous}, r.revisions...)
+	n.UpdatedAt = time.Now()
+	copied := *n
+	r.notes[n.ID] = &copied
+	return nil
+}
+
+func (r *fakeNoteRepo) FindNoteRevisions(noteID string) ([]models.UserNoteRevision, error) {
+	var revisions []models.UserNoteRevision
+	for _, rev := range r.revisions {
+		if rev.NoteID == noteID {
+			revisions = append(revisions, rev)
+		}
+	}
+	return revisions, nil
+}
+
+func (r *fakeNoteRepo) FindTagsByUser(userID string) ([]string, error) {
+	var tags []string
+	for tag := range r.tags[userID] {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+func (r *fakeNoteRepo) AddTags(tags []models.UserTag) error {
+	for _, t := range tags {
+		if r.tags[t.UserID] == nil {
+			r.tags[t.UserID] = map[string]bool{}
+		}
+		r.tags[t.UserID][t.Tag] = true
+	}
+	return nil
+}
+
+func (r *fakeNoteRepo) RemoveTag(userID, tag string) error {
+	delete(r.tags[userID], tag)
+	return nil
+}
+
+func (r *fakeNoteRepo) CountTags() ([]models.TagCount, error) {
+	return nil, nil
+}
+
+func TestEditNoteKeepsRevisions(t *testing.T) {
+	notes := newFakeNoteRepo()
+	svc := NewNoteService(notes, newFakeUserRepo(existingUser(t)))
+
+	note, err := svc.AddNote("user-1", "Asked for a refund", AdminActor("admin-1"))
+	assert.NoError(t, err)
+	assert.Equal(t, "admin-1", note.AuthorID)
+
+	_, err = svc.EditNote("user-1", note.ID, "Refund issued", AdminActor("admin-2"))
+	assert.NoError(t, err)
+	edited, err := svc.EditNote("user-1", note.ID, "Refund issued, case closed", AdminActor("admin-3"))
+	assert.NoError(t, err)
+	assert.Equal(t, "admin-1", edited.AuthorID)
+	assert.Equal(t, "admin-3", edited.EditorID)
+
+	revisions, err := svc.NoteRevisions("user-1", note.ID)
+	assert.NoError(t, err)
+	assert.Len(t, revisions, 2)
+	assert.Equal(t, "Refund issued", revisions[0].Body)
+	assert.Equal(t, "admin-2", revisions[0].AuthorID)
+	assert.Equal(t, "Asked for a refund", revisions[1].Body)
+	assert.Equal(t, "admin-1", revisions[1].AuthorID)
+
+	_, err = svc.EditNote("user-2", note.ID, "Wrong user", AdminActor("admin-1"))
+	assert.ErrorIs(t, err, ErrNoteNotFound)
+	_, err = svc.AddNote("missing", "Nobody", AdminActor("admin-1"))
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+func TestAddTagsNormalizes(t *testing.T) {
+	notes := newFakeNoteRepo()
+	svc := NewNoteService(notes, newFakeUserRepo(existingUser(t)))
+
+	tags, err := svc.AddTags("user-1", []string{" VIP", "fraud-review", "vip"}, AdminActor("admin-1"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"fraud-review", "vip"}, tags)
+
+	_, err = svc.AddTags("user-1", []string{"not a tag"}, AdminActor("admin-1"))
+	assert.Equal(t, "tags", err.(models.ValidationErrors)[0].Field)
+
+	tags, err = svc.RemoveTag("user-1", "Fraud-Review")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"vip"}, tags)
+}
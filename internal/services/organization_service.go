@@ -0,0 +1,116 @@
+package services
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/repository"
+)
+
+type IOrganizationService interface {
+	CreateOrganization(req *models.OrganizationRequest) (*models.Organization, error)
+	ListOrganizations() ([]models.Organization, error)
+	GetOrganization(organizationID string) (*models.Organization, error)
+	UpdateOrganization(organizationID string, req *models.OrganizationUpdateRequest) (*models.Organization, error)
+	Resolve(slug string) (*models.Organization, error)
+}
+
+// OrganizationService manages the tenants this deployment serves. Only
+// super admins reach it.
+type OrganizationService struct {
+	organizationRepo repository.IOrganizationRepository
+}
+
+func NewOrganizationService(organizationRepo repository.IOrganizationRepository) *OrganizationService {
+	return &OrganizationService{organizationRepo: organizationRepo}
+}
+
+func (s *OrganizationService) CreateOrganization(req *models.OrganizationRequest) (*models.Organization, error) {
+	slug, err := s.checkSlug(req.Slug, "")
+	if err != nil {
+		return nil, err
+	}
+
+	organization := &models.Organization{Name: req.Name, Slug: slug, SignupMode: req.SignupMode}
+	if err := s.organizationRepo.CreateOrganization(organization); err != nil {
+		return nil, err
+	}
+	return organization, nil
+}
+
+func (s *OrganizationService) ListOrganizations() ([]models.Organization, error) {
+	organizations, err := s.organizationRepo.FindOrganizations()
+	if err != nil {
+		return nil, err
+	}
+	if organizations == nil {
+		organizations = []models.Organization{}
+	}
+	return organizations, nil
+}
+
+func (s *OrganizationService) GetOrganization(organizationID string) (*models.Organization, error) {
+	organization, err := s.organizationRepo.FindOrganizationByID(organizationID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrOrganizationNotFound
+	}
+	return organization, err
+}
+
+// UpdateOrganization renames the organization or changes its slug. Clients
+// that name it by the old slug stop reaching it.
+func (s *OrganizationService) UpdateOrganization(organizationID string, req *models.OrganizationUpdateRequest) (*models.Organization, error) {
+	organization, err := s.GetOrganization(organizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Slug != nil {
+		slug, err := s.checkSlug(*req.Slug, organization.ID)
+		if err != nil {
+			return nil, err
+		}
+		organization.Slug = slug
+	}
+	if req.Name != nil {
+		organization.Name = *req.Name
+	}
+	if req.SignupMode != nil {
+		organization.SignupMode = *req.SignupMode
+		if organization.SignupMode == "default" {
+			organization.SignupMode = ""
+		}
+	}
+	if err := s.organizationRepo.UpdateOrganization(organization); err != nil {
+		return nil, err
+	}
+	return organization, nil
+}
+
+// Resolve finds the organization a request names by slug, or by ID.
+func (s *OrganizationService) Resolve(slug string) (*models.Organization, error) {
+	organization, err := s.organizationRepo.FindOrganizationBySlug(strings.ToLower(slug))
+	if errors.Is(err, repository.ErrNotFound) {
+		return s.GetOrganization(slug)
+	}
+	return organization, err
+}
+
+// checkSlug normalizes slug and makes sure no organization other than
+// organizationID uses it.
+func (s *OrganizationService) checkSlug(slug, organizationID string) (string, error) {
+	slug = strings.ToLower(strings.TrimSpace(slug))
+	if !models.ValidSlug(slug) {
+		return "", models.ValidationErrors{{Field: "slug", Rule: "slug"}}
+	}
+
+	existing, err := s.organizationRepo.FindOrganizationBySlug(slug)
+	if err == nil && existing.ID != organizationID {
+		return "", ErrOrganizationExists
+	}
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return "", err
+	}
+	return slug, nil
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeOrganizationRepo struct {
+	organizations map[string]*models.Organization
+}
+
+func newFakeOrganizationRepo() *fakeOrganizationRepo {
+	return &fakeOrganizationRepo{organizations: map[string]*models.Organization{}}
+}
+
+func (r *fakeOrganizationRepo) CreateOrganization(o *models.Organization) error {
+	o.ID = generateToken()
+	r.organizations[o.ID] = o
+	return nil
+}
+
+func (r *fakeOrganizationRepo) UpdateOrganization(o *models.Organization) error {
+	r.organizations[o.ID] = o
+	return nil
+}
+
+func (r *fakeOrganizationRepo) FindOrganizationByID(id string) (*models.Organization, error) {
+	if o, ok := r.organizations[id]; ok {
+		copied := *o
+		return &copied, nil
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *fakeOrganizationRepo) FindOrganizationBySlug(slug string) (*models.Organization, error) {
+	for _, o := range r.organizations {
+		if o.Slug == slug {
+			copied := *o
+			return &copied, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *fakeOrganizationRepo) FindOrganizations() ([]models.Organization, error) {
+	var organizations []models.Organization
+	for _, o := range r.organizations {
+		organizations = append(organizations, *o)
+	}
+	return organizations, nil
+}
+
+func TestOrganizationSlugs(t *testing.T) {
+	svc := NewOrganizationService(newFakeOrganizationRepo())
+
+	acme, err := svc.CreateOrganization(&models.OrganizationRequest{Name: "Acme", Slug: " Acme "})
+	assert.NoError(t, err)
+	assert.Equal(t, "acme", acme.Slug)
+
+	_, err = svc.CreateOrganization(&models.OrganizationRequest{Name: "Acme again", Slug: "acme"})
+	assert.ErrorIs(t, err, ErrOrganizationExists)
+	_, err = svc.CreateOrganization(&models.OrganizationRequest{Name: "Bad", Slug: "-bad-"})
+	assert.Equal(t, models.ValidationErrors{{Field: "slug", Rule: "slug"}}, err)
+
+	globex, err := svc.CreateOrganization(&models.OrganizationRequest{Name: "Globex", Slug: "globex"})
+	assert.NoError(t, err)
+	slug := "acme"
+	_, err = svc.UpdateOrganization(globex.ID, &models.OrganizationUpdateRequest{Slug: &slug})
+	assert.ErrorIs(t, err, ErrOrganizationExists)
+
+	resolved, err := svc.Resolve("ACME")
+	assert.NoError(t, err)
+	assert.Equal(t, acme.ID, resolved.ID)
+	resolved, err = svc.Resolve(globex.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "globex", resolved.Slug)
+	_, err = svc.Resolve("initech")
+	assert.ErrorIs(t, err, ErrOrganizationNotFound)
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/liju-github/user-management/internal/events"
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/passwords"
+	"github.com/liju-github/user-management/internal/repository"
+)
+
+// ChangePassword replaces the password of a signed-in user after checking the
+// current one.
+func (s *UserService) ChangePassword(userID, currentPassword, newPassword string) error {
+	user, err := s.userRepo.FindUserByID(userID)
+	if err != nil {
+		return userLookupError(err)
+	}
+
+	ok, _, err := s.passwords.Verify(currentPassword, user.PasswordHash)
+	if err != nil || !ok {
+		return ErrInvalidCredentials
+	}
+
+	if err := s.checkPassword("new_password", newPassword, user.Name, user.Email); err != nil {
+		return err
+	}
+
+	if err := s.setPassword(user, "new_password", newPassword); err != nil {
+		return err
+	}
+
+	s.audit.Record(user.ID, UserActor(user.ID), models.AuditPasswordChanged, nil)
+	return nil
+}
+
+// checkPassword applies the password policy to a new password and reports
+// violations against field.
+func (s *UserService) checkPassword(field, password, name, email string) error {
+	violations := s.policy.Check(password, name, email)
+	if len(violations) == 0 {
+		return nil
+	}
+
+	fieldErrors := make(models.ValidationErrors, len(violations))
+	for i, v := range violations {
+		fieldErrors[i] = models.FieldError{Field: field, Rule: v.Rule, Param: v.Param}
+	}
+	return fieldErrors
+}
+
+// setPassword rejects reuse of the current or recent passwords, then stores
+// the new hash and moves the old one into the password history.
+func (s *UserService) setPassword(user *models.User, field, newPassword string) error {
+	if err := s.checkPasswordReuse(user, field, newPassword); err != nil {
+		return err
+	}
+
+	hashedPassword, err := s.hashPassword(field, newPassword)
+	if err != nil {
+		return err
+	}
+
+	previousHash := user.PasswordHash
+	user.PasswordHash = hashedPassword
+	user.MustChangePassword = false
+
+	return s.userRepo.UpdatePassword(user, previousHash, s.historyKept())
+}
+
+// hashPassword hashes with the preferred algorithm, reporting passwords bcrypt
+// can't hash as a validation error on field.
+func (s *UserService) hashPassword(field, password string) (string, error) {
+	hashedPassword, err := s.passwords.Hash(password)
+	if errors.Is(err, passwords.ErrPasswordTooLong) {
+		return "", models.ValidationErrors{{Field: field, Rule: "max", Param: strconv.Itoa(passwords.MaxBcryptPasswordLength)}}
+	}
+	return hashedPassword, err
+}
+
+func (s *UserService) checkPasswordReuse(user *models.User, field, newPassword string) error {
+	if s.policy.HistorySize <= 0 {
+		return nil
+	}
+
+	hashes := []string{user.PasswordHash}
+	if kept := s.historyKept(); kept > 0 {
+		history, err := s.userRepo.FindPasswordHistory(user.ID, kept)
+		if err != nil {
+			return err
+		}
+		for _, h := range history {
+			hashes = append(hashes, h.PasswordHash)
+		}
+	}
+
+	for _, hash := range hashes {
+		if hash == "" {
+			continue
+		}
+		if ok, _, _ := s.passwords.Verify(newPassword, hash); ok {
+			return models.ValidationErrors{{Field: field, Rule: "reused", Param: strconv.Itoa(s.policy.HistorySize)}}
+		}
+	}
+	return nil
+}
+
+// historyKept is how many previous passwords are kept besides the current
+// one, which counts towards the policy's HistorySize.
+func (s *UserService) historyKept() int {
+	return s.policy.HistorySize - 1
+}
+
+// createPasswordReset stores a new reset token for the user that is valid
+// for ttl.
+func (s *UserService) createPasswordReset(user *models.User, ttl time.Duration) (string, error) {
+	passwordReset := newPasswordReset(user, ttl)
+	if err := s.userRepo.CreatePasswordReset(passwordReset); err != nil {
+		return "", err
+	}
+	return passwordReset.ResetToken, nil
+}
+
+func newPasswordReset(user *models.User, ttl time.Duration) *models.PasswordReset {
+	return &models.PasswordReset{
+		UserID:     user.ID,
+		ResetToken: generateToken(),
+		Expiry:     time.Now().Add(ttl).Unix(),
+	}
+}
+
+// sendPasswordReset stores a reset token valid for ttl, after running
+// write if it is set, and publishes the event that emails it to the user.
+func (s *UserService) sendPasswordReset(user *models.User, reason string, by Actor, ttl time.Duration, write func(repository.IUserRepository) error) error {
+	passwordReset := newPasswordReset(user, ttl)
+	return publishAfter(s.events, s.userRepo, func(repo repository.IUserRepository) error {
+		if write != nil {
+			if err := write(repo); err != nil {
+				return err
+			}
+		}
+		return repo.CreatePasswordReset(passwordReset)
+	}, events.PasswordResetRequested{
+		User:   models.NewUserSnapshot(user),
+		Actor:  by,
+		Reason: reason,
+		Token:  passwordReset.ResetToken,
+	})
+}
+
+// ForcePasswordReset invalidates the user's password and emails them a reset
+// link, for accounts whose credentials are suspected to be compromised.
+func (s *UserService) ForcePasswordReset(userID string, by Actor) error {
+	user, err := s.userRepo.FindUserByID(userID)
+	if err != nil {
+		return userLookupError(err)
+	}
+
+	// Replace the hash with one of a random secret nobody knows, so the old
+	// password stops working straight away.
+	unusable, err := s.passwords.Hash(generateToken())
+	if err != nil {
+		return err
+	}
+	user.PasswordHash = unusable
+	return s.sendPasswordReset(user, events.ResetForced, by, 24*time.Hour, func(repo repository.IUserRepository) error {
+		return repo.UpdateUser(user)
+	})
+}
+
+// SendPasswordResetLink emails the user a reset link on an admin's behalf.
+// Unlike ForcePasswordReset the current password keeps working.
+func (s *UserService) SendPasswordResetLink(userID string, by Actor) error {
+	user, err := s.userRepo.FindUserByID(userID)
+	if err != nil {
+		return userLookupError(err)
+	}
+
+	return s.sendPasswordReset(user, events.ResetSentByAdmin, by, time.Hour, nil)
+}
+
+// RequirePasswordChange makes the user choose a new password the next time
+// they sign in.
+func (s *UserService) RequirePasswordChange(userID string, by Actor) error {
+	user, err := s.userRepo.FindUserByID(userID)
+	if err != nil {
+		return userLookupError(err)
+	}
+
+	user.MustChangePassword = true
+	if err := s.userRepo.UpdateUser(user); err != nil {
+		return err
+	}
+	s.audit.Record(user.ID, by, models.AuditPasswordChangeRequired, nil)
+	return nil
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/url"
+	"path"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/liju-github/user-management/internal/media"
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/storage"
+)
+
+// UploadProfilePicture stores a new profile picture for the user and returns
+// its public URL. Only JPEG, PNG and WebP are accepted, detected from the
+// bytes themselves, and metadata such as EXIF GPS tags is stripped before
+// the image is stored; a JPEG's EXIF orientation is applied to its pixels
+// first. Square JPEG variants in each of media.AvatarSizes are
+// stored next to the original. The previous picture and its variants are
+// deleted once the new one is saved.
+func (s *UserService) UploadProfilePicture(userID string, image []byte) (string, error) {
+	if s.storage == nil {
+		return "", errors.New("profile picture storage is not configured")
+	}
+	if int64(len(image)) > s.maxImageSize {
+		return "", ErrFileTooLarge
+	}
+
+	contentType, err := media.Sniff(image)
+	if err != nil {
+		return "", ErrUnsupportedMediaType
+	}
+	orientation := 1
+	if contentType == media.TypeJPEG {
+		orientation = media.JPEGOrientation(image)
+	}
+	cleaned, err := media.StripMetadata(image, contentType)
+	if err != nil {
+		return "", ErrUnsupportedMediaType
+	}
+	decoded, err := media.Decode(cleaned, contentType)
+	if err != nil {
+		return "", ErrUnsupportedMediaType
+	}
+	if orientation != 1 {
+		// Stripping dropped the orientation tag, so the pixels are turned
+		// upright and the original re-encoded to match.
+		decoded = media.Orient(decoded, orientation)
+		if cleaned, err = media.EncodeJPEG(decoded); err != nil {
+			return "", err
+		}
+	}
+
+	user, err := s.userRepo.FindUserByID(userID)
+	if err != nil {
+		return "", userLookupError(err)
+	}
+
+	dir := "avatars/" + user.ID + "/" + uuid.New().String()
+	key := dir + "/original" + media.Extensions[contentType]
+	if err := s.putObject(key, cleaned, contentType); err != nil {
+		return "", err
+	}
+	for _, size := range media.AvatarSizes {
+		variant, err := media.AvatarVariant(decoded, size)
+		if err == nil {
+			err = s.putObject(variantKey(key, size), variant, media.TypeJPEG)
+		}
+		if err != nil {
+			s.deleteAvatar(key)
+			return "", err
+		}
+	}
+
+	previousKey := user.ImageKey
+	user.ImageKey = key
+	user.ImageURL = s.storage.URL(key)
+	if err := s.userRepo.UpdateUser(user); err != nil {
+		s.deleteAvatar(key)
+		return "", err
+	}
+
+	if previousKey != "" {
+		s.deleteAvatar(previousKey)
+	}
+
+	return user.ImageURL, nil
+}
+
+// AvatarURLs returns the URL of each avatar variant keyed by its size in
+// pixels. Users without an upload get generated initials avatars instead.
+func (s *UserService) AvatarURLs(user *models.User) map[string]string {
+	urls := make(map[string]string, len(media.AvatarSizes))
+	for _, size := range media.AvatarSizes {
+		if user.ImageKey != "" && s.storage != nil {
+			urls[strconv.Itoa(size)] = s.storage.URL(variantKey(user.ImageKey, size))
+		} else {
+			urls[strconv.Itoa(size)] = s.baseURL + "/api/avatars/" + strconv.Itoa(size) + "/" +
+				url.PathEscape(media.Initials(user.Name))
+		}
+	}
+	return urls
+}
+
+// variantKey returns the key of the size×size variant stored alongside the
+// original at key.
+func variantKey(key string, size int) string {
+	return path.Dir(key) + "/" + strconv.Itoa(size) + ".jpg"
+}
+
+func (s *UserService) putObject(key string, data []byte, contentType string) error {
+	return s.storage.Put(context.Background(), key, bytes.NewReader(data), int64(len(data)), contentType)
+}
+
+func (s *UserService) deleteAvatar(key string) {
+	deleteAvatar(s.storage, key)
+}
+
+// deleteAvatar removes an original and all of its variants. Failures are
+// only logged: a leftover object is harmless, while failing the request
+// after the user has been updated would not be.
+func deleteAvatar(store storage.Storage, key string) {
+	keys := []string{key}
+	for _, size := range media.AvatarSizes {
+		keys = append(keys, variantKey(key, size))
+	}
+	for _, k := range keys {
+		if err := store.Delete(context.Background(), k); err != nil {
+			log.Println("Failed to delete stored object", k+":", err)
+		}
+	}
+}
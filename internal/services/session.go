@@ -0,0 +1,74 @@
+package services
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/liju-github/user-management/internal/models"
+)
+
+// StartSession records a new sign-in for the user that lasts for ttl,
+// normally the lifetime of the refresh token issued with it.
+func (s *UserService) StartSession(userID, userAgent, ipAddress string, ttl time.Duration) (*models.Session, error) {
+	now := time.Now()
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	session := &models.Session{
+		UserID:     userID,
+		UserAgent:  userAgent,
+		IPAddress:  ipAddress,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(ttl),
+	}
+	if err := s.userRepo.CreateSession(session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// securityHistoryLimit is how many sessions and events GetSecurityHistory
+// returns.
+const securityHistoryLimit = 50
+
+// GetSecurityHistory returns the user's recent sessions, with impersonation
+// sessions flagged, and the security events recorded on their account.
+func (s *UserService) GetSecurityHistory(userID string) (*models.SecurityHistoryResponse, error) {
+	sessions, err := s.userRepo.FindSessionsByUser(userID, securityHistoryLimit)
+	if err != nil {
+		return nil, err
+	}
+	events, err := s.audit.RecentEventsForUser(userID, securityHistoryLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	history := &models.SecurityHistoryResponse{
+		Sessions: make([]models.SessionResponse, len(sessions)),
+		Events:   events,
+	}
+	if history.Events == nil {
+		history.Events = []models.AuditEvent{}
+	}
+	for i := range sessions {
+		history.Sessions[i] = models.NewSessionResponse(&sessions[i])
+	}
+	return history, nil
+}
+
+// RevokeSessions signs the user out everywhere by revoking all their
+// sessions. It returns how many were still active.
+func (s *UserService) RevokeSessions(userID string, by Actor) (int, error) {
+	user, err := s.userRepo.FindUserByID(userID)
+	if err != nil {
+		return 0, userLookupError(err)
+	}
+
+	revoked, err := s.userRepo.RevokeSessions(user.ID, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	s.audit.Record(user.ID, by, models.AuditSessionsRevoked, map[string]string{"count": strconv.FormatInt(revoked, 10)})
+	return int(revoked), nil
+}
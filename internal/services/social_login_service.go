@@ -0,0 +1,203 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/liju-github/user-management/internal/events"
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/oidc"
+	"github.com/liju-github/user-management/internal/repository"
+)
+
+type ISocialLoginService interface {
+	Providers() []string
+	Begin(provider string) (string, error)
+	Complete(provider, state, code string) (*models.User, error)
+	ForOrganization(organizationID string) ISocialLoginService
+}
+
+// SocialLoginService signs users in with OpenID Connect providers. A user
+// is found by an identity linked before, or by the verified email the
+// provider vouches for, in which case the identity is linked to them;
+// otherwise a new user is signed up.
+type SocialLoginService struct {
+	providers    map[string]*oidc.Provider
+	identityRepo repository.IIdentityRepository
+	users        *UserService
+	loginTTL     time.Duration
+
+	// organizationID limits the service to one tenant; see ForOrganization.
+	organizationID string
+}
+
+// SocialLoginServiceOption configures optional SocialLoginService
+// behaviour.
+type SocialLoginServiceOption func(*SocialLoginService)
+
+// WithSocialLoginTTL sets how long a user has to sign in at the provider.
+func WithSocialLoginTTL(ttl time.Duration) SocialLoginServiceOption {
+	return func(s *SocialLoginService) { s.loginTTL = ttl }
+}
+
+// NewSocialLoginService returns a service for providers. New users are
+// signed up through users, which applies the signup mode, and events are
+// published on its bus.
+func NewSocialLoginService(providers []*oidc.Provider, identityRepo repository.IIdentityRepository, users *UserService, opts ...SocialLoginServiceOption) *SocialLoginService {
+	s := &SocialLoginService{
+		providers:    map[string]*oidc.Provider{},
+		identityRepo: identityRepo,
+		users:        users,
+		loginTTL:     10 * time.Minute,
+	}
+	for _, provider := range providers {
+		s.providers[provider.Name()] = provider
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// ForOrganization returns the service as seen by one organization: sign-ins
+// it begins are for that organization. An empty organizationID returns s,
+// which sees every organization.
+func (s *SocialLoginService) ForOrganization(organizationID string) ISocialLoginService {
+	return s.inOrganization(organizationID)
+}
+
+func (s *SocialLoginService) inOrganization(organizationID string) *SocialLoginService {
+	if organizationID == "" {
+		return s
+	}
+	scoped := *s
+	scoped.organizationID = organizationID
+	scoped.identityRepo = s.identityRepo.ForOrganization(organizationID)
+	scoped.users = s.users.InOrganization(organizationID)
+	return &scoped
+}
+
+// Providers returns the names of the providers users can sign in with.
+func (s *SocialLoginService) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Begin starts signing in with provider and returns the URL to send the
+// user to. The state, nonce and PKCE verifier are kept until Complete.
+func (s *SocialLoginService) Begin(provider string) (string, error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return "", ErrProviderNotFound
+	}
+	organizationID := s.organizationID
+	if organizationID == "" {
+		organizationID = models.DefaultOrganizationID
+	}
+
+	login := &models.SocialLogin{
+		State:          oidc.NewVerifier(),
+		OrganizationID: organizationID,
+		Provider:       provider,
+		Nonce:          oidc.NewVerifier(),
+		CodeVerifier:   oidc.NewVerifier(),
+		ExpiresAt:      time.Now().Add(s.loginTTL),
+	}
+	authURL, err := p.AuthCodeURL(context.Background(), login.State, login.Nonce, login.CodeVerifier)
+	if err != nil {
+		log.Printf("Sign-in with %s failed: %v", provider, err)
+		return "", ErrSocialLoginFailed
+	}
+	if err := s.identityRepo.CreateSocialLogin(login); err != nil {
+		return "", err
+	}
+	return authURL, nil
+}
+
+// Complete finishes the sign-in begun with state, redeeming the code the
+// provider sent back, and returns the signed-in user. The organization is
+// the one the sign-in was begun for.
+func (s *SocialLoginService) Complete(provider, state, code string) (*models.User, error) {
+	p, ok := s.providers[provider]
+	if !ok {
+		return nil, ErrProviderNotFound
+	}
+	login, err := s.identityRepo.TakeSocialLogin(state)
+	if err != nil {
+		return nil, tokenLookupError(err)
+	}
+	if login.Provider != provider {
+		return nil, ErrInvalidToken
+	}
+	if time.Now().After(login.ExpiresAt) {
+		return nil, ErrTokenExpired
+	}
+
+	claims, err := p.Exchange(context.Background(), code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		log.Printf("Sign-in with %s failed: %v", provider, err)
+		return nil, ErrSocialLoginFailed
+	}
+	user, err := s.inOrganization(login.OrganizationID).findOrLink(provider, claims)
+	if err != nil {
+		return nil, err
+	}
+	return user, s.users.InOrganization(login.OrganizationID).admit(user)
+}
+
+// findOrLink returns the user the identity belongs to, linking it to the
+// user with its email or signing up a new user the first time it is seen.
+// Only emails the provider has verified are trusted.
+func (s *SocialLoginService) findOrLink(provider string, claims *oidc.Claims) (*models.User, error) {
+	identity, err := s.identityRepo.FindIdentity(provider, claims.Subject)
+	if err == nil {
+		user, err := s.users.userRepo.FindUserByID(identity.UserID)
+		if err != nil {
+			return nil, userLookupError(err)
+		}
+		return user, nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+	identity = &models.UserIdentity{OrganizationID: s.organizationID, Provider: provider, Subject: claims.Subject, Email: claims.Email}
+
+	user, err := s.users.userRepo.FindUserByEmail(claims.Email)
+	if errors.Is(err, repository.ErrNotFound) {
+		return s.users.signupWithIdentity(identity, claims.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	identity.UserID = user.ID
+	err = publishAfter(s.users.events, s.users.userRepo, func(repo repository.IUserRepository) error {
+		return repo.CreateIdentity(identity)
+	}, events.IdentityLinked{User: models.NewUserSnapshot(user), Provider: provider, Email: claims.Email})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// IdentitiesForUser returns the provider accounts linked to the user, for
+// their data export.
+func (s *SocialLoginService) IdentitiesForUser(userID string) ([]models.UserIdentity, error) {
+	return s.identityRepo.FindIdentitiesByUser(userID)
+}
+
+// DeleteExpiredLogins removes sign-ins that were begun but never completed.
+func (s *SocialLoginService) DeleteExpiredLogins(ctx context.Context) (int64, error) {
+	return s.identityRepo.DeleteExpiredSocialLogins(time.Now())
+}
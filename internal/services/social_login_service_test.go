@@ -0,0 +1,177 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/liju-github/user-management/internal/events"
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/oidc"
+	"github.com/liju-github/user-management/internal/oidc/oidctest"
+	"github.com/liju-github/user-management/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeIdentityRepo keeps sign-ins in progress; identities are created
+// through the user repository, so it reads them from there.
+type fakeIdentityRepo struct {
+	logins map[string]models.SocialLogin
+	users  *fakeUserRepo
+}
+
+func (r *fakeIdentityRepo) ForOrganization(string) repository.IIdentityRepository {
+	return r
+}
+
+func (r *fakeIdentityRepo) CreateSocialLogin(login *models.SocialLogin) error {
+	r.logins[login.State] = *login
+	return nil
+}
+
+func (r *fakeIdentityRepo) TakeSocialLogin(state string) (*models.SocialLogin, error) {
+	login, ok := r.logins[state]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	delete(r.logins, state)
+	return &login, nil
+}
+
+func (r *fakeIdentityRepo) DeleteExpiredSocialLogins(before time.Time) (int64, error) {
+	var deleted int64
+	for state, login := range r.logins {
+		if login.ExpiresAt.Before(before) {
+			delete(r.logins, state)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (r *fakeIdentityRepo) FindIdentity(provider, subject string) (*models.UserIdentity, error) {
+	for _, identity := range r.users.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return &identity, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *fakeIdentityRepo) FindIdentitiesByUser(userID string) ([]models.UserIdentity, error) {
+	var identities []models.UserIdentity
+	for _, identity := range r.users.identities {
+		if identity.UserID == userID {
+			identities = append(identities, identity)
+		}
+	}
+	return identities, nil
+}
+
+func TestSocialLoginEndToEnd(t *testing.T) {
+	idp := oidctest.NewProvider("client-1", "secret-1")
+	defer idp.Close()
+
+	existing := existingUser(t)
+	existing.OrganizationID = models.DefaultOrganizationID
+	userRepo := newFakeUserRepo(existing)
+	bus := events.NewBus()
+	var linked []events.IdentityLinked
+	events.Subscribe(bus, func(e events.IdentityLinked) error {
+		linked = append(linked, e)
+		return nil
+	})
+	users := NewUserService(userRepo, WithEvents(bus))
+	provider := oidc.NewProvider(oidc.Config{
+		Name:         "corp",
+		Issuer:       idp.Issuer(),
+		ClientID:     "client-1",
+		ClientSecret: "secret-1",
+		Scopes:       []string{"email", "profile"},
+		RedirectURL:  "https://app.example.com/api/auth/oidc/corp/callback",
+	})
+	svc := NewSocialLoginService([]*oidc.Provider{provider}, &fakeIdentityRepo{logins: map[string]models.SocialLogin{}, users: userRepo}, users)
+	assert.Equal(t, []string{"corp"}, svc.Providers())
+
+	signIn := func(user oidctest.User) (*models.User, error) {
+		t.Helper()
+		idp.SignIn(user)
+		authURL, err := svc.Begin("corp")
+		assert.NoError(t, err)
+		back, err := idp.Authorize(authURL)
+		assert.NoError(t, err)
+		return svc.Complete("corp", back.Query().Get("state"), back.Query().Get("code"))
+	}
+
+	// A new verified email signs up a verified user.
+	jane, err := signIn(oidctest.User{Subject: "sub-jane", Email: "jane@example.com", EmailVerified: true, Name: "Jane Roe"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Jane Roe", jane.Name)
+	assert.True(t, jane.IsVerified)
+	assert.Equal(t, models.DefaultOrganizationID, jane.OrganizationID)
+
+	// The linked identity finds her again, even with a new email.
+	again, err := signIn(oidctest.User{Subject: "sub-jane", Email: "jane.roe@example.com", EmailVerified: true})
+	assert.NoError(t, err)
+	assert.Equal(t, jane.ID, again.ID)
+
+	// An existing account is linked by verified email only.
+	_, err = signIn(oidctest.User{Subject: "sub-john", Email: "john@example.com"})
+	assert.ErrorIs(t, err, ErrEmailNotVerified)
+	john, err := signIn(oidctest.User{Subject: "sub-john", Email: "john@example.com", EmailVerified: true})
+	assert.NoError(t, err)
+	assert.Equal(t, existing.ID, john.ID)
+
+	assert.Len(t, userRepo.identities, 2)
+	if assert.Len(t, linked, 2) {
+		assert.True(t, linked[0].Signup)
+		assert.False(t, linked[1].Signup)
+		assert.Equal(t, existing.ID, linked[1].User.ID)
+	}
+
+	// A state can only be used once, and only with its provider.
+	idp.SignIn(oidctest.User{Subject: "sub-jane", Email: "jane@example.com", EmailVerified: true})
+	authURL, err := svc.Begin("corp")
+	assert.NoError(t, err)
+	back, err := idp.Authorize(authURL)
+	assert.NoError(t, err)
+	state, code := back.Query().Get("state"), back.Query().Get("code")
+	_, err = svc.Complete("other", state, code)
+	assert.ErrorIs(t, err, ErrProviderNotFound)
+	_, err = svc.Complete("corp", state, "forged-code")
+	assert.ErrorIs(t, err, ErrSocialLoginFailed)
+	_, err = svc.Complete("corp", state, code)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	_, err = svc.Begin("other")
+	assert.ErrorIs(t, err, ErrProviderNotFound)
+}
+
+func TestSocialSignupFollowsSignupMode(t *testing.T) {
+	idp := oidctest.NewProvider("client-1", "secret-1")
+	defer idp.Close()
+
+	f := newInvitationFixture(t, models.SignupInvite)
+	provider := oidc.NewProvider(oidc.Config{Name: "corp", Issuer: idp.Issuer(), ClientID: "client-1", ClientSecret: "secret-1", RedirectURL: "https://app.example.com/callback"})
+	svc := NewSocialLoginService([]*oidc.Provider{provider}, &fakeIdentityRepo{logins: map[string]models.SocialLogin{}, users: f.userRepo}, f.users)
+
+	signIn := func(email string) (*models.User, error) {
+		t.Helper()
+		idp.SignIn(oidctest.User{Subject: "sub-" + email, Email: email, EmailVerified: true})
+		authURL, err := svc.Begin("corp")
+		assert.NoError(t, err)
+		back, err := idp.Authorize(authURL)
+		assert.NoError(t, err)
+		return svc.Complete("corp", back.Query().Get("state"), back.Query().Get("code"))
+	}
+
+	_, err := signIn("jane@example.com")
+	assert.ErrorIs(t, err, ErrInvitationRequired)
+
+	_, err = f.invitations.Invite(&models.InvitationRequest{Email: "jane@example.com"}, AdminActor("admin-1"))
+	assert.NoError(t, err)
+	jane, err := signIn("jane@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "jane", jane.Name)
+	if assert.Len(t, f.userRepo.accepted, 1) {
+		assert.Equal(t, jane.ID, f.userRepo.accepted[0].AcceptedUserID)
+	}
+}
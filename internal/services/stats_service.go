@@ -0,0 +1,210 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/repository"
+)
+
+const (
+	statsDateLayout = "2006-01-02"
+	// maxStatsDays caps the range of the dashboard time series.
+	maxStatsDays = 731
+)
+
+// ageGroups lists the age groups in the order the dashboard shows them.
+var ageGroups = []string{"under_18", "18-24", "25-34", "35-44", "45-54", "55-64", "65+", "unknown"}
+
+type IStatsService interface {
+	GetStats(query *models.StatsQuery) (*models.AdminStatsResponse, error)
+}
+
+// StatsService serves the admin dashboard aggregates. Results are cached
+// for a short while so dashboard refreshes don't rerun the queries.
+type StatsService struct {
+	statsRepo repository.IStatsRepository
+	cacheTTL  time.Duration
+	now       func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedStats
+}
+
+type cachedStats struct {
+	stats   *models.AdminStatsResponse
+	expires time.Time
+}
+
+// StatsServiceOption configures optional StatsService behaviour.
+type StatsServiceOption func(*StatsService)
+
+// WithStatsCacheTTL sets how long computed stats are reused. Zero disables
+// caching.
+func WithStatsCacheTTL(ttl time.Duration) StatsServiceOption {
+	return func(s *StatsService) { s.cacheTTL = ttl }
+}
+
+func NewStatsService(statsRepo repository.IStatsRepository, opts ...StatsServiceOption) *StatsService {
+	s := &StatsService{
+		statsRepo: statsRepo,
+		cacheTTL:  time.Minute,
+		now:       time.Now,
+		cache:     make(map[string]cachedStats),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// GetStats returns the dashboard stats for query. A missing interval means
+// daily; a missing range ends today and covers 30 days, 12 weeks or 12
+// months depending on the interval.
+func (s *StatsService) GetStats(query *models.StatsQuery) (*models.AdminStatsResponse, error) {
+	q, err := s.normalizeStatsQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	key := fmt.Sprintf("%s|%s|%s", q.Interval, q.From.Format(statsDateLayout), q.To.Format(statsDateLayout))
+	now := s.now()
+	s.mu.Lock()
+	for k, entry := range s.cache {
+		if !now.Before(entry.expires) {
+			delete(s.cache, k)
+		}
+	}
+	entry, ok := s.cache[key]
+	s.mu.Unlock()
+	if ok {
+		return entry.stats, nil
+	}
+
+	stats, err := s.computeStats(q, now)
+	if err != nil {
+		return nil, err
+	}
+	if s.cacheTTL > 0 {
+		s.mu.Lock()
+		s.cache[key] = cachedStats{stats: stats, expires: now.Add(s.cacheTTL)}
+		s.mu.Unlock()
+	}
+	return stats, nil
+}
+
+func (s *StatsService) normalizeStatsQuery(query *models.StatsQuery) (models.StatsQuery, error) {
+	q := *query
+	if q.Interval == "" {
+		q.Interval = models.StatsDay
+	}
+	if q.Interval != models.StatsDay && q.Interval != models.StatsWeek && q.Interval != models.StatsMonth {
+		return q, models.ValidationErrors{{Field: "interval", Rule: "oneof", Param: "day week month"}}
+	}
+
+	if q.To.IsZero() {
+		q.To = s.now()
+	}
+	q.To = truncateDay(q.To)
+	if q.From.IsZero() {
+		switch q.Interval {
+		case models.StatsDay:
+			q.From = q.To.AddDate(0, 0, -29)
+		case models.StatsWeek:
+			q.From = q.To.AddDate(0, 0, -7*11)
+		case models.StatsMonth:
+			q.From = q.To.AddDate(0, -11, 0)
+		}
+	}
+	q.From = truncateDay(q.From)
+
+	if q.From.After(q.To) {
+		return q, models.ValidationErrors{{Field: "from", Rule: "ltefield", Param: "to"}}
+	}
+	if q.To.Sub(q.From) >= maxStatsDays*24*time.Hour {
+		return q, models.ValidationErrors{{Field: "from", Rule: "max_range", Param: fmt.Sprintf("%d days", maxStatsDays)}}
+	}
+	return q, nil
+}
+
+func (s *StatsService) computeStats(q models.StatsQuery, now time.Time) (*models.AdminStatsResponse, error) {
+	counts, err := s.statsRepo.CountUsers(now)
+	if err != nil {
+		return nil, err
+	}
+	end := q.To.AddDate(0, 0, 1)
+	signups, err := s.statsRepo.CountSignups(q.Interval, q.From, end)
+	if err != nil {
+		return nil, err
+	}
+	logins, err := s.statsRepo.CountLoginsByDay(q.From, end)
+	if err != nil {
+		return nil, err
+	}
+	genders, err := s.statsRepo.CountGenders()
+	if err != nil {
+		return nil, err
+	}
+	ages, err := s.statsRepo.CountAgeGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AdminStatsResponse{
+		Counts:      *counts,
+		Interval:    q.Interval,
+		From:        q.From.Format(statsDateLayout),
+		To:          q.To.Format(statsDateLayout),
+		Signups:     fillBuckets(statsKeys(q.Interval, q.From, q.To), signups),
+		LoginsByDay: fillBuckets(statsKeys(models.StatsDay, q.From, q.To), logins),
+		Genders:     genders,
+		AgeGroups:   fillBuckets(ageGroups, ages),
+		GeneratedAt: now.UTC(),
+	}, nil
+}
+
+// statsKeys lists the bucket keys of every interval touching [from, to],
+// matching the keys the repository groups by.
+func statsKeys(interval string, from, to time.Time) []string {
+	var keys []string
+	switch interval {
+	case models.StatsWeek:
+		// Start on the Monday of from's ISO week.
+		day := from.AddDate(0, 0, -((int(from.Weekday()) + 6) % 7))
+		for ; !day.After(to); day = day.AddDate(0, 0, 7) {
+			year, week := day.ISOWeek()
+			keys = append(keys, fmt.Sprintf("%d-W%02d", year, week))
+		}
+	case models.StatsMonth:
+		month := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
+		for ; !month.After(to); month = month.AddDate(0, 1, 0) {
+			keys = append(keys, month.Format("2006-01"))
+		}
+	default:
+		for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+			keys = append(keys, day.Format(statsDateLayout))
+		}
+	}
+	return keys
+}
+
+// fillBuckets returns a bucket for every key in order, with a zero count
+// where counted has none.
+func fillBuckets(keys []string, counted []models.StatsBucket) []models.StatsBucket {
+	byKey := make(map[string]int64, len(counted))
+	for _, bucket := range counted {
+		byKey[bucket.Key] = bucket.Count
+	}
+	buckets := make([]models.StatsBucket, len(keys))
+	for i, key := range keys {
+		buckets[i] = models.StatsBucket{Key: key, Count: byKey[key]}
+	}
+	return buckets
+}
+
+func truncateDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
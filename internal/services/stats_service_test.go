@@ -0,0 +1,115 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeStatsRepo struct {
+	calls    int
+	interval string
+	from, to time.Time
+}
+
+func (r *fakeStatsRepo) CountUsers(now time.Time) (*models.UserCounts, error) {
+	r.calls++
+	return &models.UserCounts{Total: 10, Verified: 7, Blocked: 1, Deleted: 2}, nil
+}
+
+func (r *fakeStatsRepo) CountSignups(interval string, from, to time.Time) ([]models.StatsBucket, error) {
+	r.interval, r.from, r.to = interval, from, to
+	switch interval {
+	case models.StatsWeek:
+		return []models.StatsBucket{{Key: "2026-W01", Count: 3}}, nil
+	case models.StatsMonth:
+		return []models.StatsBucket{{Key: "2026-02", Count: 4}}, nil
+	}
+	return []models.StatsBucket{{Key: "2026-01-02", Count: 5}}, nil
+}
+
+func (r *fakeStatsRepo) CountLoginsByDay(from, to time.Time) ([]models.StatsBucket, error) {
+	return []models.StatsBucket{{Key: "2026-01-03", Count: 8}}, nil
+}
+
+func (r *fakeStatsRepo) CountGenders() ([]models.StatsBucket, error) {
+	return []models.StatsBucket{{Key: "Female", Count: 6}, {Key: "Male", Count: 4}}, nil
+}
+
+func (r *fakeStatsRepo) CountAgeGroups() ([]models.StatsBucket, error) {
+	return []models.StatsBucket{{Key: "25-34", Count: 9}, {Key: "unknown", Count: 1}}, nil
+}
+
+func statsDate(t *testing.T, value string) time.Time {
+	t.Helper()
+	parsed, err := time.Parse("2006-01-02", value)
+	assert.NoError(t, err)
+	return parsed
+}
+
+func TestStatsFillsEmptyBuckets(t *testing.T) {
+	repo := &fakeStatsRepo{}
+	svc := NewStatsService(repo)
+
+	stats, err := svc.GetStats(&models.StatsQuery{From: statsDate(t, "2026-01-01"), To: statsDate(t, "2026-01-03")})
+	assert.NoError(t, err)
+	assert.Equal(t, models.StatsDay, stats.Interval)
+	assert.Equal(t, int64(10), stats.Counts.Total)
+	assert.Equal(t, []models.StatsBucket{{Key: "2026-01-01"}, {Key: "2026-01-02", Count: 5}, {Key: "2026-01-03"}}, stats.Signups)
+	assert.Equal(t, []models.StatsBucket{{Key: "2026-01-01"}, {Key: "2026-01-02"}, {Key: "2026-01-03", Count: 8}}, stats.LoginsByDay)
+	assert.Equal(t, statsDate(t, "2026-01-04"), repo.to)
+	assert.Len(t, stats.AgeGroups, len(ageGroups))
+	assert.Equal(t, "under_18", stats.AgeGroups[0].Key)
+	assert.Equal(t, int64(9), stats.AgeGroups[2].Count)
+}
+
+func TestStatsWeekAndMonthKeys(t *testing.T) {
+	svc := NewStatsService(&fakeStatsRepo{})
+
+	// 2026-01-01 is a Thursday in ISO week 1 of 2026.
+	weekly, err := svc.GetStats(&models.StatsQuery{Interval: models.StatsWeek, From: statsDate(t, "2026-01-01"), To: statsDate(t, "2026-01-12")})
+	assert.NoError(t, err)
+	assert.Equal(t, []models.StatsBucket{{Key: "2026-W01", Count: 3}, {Key: "2026-W02"}, {Key: "2026-W03"}}, weekly.Signups)
+
+	monthly, err := svc.GetStats(&models.StatsQuery{Interval: models.StatsMonth, From: statsDate(t, "2026-01-31"), To: statsDate(t, "2026-03-01")})
+	assert.NoError(t, err)
+	assert.Equal(t, []models.StatsBucket{{Key: "2026-01"}, {Key: "2026-02", Count: 4}, {Key: "2026-03"}}, monthly.Signups)
+}
+
+func TestStatsValidatesQuery(t *testing.T) {
+	svc := NewStatsService(&fakeStatsRepo{})
+
+	_, err := svc.GetStats(&models.StatsQuery{Interval: "year"})
+	assert.Equal(t, "interval", err.(models.ValidationErrors)[0].Field)
+
+	_, err = svc.GetStats(&models.StatsQuery{From: statsDate(t, "2026-02-01"), To: statsDate(t, "2026-01-01")})
+	assert.Equal(t, "ltefield", err.(models.ValidationErrors)[0].Rule)
+
+	_, err = svc.GetStats(&models.StatsQuery{From: statsDate(t, "2020-01-01"), To: statsDate(t, "2026-01-01")})
+	assert.Equal(t, "max_range", err.(models.ValidationErrors)[0].Rule)
+}
+
+func TestStatsDefaultRangeAndCache(t *testing.T) {
+	repo := &fakeStatsRepo{}
+	now := time.Date(2026, 3, 15, 10, 30, 0, 0, time.UTC)
+	svc := NewStatsService(repo, WithStatsCacheTTL(time.Minute))
+	svc.now = func() time.Time { return now }
+
+	stats, err := svc.GetStats(&models.StatsQuery{})
+	assert.NoError(t, err)
+	assert.Equal(t, "2026-02-14", stats.From)
+	assert.Equal(t, "2026-03-15", stats.To)
+	assert.Len(t, stats.Signups, 30)
+
+	now = now.Add(30 * time.Second)
+	_, err = svc.GetStats(&models.StatsQuery{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, repo.calls)
+
+	now = now.Add(time.Minute)
+	_, err = svc.GetStats(&models.StatsQuery{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, repo.calls)
+}
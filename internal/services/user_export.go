@@ -0,0 +1,225 @@
+package services
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/liju-github/user-management/internal/models"
+)
+
+// Formats supported by user exports.
+const (
+	UserExportCSV    = "csv"
+	UserExportNDJSON = "ndjson"
+)
+
+// userColumn is one column admins can pick for a user export. PII columns
+// are masked unless the admin holds models.PermissionViewPII.
+type userColumn struct {
+	name  string
+	pii   bool
+	value func(*models.User) interface{}
+	mask  func(string) string
+}
+
+var userColumns = []userColumn{
+	{name: "id", value: func(u *models.User) interface{} { return u.ID }},
+	{name: "name", pii: true, value: func(u *models.User) interface{} { return u.Name }, mask: maskName},
+	{name: "email", pii: true, value: func(u *models.User) interface{} { return u.Email }, mask: maskEmail},
+	{name: "phone", pii: true, value: func(u *models.User) interface{} { return u.PhoneNumber }, mask: maskPhone},
+	{name: "address", pii: true, value: func(u *models.User) interface{} { return u.Address }, mask: maskAll},
+	{name: "age", value: func(u *models.User) interface{} { return u.Age }},
+	{name: "gender", value: func(u *models.User) interface{} { return u.Gender }},
+	{name: "is_verified", value: func(u *models.User) interface{} { return u.IsVerified }},
+	{name: "is_blocked", value: func(u *models.User) interface{} { return u.IsBlocked }},
+	{name: "created_at", value: func(u *models.User) interface{} { return u.CreatedAt }},
+	{name: "imported_at", value: func(u *models.User) interface{} { return u.ImportedAt }},
+}
+
+// UserExport is a validated user export ready to be streamed with Write.
+type UserExport struct {
+	Format   string
+	columns  []userColumn
+	unmasked bool
+	each     func(fn func(*models.User) error) error
+}
+
+// ContentType is the MIME type of the export body.
+func (e *UserExport) ContentType() string {
+	if e.Format == UserExportNDJSON {
+		return "application/x-ndjson"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// NewUserExport checks the requested format and columns and prepares an
+// export of the users matching filter. No columns means all of them. PII
+// is masked unless adminID holds models.PermissionViewPII.
+func (a *AdminService) NewUserExport(format string, filter *models.UserFilter, columns []string, adminID string) (*UserExport, error) {
+	if format == "" {
+		format = UserExportCSV
+	}
+	if format != UserExportCSV && format != UserExportNDJSON {
+		return nil, models.ValidationErrors{{Field: "format", Rule: "oneof", Param: "csv ndjson"}}
+	}
+
+	selected, err := selectUserColumns(columns)
+	if err != nil {
+		return nil, err
+	}
+
+	unmasked, err := a.HasPermission(adminID, models.PermissionViewPII)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserExport{
+		Format:   format,
+		columns:  selected,
+		unmasked: unmasked,
+		each: func(fn func(*models.User) error) error {
+			return a.userRepo.EachUser(filter, fn)
+		},
+	}, nil
+}
+
+func selectUserColumns(names []string) ([]userColumn, error) {
+	if len(names) == 0 {
+		return userColumns, nil
+	}
+
+	selected := make([]userColumn, 0, len(names))
+	for _, name := range names {
+		found := false
+		for _, column := range userColumns {
+			if column.name == name {
+				selected = append(selected, column)
+				found = true
+				break
+			}
+		}
+		if !found {
+			known := make([]string, len(userColumns))
+			for i, column := range userColumns {
+				known[i] = column.name
+			}
+			return nil, models.ValidationErrors{{Field: "columns", Rule: "oneof", Param: strings.Join(known, " ")}}
+		}
+	}
+	return selected, nil
+}
+
+// Write streams the export to w one user at a time.
+func (e *UserExport) Write(w io.Writer) error {
+	if e.Format == UserExportNDJSON {
+		return e.writeNDJSON(w)
+	}
+	return e.writeCSV(w)
+}
+
+func (e *UserExport) writeCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+	header := make([]string, len(e.columns))
+	for i, column := range e.columns {
+		header[i] = column.name
+	}
+	if err := out.Write(header); err != nil {
+		return err
+	}
+
+	row := make([]string, len(e.columns))
+	err := e.each(func(user *models.User) error {
+		for i, column := range e.columns {
+			row[i] = spreadsheetSafe(e.cell(column, user))
+		}
+		return out.Write(row)
+	})
+	if err != nil {
+		return err
+	}
+	out.Flush()
+	return out.Error()
+}
+
+func (e *UserExport) writeNDJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	return e.each(func(user *models.User) error {
+		record := make(map[string]interface{}, len(e.columns))
+		for _, column := range e.columns {
+			if column.pii && !e.unmasked {
+				record[column.name] = e.cell(column, user)
+			} else {
+				record[column.name] = column.value(user)
+			}
+		}
+		return encoder.Encode(record)
+	})
+}
+
+// cell formats a column as text, masking it when required.
+func (e *UserExport) cell(column userColumn, user *models.User) string {
+	var text string
+	switch v := column.value(user).(type) {
+	case string:
+		text = v
+	case time.Time:
+		text = v.UTC().Format(time.RFC3339)
+	case *time.Time:
+		if v != nil {
+			text = v.UTC().Format(time.RFC3339)
+		}
+	case uint:
+		text = strconv.FormatUint(uint64(v), 10)
+	case bool:
+		text = strconv.FormatBool(v)
+	default:
+		text = fmt.Sprint(v)
+	}
+
+	if column.pii && !e.unmasked && text != "" {
+		return column.mask(text)
+	}
+	return text
+}
+
+// spreadsheetSafe stops spreadsheets from evaluating a user-supplied cell
+// as a formula by prefixing it with a quote.
+func spreadsheetSafe(text string) string {
+	if text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+// maskName keeps the first letter: "John Doe" becomes "J***".
+func maskName(name string) string {
+	r, _ := utf8.DecodeRuneInString(name)
+	return string(r) + "***"
+}
+
+// maskEmail keeps the first letter and the domain: "j***@example.com".
+func maskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		return maskAll(email)
+	}
+	return maskName(email[:at]) + email[at:]
+}
+
+// maskPhone keeps the last four digits: "******3210".
+func maskPhone(phone string) string {
+	if len(phone) <= 4 {
+		return maskAll(phone)
+	}
+	return strings.Repeat("*", len(phone)-4) + phone[len(phone)-4:]
+}
+
+func maskAll(string) string {
+	return "***"
+}
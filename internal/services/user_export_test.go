@@ -0,0 +1,74 @@
+package services
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func testUserExport(t *testing.T, format string, columns []string, unmasked bool) string {
+	selected, err := selectUserColumns(columns)
+	assert.NoError(t, err)
+
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	users := []models.User{
+		{ID: "user-1", Name: "John Doe", Email: "john@example.com", PhoneNumber: 9876543210, Address: "1 Main Street", Age: 30, IsVerified: true},
+		{ID: "user-2", Name: "=HYPERLINK(\"x\")", Email: "eve@example.com", PhoneNumber: 9876543211, Age: 41},
+	}
+	users[0].CreatedAt = created
+	users[1].CreatedAt = created
+
+	export := &UserExport{
+		Format:   format,
+		columns:  selected,
+		unmasked: unmasked,
+		each: func(fn func(*models.User) error) error {
+			for i := range users {
+				if err := fn(&users[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	var out bytes.Buffer
+	assert.NoError(t, export.Write(&out))
+	return out.String()
+}
+
+func TestUserExportCSV(t *testing.T) {
+	out := testUserExport(t, UserExportCSV, []string{"id", "name", "email", "phone", "is_verified", "created_at"}, false)
+	assert.Equal(t, strings.Join([]string{
+		"id,name,email,phone,is_verified,created_at",
+		"user-1,J***,j***@example.com,******3210,true,2024-05-01T12:00:00Z",
+		"user-2,'=***,e***@example.com,******3211,false,2024-05-01T12:00:00Z",
+		"",
+	}, "\n"), out)
+
+	out = testUserExport(t, UserExportCSV, []string{"name", "address"}, true)
+	assert.Equal(t, "name,address\nJohn Doe,1 Main Street\n\"'=HYPERLINK(\"\"x\"\")\",\n", out)
+}
+
+func TestUserExportNDJSON(t *testing.T) {
+	out := testUserExport(t, UserExportNDJSON, []string{"id", "email", "age"}, false)
+	assert.Equal(t, `{"age":30,"email":"j***@example.com","id":"user-1"}`+"\n"+
+		`{"age":41,"email":"e***@example.com","id":"user-2"}`+"\n", out)
+
+	out = testUserExport(t, UserExportNDJSON, []string{"email", "phone"}, true)
+	assert.Contains(t, out, `{"email":"john@example.com","phone":9876543210}`)
+}
+
+func TestUserExportColumns(t *testing.T) {
+	_, err := selectUserColumns([]string{"id", "password_hash"})
+	var verrs models.ValidationErrors
+	assert.ErrorAs(t, err, &verrs)
+	assert.Equal(t, "columns", verrs[0].Field)
+
+	all, err := selectUserColumns(nil)
+	assert.NoError(t, err)
+	assert.Len(t, all, len(userColumns))
+}
@@ -4,12 +4,17 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
-	"net/smtp"
+	"log"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/liju-github/user-management/internal/events"
 	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/passwords"
 	"github.com/liju-github/user-management/internal/repository"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/liju-github/user-management/internal/storage"
 )
 
 type IUserService interface {
@@ -20,32 +25,223 @@ type IUserService interface {
 	ResendVerification(email string) error
 	RequestPasswordReset(email string) error
 	ConfirmPasswordReset(token, newPassword string) error
+	ChangePassword(userID, currentPassword, newPassword string) error
 	GetProfile(userID string) (*models.User, error)
 	UpdateProfile(userID string, email string, req *models.UserUpdateRequest) error
-	UploadProfilePicture(userID, cdnURL string) error
+	UploadProfilePicture(userID string, image []byte) (string, error)
+	AvatarURLs(user *models.User) map[string]string
+	RequestAccountDeletion(userID, password string) (time.Time, error)
+	StartSession(userID, userAgent, ipAddress string, ttl time.Duration) (*models.Session, error)
+	GetSecurityHistory(userID string) (*models.SecurityHistoryResponse, error)
+	ForOrganization(organizationID string) IUserService
 }
 
 type UserService struct {
-	userRepo repository.IUserRepository
+	userRepo        repository.IUserRepository
+	mailer          Mailer
+	baseURL         string
+	antiEnumeration bool
+	passwords       *passwords.Manager
+	policy          *passwords.Policy
+	storage         storage.Storage
+	maxImageSize    int64
+	deletionGrace   time.Duration
+	audit           *AuditService
+	webhooks        *WebhookService
+	events          *events.Bus
+	invitations     *InvitationService
+	exports         *ExportService
+
+	deletedEmailReuse bool
+
+	// organizationID limits the service to one tenant; see InOrganization.
+	organizationID string
+
+	// dummy is shared with the copies made by InOrganization.
+	dummy *lazyHash
 }
 
-func NewUserService(userRepo repository.IUserRepository) *UserService {
-	return &UserService{userRepo: userRepo}
+type lazyHash struct {
+	once sync.Once
+	hash string
+}
+
+// UserServiceOption configures optional UserService behaviour.
+type UserServiceOption func(*UserService)
+
+// WithMailer sets the mailer used for verification and reset emails when
+// the service has no bus from WithEvents.
+func WithMailer(mailer Mailer) UserServiceOption {
+	return func(s *UserService) { s.mailer = mailer }
+}
+
+// WithBaseURL sets the public URL used to build links in emails.
+func WithBaseURL(baseURL string) UserServiceOption {
+	return func(s *UserService) { s.baseURL = baseURL }
+}
+
+// WithPasswordManager sets the hasher used for new passwords and for
+// verifying existing hashes.
+func WithPasswordManager(manager *passwords.Manager) UserServiceOption {
+	return func(s *UserService) { s.passwords = manager }
+}
+
+// WithPasswordPolicy sets the rules new passwords must satisfy.
+func WithPasswordPolicy(policy *passwords.Policy) UserServiceOption {
+	return func(s *UserService) { s.policy = policy }
+}
+
+// WithStorage sets where uploaded profile pictures are stored.
+func WithStorage(store storage.Storage) UserServiceOption {
+	return func(s *UserService) { s.storage = store }
+}
+
+// WithMaxImageSize limits the size of uploaded profile pictures in bytes.
+func WithMaxImageSize(size int64) UserServiceOption {
+	return func(s *UserService) { s.maxImageSize = size }
+}
+
+// WithDeletionGracePeriod sets how long an account stays pending deletion,
+// during which signing in cancels the deletion.
+func WithDeletionGracePeriod(grace time.Duration) UserServiceOption {
+	return func(s *UserService) { s.deletionGrace = grace }
+}
+
+// WithAuditLog records account changes made through the service.
+func WithAuditLog(audit *AuditService) UserServiceOption {
+	return func(s *UserService) { s.audit = audit }
+}
+
+// WithWebhooks announces user lifecycle events to webhook endpoints when the
+// service has no bus from WithEvents.
+func WithWebhooks(webhooks *WebhookService) UserServiceOption {
+	return func(s *UserService) { s.webhooks = webhooks }
+}
+
+// WithEvents publishes the service's domain events on bus, whose
+// subscribers send the emails, audit records and webhooks. Without it the
+// service uses a bus of its own wired to its mailer, audit log and webhooks.
+func WithEvents(bus *events.Bus) UserServiceOption {
+	return func(s *UserService) { s.events = bus }
+}
+
+// WithInvitations makes Signup follow the organization's signup mode and
+// accept invitation tokens. Without it anyone can sign up.
+func WithInvitations(invitations *InvitationService) UserServiceOption {
+	return func(s *UserService) { s.invitations = invitations }
+}
+
+// WithExports lets purges delete the user's data exports and their
+// archives.
+func WithExports(exports *ExportService) UserServiceOption {
+	return func(s *UserService) { s.exports = exports }
+}
+
+// WithDeletedEmailReuse controls whether the email of a soft-deleted account
+// can be used to sign up again. It is allowed by default.
+func WithDeletedEmailReuse(allowed bool) UserServiceOption {
+	return func(s *UserService) { s.deletedEmailReuse = allowed }
+}
+
+// WithAntiEnumeration makes Signup, Login, ResendVerification and
+// RequestPasswordReset respond the same way, in comparable time, whether or
+// not the email belongs to an account.
+func WithAntiEnumeration(enabled bool) UserServiceOption {
+	return func(s *UserService) { s.antiEnumeration = enabled }
+}
+
+func NewUserService(userRepo repository.IUserRepository, opts ...UserServiceOption) *UserService {
+	s := &UserService{
+		userRepo:      userRepo,
+		mailer:        LogMailer{},
+		baseURL:       "http://localhost:8080",
+		passwords:     passwords.NewManagerFromConfig("argon2id", passwords.DefaultArgon2idParams, 0),
+		policy:        passwords.DefaultPolicy(),
+		maxImageSize:  5 << 20,
+		deletionGrace: 30 * 24 * time.Hour,
+
+		deletedEmailReuse: true,
+
+		dummy: &lazyHash{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.events == nil {
+		s.events = events.NewBus()
+		SubscribeEmails(s.events, s.mailer, s.baseURL)
+		SubscribeAudit(s.events, s.audit)
+		SubscribeWebhooks(s.events, s.webhooks)
+	}
+	return s
+}
+
+// ForOrganization returns the service as seen by one organization: it
+// signs up users into it and only finds its users.
+func (s *UserService) ForOrganization(organizationID string) IUserService {
+	return s.InOrganization(organizationID)
+}
+
+// InOrganization is ForOrganization for callers that need the concrete
+// service. An empty organizationID returns s, which sees every
+// organization.
+func (s *UserService) InOrganization(organizationID string) *UserService {
+	if organizationID == "" {
+		return s
+	}
+	scoped := *s
+	scoped.organizationID = organizationID
+	scoped.userRepo = s.userRepo.ForOrganization(organizationID)
+	return &scoped
 }
 
 func (s *UserService) Signup(user *models.UserSignupRequest) error {
-	existingUser, _ := s.userRepo.FindUserByEmail(user.Email)
-	if existingUser != nil {
-		return errors.New(models.UserAlreadyExists)
+	invitation, err := s.signupInvitation(user)
+	if err != nil {
+		return err
+	}
+	if err := s.checkPassword("password", user.Password, user.Name, user.Email); err != nil {
+		return err
+	}
+
+	existingUser, err := s.userRepo.FindUserByEmail(user.Email)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+	hashedPassword, err := s.hashPassword("password", user.Password)
+	if err != nil {
+		return err
 	}
 
-	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	if existingUser == nil && !s.deletedEmailReuse {
+		if _, err := s.userRepo.FindDeletedUserByEmail(user.Email); err == nil {
+			if s.antiEnumeration {
+				return nil
+			}
+			return ErrUserExists
+		} else if !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+	}
+
+	if existingUser != nil {
+		if !s.antiEnumeration {
+			return ErrUserExists
+		}
+		// Tell the real owner instead of telling the caller; the password is
+		// still hashed above so both branches take about the same time.
+		return s.forKnownAccount(func() error {
+			return publishAfter(s.events, s.userRepo, nil, events.SignupAttempted{User: models.NewUserSnapshot(existingUser)})
+		})
+	}
 	// verificationToken := generateToken()
 
 	newUser := &models.User{
+		// The ID is set here so the event carries it.
+		ID:           uuid.New().String(),
 		Name:         user.Name,
 		Email:        user.Email,
-		PasswordHash: string(hashedPassword),
+		PasswordHash: hashedPassword,
 		IsVerified:   true,
 		Age:          user.Age,
 		Gender:       user.Gender,
@@ -56,7 +252,19 @@ func (s *UserService) Signup(user *models.UserSignupRequest) error {
 		// VerificationExpiry: time.Now().Add(24 * time.Hour).Unix(),
 	}
 
-	if err := s.userRepo.CreateUser(newUser); err != nil {
+	newUser.OrganizationID = s.organizationID
+	if newUser.OrganizationID == "" {
+		newUser.OrganizationID = models.DefaultOrganizationID
+	}
+	newUser.CreatedAt = time.Now()
+
+	if invitation != nil {
+		return s.createUser(newUser, invitation, nil)
+	}
+	err = publishAfter(s.events, s.userRepo, func(repo repository.IUserRepository) error {
+		return repo.CreateUser(newUser)
+	}, events.UserSignedUp{User: models.NewUserSnapshot(newUser)})
+	if err != nil {
 		return err
 	}
 
@@ -65,20 +273,212 @@ func (s *UserService) Signup(user *models.UserSignupRequest) error {
 	return nil
 }
 
+// signupInvitation checks that the signup is allowed by the organization's
+// signup mode and returns the invitation it redeems, if any. An invitation
+// only works for the organization and email address it was sent to.
+func (s *UserService) signupInvitation(user *models.UserSignupRequest) (*models.Invitation, error) {
+	if s.invitations == nil {
+		return nil, nil
+	}
+	organizationID := s.organizationID
+	if organizationID == "" {
+		organizationID = models.DefaultOrganizationID
+	}
+	mode, err := s.invitations.SignupMode(organizationID)
+	if err != nil {
+		return nil, err
+	}
+	if mode == models.SignupClosed {
+		return nil, ErrSignupClosed
+	}
+	if user.InvitationToken == "" {
+		if mode == models.SignupInvite {
+			return nil, ErrInvitationRequired
+		}
+		return nil, nil
+	}
+
+	invitation, err := s.invitations.Lookup(user.InvitationToken)
+	if err != nil {
+		return nil, err
+	}
+	if invitation.OrganizationID != organizationID || !strings.EqualFold(invitation.Email, user.Email) {
+		return nil, ErrInvalidToken
+	}
+	return invitation, nil
+}
+
+// createUser creates a user who signed up with an invitation or with a
+// provider identity, or both. In one transaction it marks the invitation
+// used, adds the user to the group it names and links the identity. Either
+// stands in for email verification.
+func (s *UserService) createUser(user *models.User, invitation *models.Invitation, identity *models.UserIdentity) error {
+	user.IsVerified = true
+	evts := []events.Event{events.UserSignedUp{User: models.NewUserSnapshot(user)}}
+
+	var member *models.GroupMember
+	if invitation != nil {
+		invitation.AcceptedAt = &user.CreatedAt
+		invitation.AcceptedUserID = user.ID
+		inviter := Actor{ID: invitation.InvitedBy, Role: invitation.InviterRole}
+		evts = append(evts, events.InvitationAccepted{User: models.NewUserSnapshot(user), InvitationID: invitation.ID, InvitedBy: inviter})
+
+		if invitation.GroupID != "" {
+			member = &models.GroupMember{GroupID: invitation.GroupID, UserID: user.ID, Role: invitation.GroupRole, AddedBy: invitation.InvitedBy}
+			group, err := s.invitations.groupRepo.ForOrganization(invitation.OrganizationID).FindGroupByID(invitation.GroupID)
+			if errors.Is(err, repository.ErrNotFound) {
+				// The group was deleted after the invitation was sent.
+				member = nil
+			} else if err != nil {
+				return err
+			} else {
+				evts = append(evts, events.GroupMemberAdded{UserID: user.ID, Group: userGroup(group, member.Role), Actor: inviter})
+			}
+		}
+	}
+	if identity != nil {
+		identity.UserID = user.ID
+		evts = append(evts, events.IdentityLinked{User: models.NewUserSnapshot(user), Provider: identity.Provider, Email: identity.Email, Signup: true})
+	}
+
+	return publishAfter(s.events, s.userRepo, func(repo repository.IUserRepository) error {
+		return repo.Transaction(func(tx repository.IUserRepository) error {
+			if err := tx.CreateUser(user); err != nil {
+				return err
+			}
+			if invitation != nil {
+				err := tx.AcceptInvitation(invitation, member)
+				if errors.Is(err, repository.ErrNotFound) {
+					return ErrInvalidToken
+				}
+				if err != nil {
+					return err
+				}
+			}
+			if identity != nil {
+				return tx.CreateIdentity(identity)
+			}
+			return nil
+		})
+	}, evts...)
+}
+
+// signupWithIdentity creates a user for someone signing in with a provider
+// identity for the first time, if the organization's signup mode lets
+// them. A pending invitation for the email is accepted along the way, and
+// is required when the organization is invite-only.
+func (s *UserService) signupWithIdentity(identity *models.UserIdentity, name string) (*models.User, error) {
+	var invitation *models.Invitation
+	if s.invitations != nil {
+		mode, err := s.invitations.SignupMode(identity.OrganizationID)
+		if err != nil {
+			return nil, err
+		}
+		if mode == models.SignupClosed {
+			return nil, ErrSignupClosed
+		}
+		invitation, err = s.invitations.invitationRepo.ForOrganization(identity.OrganizationID).FindPendingInvitation(identity.Email, time.Now())
+		if errors.Is(err, repository.ErrNotFound) {
+			if mode == models.SignupInvite {
+				return nil, ErrInvitationRequired
+			}
+			invitation = nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	if name == "" {
+		name, _, _ = strings.Cut(identity.Email, "@")
+	}
+	user := &models.User{
+		ID:             uuid.New().String(),
+		OrganizationID: identity.OrganizationID,
+		Name:           name,
+		Email:          identity.Email,
+	}
+	user.CreatedAt = time.Now()
+	if err := s.createUser(user, invitation, identity); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// admit lets a user who proved who they are some other way than with their
+// password sign in, on the same terms as Login: a blocked user is refused,
+// a block that has run out is cleared and a pending deletion is cancelled.
+func (s *UserService) admit(user *models.User) error {
+	if user.DeletionDue(time.Now()) {
+		return ErrUserNotFound
+	}
+	if user.IsBlocked {
+		if user.BlockActive(time.Now()) {
+			return NewBlockedError(user)
+		}
+		if err := unblock(s.events, s.userRepo, user, SystemActor); err != nil {
+			return err
+		}
+	}
+	if user.DeletionScheduledAt != nil {
+		s.cancelAccountDeletion(user)
+	}
+	return nil
+}
+
 func (s *UserService) Login(email, password string) (*models.User, error) {
 	user, err := s.userRepo.FindUserByEmail(email)
+	if err == nil && user.DeletionDue(time.Now()) {
+		// Only waiting for the purge job; signing in can no longer save it.
+		err = repository.ErrNotFound
+	}
 	if err != nil {
-		return nil, errors.New(models.UserDoesntExist)
+		if errors.Is(err, repository.ErrNotFound) {
+			// Burn the same hashing work a real comparison would.
+			s.passwords.Verify(password, s.dummyPasswordHash())
+			if s.antiEnumeration {
+				return nil, ErrInvalidCredentials
+			}
+		}
+		return nil, userLookupError(err)
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
-		return nil, errors.New("invalid credentials")
+	ok, needsRehash, err := s.passwords.Verify(password, user.PasswordHash)
+	if err != nil || !ok {
+		return nil, ErrInvalidCredentials
 	}
 
 	if !user.IsVerified {
-		return nil, errors.New("email not verified")
+		return nil, ErrEmailNotVerified
+	}
+
+	if user.IsBlocked {
+		if user.BlockActive(time.Now()) {
+			return nil, NewBlockedError(user)
+		}
+		// The block has run out; clear it now rather than waiting for
+		// an admin.
+		if err := unblock(s.events, s.userRepo, user, SystemActor); err != nil {
+			return nil, err
+		}
 	}
 
+	if user.MustChangePassword {
+		resetToken, err := s.createPasswordReset(user, 15*time.Minute)
+		if err != nil {
+			return nil, err
+		}
+		return nil, &PasswordChangeRequiredError{ResetToken: resetToken}
+	}
+
+	if needsRehash {
+		s.rehashPassword(user, password)
+	}
+
+	if user.DeletionScheduledAt != nil {
+		s.cancelAccountDeletion(user)
+	}
+
+	s.events.Publish(events.UserLoggedIn{User: models.NewUserSnapshot(user)})
 	return user, nil
 }
 
@@ -89,114 +489,167 @@ func (s *UserService) Logout(userID string) error {
 func (s *UserService) VerifyEmail(token string) error {
 	user, err := s.userRepo.FindUserByVerificationToken(token)
 	if err != nil {
-		return errors.New("invalid token")
+		return tokenLookupError(err)
 	}
 
 	if time.Now().Unix() > user.VerificationExpiry {
-		return errors.New("token expired")
+		return ErrTokenExpired
 	}
 
 	user.IsVerified = true
 	user.VerificationToken = ""
 	user.VerificationExpiry = 0
 
-	return s.userRepo.UpdateUser(user)
+	return publishAfter(s.events, s.userRepo, func(repo repository.IUserRepository) error {
+		return repo.UpdateUser(user)
+	}, events.UserVerified{User: models.NewUserSnapshot(user), Actor: UserActor(user.ID)})
 }
 
 func (s *UserService) ResendVerification(email string) error {
 	user, err := s.userRepo.FindUserByEmail(email)
 	if err != nil {
-		return errors.New(models.UserDoesntExist)
+		if s.antiEnumeration && errors.Is(err, repository.ErrNotFound) {
+			return nil
+		}
+		return userLookupError(err)
 	}
 
 	if user.IsVerified {
-		return errors.New("email already verified")
+		if s.antiEnumeration {
+			return nil
+		}
+		return ErrEmailAlreadyVerified
 	}
 
-	verificationToken := generateToken()
-	user.VerificationToken = verificationToken
-	user.VerificationExpiry = time.Now().Add(24 * time.Hour).Unix()
-
-	if err := s.userRepo.UpdateUser(user); err != nil {
-		return err
-	}
+	return s.forKnownAccount(func() error {
+		verificationToken := generateToken()
+		user.VerificationToken = verificationToken
+		user.VerificationExpiry = time.Now().Add(24 * time.Hour).Unix()
 
-	return s.sendVerificationEmail(user.Email, verificationToken)
+		return publishAfter(s.events, s.userRepo, func(repo repository.IUserRepository) error {
+			return repo.UpdateUser(user)
+		}, events.VerificationRequested{User: models.NewUserSnapshot(user), Token: verificationToken})
+	})
 }
 
 func (s *UserService) RequestPasswordReset(email string) error {
 	user, err := s.userRepo.FindUserByEmail(email)
 	if err != nil {
-		return errors.New(models.UserDoesntExist)
+		if s.antiEnumeration && errors.Is(err, repository.ErrNotFound) {
+			return nil
+		}
+		return userLookupError(err)
 	}
 
-	resetToken := generateToken()
-	resetExpiry := time.Now().Add(1 * time.Hour).Unix()
+	return s.forKnownAccount(func() error {
+		return s.sendPasswordReset(user, events.ResetRequested, UserActor(user.ID), time.Hour, nil)
+	})
+}
 
-	passwordReset := &models.PasswordReset{
-		UserID:     user.ID,
-		ResetToken: resetToken,
-		Expiry:     resetExpiry,
+// forKnownAccount does the work a public endpoint does once it has found
+// the account an email belongs to. With anti-enumeration it runs in the
+// background, so the response comes as fast as for an unknown email, and
+// failures are only logged.
+func (s *UserService) forKnownAccount(work func() error) error {
+	if !s.antiEnumeration {
+		return work()
 	}
-
-	if err := s.userRepo.CreatePasswordReset(passwordReset); err != nil {
-		return err
-	}
-
-	return s.sendPasswordResetEmail(user.Email, resetToken)
+	go func() {
+		if err := work(); err != nil {
+			log.Printf("Failed to handle request for a known account: %v", err)
+		}
+	}()
+	return nil
 }
 
 func (s *UserService) ConfirmPasswordReset(token, newPassword string) error {
 	passwordReset, err := s.userRepo.FindPasswordResetByToken(token)
 	if err != nil {
-		return errors.New("invalid token")
+		return tokenLookupError(err)
 	}
 
 	if time.Now().Unix() > passwordReset.Expiry {
-		return errors.New("token expired")
+		return ErrTokenExpired
 	}
 
 	user, err := s.userRepo.FindUserByID(passwordReset.UserID)
 	if err != nil {
-		return errors.New(models.UserDoesntExist)
+		return userLookupError(err)
 	}
 
-	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
-	user.PasswordHash = string(hashedPassword)
+	if err := s.checkPassword("new_password", newPassword, user.Name, user.Email); err != nil {
+		return err
+	}
 
-	if err := s.userRepo.UpdateUser(user); err != nil {
+	if err := s.setPassword(user, "new_password", newPassword); err != nil {
 		return err
 	}
+	s.audit.Record(user.ID, UserActor(user.ID), models.AuditPasswordReset, nil)
 
 	return s.userRepo.DeletePasswordReset(passwordReset.ID)
 }
 
 func (s *UserService) GetProfile(userID string) (*models.User, error) {
-	return s.userRepo.FindUserByID(userID)
+	user, err := s.userRepo.FindUserByID(userID)
+	if err != nil {
+		return nil, userLookupError(err)
+	}
+	return user, nil
 }
 
 func (s *UserService) UpdateProfile(userID string, email string, req *models.UserUpdateRequest) error {
 	user, err := s.userRepo.FindUserByID(userID)
 	if err != nil {
-		return errors.New(models.UserDoesntExist)
+		return userLookupError(err)
+	}
+
+	var fields []string
+	setString := func(field string, target *string, value *string) {
+		if value != nil && *value != *target {
+			*target = *value
+			fields = append(fields, field)
+		}
 	}
+	setString("name", &user.Name, req.Name)
+	if req.Age != nil && *req.Age != user.Age {
+		user.Age = *req.Age
+		fields = append(fields, "age")
+	}
+	setString("gender", &user.Gender, req.Gender)
+	setString("address", &user.Address, req.Address)
 
-	user.Name = req.Name
-	user.Age = req.Age
-	user.Gender = req.Gender
-	user.Address = req.Address
+	if len(fields) == 0 {
+		return s.userRepo.UpdateUser(user)
+	}
+	return publishAfter(s.events, s.userRepo, func(repo repository.IUserRepository) error {
+		return repo.UpdateUser(user)
+	}, events.ProfileUpdated{User: models.NewUserSnapshot(user), Actor: UserActor(user.ID), Fields: fields})
+}
 
-	return s.userRepo.UpdateUser(user)
+// unblock lifts the user's block and announces it.
+func unblock(bus *events.Bus, userRepo repository.IUserRepository, user *models.User, by Actor) error {
+	snapshot := models.NewUserSnapshot(user)
+	snapshot.IsBlocked = false
+	return publishAfter(bus, userRepo, func(repo repository.IUserRepository) error {
+		return repo.UnblockUser(user, by.ID)
+	}, events.UserUnblocked{User: snapshot, Actor: by})
 }
 
-func (s *UserService) UploadProfilePicture(userID, cdnURL string) error {
-	user, err := s.userRepo.FindUserByID(userID)
-	if err != nil {
-		return errors.New(models.UserDoesntExist)
+// userLookupError translates a repository lookup failure into ErrUserNotFound,
+// leaving unexpected database errors untouched.
+func userLookupError(err error) error {
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrUserNotFound
 	}
+	return err
+}
 
-	user.ImageURL = cdnURL
-	return s.userRepo.UpdateUser(user)
+// tokenLookupError is userLookupError for verification and reset tokens.
+func tokenLookupError(err error) error {
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrInvalidToken
+	}
+	return err
 }
 
 func generateToken() string {
@@ -205,28 +658,26 @@ func generateToken() string {
 	return base64.URLEncoding.EncodeToString(b)
 }
 
-func (s *UserService) sendVerificationEmail(email, token string) error {
-	from := "lijuthomasliju03@gmail.com"
-	password := "ciwg zzwn gpbs dekx"
-	to := []string{"h4ze07@gmail.com"}
-	smtpHost := "smtp.gmail.com"
-	smtpPort := "587"
-
-	message := []byte("Subject: Email Verification\r\n" +
-		"\r\n" +
-		"Please verify your email by clicking the following link:\r\n" +
-		"http://example.com/verify?token=" + token)
-
-	auth := smtp.PlainAuth("", from, password, smtpHost)
+// dummyPasswordHash is compared against when no account matches an email so
+// that unknown and known accounts cost the same hashing work.
+func (s *UserService) dummyPasswordHash() string {
+	s.dummy.once.Do(func() {
+		s.dummy.hash, _ = s.passwords.Hash(generateToken())
+	})
+	return s.dummy.hash
+}
 
-	err := smtp.SendMail(smtpHost+":"+smtpPort, auth, from, to, message)
+// rehashPassword upgrades a stored hash that uses an older algorithm or
+// weaker parameters. The password was just verified, so failures only mean
+// the upgrade is retried on the next login.
+func (s *UserService) rehashPassword(user *models.User, password string) {
+	hashedPassword, err := s.passwords.Hash(password)
 	if err != nil {
-		return err
+		log.Println("Failed to rehash password:", err)
+		return
+	}
+	user.PasswordHash = hashedPassword
+	if err := s.userRepo.UpdateUser(user); err != nil {
+		log.Println("Failed to store rehashed password:", err)
 	}
-
-	return nil
-}
-
-func (s *UserService) sendPasswordResetEmail(email, token string) error {
-	return s.sendVerificationEmail(email, token)
 }
@@ -0,0 +1,738 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/jpeg"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/liju-github/user-management/internal/events"
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/passwords"
+	"github.com/liju-github/user-management/internal/repository"
+	"github.com/liju-github/user-management/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type fakeUserRepo struct {
+	users      map[string]*models.User
+	resets     map[string]*models.PasswordReset
+	history    map[string][]models.PasswordHistory
+	deleted    []*models.User
+	blocks     []models.UserBlock
+	sessions   []models.Session
+	outbox     []models.OutboxEvent
+	accepted   []models.Invitation
+	members    []models.GroupMember
+	identities []models.UserIdentity
+}
+
+func newFakeUserRepo(users ...*models.User) *fakeUserRepo {
+	repo := &fakeUserRepo{
+		users:   map[string]*models.User{},
+		resets:  map[string]*models.PasswordReset{},
+		history: map[string][]models.PasswordHistory{},
+	}
+	for _, u := range users {
+		repo.users[u.ID] = u
+	}
+	return repo
+}
+
+func (r *fakeUserRepo) FindUserByEmail(email string) (*models.User, error) {
+	for _, u := range r.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *fakeUserRepo) CreateUser(u *models.User) error {
+	if u.ID == "" {
+		u.ID = generateToken()
+	}
+	r.users[u.ID] = u
+	return nil
+}
+
+func (r *fakeUserRepo) UpdateUser(u *models.User) error {
+	r.users[u.ID] = u
+	return nil
+}
+
+func (r *fakeUserRepo) FindUserByID(id string) (*models.User, error) {
+	if u, ok := r.users[id]; ok {
+		return u, nil
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *fakeUserRepo) FindUserByVerificationToken(token string) (*models.User, error) {
+	for _, u := range r.users {
+		if u.VerificationToken == token {
+			return u, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *fakeUserRepo) CreatePasswordReset(pr *models.PasswordReset) error {
+	pr.ID = generateToken()
+	r.resets[pr.ResetToken] = pr
+	return nil
+}
+
+func (r *fakeUserRepo) FindPasswordResetByToken(token string) (*models.PasswordReset, error) {
+	if pr, ok := r.resets[token]; ok {
+		return pr, nil
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *fakeUserRepo) FindPasswordResetsByUser(userID string) ([]models.PasswordReset, error) {
+	var resets []models.PasswordReset
+	for _, pr := range r.resets {
+		if pr.UserID == userID {
+			resets = append(resets, *pr)
+		}
+	}
+	return resets, nil
+}
+
+func (r *fakeUserRepo) DeletePasswordReset(id string) error {
+	for token, pr := range r.resets {
+		if pr.ID == id {
+			delete(r.resets, token)
+		}
+	}
+	return nil
+}
+
+func (r *fakeUserRepo) FindPasswordHistory(userID string, limit int) ([]models.PasswordHistory, error) {
+	history := r.history[userID]
+	if len(history) > limit {
+		history = history[:limit]
+	}
+	return history, nil
+}
+
+func (r *fakeUserRepo) UpdatePassword(u *models.User, previousHash string, keep int) error {
+	r.users[u.ID] = u
+	history := append([]models.PasswordHistory{{UserID: u.ID, PasswordHash: previousHash}}, r.history[u.ID]...)
+	if len(history) > keep {
+		history = history[:keep]
+	}
+	r.history[u.ID] = history
+	return nil
+}
+
+func (r *fakeUserRepo) FindUsersDueForPurge(before time.Time, limit int) ([]models.User, error) {
+	var due []models.User
+	for _, u := range r.users {
+		if u.DeletionScheduledAt != nil && !u.DeletionScheduledAt.After(before) && len(due) < limit {
+			due = append(due, *u)
+		}
+	}
+	return due, nil
+}
+
+func (r *fakeUserRepo) PurgeUser(userID string) error {
+	delete(r.users, userID)
+	delete(r.history, userID)
+	sessions := r.sessions[:0]
+	for _, s := range r.sessions {
+		if s.UserID != userID {
+			sessions = append(sessions, s)
+		}
+	}
+	r.sessions = sessions
+	for token, pr := range r.resets {
+		if pr.UserID == userID {
+			delete(r.resets, token)
+		}
+	}
+	return nil
+}
+
+func (r *fakeUserRepo) FindDeletedUserByEmail(email string) (*models.User, error) {
+	for _, u := range r.deleted {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *fakeUserRepo) DeleteUser(userID string) error {
+	u, ok := r.users[userID]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	delete(r.users, userID)
+	r.deleted = append(r.deleted, u)
+	return nil
+}
+
+func (r *fakeUserRepo) RestoreUser(userID string) error {
+	for i, u := range r.deleted {
+		if u.ID == userID {
+			r.deleted = append(r.deleted[:i], r.deleted[i+1:]...)
+			r.users[u.ID] = u
+			return nil
+		}
+	}
+	return repository.ErrNotFound
+}
+
+func (r *fakeUserRepo) BlockUser(u *models.User, block *models.UserBlock) error {
+	u.IsBlocked = true
+	u.BlockReason = block.Reason
+	u.BlockedUntil = block.Until
+	r.users[u.ID] = u
+	block.UserID = u.ID
+	r.blocks = append(r.blocks, *block)
+	return nil
+}
+
+func (r *fakeUserRepo) UnblockUser(u *models.User, liftedBy string) error {
+	u.IsBlocked = false
+	u.BlockReason = ""
+	u.BlockedUntil = nil
+	r.users[u.ID] = u
+	return nil
+}
+
+func (r *fakeUserRepo) FindBlocksByUser(userID string) ([]models.UserBlock, error) {
+	var blocks []models.UserBlock
+	for _, b := range r.blocks {
+		if b.UserID == userID {
+			blocks = append(blocks, b)
+		}
+	}
+	return blocks, nil
+}
+
+func (r *fakeUserRepo) CreateSession(s *models.Session) error {
+	s.ID = generateToken()
+	r.sessions = append(r.sessions, *s)
+	return nil
+}
+
+func (r *fakeUserRepo) RevokeSessions(userID string, at time.Time) (int64, error) {
+	var revoked int64
+	for i, s := range r.sessions {
+		if s.UserID == userID && s.Active(at) {
+			r.sessions[i].RevokedAt = &at
+			revoked++
+		}
+	}
+	if u, ok := r.users[userID]; ok {
+		u.SessionsRevokedAt = &at
+	}
+	return revoked, nil
+}
+
+func (r *fakeUserRepo) FindSessionsByUser(userID string, limit int) ([]models.Session, error) {
+	var sessions []models.Session
+	for i := len(r.sessions) - 1; i >= 0 && len(sessions) < limit; i-- {
+		if r.sessions[i].UserID == userID {
+			sessions = append(sessions, r.sessions[i])
+		}
+	}
+	return sessions, nil
+}
+
+func (r *fakeUserRepo) CreateOutboxEvents(records []models.OutboxEvent) error {
+	r.outbox = append(r.outbox, records...)
+	return nil
+}
+
+func (r *fakeUserRepo) Transaction(fn func(repository.IUserRepository) error) error {
+	return fn(r)
+}
+
+func (r *fakeUserRepo) AcceptInvitation(invitation *models.Invitation, member *models.GroupMember) error {
+	r.accepted = append(r.accepted, *invitation)
+	if member != nil {
+		r.members = append(r.members, *member)
+	}
+	return nil
+}
+
+func (r *fakeUserRepo) CreateIdentity(identity *models.UserIdentity) error {
+	r.identities = append(r.identities, *identity)
+	return nil
+}
+
+// ForOrganization returns r: the fake holds a single organization's users.
+func (r *fakeUserRepo) ForOrganization(string) repository.IUserRepository {
+	return r
+}
+
+type sentMail struct {
+	to, subject string
+}
+
+type recordingMailer struct {
+	mu   sync.Mutex
+	sent []sentMail
+	done chan struct{}
+}
+
+func newRecordingMailer() *recordingMailer {
+	return &recordingMailer{done: make(chan struct{}, 10)}
+}
+
+func (m *recordingMailer) Send(to, subject, body string) error {
+	m.mu.Lock()
+	m.sent = append(m.sent, sentMail{to, subject})
+	m.mu.Unlock()
+	m.done <- struct{}{}
+	return nil
+}
+
+func (m *recordingMailer) wait(t *testing.T) sentMail {
+	t.Helper()
+	select {
+	case <-m.done:
+	case <-time.After(time.Second):
+		t.Fatal("no email was sent")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.sent[len(m.sent)-1]
+}
+
+func existingUser(t *testing.T) *models.User {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte("SecurePass@123"), bcrypt.MinCost)
+	assert.NoError(t, err)
+	return &models.User{ID: "user-1", Name: "John Doe", Email: "john@example.com", PasswordHash: string(hash), IsVerified: true}
+}
+
+func TestLoginAntiEnumeration(t *testing.T) {
+	svc := NewUserService(newFakeUserRepo(existingUser(t)), WithAntiEnumeration(true))
+
+	_, unknownErr := svc.Login("nobody@example.com", "SecurePass@123")
+	_, wrongErr := svc.Login("john@example.com", "WrongPass@123")
+
+	assert.ErrorIs(t, unknownErr, ErrInvalidCredentials)
+	assert.ErrorIs(t, wrongErr, ErrInvalidCredentials)
+
+	user, err := svc.Login("john@example.com", "SecurePass@123")
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", user.ID)
+}
+
+func TestLoginWithoutAntiEnumeration(t *testing.T) {
+	svc := NewUserService(newFakeUserRepo(existingUser(t)))
+
+	_, err := svc.Login("nobody@example.com", "SecurePass@123")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+func TestPublicEndpointsDoNotRevealUnknownEmails(t *testing.T) {
+	mailer := newRecordingMailer()
+	svc := NewUserService(newFakeUserRepo(existingUser(t)), WithAntiEnumeration(true), WithMailer(mailer))
+
+	assert.NoError(t, svc.ResendVerification("nobody@example.com"))
+	assert.NoError(t, svc.ResendVerification("john@example.com"))
+	assert.NoError(t, svc.RequestPasswordReset("nobody@example.com"))
+	assert.NoError(t, svc.RequestPasswordReset("john@example.com"))
+
+	mail := mailer.wait(t)
+	assert.Equal(t, "john@example.com", mail.to)
+	assert.Equal(t, "Password Reset", mail.subject)
+}
+
+func TestUpdateProfileChangesOnlyGivenFields(t *testing.T) {
+	user := existingUser(t)
+	user.Age, user.Gender, user.Address = 30, "Male", "1 Main Street"
+	repo := newFakeUserRepo(user)
+	svc := NewUserService(repo)
+
+	name := "Johnny Doe"
+	assert.NoError(t, svc.UpdateProfile("user-1", "john@example.com", &models.UserUpdateRequest{Name: &name}))
+
+	updated := repo.users["user-1"]
+	assert.Equal(t, "Johnny Doe", updated.Name)
+	assert.Equal(t, uint(30), updated.Age)
+	assert.Equal(t, "Male", updated.Gender)
+	assert.Equal(t, "1 Main Street", updated.Address)
+}
+
+func TestSignupConflictEmailsOwner(t *testing.T) {
+	req := &models.UserSignupRequest{Name: "Someone Else", Email: "john@example.com", Password: "Another@Pass1"}
+
+	strict := NewUserService(newFakeUserRepo(existingUser(t)))
+	assert.ErrorIs(t, strict.Signup(req), ErrUserExists)
+
+	mailer := newRecordingMailer()
+	quiet := NewUserService(newFakeUserRepo(existingUser(t)), WithAntiEnumeration(true), WithMailer(mailer))
+	assert.NoError(t, quiet.Signup(req))
+
+	mail := mailer.wait(t)
+	assert.Equal(t, "john@example.com", mail.to)
+	assert.Equal(t, "Sign-up attempt", mail.subject)
+}
+
+func TestLoginUpgradesLegacyHash(t *testing.T) {
+	repo := newFakeUserRepo(existingUser(t))
+	manager := passwords.NewManager(
+		passwords.NewArgon2idHasher(passwords.Argon2idParams{Memory: 1024, Iterations: 1, Parallelism: 1}),
+		passwords.NewBcryptHasher(bcrypt.MinCost),
+	)
+	svc := NewUserService(repo, WithPasswordManager(manager))
+
+	_, err := svc.Login("john@example.com", "SecurePass@123")
+	assert.NoError(t, err)
+
+	upgraded := repo.users["user-1"].PasswordHash
+	assert.True(t, strings.HasPrefix(upgraded, "$argon2id$"))
+
+	_, err = svc.Login("john@example.com", "SecurePass@123")
+	assert.NoError(t, err)
+	assert.Equal(t, upgraded, repo.users["user-1"].PasswordHash)
+}
+
+func TestPasswordPolicyAppliesToChangeAndReset(t *testing.T) {
+	repo := newFakeUserRepo(existingUser(t))
+	manager := passwords.NewManager(passwords.NewBcryptHasher(bcrypt.MinCost))
+	policy := passwords.DefaultPolicy()
+	policy.HistorySize = 2
+	svc := NewUserService(repo, WithPasswordManager(manager), WithPasswordPolicy(policy))
+
+	err := svc.ChangePassword("user-1", "WrongPass@123", "Fresh@Pass123")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	err = svc.ChangePassword("user-1", "SecurePass@123", "weak")
+	var fieldErrors models.ValidationErrors
+	assert.ErrorAs(t, err, &fieldErrors)
+	assert.Contains(t, fieldErrors, models.FieldError{Field: "new_password", Rule: "min", Param: "8"})
+
+	err = svc.ChangePassword("user-1", "SecurePass@123", "John@Doe12345")
+	assert.ErrorAs(t, err, &fieldErrors)
+	assert.Equal(t, models.ValidationErrors{{Field: "new_password", Rule: "personal_info"}}, fieldErrors)
+
+	err = svc.ChangePassword("user-1", "SecurePass@123", "SecurePass@123")
+	assert.ErrorAs(t, err, &fieldErrors)
+	assert.Equal(t, models.ValidationErrors{{Field: "new_password", Rule: "reused", Param: "2"}}, fieldErrors)
+
+	assert.NoError(t, svc.ChangePassword("user-1", "SecurePass@123", "Fresh@Pass123"))
+
+	// The previous password is now in the history and can't come back
+	// through a reset either.
+	repo.resets["reset-token"] = &models.PasswordReset{ID: "reset-1", UserID: "user-1", ResetToken: "reset-token", Expiry: time.Now().Add(time.Hour).Unix()}
+	err = svc.ConfirmPasswordReset("reset-token", "SecurePass@123")
+	assert.ErrorAs(t, err, &fieldErrors)
+	assert.Equal(t, "reused", fieldErrors[0].Rule)
+
+	assert.NoError(t, svc.ConfirmPasswordReset("reset-token", "Another@Pass456"))
+	_, ok := repo.resets["reset-token"]
+	assert.False(t, ok)
+
+	// Only the last two passwords count, the current one included.
+	assert.Len(t, repo.history["user-1"], 1)
+	err = svc.ChangePassword("user-1", "Another@Pass456", "Fresh@Pass123")
+	assert.ErrorAs(t, err, &fieldErrors)
+	assert.NoError(t, svc.ChangePassword("user-1", "Another@Pass456", "SecurePass@123"))
+}
+
+func encodedJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var encoded bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&encoded, img, nil))
+	return encoded.Bytes()
+}
+
+func TestUploadProfilePictureStoresVariantsAndReplacesOld(t *testing.T) {
+	var encoded bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&encoded, image.NewGray(image.Rect(0, 0, 4, 4)), nil))
+	exif := []byte{0xFF, 0xE1, 0x00, 0x0A, 'E', 'x', 'i', 'f', 0, 0, 'G', 'P'}
+	withExif := append(append([]byte{0xFF, 0xD8}, exif...), encoded.Bytes()[2:]...)
+
+	store, err := storage.NewLocalStorage(t.TempDir(), "/media")
+	assert.NoError(t, err)
+	repo := newFakeUserRepo(existingUser(t))
+	svc := NewUserService(repo, WithStorage(store), WithMaxImageSize(1<<20))
+
+	first, err := svc.UploadProfilePicture("user-1", withExif)
+	assert.NoError(t, err)
+	firstKey := repo.users["user-1"].ImageKey
+	assert.Equal(t, "/media/"+firstKey, first)
+
+	stored, err := store.Get(context.Background(), firstKey)
+	assert.NoError(t, err)
+	data, _ := io.ReadAll(stored)
+	stored.Close()
+	assert.False(t, bytes.Contains(data, []byte("Exif")))
+
+	variant, err := store.Get(context.Background(), variantKey(firstKey, 128))
+	assert.NoError(t, err)
+	variant.Close()
+	assert.Equal(t, "/media/"+variantKey(firstKey, 512), svc.AvatarURLs(repo.users["user-1"])["512"])
+
+	_, err = svc.UploadProfilePicture("user-1", encoded.Bytes())
+	assert.NoError(t, err)
+	_, err = store.Get(context.Background(), firstKey)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = store.Get(context.Background(), variantKey(firstKey, 128))
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	// A portrait phone photo, stored sideways with orientation 6, is kept
+	// upright once its EXIF is gone.
+	sideways := append([]byte{0xFF, 0xD8, 0xFF, 0xE1, 0x00, 0x22, 'E', 'x', 'i', 'f', 0, 0,
+		'M', 'M', 0, 42, 0, 0, 0, 8, 0, 1, 0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, 6, 0, 0, 0, 0, 0, 0},
+		encodedJPEG(t, image.NewGray(image.Rect(0, 0, 40, 20)))[2:]...)
+	_, err = svc.UploadProfilePicture("user-1", sideways)
+	assert.NoError(t, err)
+	stored, err = store.Get(context.Background(), repo.users["user-1"].ImageKey)
+	assert.NoError(t, err)
+	upright, err := jpeg.Decode(stored)
+	stored.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 20, 40), upright.Bounds())
+
+	_, err = svc.UploadProfilePicture("user-1", []byte("GIF89a not allowed"))
+	assert.ErrorIs(t, err, ErrUnsupportedMediaType)
+
+	_, err = svc.UploadProfilePicture("user-1", make([]byte, 2<<20))
+	assert.ErrorIs(t, err, ErrFileTooLarge)
+}
+
+func TestAvatarURLsFallBackToInitials(t *testing.T) {
+	svc := NewUserService(newFakeUserRepo(), WithBaseURL("https://api.example.com"))
+
+	urls := svc.AvatarURLs(&models.User{Name: "John Doe"})
+	assert.Equal(t, map[string]string{
+		"64":  "https://api.example.com/api/avatars/64/JD",
+		"128": "https://api.example.com/api/avatars/128/JD",
+		"512": "https://api.example.com/api/avatars/512/JD",
+	}, urls)
+}
+
+func TestAccountDeletionGracePeriod(t *testing.T) {
+	repo := newFakeUserRepo(existingUser(t))
+	mailer := newRecordingMailer()
+	audit := &fakeAuditRepo{}
+	store, err := storage.NewLocalStorage(t.TempDir(), "/media")
+	assert.NoError(t, err)
+	exportRepo := &fakeExportRepo{exports: map[string]models.DataExport{}}
+	archive := &models.DataExport{UserID: "user-1", Status: models.ExportReady, StorageKey: "exports/user-1/export-1.zip"}
+	assert.NoError(t, exportRepo.CreateExport(archive))
+	assert.NoError(t, store.Put(context.Background(), archive.StorageKey, strings.NewReader("zip"), 3, "application/zip"))
+	svc := NewUserService(repo, WithMailer(mailer), WithDeletionGracePeriod(time.Hour), WithAuditLog(NewAuditService(audit)),
+		WithExports(NewExportService(exportRepo, repo, store)))
+
+	_, err = svc.RequestAccountDeletion("user-1", "WrongPass@123")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	scheduledAt, err := svc.RequestAccountDeletion("user-1", "SecurePass@123")
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), scheduledAt, time.Minute)
+	assert.Equal(t, "Account deletion scheduled", mailer.wait(t).subject)
+
+	// Signing in during the grace period cancels the deletion.
+	_, err = svc.Login("john@example.com", "SecurePass@123")
+	assert.NoError(t, err)
+	assert.Nil(t, repo.users["user-1"].DeletionScheduledAt)
+	assert.Equal(t, "Account deletion cancelled", mailer.wait(t).subject)
+
+	_, err = svc.RequestAccountDeletion("user-1", "SecurePass@123")
+	assert.NoError(t, err)
+	purged, err := svc.PurgeDueAccounts(context.Background())
+	assert.NoError(t, err)
+	assert.Zero(t, purged)
+
+	past := time.Now().Add(-time.Minute)
+	repo.users["user-1"].DeletionScheduledAt = &past
+	// Once the grace period is over signing in no longer brings it back.
+	_, err = svc.Login("john@example.com", "SecurePass@123")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+	assert.Equal(t, &past, repo.users["user-1"].DeletionScheduledAt)
+	repo.resets["reset-token"] = &models.PasswordReset{ID: "reset-1", UserID: "user-1", ResetToken: "reset-token"}
+	assert.NoError(t, repo.CreateSession(&models.Session{UserID: "user-1", IPAddress: "203.0.113.7"}))
+	purged, err = svc.PurgeDueAccounts(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	assert.Empty(t, repo.users)
+	purge := audit.events[len(audit.events)-1]
+	assert.Equal(t, models.AuditUserPurged, purge.Action)
+	assert.Equal(t, models.ActorSystem, purge.ActorRole)
+	assert.Empty(t, repo.resets)
+	assert.Empty(t, repo.sessions)
+	assert.Empty(t, exportRepo.exports)
+	_, err = store.Get(context.Background(), archive.StorageKey)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestSignupWithDeletedEmail(t *testing.T) {
+	deleted := existingUser(t)
+	req := &models.UserSignupRequest{Name: "John Doe", Email: "john@example.com", Password: "Another@Pass1"}
+
+	repo := newFakeUserRepo()
+	repo.deleted = []*models.User{deleted}
+	strict := NewUserService(repo, WithDeletedEmailReuse(false))
+	assert.ErrorIs(t, strict.Signup(req), ErrUserExists)
+	assert.Empty(t, repo.users)
+
+	lenient := NewUserService(repo)
+	assert.NoError(t, lenient.Signup(req))
+	assert.Len(t, repo.users, 1)
+}
+
+func TestLoginHonoursBlockExpiry(t *testing.T) {
+	user := existingUser(t)
+	until := time.Now().Add(time.Hour)
+	user.IsBlocked, user.BlockReason, user.BlockedUntil = true, models.BlockReasonSpam, &until
+	repo := newFakeUserRepo(user)
+	svc := NewUserService(repo)
+
+	_, err := svc.Login("john@example.com", "SecurePass@123")
+	var blocked *BlockedError
+	assert.ErrorAs(t, err, &blocked)
+	assert.ErrorIs(t, err, ErrUserBlocked)
+	assert.Equal(t, models.BlockReasonSpam, blocked.Reason)
+	assert.Equal(t, until, *blocked.Until)
+
+	past := time.Now().Add(-time.Minute)
+	user.BlockedUntil = &past
+	_, err = svc.Login("john@example.com", "SecurePass@123")
+	assert.NoError(t, err)
+	assert.False(t, repo.users["user-1"].IsBlocked)
+}
+
+func TestForcePasswordReset(t *testing.T) {
+	repo := newFakeUserRepo(existingUser(t))
+	mailer := newRecordingMailer()
+	auditRepo := &fakeAuditRepo{}
+	manager := passwords.NewManager(passwords.NewBcryptHasher(bcrypt.MinCost))
+	svc := NewUserService(repo, WithMailer(mailer), WithPasswordManager(manager), WithAuditLog(NewAuditService(auditRepo)))
+
+	assert.NoError(t, svc.ForcePasswordReset("user-1", AdminActor("admin-1")))
+	assert.Equal(t, "Password reset required", mailer.wait(t).subject)
+
+	_, err := svc.Login("john@example.com", "SecurePass@123")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	assert.Len(t, repo.resets, 1)
+	assert.Equal(t, models.AuditPasswordResetForced, auditRepo.events[0].Action)
+	assert.Equal(t, "admin-1", auditRepo.events[0].ActorID)
+
+	assert.ErrorIs(t, svc.ForcePasswordReset("missing", AdminActor("admin-1")), ErrUserNotFound)
+}
+
+func TestSecurityHistoryFlagsImpersonation(t *testing.T) {
+	repo := newFakeUserRepo(existingUser(t))
+	auditRepo := &fakeAuditRepo{}
+	audit := NewAuditService(auditRepo)
+	svc := NewUserService(repo, WithAuditLog(audit))
+
+	_, err := svc.StartSession("user-1", "Firefox", "203.0.113.7", time.Hour)
+	assert.NoError(t, err)
+	assert.NoError(t, repo.CreateSession(&models.Session{UserID: "user-1", ExpiresAt: time.Now().Add(time.Minute), ImpersonatorID: "admin-1"}))
+	audit.Record("user-1", AdminActor("admin-1"), models.AuditImpersonationStarted, nil)
+
+	history, err := svc.GetSecurityHistory("user-1")
+	assert.NoError(t, err)
+	assert.Len(t, history.Sessions, 2)
+	assert.True(t, history.Sessions[0].Impersonated)
+	assert.False(t, history.Sessions[1].Impersonated)
+	assert.Equal(t, "Firefox", history.Sessions[1].UserAgent)
+	assert.Equal(t, models.AuditImpersonationStarted, history.Events[0].Action)
+}
+
+func TestRequirePasswordChange(t *testing.T) {
+	repo := newFakeUserRepo(existingUser(t))
+	auditRepo := &fakeAuditRepo{}
+	manager := passwords.NewManager(passwords.NewBcryptHasher(bcrypt.MinCost))
+	svc := NewUserService(repo, WithPasswordManager(manager), WithAuditLog(NewAuditService(auditRepo)))
+
+	assert.NoError(t, svc.RequirePasswordChange("user-1", AdminActor("admin-1")))
+	assert.Equal(t, models.AuditPasswordChangeRequired, auditRepo.events[0].Action)
+
+	_, err := svc.Login("john@example.com", "SecurePass@123")
+	var required *PasswordChangeRequiredError
+	assert.ErrorAs(t, err, &required)
+	assert.ErrorIs(t, err, ErrPasswordChangeNeeded)
+	assert.NotEmpty(t, required.ResetToken)
+
+	assert.NoError(t, svc.ConfirmPasswordReset(required.ResetToken, "NewSecure@456"))
+	assert.False(t, repo.users["user-1"].MustChangePassword)
+	_, err = svc.Login("john@example.com", "NewSecure@456")
+	assert.NoError(t, err)
+}
+
+func TestSendPasswordResetLinkKeepsPassword(t *testing.T) {
+	repo := newFakeUserRepo(existingUser(t))
+	mailer := newRecordingMailer()
+	auditRepo := &fakeAuditRepo{}
+	svc := NewUserService(repo, WithMailer(mailer), WithAuditLog(NewAuditService(auditRepo)))
+
+	assert.NoError(t, svc.SendPasswordResetLink("user-1", AdminActor("admin-1")))
+	assert.Equal(t, "john@example.com", mailer.wait(t).to)
+	assert.Len(t, repo.resets, 1)
+	assert.Equal(t, models.AuditPasswordResetSent, auditRepo.events[0].Action)
+
+	_, err := svc.Login("john@example.com", "SecurePass@123")
+	assert.NoError(t, err)
+}
+
+func TestRevokeSessions(t *testing.T) {
+	repo := newFakeUserRepo(existingUser(t))
+	auditRepo := &fakeAuditRepo{}
+	svc := NewUserService(repo, WithAuditLog(NewAuditService(auditRepo)))
+
+	for i := 0; i < 2; i++ {
+		_, err := svc.StartSession("user-1", "Firefox", "203.0.113.7", time.Hour)
+		assert.NoError(t, err)
+	}
+
+	revoked, err := svc.RevokeSessions("user-1", AdminActor("admin-1"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, revoked)
+	for _, session := range repo.sessions {
+		assert.False(t, session.Active(time.Now()))
+	}
+	assert.NotNil(t, repo.users["user-1"].SessionsRevokedAt)
+	assert.Equal(t, models.AuditSessionsRevoked, auditRepo.events[0].Action)
+	assert.JSONEq(t, `{"count":"2"}`, auditRepo.events[0].Details)
+
+	_, err = svc.RevokeSessions("missing", AdminActor("admin-1"))
+	assert.ErrorIs(t, err, ErrUserNotFound)
+}
+
+func TestEventsGoThroughOutbox(t *testing.T) {
+	repo := newFakeUserRepo()
+	bus := events.NewBus()
+	var signedUp []events.UserSignedUp
+	events.Subscribe(bus, func(e events.UserSignedUp) error {
+		signedUp = append(signedUp, e)
+		return nil
+	})
+	svc := NewUserService(repo, WithEvents(bus))
+
+	// Dispatched straight away by default.
+	err := svc.Signup(&models.UserSignupRequest{Name: "Jane Roe", Email: "jane@example.com", Password: "SecurePass@123", Age: 30})
+	assert.NoError(t, err)
+	assert.Len(t, signedUp, 1)
+	assert.Equal(t, "jane@example.com", signedUp[0].User.Email)
+	assert.Contains(t, repo.users, signedUp[0].User.ID)
+
+	// Stored with the change for the relay instead.
+	bus.UseOutbox()
+	err = svc.Signup(&models.UserSignupRequest{Name: "Max Mustermann", Email: "max@example.com", Password: "SecurePass@123", Age: 30})
+	assert.NoError(t, err)
+	assert.Len(t, signedUp, 1)
+	assert.Len(t, repo.outbox, 1)
+
+	event, err := events.Decode(&repo.outbox[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "max@example.com", event.(events.UserSignedUp).User.Email)
+}
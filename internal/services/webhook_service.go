@@ -0,0 +1,515 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/repository"
+)
+
+// Headers sent with every webhook request. The signature is
+// "sha256=" followed by the hex HMAC-SHA256, keyed with the endpoint's
+// secret, of the timestamp, a dot and the raw body; see SignWebhook.
+const (
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+const (
+	webhookBatchSize = 50
+	// webhookClaimTTL is how long a delivery being sent is hidden from other
+	// workers; it must be longer than the HTTP timeout.
+	webhookClaimTTL      = 2 * time.Minute
+	webhookMaxBackoff    = 6 * time.Hour
+	webhookDeliveryLimit = 100
+	webhookErrorLength   = 1000
+)
+
+type IWebhookService interface {
+	CreateEndpoint(req *models.WebhookEndpointRequest, by Actor) (*models.WebhookEndpoint, string, error)
+	ListEndpoints() ([]models.WebhookEndpoint, error)
+	GetEndpoint(endpointID string) (*models.WebhookEndpoint, error)
+	UpdateEndpoint(endpointID string, req *models.WebhookEndpointUpdateRequest) (*models.WebhookEndpoint, error)
+	RotateSecret(endpointID string) (string, error)
+	DeleteEndpoint(endpointID string) error
+	ListDeliveries(endpointID, status string) ([]models.WebhookDelivery, error)
+	ReplayDelivery(deliveryID string) (*models.WebhookDelivery, error)
+}
+
+// WebhookService tells registered endpoints about user lifecycle events.
+// Publish queues a delivery per subscribed endpoint and Run sends them in
+// the background, retrying failures with exponential backoff.
+type WebhookService struct {
+	webhookRepo  repository.IWebhookRepository
+	client       *http.Client
+	maxAttempts  int
+	retryBackoff time.Duration
+	pollInterval time.Duration
+	now          func() time.Time
+	wake         chan struct{}
+}
+
+// WebhookServiceOption configures optional WebhookService behaviour.
+type WebhookServiceOption func(*WebhookService)
+
+// WithWebhookTimeout limits how long an endpoint has to respond.
+func WithWebhookTimeout(timeout time.Duration) WebhookServiceOption {
+	return func(w *WebhookService) { w.client.Timeout = timeout }
+}
+
+// WithWebhookRetries sets how many times a delivery is attempted and the
+// wait before the first retry, which doubles after every further failure.
+func WithWebhookRetries(maxAttempts int, backoff time.Duration) WebhookServiceOption {
+	return func(w *WebhookService) {
+		if maxAttempts > 0 {
+			w.maxAttempts = maxAttempts
+		}
+		if backoff > 0 {
+			w.retryBackoff = backoff
+		}
+	}
+}
+
+func NewWebhookService(webhookRepo repository.IWebhookRepository, opts ...WebhookServiceOption) *WebhookService {
+	w := &WebhookService{
+		webhookRepo: webhookRepo,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			// Endpoint URLs are chosen by admins, so requests only go out to
+			// public addresses, checked after DNS resolution, and never
+			// through a proxy that would dial on our behalf.
+			Transport: &http.Transport{
+				DialContext:         (&net.Dialer{Timeout: 10 * time.Second, Control: dialPublicOnly}).DialContext,
+				TLSHandshakeTimeout: 10 * time.Second,
+				MaxIdleConns:        100,
+				IdleConnTimeout:     90 * time.Second,
+			},
+			// A redirect is treated as a failed delivery rather than
+			// followed to a URL nobody registered.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		maxAttempts:  8,
+		retryBackoff: 30 * time.Second,
+		pollInterval: 5 * time.Second,
+		now:          time.Now,
+		wake:         make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// SignWebhook returns the signature header value for a webhook body sent at
+// timestamp. Receivers recompute it to check a request came from us, and
+// reject old timestamps to stop replays.
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Publish queues eventType about user for every endpoint subscribed to it.
+// Failures are logged rather than returned so they never undo the change
+// being announced. It is a no-op on a nil *WebhookService.
+func (w *WebhookService) Publish(eventType string, user models.UserSnapshot) {
+	if w == nil {
+		return
+	}
+	if err := w.publish(eventType, user); err != nil {
+		log.Printf("webhooks: failed to queue %s for user %s: %v", eventType, user.ID, err)
+	}
+}
+
+func (w *WebhookService) publish(eventType string, user models.UserSnapshot) error {
+	endpoints, err := w.webhookRepo.FindWebhookEndpoints()
+	if err != nil {
+		return err
+	}
+
+	now := w.now()
+	event := models.WebhookEvent{
+		ID:        uuid.New().String(),
+		Type:      eventType,
+		CreatedAt: now.UTC(),
+		Data:      models.WebhookEventData{User: user},
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	var deliveries []models.WebhookDelivery
+	for i := range endpoints {
+		if !endpoints[i].Subscribed(eventType) {
+			continue
+		}
+		deliveries = append(deliveries, models.WebhookDelivery{
+			EndpointID:    endpoints[i].ID,
+			EventID:       event.ID,
+			EventType:     eventType,
+			Payload:       string(payload),
+			Status:        models.WebhookDeliveryPending,
+			NextAttemptAt: &now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	if err := w.webhookRepo.CreateWebhookDeliveries(deliveries); err != nil {
+		return err
+	}
+	w.notify()
+	return nil
+}
+
+// notify wakes Run without waiting for its next poll.
+func (w *WebhookService) notify() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run sends due deliveries until ctx is cancelled, polling for retries and
+// waking early when new events are published.
+func (w *WebhookService) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := w.DeliverDue(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("webhooks: delivery run failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-w.wake:
+		}
+	}
+}
+
+// DeliverDue attempts every delivery that is due and returns how many it
+// attempted.
+func (w *WebhookService) DeliverDue(ctx context.Context) (int, error) {
+	attempted := 0
+	for {
+		due, err := w.webhookRepo.FindDueWebhookDeliveries(w.now(), webhookBatchSize)
+		if err != nil {
+			return attempted, err
+		}
+
+		endpoints := map[string]*models.WebhookEndpoint{}
+		for i := range due {
+			if err := ctx.Err(); err != nil {
+				return attempted, err
+			}
+
+			delivery := &due[i]
+			claimed, err := w.webhookRepo.ClaimWebhookDelivery(delivery, w.now().Add(webhookClaimTTL))
+			if err != nil {
+				return attempted, err
+			}
+			if !claimed {
+				continue
+			}
+
+			endpoint, ok := endpoints[delivery.EndpointID]
+			if !ok {
+				endpoint, err = w.webhookRepo.FindWebhookEndpointByID(delivery.EndpointID)
+				if err != nil && !errors.Is(err, repository.ErrNotFound) {
+					return attempted, err
+				}
+				endpoints[delivery.EndpointID] = endpoint
+			}
+
+			if err := w.attempt(ctx, endpoint, delivery); err != nil {
+				return attempted, err
+			}
+			attempted++
+		}
+
+		if len(due) < webhookBatchSize {
+			return attempted, nil
+		}
+	}
+}
+
+// attempt sends the delivery once and records the outcome, scheduling a
+// retry after a failure while attempts remain.
+func (w *WebhookService) attempt(ctx context.Context, endpoint *models.WebhookEndpoint, delivery *models.WebhookDelivery) error {
+	now := w.now()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	delivery.LastStatusCode = 0
+	delivery.LastError = ""
+
+	var sendErr error
+	if endpoint == nil || !endpoint.Active {
+		// Nobody is listening any more; give up without retrying.
+		sendErr = errors.New("endpoint is disabled")
+		delivery.Attempts = w.maxAttempts
+	} else {
+		delivery.LastStatusCode, sendErr = w.send(ctx, endpoint, delivery, now)
+	}
+
+	switch {
+	case sendErr == nil:
+		delivery.Status = models.WebhookDeliverySucceeded
+		delivery.NextAttemptAt = nil
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= w.maxAttempts:
+		delivery.Status = models.WebhookDeliveryFailed
+		delivery.NextAttemptAt = nil
+		delivery.LastError = truncate(sendErr.Error(), webhookErrorLength)
+	default:
+		next := now.Add(w.backoff(delivery.Attempts))
+		delivery.NextAttemptAt = &next
+		delivery.LastError = truncate(sendErr.Error(), webhookErrorLength)
+	}
+	return w.webhookRepo.UpdateWebhookDelivery(delivery)
+}
+
+func (w *WebhookService) send(ctx context.Context, endpoint *models.WebhookEndpoint, delivery *models.WebhookDelivery, now time.Time) (int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "user-management-webhooks/1.0")
+	req.Header.Set(WebhookEventHeader, delivery.EventType)
+	req.Header.Set(WebhookDeliveryHeader, delivery.ID)
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(endpoint.Secret, timestamp, body))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff is the wait after the given number of failed attempts.
+func (w *WebhookService) backoff(attempts int) time.Duration {
+	wait := w.retryBackoff
+	for i := 1; i < attempts && wait < webhookMaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > webhookMaxBackoff {
+		wait = webhookMaxBackoff
+	}
+	return wait
+}
+
+// CreateEndpoint registers an endpoint and returns it with its signing
+// secret, which is only ever shown here and by RotateSecret.
+func (w *WebhookService) CreateEndpoint(req *models.WebhookEndpointRequest, by Actor) (*models.WebhookEndpoint, string, error) {
+	endpoint := &models.WebhookEndpoint{
+		URL:         req.URL,
+		Description: req.Description,
+		EventTypes:  uniqueIDs(req.EventTypes),
+		Secret:      newWebhookSecret(),
+		Active:      true,
+		CreatedBy:   by.ID,
+	}
+	if err := w.webhookRepo.CreateWebhookEndpoint(endpoint); err != nil {
+		return nil, "", err
+	}
+	return endpoint, endpoint.Secret, nil
+}
+
+func (w *WebhookService) ListEndpoints() ([]models.WebhookEndpoint, error) {
+	return w.webhookRepo.FindWebhookEndpoints()
+}
+
+func (w *WebhookService) GetEndpoint(endpointID string) (*models.WebhookEndpoint, error) {
+	endpoint, err := w.webhookRepo.FindWebhookEndpointByID(endpointID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrWebhookNotFound
+	}
+	return endpoint, err
+}
+
+// UpdateEndpoint changes the fields present in req. Deactivating an
+// endpoint stops new deliveries and fails the pending ones.
+func (w *WebhookService) UpdateEndpoint(endpointID string, req *models.WebhookEndpointUpdateRequest) (*models.WebhookEndpoint, error) {
+	endpoint, err := w.GetEndpoint(endpointID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.URL != nil {
+		endpoint.URL = *req.URL
+	}
+	if req.Description != nil {
+		endpoint.Description = *req.Description
+	}
+	if req.EventTypes != nil {
+		endpoint.EventTypes = uniqueIDs(req.EventTypes)
+	}
+	if req.Active != nil {
+		endpoint.Active = *req.Active
+	}
+	if err := w.webhookRepo.UpdateWebhookEndpoint(endpoint); err != nil {
+		return nil, err
+	}
+	return endpoint, nil
+}
+
+// RotateSecret gives the endpoint a new signing secret and returns it.
+// Requests are signed with the new secret from then on.
+func (w *WebhookService) RotateSecret(endpointID string) (string, error) {
+	endpoint, err := w.GetEndpoint(endpointID)
+	if err != nil {
+		return "", err
+	}
+
+	endpoint.Secret = newWebhookSecret()
+	if err := w.webhookRepo.UpdateWebhookEndpoint(endpoint); err != nil {
+		return "", err
+	}
+	return endpoint.Secret, nil
+}
+
+// DeleteEndpoint removes the endpoint and its delivery log.
+func (w *WebhookService) DeleteEndpoint(endpointID string) error {
+	err := w.webhookRepo.DeleteWebhookEndpoint(endpointID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrWebhookNotFound
+	}
+	return err
+}
+
+// ListDeliveries returns the endpoint's latest deliveries, newest first,
+// optionally only those with the given status.
+func (w *WebhookService) ListDeliveries(endpointID, status string) ([]models.WebhookDelivery, error) {
+	if status != "" && status != models.WebhookDeliveryPending && status != models.WebhookDeliverySucceeded && status != models.WebhookDeliveryFailed {
+		return nil, models.ValidationErrors{{Field: "status", Rule: "oneof", Param: "pending succeeded failed"}}
+	}
+	if _, err := w.GetEndpoint(endpointID); err != nil {
+		return nil, err
+	}
+	return w.webhookRepo.FindWebhookDeliveries(endpointID, status, webhookDeliveryLimit)
+}
+
+// ReplayDelivery queues a failed delivery to be sent again as a new
+// delivery with the same event, leaving the failed one in the log.
+func (w *WebhookService) ReplayDelivery(deliveryID string) (*models.WebhookDelivery, error) {
+	original, err := w.webhookRepo.FindWebhookDeliveryByID(deliveryID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrWebhookDeliveryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if original.Status != models.WebhookDeliveryFailed {
+		return nil, ErrWebhookNotReplayable
+	}
+
+	now := w.now()
+	replay := []models.WebhookDelivery{{
+		EndpointID:    original.EndpointID,
+		EventID:       original.EventID,
+		EventType:     original.EventType,
+		Payload:       original.Payload,
+		Status:        models.WebhookDeliveryPending,
+		NextAttemptAt: &now,
+		ReplayOf:      original.ID,
+	}}
+	if err := w.webhookRepo.CreateWebhookDeliveries(replay); err != nil {
+		return nil, err
+	}
+	w.notify()
+	return &replay[0], nil
+}
+
+func newWebhookSecret() string {
+	return "whsec_" + generateToken()
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
+
+// nonPublicPrefixes are special-purpose ranges, on top of the private,
+// loopback, link-local and multicast ones netip classifies, that a webhook
+// must not reach.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("100::/64"),
+	netip.MustParsePrefix("2001::/23"),
+	netip.MustParsePrefix("2001:db8::/32"),
+	netip.MustParsePrefix("2002::/16"),
+}
+
+// dialPublicOnly refuses connections to addresses that are not publicly
+// routable, such as the metadata service or hosts on the internal network.
+// It runs after name resolution, so a hostname that resolves to one is
+// refused too.
+func dialPublicOnly(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("webhook address %q: %w", address, err)
+	}
+	if !isPublicAddr(addrPort.Addr()) {
+		return fmt.Errorf("webhook address %s is not public", addrPort.Addr())
+	}
+	return nil
+}
+
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,282 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeWebhookRepo struct {
+	endpoints  []models.WebhookEndpoint
+	deliveries []models.WebhookDelivery
+}
+
+func (r *fakeWebhookRepo) CreateWebhookEndpoint(e *models.WebhookEndpoint) error {
+	e.ID = generateToken()
+	r.endpoints = append(r.endpoints, *e)
+	return nil
+}
+
+func (r *fakeWebhookRepo) UpdateWebhookEndpoint(e *models.WebhookEndpoint) error {
+	for i := range r.endpoints {
+		if r.endpoints[i].ID == e.ID {
+			r.endpoints[i] = *e
+		}
+	}
+	return nil
+}
+
+func (r *fakeWebhookRepo) DeleteWebhookEndpoint(id string) error {
+	for i := range r.endpoints {
+		if r.endpoints[i].ID == id {
+			r.endpoints = append(r.endpoints[:i], r.endpoints[i+1:]...)
+			return nil
+		}
+	}
+	return repository.ErrNotFound
+}
+
+func (r *fakeWebhookRepo) FindWebhookEndpointByID(id string) (*models.WebhookEndpoint, error) {
+	for i := range r.endpoints {
+		if r.endpoints[i].ID == id {
+			e := r.endpoints[i]
+			return &e, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *fakeWebhookRepo) FindWebhookEndpoints() ([]models.WebhookEndpoint, error) {
+	return append([]models.WebhookEndpoint(nil), r.endpoints...), nil
+}
+
+func (r *fakeWebhookRepo) CreateWebhookDeliveries(deliveries []models.WebhookDelivery) error {
+	for i := range deliveries {
+		deliveries[i].ID = generateToken()
+		r.deliveries = append(r.deliveries, deliveries[i])
+	}
+	return nil
+}
+
+func (r *fakeWebhookRepo) UpdateWebhookDelivery(d *models.WebhookDelivery) error {
+	for i := range r.deliveries {
+		if r.deliveries[i].ID == d.ID {
+			r.deliveries[i] = *d
+		}
+	}
+	return nil
+}
+
+func (r *fakeWebhookRepo) FindWebhookDeliveryByID(id string) (*models.WebhookDelivery, error) {
+	for i := range r.deliveries {
+		if r.deliveries[i].ID == id {
+			d := r.deliveries[i]
+			return &d, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *fakeWebhookRepo) FindWebhookDeliveries(endpointID, status string, limit int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	for _, d := range r.deliveries {
+		if d.EndpointID == endpointID && (status == "" || d.Status == status) {
+			deliveries = append(deliveries, d)
+		}
+	}
+	return deliveries, nil
+}
+
+func (r *fakeWebhookRepo) FindDueWebhookDeliveries(now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	var due []models.WebhookDelivery
+	for _, d := range r.deliveries {
+		if d.Status == models.WebhookDeliveryPending && !d.NextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+	return due, nil
+}
+
+func (r *fakeWebhookRepo) ClaimWebhookDelivery(d *models.WebhookDelivery, until time.Time) (bool, error) {
+	d.NextAttemptAt = &until
+	return true, nil
+}
+
+// webhookReceiver records the requests sent to it and answers with the
+// queued status codes, then 200.
+type webhookReceiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rcv *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	rcv.requests = append(rcv.requests, r)
+	rcv.bodies = append(rcv.bodies, body)
+	status := http.StatusOK
+	if len(rcv.statuses) > 0 {
+		status, rcv.statuses = rcv.statuses[0], rcv.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func newWebhookTest(t *testing.T, statuses ...int) (*WebhookService, *fakeWebhookRepo, *webhookReceiver, *time.Time) {
+	t.Helper()
+	receiver := &webhookReceiver{statuses: statuses}
+	server := httptest.NewTLSServer(receiver)
+	t.Cleanup(server.Close)
+
+	repo := &fakeWebhookRepo{}
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	svc := NewWebhookService(repo, WithWebhookRetries(3, time.Minute))
+	svc.now = func() time.Time { return now }
+	// The receiver is on loopback, which the real transport refuses, and
+	// uses a certificate only its own client trusts.
+	svc.client.Transport = server.Client().Transport
+
+	_, _, err := svc.CreateEndpoint(&models.WebhookEndpointRequest{
+		URL:        server.URL,
+		EventTypes: []string{models.WebhookUserSignedUp, models.WebhookUserBlocked},
+	}, AdminActor("admin-1"))
+	assert.NoError(t, err)
+	return svc, repo, receiver, &now
+}
+
+func TestWebhookDeliveryIsSigned(t *testing.T) {
+	svc, repo, receiver, _ := newWebhookTest(t)
+	user := &models.User{ID: "user-1", Email: "john@example.com", Name: "John Doe"}
+
+	svc.Publish(models.WebhookUserSignedUp, models.NewUserSnapshot(user))
+	svc.Publish(models.WebhookUserVerified, models.NewUserSnapshot(user))
+	assert.Len(t, repo.deliveries, 1)
+
+	attempted, err := svc.DeliverDue(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, attempted)
+	assert.Equal(t, models.WebhookDeliverySucceeded, repo.deliveries[0].Status)
+
+	req, body := receiver.requests[0], receiver.bodies[0]
+	assert.Equal(t, models.WebhookUserSignedUp, req.Header.Get(WebhookEventHeader))
+	timestamp, err := strconv.ParseInt(req.Header.Get(WebhookTimestampHeader), 10, 64)
+	assert.NoError(t, err)
+	assert.Equal(t, SignWebhook(repo.endpoints[0].Secret, timestamp, body), req.Header.Get(WebhookSignatureHeader))
+
+	var event models.WebhookEvent
+	assert.NoError(t, json.Unmarshal(body, &event))
+	assert.Equal(t, "john@example.com", event.Data.User.Email)
+	assert.Equal(t, repo.deliveries[0].EventID, event.ID)
+}
+
+func TestWebhookRetriesWithBackoff(t *testing.T) {
+	svc, repo, receiver, now := newWebhookTest(t, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable)
+	svc.Publish(models.WebhookUserBlocked, models.UserSnapshot{ID: "user-1"})
+
+	_, err := svc.DeliverDue(context.Background())
+	assert.NoError(t, err)
+	delivery := repo.deliveries[0]
+	assert.Equal(t, models.WebhookDeliveryPending, delivery.Status)
+	assert.Equal(t, http.StatusInternalServerError, delivery.LastStatusCode)
+	assert.Equal(t, now.Add(time.Minute), *delivery.NextAttemptAt)
+
+	// Not due yet.
+	attempted, _ := svc.DeliverDue(context.Background())
+	assert.Equal(t, 0, attempted)
+
+	*now = now.Add(time.Minute)
+	svc.DeliverDue(context.Background())
+	assert.Equal(t, now.Add(2*time.Minute), *repo.deliveries[0].NextAttemptAt)
+
+	*now = now.Add(2 * time.Minute)
+	svc.DeliverDue(context.Background())
+	delivery = repo.deliveries[0]
+	assert.Equal(t, models.WebhookDeliveryFailed, delivery.Status)
+	assert.Equal(t, 3, delivery.Attempts)
+	assert.Nil(t, delivery.NextAttemptAt)
+	assert.Len(t, receiver.requests, 3)
+
+	replay, err := svc.ReplayDelivery(delivery.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, delivery.ID, replay.ReplayOf)
+	svc.DeliverDue(context.Background())
+	replayed, _ := repo.FindWebhookDeliveryByID(replay.ID)
+	assert.Equal(t, models.WebhookDeliverySucceeded, replayed.Status)
+	assert.Equal(t, receiver.bodies[0], receiver.bodies[3])
+
+	_, err = svc.ReplayDelivery(replay.ID)
+	assert.ErrorIs(t, err, ErrWebhookNotReplayable)
+}
+
+func TestWebhookDisabledEndpointFailsPending(t *testing.T) {
+	svc, repo, receiver, _ := newWebhookTest(t)
+	svc.Publish(models.WebhookUserSignedUp, models.UserSnapshot{ID: "user-1"})
+
+	inactive := false
+	_, err := svc.UpdateEndpoint(repo.endpoints[0].ID, &models.WebhookEndpointUpdateRequest{Active: &inactive})
+	assert.NoError(t, err)
+
+	svc.DeliverDue(context.Background())
+	assert.Equal(t, models.WebhookDeliveryFailed, repo.deliveries[0].Status)
+	assert.Empty(t, receiver.requests)
+
+	svc.Publish(models.WebhookUserSignedUp, models.UserSnapshot{ID: "user-2"})
+	assert.Len(t, repo.deliveries, 1)
+}
+
+func TestWebhookOnlyReachesPublicHTTPS(t *testing.T) {
+	repo := &fakeWebhookRepo{}
+	svc := NewWebhookService(repo, WithWebhookRetries(1, time.Minute))
+	events := []string{models.WebhookUserSignedUp}
+
+	err := models.ValidateStruct(&models.WebhookEndpointRequest{URL: "http://hooks.example.com/users", EventTypes: events})
+	assert.Equal(t, models.ValidationErrors{{Field: "url", Rule: "https_url"}}, err)
+
+	server := httptest.NewTLSServer(&webhookReceiver{})
+	defer server.Close()
+	_, _, err = svc.CreateEndpoint(&models.WebhookEndpointRequest{URL: server.URL, EventTypes: events}, AdminActor("admin-1"))
+	assert.NoError(t, err)
+
+	svc.Publish(models.WebhookUserSignedUp, models.UserSnapshot{ID: "user-1"})
+	svc.DeliverDue(context.Background())
+	assert.Equal(t, models.WebhookDeliveryFailed, repo.deliveries[0].Status)
+	assert.Contains(t, repo.deliveries[0].LastError, "is not public")
+
+	for addr, public := range map[string]bool{
+		"93.184.216.34":   true,
+		"2606:4700::1111": true,
+		"127.0.0.1":       false,
+		"10.1.2.3":        false,
+		"169.254.169.254": false,
+		"100.64.0.1":      false,
+		"0.0.0.0":         false,
+		"::1":             false,
+		"fd00::1":         false,
+		"::ffff:10.0.0.1": false,
+	} {
+		assert.Equal(t, public, isPublicAddr(netip.MustParseAddr(addr)), addr)
+	}
+}
+
+func TestSignupPublishesWebhook(t *testing.T) {
+	webhookRepo := &fakeWebhookRepo{endpoints: []models.WebhookEndpoint{{ID: "hook-1", Active: true, EventTypes: []string{models.WebhookUserSignedUp}}}}
+	svc := NewUserService(newFakeUserRepo(), WithWebhooks(NewWebhookService(webhookRepo)))
+
+	err := svc.Signup(&models.UserSignupRequest{Name: "Jane Roe", Email: "jane@example.com", Password: "Sup3r$ecretPass", Age: 30, Gender: "Female", PhoneNumber: 9876543210, Address: "1 Main Street"})
+	assert.NoError(t, err)
+	assert.Len(t, webhookRepo.deliveries, 1)
+	assert.Equal(t, models.WebhookUserSignedUp, webhookRepo.deliveries[0].EventType)
+}
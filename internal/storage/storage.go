@@ -0,0 +1,64 @@
+// Package storage stores uploaded files such as profile pictures.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+)
+
+var (
+	// ErrNotFound is returned when an object does not exist.
+	ErrNotFound = errors.New("object not found")
+	// ErrInvalidKey is returned for keys that would escape the storage root.
+	ErrInvalidKey = errors.New("invalid object key")
+)
+
+// Storage is a flat object store addressed by slash-separated keys.
+type Storage interface {
+	// Put stores body under key, replacing any existing object.
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	// Get opens the object stored under key.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object stored under key. Deleting a missing object
+	// is not an error.
+	Delete(ctx context.Context, key string) error
+	// URL returns the public URL of the object stored under key.
+	URL(key string) string
+}
+
+// cleanKey rejects keys that are empty, absolute or contain "..".
+func cleanKey(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return "", ErrInvalidKey
+	}
+	cleaned := path.Clean(key)
+	if cleaned != key || cleaned == "." || strings.HasPrefix(cleaned, "../") || cleaned == ".." {
+		return "", ErrInvalidKey
+	}
+	return cleaned, nil
+}
+
+// Open returns the storage selected by driver: "s3" uses s3, anything else
+// keeps files under localDir and serves them from mediaURL.
+func Open(driver, localDir, mediaURL string, s3 S3Config) (Storage, error) {
+	if driver == "s3" {
+		return NewS3Storage(s3)
+	}
+	return NewLocalStorage(localDir, mediaURL)
+}
+
+// OpenPrivate returns the store selected by driver for files only the
+// application hands out, such as personal data exports. Nothing serves
+// localDir, and s3.Bucket must not allow public reads.
+func OpenPrivate(driver, localDir string, s3 S3Config) (Storage, error) {
+	if driver == "s3" {
+		if s3.Bucket == "" {
+			return nil, errors.New("a private S3 bucket is required")
+		}
+		return NewS3Storage(s3)
+	}
+	return NewLocalStorage(localDir, "")
+}
@@ -0,0 +1,120 @@
+// Package tenancy scopes database access to one organization. A *gorm.DB
+// returned by Scoped only sees and writes rows of that organization in
+// every table with an organization_id column, so repositories built on it
+// need no tenant conditions of their own.
+package tenancy
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrCrossOrganization is returned when a scoped connection is asked to
+// create a row belonging to another organization.
+var ErrCrossOrganization = errors.New("row belongs to another organization")
+
+type contextKey struct{}
+
+// WithOrganization returns a context scoped to organizationID.
+func WithOrganization(ctx context.Context, organizationID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, organizationID)
+}
+
+// OrganizationFrom returns the organization ctx is scoped to, if any.
+func OrganizationFrom(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	organizationID, ok := ctx.Value(contextKey{}).(string)
+	return organizationID, ok && organizationID != ""
+}
+
+// Scoped returns db limited to organizationID. An empty organizationID
+// returns db unchanged, with access to every organization.
+func Scoped(db *gorm.DB, organizationID string) *gorm.DB {
+	if organizationID == "" {
+		return db
+	}
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return db.WithContext(WithOrganization(ctx, organizationID))
+}
+
+// field is the model field that holds the owning organization.
+const field = "OrganizationID"
+
+// Register installs the callbacks that apply Scoped to every statement. It
+// must be called once on the root connection.
+func Register(db *gorm.DB) error {
+	callbacks := db.Callback()
+	if err := callbacks.Create().Before("gorm:create").Register("tenancy:create", assign); err != nil {
+		return err
+	}
+	if err := callbacks.Query().Before("gorm:query").Register("tenancy:query", restrict); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:update").Register("tenancy:update", restrict); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().Before("gorm:delete").Register("tenancy:delete", restrict); err != nil {
+		return err
+	}
+	return callbacks.Row().Before("gorm:row").Register("tenancy:row", restrict)
+}
+
+// restrict adds an organization condition to statements on tenant tables.
+func restrict(db *gorm.DB) {
+	organizationID, ok := OrganizationFrom(db.Statement.Context)
+	if !ok || db.Statement.Schema == nil {
+		return
+	}
+	f := db.Statement.Schema.LookUpField(field)
+	if f == nil {
+		return
+	}
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: db.Statement.Table, Name: f.DBName}, Value: organizationID},
+	}})
+}
+
+// assign sets the organization on new rows of tenant tables, refusing rows
+// that name a different one.
+func assign(db *gorm.DB) {
+	organizationID, ok := OrganizationFrom(db.Statement.Context)
+	if !ok || db.Statement.Schema == nil {
+		return
+	}
+	f := db.Statement.Schema.LookUpField(field)
+	if f == nil {
+		return
+	}
+
+	set := func(rv reflect.Value) {
+		value, zero := f.ValueOf(db.Statement.Context, rv)
+		if zero {
+			if err := f.Set(db.Statement.Context, rv, organizationID); err != nil {
+				db.AddError(err)
+			}
+			return
+		}
+		if value != organizationID {
+			db.AddError(ErrCrossOrganization)
+		}
+	}
+
+	rv := db.Statement.ReflectValue
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			set(reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		set(rv)
+	}
+}
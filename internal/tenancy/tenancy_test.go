@@ -0,0 +1,66 @@
+package tenancy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+type tenantRow struct {
+	ID             string
+	OrganizationID string
+	Name           string
+}
+
+type sharedRow struct {
+	ID   string
+	Name string
+}
+
+func dryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "user:pass@tcp(localhost:3306)/db", SkipInitializeWithVersion: true}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	assert.NoError(t, err)
+	assert.NoError(t, Register(db))
+	return db
+}
+
+func TestScopedRestrictsTenantTables(t *testing.T) {
+	db := dryRunDB(t)
+	scoped := Scoped(db, "org-1")
+
+	stmt := scoped.Where("name = ?", "a").Find(&[]tenantRow{}).Statement
+	assert.Contains(t, stmt.SQL.String(), "`tenant_rows`.`organization_id` = ?")
+	assert.Contains(t, stmt.Vars, "org-1")
+
+	stmt = scoped.Model(&tenantRow{}).Where("id = ?", "row-1").Update("name", "b").Statement
+	assert.Contains(t, stmt.SQL.String(), "`tenant_rows`.`organization_id` = ?")
+
+	stmt = scoped.Where("id = ?", "row-1").Delete(&tenantRow{}).Statement
+	assert.Contains(t, stmt.SQL.String(), "`tenant_rows`.`organization_id` = ?")
+
+	// Tables without the column are left alone.
+	stmt = scoped.Find(&[]sharedRow{}).Statement
+	assert.NotContains(t, stmt.SQL.String(), "organization_id")
+
+	// The scope doesn't leak into the connection it was made from.
+	stmt = db.Find(&[]tenantRow{}).Statement
+	assert.NotContains(t, stmt.SQL.String(), "organization_id")
+}
+
+func TestScopedAssignsOrganizationOnCreate(t *testing.T) {
+	scoped := Scoped(dryRunDB(t), "org-1")
+
+	row := tenantRow{ID: "row-1"}
+	assert.NoError(t, scoped.Create(&row).Error)
+	assert.Equal(t, "org-1", row.OrganizationID)
+
+	rows := []tenantRow{{ID: "row-2"}, {ID: "row-3", OrganizationID: "org-1"}}
+	assert.NoError(t, scoped.Create(&rows).Error)
+	assert.Equal(t, "org-1", rows[0].OrganizationID)
+
+	other := tenantRow{ID: "row-4", OrganizationID: "org-2"}
+	assert.ErrorIs(t, scoped.Create(&other).Error, ErrCrossOrganization)
+}
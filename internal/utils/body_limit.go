@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// BodyLimit rejects request bodies larger than limit bytes, or larger than
+// the entry in routes keyed by "METHOD /path" for the few routes that take
+// big uploads. It expects the app to stream request bodies, so a rejected
+// body is never read; bodies of unknown length are refused for the same
+// reason.
+func BodyLimit(limit int64, routes map[string]int64) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		allowed := limit
+		if routeLimit, ok := routes[ctx.Method()+" "+ctx.Path()]; ok {
+			allowed = routeLimit
+		}
+
+		// fasthttp reports a chunked body's length as -1.
+		size := ctx.Request().Header.ContentLength()
+		var err error
+		switch {
+		case size == -1:
+			err = fiber.ErrLengthRequired
+		case int64(size) > allowed:
+			err = fiber.ErrRequestEntityTooLarge
+		default:
+			return ctx.Next()
+		}
+		// The unread body is still on the wire, so the connection can't be
+		// reused for another request.
+		ctx.Context().SetConnectionClose()
+		return err
+	}
+}
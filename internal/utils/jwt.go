@@ -1,21 +1,57 @@
 package utils
 
 import (
+	"errors"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/liju-github/user-management/internal/models"
 	"github.com/liju-github/user-management/internal/repository"
+	"github.com/liju-github/user-management/internal/services"
 )
 
-func GenerateJWT(email string, ID string, role string, expiry uint) (string, error) {
+// TokenOption adds optional claims to a token issued by GenerateJWT.
+type TokenOption func(jwt.MapClaims)
+
+// WithSessionID ties the token to a session, so it stops working once the
+// session is revoked.
+func WithSessionID(sessionID string) TokenOption {
+	return func(claims jwt.MapClaims) { claims["sid"] = sessionID }
+}
+
+// WithExpiry makes the token expire at a precise time instead of after
+// whole hours.
+func WithExpiry(expiresAt time.Time) TokenOption {
+	return func(claims jwt.MapClaims) { claims["exp"] = expiresAt.Unix() }
+}
+
+// WithActor marks the token as issued to an admin acting as the user. The
+// "act" claim follows RFC 8693 and names the admin in "sub".
+func WithActor(adminID string) TokenOption {
+	return func(claims jwt.MapClaims) {
+		claims["act"] = map[string]interface{}{"sub": adminID, "role": "admin"}
+	}
+}
+
+// WithGroups lists the groups the user belongs to, with their role in
+// each, in the "groups" claim.
+func WithGroups(groups []models.UserGroup) TokenOption {
+	return func(claims jwt.MapClaims) { claims["groups"] = groups }
+}
+
+func GenerateJWT(email string, ID string, role string, expiry uint, opts ...TokenOption) (string, error) {
 	claims := jwt.MapClaims{
 		"email": email,
 		"ID":    ID,
 		"exp":   time.Now().Add(time.Hour * time.Duration(expiry)).Unix(),
 		"role":  role,
 	}
+	for _, opt := range opts {
+		opt(claims)
+	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte("secret"))
 }
@@ -23,8 +59,8 @@ func GenerateJWT(email string, ID string, role string, expiry uint) (string, err
 func JWTMiddleware(requiredRole string, userDB *repository.UserRepository) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
 		authHeader := ctx.Get("Authorization")
-		if authHeader == "" {
-			return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Missing or invalid token"})
+		if !strings.HasPrefix(authHeader, "Bearer ") {
+			return services.ErrMissingAuthToken
 		}
 
 		tokenStr := authHeader[len("Bearer "):]
@@ -33,30 +69,44 @@ func JWTMiddleware(requiredRole string, userDB *repository.UserRepository) fiber
 		})
 
 		// Check if the token is valid and not expired
+		var validationErr *jwt.ValidationError
+		if errors.As(err, &validationErr) && validationErr.Errors&jwt.ValidationErrorExpired != 0 {
+			return services.ErrAuthTokenExpired
+		}
 		if err != nil || !token.Valid {
-			return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+			return services.ErrInvalidAuthToken
 		}
 
 		// Extract claims
 		claims, ok := token.Claims.(jwt.MapClaims)
 		if !ok || claims["exp"] == nil {
-			return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token claims"})
+			return services.ErrInvalidAuthToken
 		}
 
 		// Compare the expiration time
-		exp := claims["exp"].(float64) // JWT expiration is a float64
+		exp, ok := claims["exp"].(float64) // JWT expiration is a float64
+		if !ok {
+			return services.ErrInvalidAuthToken
+		}
 		if time.Now().Unix() > int64(exp) {
-			return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Token has expired"})
+			return services.ErrAuthTokenExpired
 		}
 
 		// Extract role from JWT claims
 		clientRole, ok := claims["role"].(string)
 		if !ok {
-			return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid role in token"})
+			return services.ErrInvalidAuthToken
+		}
+
+		// Tokens from before organizations existed belong to the default one
+		organizationID, _ := claims["org"].(string)
+		if organizationID == "" {
+			organizationID = models.DefaultOrganizationID
 		}
 
 		// Allow admin to access all routes except GET
 		if clientRole == "admin" {
+			ctx.Locals("org", organizationID)
 			ctx.Locals("ID", claims["ID"])
 			ctx.Locals("email", claims["email"])
 			ctx.Locals("expiry", claims["exp"])
@@ -67,19 +117,61 @@ func JWTMiddleware(requiredRole string, userDB *repository.UserRepository) fiber
 
 		// If a requiredRole is provided, ensure the user has that role
 		if requiredRole != "" && requiredRole != clientRole {
-			return ctx.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Insufficient privileges"})
+			return services.ErrInsufficientAccess
 		}
 
 
-		userInfo,err := userDB.FindUserByID(claims["ID"].(string))
+		userID, _ := claims["ID"].(string)
+		userInfo,err := userDB.FindUserByID(userID)
 		if err!=nil {
-			return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Please try again"})
+			if errors.Is(err, repository.ErrNotFound) {
+				return services.ErrInvalidAuthToken
+			}
+			return err
 		}
-		if userInfo.IsBlocked{
-			return ctx.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "user is blocked"})
+		// A user's token only works in their own organization
+		if userInfo.OrganizationID != organizationID {
+			return services.ErrInvalidAuthToken
+		}
+		if tenant, explicit := explicitTenant(ctx); explicit && tenant != organizationID {
+			return services.ErrInvalidAuthToken
+		}
+
+		// An expired block is ignored here even if nothing has cleared it yet
+		if userInfo.BlockActive(time.Now()) {
+			return services.NewBlockedError(userInfo)
+		}
+
+		// Tokens issued for a session stop working once it is revoked.
+		// Tokens from before sessions existed carry no sid and simply run
+		// out; impersonation tokens always have one.
+		sessionID, hasSession := claims["sid"].(string)
+		if !hasSession && (claims["act"] != nil || userInfo.SessionsRevokedAt != nil) {
+			return services.ErrInvalidAuthToken
+		}
+		if hasSession {
+			session, err := userDB.FindSessionByID(sessionID)
+			if err != nil {
+				if errors.Is(err, repository.ErrNotFound) {
+					return services.ErrInvalidAuthToken
+				}
+				return err
+			}
+			if session.UserID != userID || !session.Active(time.Now()) {
+				return services.ErrInvalidAuthToken
+			}
+			ctx.Locals("sid", sessionID)
+
+			// The session, not the token, says who is really acting, so
+			// the admin can't be dropped from a refreshed token.
+			if session.ImpersonatorID != "" {
+				ctx.Locals("actor", session.ImpersonatorID)
+				log.Printf("Impersonated request by admin %s as user %s: %s %s", session.ImpersonatorID, userID, ctx.Method(), ctx.Path())
+			}
 		}
 
 		// Set user details in context locals
+		ctx.Locals("org", organizationID)
 		ctx.Locals("ID", claims["ID"])
 		ctx.Locals("email", claims["email"])
 		ctx.Locals("expiry", claims["exp"])
@@ -92,3 +184,47 @@ func JWTMiddleware(requiredRole string, userDB *repository.UserRepository) fiber
 		return ctx.Next()
 	}
 }
+
+// DenyImpersonation rejects requests made by an admin impersonating the
+// user. It guards actions only the user themselves may take, such as
+// changing their password or deleting their account.
+func DenyImpersonation() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		if actor, _ := ctx.Locals("actor").(string); actor != "" {
+			return services.ErrImpersonationDenied
+		}
+		return ctx.Next()
+	}
+}
+
+// RecordImpersonation adds an audit event for every request an admin makes
+// while impersonating a user, naming both of them.
+func RecordImpersonation(audit *services.AuditService) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		if actor, _ := ctx.Locals("actor").(string); actor != "" {
+			userID, _ := ctx.Locals("ID").(string)
+			sessionID, _ := ctx.Locals("sid").(string)
+			audit.Record(userID, services.AdminActor(actor), models.AuditImpersonatedRequest, map[string]string{
+				"method":     ctx.Method(),
+				"path":       ctx.Path(),
+				"session_id": sessionID,
+			})
+		}
+		return ctx.Next()
+	}
+}
+
+// RequirePermission lets through only admins who have been granted
+// permission. It must run after JWTMiddleware.
+func RequirePermission(permission string, adminDB *repository.AdminRepository) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		admin, err := currentAdmin(ctx, adminDB)
+		if err != nil {
+			return err
+		}
+		if !admin.HasPermission(permission) {
+			return services.ErrInsufficientAccess
+		}
+		return ctx.Next()
+	}
+}
@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/liju-github/user-management/internal/models"
+	"github.com/liju-github/user-management/internal/repository"
+	"github.com/liju-github/user-management/internal/services"
+)
+
+// OrganizationHeader names the organization a request is for, by slug or ID.
+const OrganizationHeader = "X-Organization"
+
+// WithOrganization ties the token to the organization its holder belongs
+// to. Tokens without the claim belong to the default organization.
+func WithOrganization(organizationID string) TokenOption {
+	return func(claims jwt.MapClaims) { claims["org"] = organizationID }
+}
+
+// TenantMiddleware works out which organization a request is for, from the
+// X-Organization header or else the subdomain of baseDomain, and stores its
+// ID in the "tenant" local. Requests that name no organization are for the
+// default one; naming an unknown one is an error. "tenant_explicit" is set
+// when the request named it, so signed-in callers can be held to it.
+func TenantMiddleware(organizations services.IOrganizationService, baseDomain string) fiber.Handler {
+	baseDomain = strings.ToLower(strings.TrimPrefix(baseDomain, "."))
+	return func(ctx *fiber.Ctx) error {
+		name := strings.TrimSpace(ctx.Get(OrganizationHeader))
+		if name == "" && baseDomain != "" {
+			name = subdomain(ctx.Hostname(), baseDomain)
+		}
+		if name == "" {
+			ctx.Locals("tenant", models.DefaultOrganizationID)
+			return ctx.Next()
+		}
+
+		organization, err := organizations.Resolve(name)
+		if err != nil {
+			return err
+		}
+		ctx.Locals("tenant", organization.ID)
+		ctx.Locals("tenant_explicit", true)
+		return ctx.Next()
+	}
+}
+
+// subdomain returns the first label of host below baseDomain, or "" when
+// host is not under it.
+func subdomain(host, baseDomain string) string {
+	host = strings.ToLower(host)
+	if i := strings.LastIndexByte(host, ':'); i >= 0 && !strings.Contains(host[i:], "]") {
+		host = host[:i]
+	}
+	prefix, ok := strings.CutSuffix(host, "."+baseDomain)
+	if !ok || prefix == "" {
+		return ""
+	}
+	if i := strings.LastIndexByte(prefix, '.'); i >= 0 {
+		prefix = prefix[i+1:]
+	}
+	if prefix == "www" {
+		return ""
+	}
+	return prefix
+}
+
+// explicitTenant returns the organization the request named, if it named one.
+func explicitTenant(ctx *fiber.Ctx) (string, bool) {
+	if explicit, _ := ctx.Locals("tenant_explicit").(bool); !explicit {
+		return "", false
+	}
+	tenant, _ := ctx.Locals("tenant").(string)
+	return tenant, tenant != ""
+}
+
+// ScopeAdmin limits an admin to their own organization by setting the "org"
+// local the admin endpoints act in. Super admins act in the organization
+// the request names, or in every organization when it names none. It must
+// run after JWTMiddleware.
+func ScopeAdmin(adminDB *repository.AdminRepository) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		admin, err := currentAdmin(ctx, adminDB)
+		if err != nil {
+			return err
+		}
+
+		tenant, explicit := explicitTenant(ctx)
+		switch {
+		case admin.SuperAdmin:
+			ctx.Locals("super_admin", true)
+			ctx.Locals("org", tenant)
+		case explicit && tenant != admin.OrganizationID:
+			return services.ErrInsufficientAccess
+		default:
+			ctx.Locals("org", admin.OrganizationID)
+		}
+		return ctx.Next()
+	}
+}
+
+// RequireSuperAdmin lets through only admins who manage every organization.
+// It must run after JWTMiddleware.
+func RequireSuperAdmin(adminDB *repository.AdminRepository) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		admin, err := currentAdmin(ctx, adminDB)
+		if err != nil {
+			return err
+		}
+		if !admin.SuperAdmin {
+			return services.ErrInsufficientAccess
+		}
+		return ctx.Next()
+	}
+}
+
+// currentAdmin loads the admin the request's token was issued to.
+func currentAdmin(ctx *fiber.Ctx, adminDB *repository.AdminRepository) (*models.Admin, error) {
+	if role, _ := ctx.Locals("role").(string); role != "admin" {
+		return nil, services.ErrInsufficientAccess
+	}
+
+	adminID, _ := ctx.Locals("ID").(string)
+	admin, err := adminDB.FindAdminByID(adminID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, services.ErrInsufficientAccess
+		}
+		return nil, err
+	}
+	return admin, nil
+}